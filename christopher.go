@@ -19,6 +19,8 @@ func christopherApp() *cli.App {
 	app.Commands = []cli.Command{
 		FeedWatcherCli,
 		DownloaderCli,
+		DownloadsCli,
+		WatchlistCli,
 		DebriderCli,
 		DownloadAndDebridCli,
 		WebServerCli,
@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"time"
 
 	"github.com/davidderus/christopher/config"
 	. "github.com/onsi/ginkgo"
@@ -41,6 +42,34 @@ var _ = Describe("Christopher", func() {
 			Expect(fwErr).To(BeNil())
 			Expect(fwOutput).To(ContainSubstring("Starts the feed watcher"))
 		})
+
+		It("should show the backfill flags", func() {
+			cliBuffer := new(bytes.Buffer)
+			cliApp.Writer = cliBuffer
+
+			fwErr := cliApp.Run([]string{"christopher", "feed-watcher", "--help"})
+			fwOutput := cliBuffer.String()
+
+			Expect(fwErr).To(BeNil())
+			Expect(fwOutput).To(ContainSubstring("--since DATE"))
+			Expect(fwOutput).To(ContainSubstring("--once"))
+		})
+	})
+
+	Context("feed-watcher --since", func() {
+		It("should accept dates and times", func() {
+			sinceDate, sinceError := parseSinceDate("2017-02-25")
+			Expect(sinceError).NotTo(HaveOccurred())
+			Expect(sinceDate).To(Equal(time.Date(2017, time.February, 25, 0, 0, 0, 0, time.Local)))
+
+			sinceDate, _ = parseSinceDate("2017-02-25T10:30:00Z")
+			Expect(sinceDate.Equal(time.Date(2017, time.February, 25, 10, 30, 0, 0, time.UTC))).To(BeTrue())
+		})
+
+		It("should refuse invalid dates", func() {
+			_, sinceError := parseSinceDate("yesterday")
+			Expect(sinceError.Error()).To(Equal("Invalid since date yesterday"))
+		})
 	})
 
 	Context("download --help", func() {
@@ -56,6 +85,34 @@ var _ = Describe("Christopher", func() {
 		})
 	})
 
+	Context("downloads --help", func() {
+		It("should show the downloads management help", func() {
+			cliBuffer := new(bytes.Buffer)
+			cliApp.Writer = cliBuffer
+
+			fwErr := cliApp.Run([]string{"downloads", "--help"})
+			fwOutput := cliBuffer.String()
+
+			Expect(fwErr).To(BeNil())
+			Expect(fwOutput).To(ContainSubstring("Manages the downloads"))
+		})
+	})
+
+	Context("watchlist --help", func() {
+		It("should show the watchlist management help", func() {
+			cliBuffer := new(bytes.Buffer)
+			cliApp.Writer = cliBuffer
+
+			fwErr := cliApp.Run([]string{"christopher", "watchlist", "--help"})
+			fwOutput := cliBuffer.String()
+
+			Expect(fwErr).To(BeNil())
+			Expect(fwOutput).To(ContainSubstring("Lists the watched shows and their missing episodes"))
+			Expect(fwOutput).To(ContainSubstring("list"))
+			Expect(fwOutput).To(ContainSubstring("Adds a show to the watchlist"))
+		})
+	})
+
 	Context("debrid --help", func() {
 		It("should show the debrider help", func() {
 			cliBuffer := new(bytes.Buffer)
@@ -2,12 +2,18 @@ package main
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/davidderus/christopher/config"
+	"github.com/davidderus/christopher/database"
+	"github.com/davidderus/christopher/debrider"
 	"github.com/davidderus/christopher/dispatcher"
+	"github.com/davidderus/christopher/downloader"
 	"github.com/davidderus/christopher/feedwatcher"
+	"github.com/davidderus/christopher/postprocess"
 	"github.com/davidderus/christopher/teller"
+	"github.com/davidderus/christopher/watchlist"
 	"github.com/davidderus/christopher/webserver"
 	"github.com/urfave/cli"
 )
@@ -43,6 +49,100 @@ func loadTeller() {
 	appTeller = teller.NewTeller(appConfig.Teller.LogLevel, appConfig.Teller.LogFormatter)
 }
 
+// startDownloadEvents listens to the events of each downloader instance in
+// background if the downloader supports it, logging each of them and
+// post-processing the completed downloads
+//
+// The story is given the post-processors, corrupted downloads being played
+// again through it. Instances sharing a downloader and its auth infos share
+// their events and post-processor, so downloads are processed once.
+func startDownloadEvents(story *dispatcher.ChristopherStory) {
+	postProcessing := appConfig.Verification.Enabled || appConfig.Extraction.Enabled || appConfig.Library.Enabled
+
+	processors := make(map[string]*postprocess.Processor)
+
+	// Post-processors by downloader and auth infos, nil if disabled
+	followedDownloaders := make(map[string]*postprocess.Processor)
+
+	for _, downloaderID := range append([]string{config.DefaultDownloader}, appConfig.DownloaderIDs()...) {
+		downloaderConfig, _ := appConfig.DownloaderInstance(downloaderID)
+		downloaderKey := fmt.Sprintf("%s#%v", downloaderConfig.Name, downloaderConfig.AuthInfos)
+
+		if processor, isFollowed := followedDownloaders[downloaderKey]; isFollowed {
+			if processor != nil {
+				processors[downloaderID] = processor
+			}
+			continue
+		}
+		followedDownloaders[downloaderKey] = nil
+
+		dlInstance, dlError := downloader.NewDownloader(downloaderConfig.Name, downloaderConfig.AuthInfos)
+		if dlError != nil {
+			appTeller.Log().WithField("downloaderID", downloaderID).Warnln("Download events disabled:", dlError)
+			continue
+		}
+
+		eventStream := downloader.NewEventStream()
+		downloaderName := downloaderConfig.Name
+
+		eventStream.OnError = func(err error) {
+			appTeller.LogWithFields(map[string]interface{}{
+				"downloaderID":    downloaderID,
+				"downloadHandler": downloaderName,
+			}).Warnln("Download events lost:", err)
+		}
+
+		eventStream.Subscribe(func(event *downloader.DownloadEvent) {
+			appTeller.LogWithFields(map[string]interface{}{
+				"downloaderID":    downloaderID,
+				"downloadHandler": downloaderName,
+				"downloadID":      event.DownloadID,
+				"downloadEvent":   event.Type,
+			}).Infoln("Download event received")
+		})
+
+		if postProcessing {
+			processor := postprocess.NewProcessor(dlInstance, appConfig)
+			processor.Notify = logPostProcessResult
+			processor.Redownload = story.Redownload
+
+			processors[downloaderID] = processor
+			followedDownloaders[downloaderKey] = processor
+
+			eventStream.Subscribe(processor.HandleEvent)
+		}
+
+		listener, isListener := dlInstance.(downloader.Listener)
+		if isListener {
+			go eventStream.Listen(listener, make(chan struct{}))
+		}
+	}
+
+	story.SetProcessors(processors)
+}
+
+// logNativeSaveError reports a native downloads state lost by a transfer
+func logNativeSaveError(err error) {
+	appTeller.Log().Errorln(err)
+}
+
+// logPostProcessResult notifies the outcome of a post-processing task
+func logPostProcessResult(result *postprocess.Result) {
+	entry := appTeller.LogWithFields(map[string]interface{}{
+		"downloadID":  result.DownloadID,
+		"task":        result.Task,
+		"source":      result.Source,
+		"destination": result.Destination,
+	})
+
+	if result.Error != nil {
+		entry.Errorln("Post-processing failed:", result.Error)
+		return
+	}
+
+	entry.Infoln("Post-processing done")
+}
+
 //////////////
 // Debrider //
 //////////////
@@ -148,6 +248,253 @@ func runDownloader(ctx *cli.Context) error {
 	return nil
 }
 
+///////////////
+// Downloads //
+///////////////
+
+// DownloadsCli defines the cli args to manage the downloader queue
+var DownloadsCli = cli.Command{
+	Name:        "downloads",
+	Aliases:     []string{"dl"},
+	Usage:       "Manages the downloads",
+	Description: "Lists, pauses, resumes and removes the downloads of the downloader set in the config file.",
+	Subcommands: []cli.Command{
+		{
+			Name:   "list",
+			Usage:  "Lists the downloads in a given state",
+			Action: listDownloads,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "state, s",
+					Value: string(downloader.StateActive),
+					Usage: "List downloads in `STATE` (active, waiting or stopped)",
+				},
+			},
+		},
+		{
+			Name:      "pause",
+			Usage:     "Pauses a download",
+			Action:    manageDownload("pause"),
+			ArgsUsage: "<ID>",
+		},
+		{
+			Name:      "resume",
+			Usage:     "Resumes a paused download",
+			Action:    manageDownload("resume"),
+			ArgsUsage: "<ID>",
+		},
+		{
+			Name:      "remove",
+			Usage:     "Removes a download",
+			Action:    manageDownload("remove"),
+			ArgsUsage: "<ID>",
+		},
+		{
+			Name:   "purge",
+			Usage:  "Purges completed, failed and removed downloads",
+			Action: purgeDownloads,
+		},
+	},
+}
+
+// loadDownloader returns the downloader set in the config file
+func loadDownloader() (downloader.Downloader, error) {
+	loadError := loadRequirements()
+	if loadError != nil {
+		return nil, loadError
+	}
+
+	return downloader.NewDownloader(appConfig.Downloader.Name, appConfig.Downloader.AuthInfos)
+}
+
+func listDownloads(ctx *cli.Context) error {
+	dlInstance, dlError := loadDownloader()
+	if dlError != nil {
+		return cli.NewExitError(dlError.Error(), 1)
+	}
+
+	state, stateError := downloader.ParseDownloadState(ctx.String("state"))
+	if stateError != nil {
+		return cli.NewExitError(stateError.Error(), 1)
+	}
+
+	downloads, listError := dlInstance.List(state)
+	if listError != nil {
+		return cli.NewExitError(listError.Error(), 1)
+	}
+
+	for _, download := range downloads {
+		fmt.Fprintf(ctx.App.Writer, "%s\t%s\t%.1f%%\t%s\n", download.ID, download.State, download.Progress()*100, download.Name)
+	}
+
+	return nil
+}
+
+// manageDownload returns a cli action applying a given action to a download
+func manageDownload(action string) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		dlInstance, dlError := loadDownloader()
+		if dlError != nil {
+			return cli.NewExitError(dlError.Error(), 1)
+		}
+
+		downloadID := ctx.Args().First()
+		if downloadID == "" {
+			return cli.NewExitError("No download ID given", 1)
+		}
+
+		var actionError error
+
+		switch action {
+		case "pause":
+			actionError = dlInstance.Pause(downloadID)
+		case "resume":
+			actionError = dlInstance.Resume(downloadID)
+		case "remove":
+			actionError = dlInstance.Remove(downloadID)
+		}
+
+		if actionError != nil {
+			return cli.NewExitError(actionError.Error(), 1)
+		}
+
+		appTeller.LogWithFields(map[string]interface{}{
+			"downloadHandler": appConfig.Downloader.Name,
+			"downloadID":      downloadID,
+		}).Infof("Download %s done", action)
+
+		return nil
+	}
+}
+
+func purgeDownloads(ctx *cli.Context) error {
+	dlInstance, dlError := loadDownloader()
+	if dlError != nil {
+		return cli.NewExitError(dlError.Error(), 1)
+	}
+
+	purgeError := dlInstance.Purge()
+	if purgeError != nil {
+		return cli.NewExitError(purgeError.Error(), 1)
+	}
+
+	appTeller.Log().Infoln("Downloads purged")
+
+	return nil
+}
+
+///////////////
+// Watchlist //
+///////////////
+
+// WatchlistCli defines the cli args to manage the TV shows watchlist
+var WatchlistCli = cli.Command{
+	Name:        "watchlist",
+	Aliases:     []string{"wl"},
+	Usage:       "Manages the TV shows watchlist",
+	Description: "Lists the watched shows and their missing episodes, adds and removes shows. Shows are added to the database, a running feed watcher seeing them at its next poll.",
+	Subcommands: []cli.Command{
+		{
+			Name:   "list",
+			Usage:  "Lists the watched shows with their last and missing episodes",
+			Action: listWatchlist,
+		},
+		{
+			Name:      "add",
+			Usage:     "Adds a show to the watchlist",
+			Action:    addToWatchlist,
+			ArgsUsage: "<SHOW>",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "from, f",
+					Usage: "Only download the episodes from `EPISODE` (such as S03E01 or 2017-02-10)",
+				},
+			},
+		},
+		{
+			Name:      "remove",
+			Usage:     "Removes a show from the watchlist",
+			Action:    removeFromWatchlist,
+			ArgsUsage: "<SHOW>",
+		},
+	},
+}
+
+// loadWatchlist returns the watchlist of the config file and the database
+func loadWatchlist() (*watchlist.Watchlist, error) {
+	loadError := loadRequirements()
+	if loadError != nil {
+		return nil, loadError
+	}
+
+	appDatabase, databaseError := database.Open(appConfig.DBPath)
+	if databaseError != nil {
+		return nil, databaseError
+	}
+
+	return watchlist.New(appConfig.Watchlist, appDatabase), nil
+}
+
+func listWatchlist(ctx *cli.Context) error {
+	showsWatchlist, watchlistError := loadWatchlist()
+	if watchlistError != nil {
+		return cli.NewExitError(watchlistError.Error(), 1)
+	}
+
+	for _, status := range showsWatchlist.Status() {
+		lastEpisode := status.LastEpisode
+		if lastEpisode == "" {
+			lastEpisode = "-"
+		}
+
+		fmt.Fprintf(ctx.App.Writer, "%s\t%s\t%d grabbed\tmissing: %s\n", status.Name, lastEpisode, status.Grabbed, strings.Join(status.Missing, ", "))
+	}
+
+	return nil
+}
+
+func addToWatchlist(ctx *cli.Context) error {
+	showsWatchlist, watchlistError := loadWatchlist()
+	if watchlistError != nil {
+		return cli.NewExitError(watchlistError.Error(), 1)
+	}
+
+	show := strings.Join(ctx.Args(), " ")
+	if show == "" {
+		return cli.NewExitError("No show given", 1)
+	}
+
+	addError := showsWatchlist.Add(show, ctx.String("from"))
+	if addError != nil {
+		return cli.NewExitError(addError.Error(), 1)
+	}
+
+	appTeller.Log().WithField("show", show).Infoln("Show added to the watchlist")
+
+	return nil
+}
+
+func removeFromWatchlist(ctx *cli.Context) error {
+	showsWatchlist, watchlistError := loadWatchlist()
+	if watchlistError != nil {
+		return cli.NewExitError(watchlistError.Error(), 1)
+	}
+
+	show := strings.Join(ctx.Args(), " ")
+	if show == "" {
+		return cli.NewExitError("No show given", 1)
+	}
+
+	removeError := showsWatchlist.Remove(show)
+	if removeError != nil {
+		return cli.NewExitError(removeError.Error(), 1)
+	}
+
+	appTeller.Log().WithField("show", show).Infoln("Show removed from the watchlist")
+
+	return nil
+}
+
 /////////////////////////
 // Download and Debrid //
 /////////////////////////
@@ -205,6 +552,33 @@ var FeedWatcherCli = cli.Command{
 	Usage:       "Starts the feed watcher",
 	Description: "Watch the feeds defined in configuration and send all links to the right service.",
 	Action:      runFeedWatcher,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "since",
+			Usage: "Send the items published since `DATE` (2006-01-02 or RFC 3339) for the feeds without history",
+		},
+		cli.BoolFlag{
+			Name:  "once",
+			Usage: "Watch the feeds a single time then exit",
+		},
+	},
+}
+
+// parseSinceDate returns the date given to --since, the current time if
+// blank
+func parseSinceDate(since string) (time.Time, error) {
+	if since == "" {
+		return time.Now(), nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		sinceDate, parseError := time.ParseInLocation(layout, since, time.Local)
+		if parseError == nil {
+			return sinceDate, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("Invalid since date %s", since)
 }
 
 func runFeedWatcher(ctx *cli.Context) error {
@@ -214,6 +588,11 @@ func runFeedWatcher(ctx *cli.Context) error {
 		return cli.NewExitError(loadError.Error(), 1)
 	}
 
+	sinceDate, sinceError := parseSinceDate(ctx.String("since"))
+	if sinceError != nil {
+		return cli.NewExitError(sinceError.Error(), 1)
+	}
+
 	// Building FeedWatcher from config
 	feedWatcherConfig := appConfig.FeedWatcher
 	watchInterval := time.Duration(feedWatcherConfig.WatchInterval) * time.Minute
@@ -225,12 +604,27 @@ func runFeedWatcher(ctx *cli.Context) error {
 	// Adding Teller
 	feedWatcher.SetTeller(appTeller)
 
+	// Remembering the processed items across runs
+	appDatabase, databaseError := database.Open(appConfig.DBPath)
+	if databaseError != nil {
+		appTeller.Log().Fatalln(databaseError)
+	}
+
+	// Sharing the watchlist so feeds never grab the same episode twice
+	showsWatchlist := watchlist.New(appConfig.Watchlist, appDatabase)
+
 	// Getting feeds
 	configFeeds := feedWatcherConfig.Feeds
 	feedWatcherFeeds := make([]feedwatcher.RemoteFeed, len(configFeeds))
 	for feedIndex, feed := range configFeeds {
 		feedProvider := feed.Provider
 
+		// Scraped pages and JSON feeds links are found by the generic extractor
+		// by default
+		if (feed.Type == config.FeedTypeScrape || feed.Type == config.FeedTypeJSON) && feedProvider == "" {
+			feedProvider = "generic"
+		}
+
 		providerOptions := appConfig.Providers[feedProvider]
 
 		feedWatcherFeeds[feedIndex] = feedwatcher.RemoteFeed{
@@ -238,33 +632,70 @@ func runFeedWatcher(ctx *cli.Context) error {
 			URL:             feed.URL,
 			Provider:        feedProvider,
 			ProviderOptions: providerOptions,
+			Database:        appDatabase,
+			Filters:         feed.Filters,
+			Teller:          appTeller,
+		}
+
+		if feed.Watchlist {
+			feedWatcherFeeds[feedIndex].Watchlist = showsWatchlist
+		}
+
+		switch feed.Type {
+		case config.FeedTypeScrape:
+			scraper, scraperError := feedwatcher.NewScraper(feed.Scrape)
+			if scraperError != nil {
+				appTeller.Log().Fatalf("Feed %s: %s", feed.Title, scraperError)
+			}
+
+			feedWatcherFeeds[feedIndex].Parser = scraper.Parse
+		case config.FeedTypeJSON:
+			feedWatcherFeeds[feedIndex].Parser = feedwatcher.NewJSONParser(feed.JSON).Parse
 		}
 	}
 
 	feedWatcher.Feeds = feedWatcherFeeds
 
-	// Artificial SinceDate for now
-	feedWatcher.SinceDate = time.Now()
+	// Native transfers would stop with a single run process
+	downloader.SetNativeTransfers(!ctx.Bool("once"))
+	downloader.OnNativeSaveError(logNativeSaveError)
+
+	// Feeds with a database history resume from their last successful poll
+	feedWatcher.SinceDate = sinceDate
 
 	// Using default story to process new links
 	story := &dispatcher.ChristopherStory{}
-	story.SetConfig(appConfig).EnableDebrider().EnableDownloader()
+	story.SetConfig(appConfig).EnableDebrider().EnableDownloader().EnableDeferral()
 	story.SetTeller(appTeller)
 
-	scenario := story.Scenario()
-	scenario.SetInitialStep("config")
+	// Loading persisted debrider sessions once for all the feeds events
+	debriderSessions, sessionsError := debrider.NewSessionPool(appConfig.Debrider.SessionsPath)
+	if sessionsError != nil {
+		appTeller.Log().Fatalln(sessionsError)
+	}
+	story.SetDebriderSessions(debriderSessions)
+
+	// Following downloads once sent to the downloaders
+	startDownloadEvents(story)
 
-	feedWatcher.Scenario = scenario
+	feedWatcher.Story = story
 
-	// Running FeedWatcher for eternity
-	runSummary, runError := feedWatcher.Run(0)
+	var runSummary string
+	var runError error
+
+	// Running FeedWatcher once or for eternity
+	if ctx.Bool("once") {
+		runSummary, runError = feedWatcher.RunOnce()
+	} else {
+		runSummary, runError = feedWatcher.Run(0)
+	}
 
 	// Handling run errors
 	if runError != nil {
 		appTeller.Log().Fatalln(runError)
 	}
 
-	// Logging output if any (will never be reached on Run(0))
+	// Logging output if any (only reached when running once)
 	appTeller.Log().Infoln(runSummary)
 
 	return nil
@@ -291,6 +722,14 @@ func runWebServer(ctx *cli.Context) error {
 
 	webServer := webserver.NewWebServer(appConfig, appTeller)
 
+	// Running the native transfers for the whole server life
+	downloader.SetNativeTransfers(true)
+	downloader.OnNativeSaveError(logNativeSaveError)
+
+	// Following downloads once sent to the downloaders, with the story of the
+	// submitted URIs
+	startDownloadEvents(webServer.Story())
+
 	appTeller.Log().Fatalln(webServer.Start())
 
 	return nil
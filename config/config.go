@@ -1,13 +1,20 @@
 package config
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"os"
 	"os/user"
 	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/davidderus/christopher/release"
 )
 
 const (
@@ -17,6 +24,9 @@ const (
 	// defaultDBName is the default filename for the database
 	defaultDBName = "database.db"
 
+	// defaultDebriderSessionsName is the default filename for the debrider sessions
+	defaultDebriderSessionsName = "debrider_sessions.json"
+
 	// defaultHost sets up the webserver host default as a local host
 	defaultHost = "127.0.0.1"
 
@@ -31,6 +41,84 @@ const (
 
 	// defaultLogFormatter sets the log items formatter
 	defaultLogFormatter = "text"
+
+	// defaultInvalidCharacters are the characters removed from file names
+	defaultInvalidCharacters = `<>:"/\|?*`
+
+	// defaultNamingReplacement replaces the invalid characters of file names
+	defaultNamingReplacement = "_"
+
+	// defaultMaxNameLength is the maximum length in bytes of a file name
+	defaultMaxNameLength = 255
+
+	// defaultNamingTimeout is the timeout in seconds of file name requests
+	defaultNamingTimeout = 10
+
+	// defaultDiskSpaceReserve is the free space in MB kept after a download
+	defaultDiskSpaceReserve = 1024
+)
+
+// defaultExtractionCommand extracts RAR, ZIP and 7z archives with 7-Zip
+var defaultExtractionCommand = []string{"7z", "x", "-y", "-p{password}", "-o{dir}", "{archive}"}
+
+// defaultLibraryLayout is the default path of an episode in the library
+const defaultLibraryLayout = "{Show}/Season {Season}/{Show} - S{SS}E{EE}.{ext}"
+
+// defaultLibraryExtensions are the video files extensions
+var defaultLibraryExtensions = []string{".mkv", ".mp4", ".avi", ".m4v", ".ts", ".wmv"}
+
+// Library organization modes
+const (
+	// LibraryMove moves the episodes to the library
+	LibraryMove = "move"
+
+	// LibraryHardlink links the episodes to the library
+	LibraryHardlink = "hardlink"
+)
+
+// Disk space shortage handling modes
+const (
+	// ShortageDefer plays the event again at the next feed watcher scan
+	ShortageDefer = "defer"
+
+	// ShortageReroute sends the event to a fallback downloader instance
+	ShortageReroute = "reroute"
+
+	// ShortageReject refuses the event
+	ShortageReject = "reject"
+)
+
+// Verification mismatch handling modes
+const (
+	// MismatchFail reports corrupted downloads
+	MismatchFail = "fail"
+
+	// MismatchRedownload downloads corrupted files again
+	MismatchRedownload = "redownload"
+)
+
+// Naming collision handling modes
+const (
+	// CollisionRename adds a number to the name of an already existing file
+	CollisionRename = "rename"
+
+	// CollisionOverwrite keeps the name of an already existing file
+	CollisionOverwrite = "overwrite"
+
+	// CollisionSkip refuses to download an already existing file
+	CollisionSkip = "skip"
+)
+
+// Feed types
+const (
+	// FeedTypeFeed is an RSS or Atom feed
+	FeedTypeFeed = "feed"
+
+	// FeedTypeScrape is an HTML page scraped with CSS selectors
+	FeedTypeScrape = "scrape"
+
+	// FeedTypeJSON is a JSON document mapped with some paths
+	FeedTypeJSON = "json"
 )
 
 // Feed is a Feed Representation
@@ -38,6 +126,72 @@ type feed struct {
 	Title    string // Remote feed title
 	URL      string // URL to the feed
 	Provider string // The feed provider
+
+	// Type is the kind of feed: "feed" (default), "scrape" or "json"
+	Type string
+
+	// Scrape defines how the page of a scraped feed is read
+	Scrape ScrapeOptions
+
+	// JSON defines how the items of a JSON feed are mapped
+	JSON JSONOptions `toml:"json"`
+
+	// Filters defines which items of the feed are downloaded
+	Filters FilterOptions
+
+	// Watchlist only lets the episodes of the watched shows through, each
+	// episode being downloaded once
+	Watchlist bool
+}
+
+// FilterOptions defines the rules feed items must pass to be downloaded, on
+// their title and description
+type FilterOptions struct {
+	// Include regexes must be matched by one at least, Exclude regexes by none
+	Include []string
+	Exclude []string
+
+	// Keywords must be found one at least, ExcludedKeywords none. Keywords are
+	// matched as whole words, whatever the case and separators.
+	Keywords         []string
+	ExcludedKeywords []string `toml:"excluded_keywords"`
+
+	// MinSize and MaxSize bound the item size in MB, items of unknown size
+	// passing
+	MinSize int64 `toml:"min_size"`
+	MaxSize int64 `toml:"max_size"`
+
+	// Qualities are the accepted qualities, by preference, such as
+	// ["1080p", "720p"], "unknown" accepting the items without quality. All
+	// qualities are accepted if empty.
+	Qualities []string
+
+	// QualityWait is the time in hours a lesser quality waits for the
+	// preferred one after its publication. It needs a database.
+	QualityWait int `toml:"quality_wait"`
+
+	// RejectedQualities are release tags never downloaded, such as "CAM"
+	RejectedQualities []string `toml:"rejected_qualities"`
+}
+
+// ScrapeOptions defines the CSS selectors turning an HTML page into feed items
+type ScrapeOptions struct {
+	Item  string // Selector of the items in the page
+	Title string // Selector of the item title, the link text being used if blank
+	Link  string // Selector of the item links (default to "a[href]")
+
+	// Date is the selector of the item publication date, its "datetime"
+	// attribute or text being parsed with DateFormat (default to RFC 3339)
+	Date       string
+	DateFormat string `toml:"date_format"`
+
+	// NextPage is the selector of the link to the next page, followed up to
+	// MaxPages pages (default to 1)
+	NextPage string `toml:"next_page"`
+	MaxPages int    `toml:"max_pages"`
+
+	// UserAgent is sent along the page requests
+	UserAgent string `toml:"user_agent"`
 }
 
 // FeedWatcherOptions defines some options for the FeedWatcher
@@ -46,6 +200,34 @@ type feedWatcherOptions struct {
 	Feeds         []*feed
 }
 
+// JSONOptions defines the paths mapping a JSON document to feed items
+//
+// Paths are keys separated by dots, such as "data.children", where numbers
+// index arrays and "*" stands for all the elements of an array.
+type JSONOptions struct {
+	Items       string // Path of the items array, the document itself if blank
+	GUID        string // Path of the item id within each item
+	Title       string
+	Link        string
+	Description string
+
+	// Enclosures is the path of the item additional links, such as
+	// "attachments.*.url"
+	Enclosures string
+
+	// Date is the path of the item publication date, parsed with DateFormat:
+	// a Go layout or "unix" for seconds since epoch (default to RFC 3339)
+	Date       string
+	DateFormat string `toml:"date_format"`
+
+	// UserAgent is sent along the requests
+	UserAgent string `toml:"user_agent"`
+}
+
+// DefaultDownloader is the id of the downloader defined in the [downloader]
+// section
+const DefaultDownloader = "default"
+
 // DownloaderOptions defines options for the downloader
 type DownloaderOptions struct {
 	Name            string
@@ -53,15 +235,251 @@ type DownloaderOptions struct {
 	DownloadOptions map[string]interface{} `toml:"download_options"`
 }
 
+// OptionFields are the event infos available in download options templates,
+// such as dir = "/media/{{.Feed}}/{{.Show}}/Season {{.Season}}"
+type OptionFields struct {
+	URI    string // URI being downloaded
+	Origin string // Submitter of the URI (cli, feed-watcher or webserver)
+	User   string // Webserver user having submitted the URI
+	Feed   string // Title of the feed the URI comes from
+	Title  string // Title of the feed item the URI comes from
+
+	// Show, Season and Episode are parsed from the title or the URI
+	Show    string
+	Season  int
+	Episode int
+
+	// Date is the time the download is sent to the downloader
+	Date time.Time
+}
+
+// RenderOptions evaluates the templates in the string values of some
+// download options
+func RenderOptions(options map[string]interface{}, fields *OptionFields) (map[string]interface{}, error) {
+	renderedOptions := make(map[string]interface{}, len(options))
+
+	for optionName, optionValue := range options {
+		templateValue, isString := optionValue.(string)
+		if !isString || !strings.Contains(templateValue, "{{") {
+			renderedOptions[optionName] = optionValue
+			continue
+		}
+
+		optionTemplate, parseError := template.New(optionName).Parse(templateValue)
+		if parseError != nil {
+			return nil, fmt.Errorf("Invalid download option %s: %s", optionName, parseError)
+		}
+
+		var renderedValue bytes.Buffer
+
+		executeError := optionTemplate.Execute(&renderedValue, fields)
+		if executeError != nil {
+			return nil, fmt.Errorf("Invalid download option %s: %s", optionName, executeError)
+		}
+
+		renderedOptions[optionName] = renderedValue.String()
+	}
+
+	return renderedOptions, nil
+}
+
+// PoolOptions defines a pool balancing downloads between downloader instances
+type PoolOptions struct {
+	// Downloaders are the downloader instance ids of the pool
+	Downloaders []string
+
+	// Strategy is round-robin (default), fewest-active or most-free-space
+	Strategy string
+
+	// HealthCheckInterval is the time in seconds between two checks of a
+	// downloader (default to 30)
+	HealthCheckInterval int `toml:"health_check_interval"`
+}
+
+// RoutingOptions defines how URIs are dispatched between downloaders
+type RoutingOptions struct {
+	// Rules are evaluated in order, the first matching one is used
+	Rules []*RoutingRule
+
+	// Downloader is the downloader instance or pool id used for the URIs
+	// without matching rule nor dedicated downloader, the default one if blank
+	Downloader string
+}
+
+// RoutingRule sends the matching URIs to a downloader with some options
+//
+// All the criteria set must match, a rule without criteria matches any URI.
+type RoutingRule struct {
+	Host      string // URI host, subdomains included
+	Regex     string // Regular expression the URI must match
+	Extension string // File extension of the URI path, such as ".mkv"
+	Origin    string // Submitter of the URI (cli, feed-watcher or webserver)
+	User      string // Webserver user having submitted the URI
+	Feed      string // Title of the feed the URI comes from
+
+	// Downloader is the downloader instance or pool id, the default one if
+	// blank
+	Downloader string
+
+	// DownloadOptions override the downloader download options
+	DownloadOptions map[string]interface{} `toml:"download_options"`
+}
+
+// NamingOptions defines how the downloaded files are named
+type NamingOptions struct {
+	// Enabled looks for the real name of the HTTP downloads and sends it to
+	// the downloader as the "out" download option
+	Enabled bool
+
+	// InvalidCharacters are replaced by Replacement in file names
+	InvalidCharacters string `toml:"invalid_characters"`
+	Replacement       string
+
+	// MaxLength is the maximum length in bytes of a file name
+	MaxLength int `toml:"max_length"`
+
+	// Collision is what to do when a file already exists in the download dir:
+	// rename (default), overwrite or skip
+	Collision string
+
+	// Timeout is the timeout in seconds of the requests to the file server
+	Timeout int
+}
+
+// DiskSpaceOptions defines the free space checked before each download
+type DiskSpaceOptions struct {
+	// Enabled checks the free space of the downloader before each download
+	Enabled bool
+
+	// Reserve is the free space in MB to keep once the file is downloaded
+	Reserve int64
+
+	// OnShortage is "defer" (default) to try again at the next feed watcher
+	// scan, "reroute" to use the Fallback downloader or "reject"
+	OnShortage string `toml:"on_shortage"`
+
+	// Fallback is the downloader instance or pool id used on reroute
+	Fallback string
+}
+
+// ExtractionOptions defines how the downloaded archives are extracted
+type ExtractionOptions struct {
+	// Enabled extracts the archives of completed downloads
+	Enabled bool
+
+	// Command extracts an archive, "{archive}", "{dir}" and "{password}" being
+	// replaced in its arguments. It must fail on a wrong password.
+	Command []string
+
+	// NativeZip extracts unencrypted single ZIP archives without Command
+	NativeZip bool `toml:"native_zip"`
+
+	// Passwords are tried in order, an archive without password is tried
+	// with a blank one
+	Passwords []string
+
+	// DeleteArchives removes all the parts of an archive once extracted
+	DeleteArchives bool `toml:"delete_archives"`
+
+	// Dir is the extraction dir, default to the archive dir
+	Dir string
+}
+
+// VerificationOptions defines how the completed downloads are verified
+type VerificationOptions struct {
+	// Enabled checks the size and checksums of the completed downloads
+	Enabled bool
+
+	// Sidecars checks the files against the SFV, MD5, SHA1 and SHA256 files
+	// found next to them
+	Sidecars bool
+
+	// OnMismatch is "fail" (default) to only report corrupted downloads or
+	// "redownload" to download them again
+	OnMismatch string `toml:"on_mismatch"`
+
+	// MaxRedownloads is the number of times a file is downloaded again
+	MaxRedownloads int `toml:"max_redownloads"`
+}
+
+// LibraryOptions defines how the downloaded episodes are organized
+type LibraryOptions struct {
+	// Enabled moves the completed episodes to the library
+	Enabled bool
+
+	// Dir is the library root dir
+	Dir string
+
+	// Layout is the path of an episode in the library. "{Show}", "{Season}",
+	// "{SS}" (2 digits season), "{Episode}", "{EE}", "{Quality}" and "{ext}"
+	// are replaced.
+	Layout string
+
+	// Mode is "move" (default) or "hardlink" to keep the downloaded files in
+	// place, such as seeding torrents
+	Mode string
+
+	// Collision is what to do when an episode is already in the library:
+	// skip (default), overwrite or rename
+	Collision string
+
+	// Extensions are the extensions of the files to organize
+	Extensions []string
+}
+
+// WatchlistOptions defines the TV shows to download, more shows being added
+// to the database from the command line
+type WatchlistOptions struct {
+	Shows []*WatchlistShow
+
+	// Qualities are the qualities by preference, such as ["1080p", "720p"].
+	// With Upgrade, a grabbed episode is downloaded again in a better one.
+	Qualities []string
+	Upgrade   bool
+}
+
+// WatchlistShow is a TV show of the watchlist
+type WatchlistShow struct {
+	Name string
+
+	// From is the first episode wanted, such as "S03E01", "3x01" or
+	// "2017-02-10" for daily shows, every episode being wanted if blank
+	From string
+}
+
 // DebriderOptions defines name and auth info for the debrider
 type DebriderOptions struct {
 	Name      string
 	AuthInfos map[string]string `toml:"auth_infos"`
+
+	// SessionsPath is the file where debrider sessions are persisted.
+	// Sessions are only kept in memory if blank.
+	SessionsPath string `toml:"sessions_path"`
 }
 
 // ProviderOptions specify options for a given provider
 type ProviderOptions struct {
 	FavoriteHosts []string `toml:"favorite_hosts"`
+
+	// Extractor is the feed extractor of the provider, such as "generic",
+	// the provider name being used if blank
+	Extractor string
+
+	// Sources are the parts of the items the generic extractor looks for links
+	// in, in order: "enclosure", "link", "description", "content" or
+	// "element:<prefix:name>" for a custom element
+	Sources []string
+
+	// Selector selects the links in the description and content HTML (default
+	// to "a[href]")
+	Selector string
+
+	// Regex must be matched by the links, its first group being the link if
+	// any. Links written as text in the items are found thanks to it.
+	Regex string
+
+	// ExcludedHosts are never downloaded
+	ExcludedHosts []string `toml:"excluded_hosts"`
 }
 
 type webUser struct {
@@ -106,6 +524,33 @@ type Config struct {
 
 	Downloader DownloaderOptions
 
+	// Downloaders are some additional downloader instances by id
+	Downloaders map[string]*DownloaderOptions
+
+	// Pools are some groups of downloader instances balancing downloads by id
+	Pools map[string]*PoolOptions
+
+	// Routing chooses a downloader instance and download options for each URI
+	Routing RoutingOptions
+
+	// Naming sets the file names of the downloads
+	Naming NamingOptions
+
+	// DiskSpace checks the downloaders free space before each download
+	DiskSpace DiskSpaceOptions `toml:"disk_space"`
+
+	// Verification checks the completed downloads
+	Verification VerificationOptions
+
+	// Extraction extracts the downloaded archives
+	Extraction ExtractionOptions
+
+	// Library organizes the downloaded episodes
+	Library LibraryOptions
+
+	// Watchlist defines the TV shows followed by the watchlist feeds
+	Watchlist WatchlistOptions
+
 	Debrider DebriderOptions
 
 	Providers map[string]ProviderOptions
@@ -115,6 +560,38 @@ type Config struct {
 	Teller TellerOptions
 }
 
+// DownloaderInstance returns the options of a downloader instance by id
+func (c *Config) DownloaderInstance(id string) (*DownloaderOptions, error) {
+	if id == "" || id == DefaultDownloader {
+		return &c.Downloader, nil
+	}
+
+	downloaderOptions, exists := c.Downloaders[id]
+	if !exists {
+		return nil, fmt.Errorf("Unknown downloader %s", id)
+	}
+
+	return downloaderOptions, nil
+}
+
+// IsPool indicates if an id is the one of a downloader pool
+func (c *Config) IsPool(id string) bool {
+	_, exists := c.Pools[id]
+	return exists
+}
+
+// DownloaderIDs returns the additional downloader instances ids, sorted
+func (c *Config) DownloaderIDs() []string {
+	ids := make([]string, 0, len(c.Downloaders))
+	for id := range c.Downloaders {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
 // Load loads config from the default config path
 func Load() (*Config, error) {
 	return LoadFromFile(DefaultConfigPath())
@@ -169,6 +646,190 @@ func (c *Config) validate() error {
 		return errors.New("DBPath can't be blank")
 	}
 
+	// Validating download options templates against blank fields
+	_, optionsError := RenderOptions(c.Downloader.DownloadOptions, &OptionFields{})
+	if optionsError != nil {
+		return fmt.Errorf("Downloader: %s", optionsError)
+	}
+
+	// Validating additional downloaders
+	for id, downloaderOptions := range c.Downloaders {
+		if id == DefaultDownloader {
+			return fmt.Errorf("Downloader id %s is reserved", DefaultDownloader)
+		}
+
+		if downloaderOptions.Name == "" {
+			return fmt.Errorf("Downloader %s must have a name", id)
+		}
+
+		_, optionsError = RenderOptions(downloaderOptions.DownloadOptions, &OptionFields{})
+		if optionsError != nil {
+			return fmt.Errorf("Downloader %s: %s", id, optionsError)
+		}
+	}
+
+	// Validating downloader pools
+	for id, poolOptions := range c.Pools {
+		if id == DefaultDownloader || c.Downloaders[id] != nil {
+			return fmt.Errorf("Pool id %s is already used by a downloader", id)
+		}
+
+		if len(poolOptions.Downloaders) == 0 {
+			return fmt.Errorf("Pool %s must have some downloaders", id)
+		}
+
+		for _, downloaderID := range poolOptions.Downloaders {
+			_, downloaderError := c.DownloaderInstance(downloaderID)
+			if downloaderError != nil {
+				return fmt.Errorf("Pool %s: %s", id, downloaderError)
+			}
+		}
+
+		switch poolOptions.Strategy {
+		case "", "round-robin", "fewest-active", "most-free-space":
+		default:
+			return fmt.Errorf("Pool %s has an invalid strategy %s", id, poolOptions.Strategy)
+		}
+	}
+
+	// Validating feeds types and filters
+	for _, feed := range c.FeedWatcher.Feeds {
+		for _, filterRegex := range append(append([]string(nil), feed.Filters.Include...), feed.Filters.Exclude...) {
+			_, regexError := regexp.Compile(filterRegex)
+			if regexError != nil {
+				return fmt.Errorf("Feed %s has an invalid filter regex: %s", feed.Title, regexError)
+			}
+		}
+
+		switch feed.Type {
+		case "", FeedTypeFeed:
+		case FeedTypeScrape:
+			if feed.Scrape.Item == "" {
+				return fmt.Errorf("Feed %s needs an item selector", feed.Title)
+			}
+		case FeedTypeJSON:
+			if feed.JSON.Link == "" {
+				return fmt.Errorf("Feed %s needs a link path", feed.Title)
+			}
+		default:
+			return fmt.Errorf("Feed %s has an invalid type %s", feed.Title, feed.Type)
+		}
+	}
+
+	// Validating providers regexes
+	for providerName, providerOptions := range c.Providers {
+		if providerOptions.Regex != "" {
+			_, regexError := regexp.Compile(providerOptions.Regex)
+			if regexError != nil {
+				return fmt.Errorf("Provider %s has an invalid regex: %s", providerName, regexError)
+			}
+		}
+	}
+
+	// Validating routing rules
+	for ruleIndex, rule := range c.Routing.Rules {
+		if rule.Regex != "" {
+			_, regexError := regexp.Compile(rule.Regex)
+			if regexError != nil {
+				return fmt.Errorf("Routing rule %d has an invalid regex: %s", ruleIndex+1, regexError)
+			}
+		}
+
+		if !c.IsPool(rule.Downloader) {
+			_, downloaderError := c.DownloaderInstance(rule.Downloader)
+			if downloaderError != nil {
+				return fmt.Errorf("Routing rule %d: %s", ruleIndex+1, downloaderError)
+			}
+		}
+
+		_, optionsError = RenderOptions(rule.DownloadOptions, &OptionFields{})
+		if optionsError != nil {
+			return fmt.Errorf("Routing rule %d: %s", ruleIndex+1, optionsError)
+		}
+	}
+
+	if !c.IsPool(c.Routing.Downloader) {
+		_, downloaderError := c.DownloaderInstance(c.Routing.Downloader)
+		if downloaderError != nil {
+			return fmt.Errorf("Routing: %s", downloaderError)
+		}
+	}
+
+	// Validating naming
+	switch c.Naming.Collision {
+	case CollisionRename, CollisionOverwrite, CollisionSkip:
+	default:
+		return fmt.Errorf("Invalid naming collision %s", c.Naming.Collision)
+	}
+
+	if strings.ContainsAny(c.Naming.Replacement, c.Naming.InvalidCharacters+"/") {
+		return errors.New("Naming replacement can't contain invalid characters")
+	}
+
+	// Validating disk space guard
+	if c.DiskSpace.Reserve < 0 {
+		return errors.New("Disk space reserve can't be negative")
+	}
+
+	switch c.DiskSpace.OnShortage {
+	case ShortageDefer, ShortageReject:
+	case ShortageReroute:
+		if c.DiskSpace.Fallback == "" {
+			return errors.New("Disk space reroute needs a fallback downloader")
+		}
+
+		if !c.IsPool(c.DiskSpace.Fallback) {
+			_, downloaderError := c.DownloaderInstance(c.DiskSpace.Fallback)
+			if downloaderError != nil {
+				return fmt.Errorf("Disk space: %s", downloaderError)
+			}
+		}
+	default:
+		return fmt.Errorf("Invalid disk space shortage mode %s", c.DiskSpace.OnShortage)
+	}
+
+	// Validating verification
+	switch c.Verification.OnMismatch {
+	case MismatchFail, MismatchRedownload:
+	default:
+		return fmt.Errorf("Invalid verification mismatch mode %s", c.Verification.OnMismatch)
+	}
+
+	// Validating extraction
+	if c.Extraction.Enabled && len(c.Extraction.Command) == 0 && !c.Extraction.NativeZip {
+		return errors.New("Extraction needs a command or native ZIP support")
+	}
+
+	// Validating library
+	if c.Library.Enabled {
+		if c.Library.Dir == "" {
+			return errors.New("Library dir can't be blank")
+		}
+
+		switch c.Library.Mode {
+		case LibraryMove, LibraryHardlink:
+		default:
+			return fmt.Errorf("Invalid library mode %s", c.Library.Mode)
+		}
+
+		switch c.Library.Collision {
+		case CollisionRename, CollisionOverwrite, CollisionSkip:
+		default:
+			return fmt.Errorf("Invalid library collision %s", c.Library.Collision)
+		}
+	}
+
+	// Validating watchlist shows
+	for _, show := range c.Watchlist.Shows {
+		if show.Name == "" {
+			return errors.New("Watchlist shows must have a name")
+		}
+
+		if show.From != "" && release.ParseEpisodeKey(show.From) == "" {
+			return fmt.Errorf("Watchlist show %s has an invalid from episode %s", show.Name, show.From)
+		}
+	}
+
 	// Must have 32 bytes secret for CSRF protection
 	if c.WebServer.Secret == "" {
 		return errors.New("A 32 bytes secret token must be set")
@@ -183,6 +844,9 @@ func (c *Config) setDefaults() {
 	// Setting default DBPath
 	c.DBPath = path.Join(userDir, ".config", "christopher", defaultDBName)
 
+	// Setting default debrider sessions path
+	c.Debrider.SessionsPath = path.Join(userDir, ".config", "christopher", defaultDebriderSessionsName)
+
 	// Setting default WatchInterval
 	c.FeedWatcher.WatchInterval = defaultWatchInterval
 
@@ -191,6 +855,33 @@ func (c *Config) setDefaults() {
 	c.WebServer.Port = defaultPort
 	c.WebServer.AuthRealm = defaultAuthRealm
 
+	// Naming defaults
+	c.Naming.InvalidCharacters = defaultInvalidCharacters
+	c.Naming.Replacement = defaultNamingReplacement
+	c.Naming.MaxLength = defaultMaxNameLength
+	c.Naming.Collision = CollisionRename
+	c.Naming.Timeout = defaultNamingTimeout
+
+	// Disk space defaults
+	c.DiskSpace.Reserve = defaultDiskSpaceReserve
+	c.DiskSpace.OnShortage = ShortageDefer
+
+	// Verification defaults
+	c.Verification.Sidecars = true
+	c.Verification.OnMismatch = MismatchFail
+	c.Verification.MaxRedownloads = 1
+
+	// Extraction defaults
+	// Copying as decoding reuses the slice
+	c.Extraction.Command = append([]string(nil), defaultExtractionCommand...)
+	c.Extraction.NativeZip = true
+
+	// Library defaults
+	c.Library.Layout = defaultLibraryLayout
+	c.Library.Mode = LibraryMove
+	c.Library.Collision = CollisionSkip
+	c.Library.Extensions = append([]string(nil), defaultLibraryExtensions...)
+
 	c.Teller.LogLevel = defaultLogLevel
 	c.Teller.LogFormatter = defaultLogFormatter
 }
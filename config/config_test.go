@@ -1,6 +1,9 @@
 package config_test
 
 import (
+	"io/ioutil"
+	"os"
+
 	. "github.com/davidderus/christopher/config"
 
 	. "github.com/onsi/ginkgo"
@@ -53,6 +56,35 @@ var _ = Describe("Config", func() {
 				Expect(downloaderConfig.AuthInfos["token"]).To(Equal("my-good-token"))
 				Expect(downloaderConfig.AuthInfos["rpc_url"]).To(Equal("http://127.0.0.1:6800/jsonrpc"))
 
+				By("Parsing additional Downloaders config")
+				Expect(config.DownloaderIDs()).To(Equal([]string{"torrents"}))
+
+				torrentsConfig, torrentsError := config.DownloaderInstance("torrents")
+				Expect(torrentsError).NotTo(HaveOccurred())
+				Expect(torrentsConfig.Name).To(Equal("transmission"))
+
+				defaultConfig, _ := config.DownloaderInstance(DefaultDownloader)
+				Expect(defaultConfig.Name).To(Equal("aria2"))
+
+				_, unknownError := config.DownloaderInstance("unknown")
+				Expect(unknownError.Error()).To(Equal("Unknown downloader unknown"))
+
+				By("Parsing Routing config")
+				routingRules := config.Routing.Rules
+				Expect(len(routingRules)).To(Equal(2))
+				Expect(routingRules[0].Host).To(Equal("rapidgator.net"))
+				Expect(routingRules[0].Origin).To(Equal("feed-watcher"))
+				Expect(routingRules[0].DownloadOptions["dir"]).To(Equal("/media/series"))
+				Expect(routingRules[1].Extension).To(Equal(".torrent"))
+				Expect(routingRules[1].Downloader).To(Equal("torrents"))
+
+				By("Parsing Pools config")
+				Expect(config.IsPool("everything")).To(BeTrue())
+				Expect(config.IsPool("torrents")).To(BeFalse())
+				Expect(config.Pools["everything"].Downloaders).To(Equal([]string{"default", "torrents"}))
+				Expect(config.Pools["everything"].Strategy).To(Equal("fewest-active"))
+				Expect(config.Pools["everything"].HealthCheckInterval).To(Equal(60))
+
 				// Debrider
 				By("Parsing Debrider config")
 				debriderConfig := config.Debrider
@@ -112,6 +144,195 @@ var _ = Describe("Config", func() {
 			})
 		})
 
+		Context("with an invalid routing rule", func() {
+			It("return an error", func() {
+				configFile, _ := ioutil.TempFile("", "christopher-config")
+				defer os.Remove(configFile.Name())
+
+				configFile.WriteString(`
+db_path = "/tmp/christopher.db"
+
+[[routing.rules]]
+  downloader = "unknown"
+
+[webserver]
+  secret = "Ahgho7aKetho4aiceiVoa3eiKu0chouY"
+`)
+				configFile.Close()
+
+				_, loadError := LoadFromFile(configFile.Name())
+				Expect(loadError.Error()).To(Equal("Routing rule 1: Unknown downloader unknown"))
+			})
+		})
+
+		Context("with an invalid pool", func() {
+			It("return an error", func() {
+				configFile, _ := ioutil.TempFile("", "christopher-config")
+				defer os.Remove(configFile.Name())
+
+				configFile.WriteString(`
+db_path = "/tmp/christopher.db"
+
+[pools.mirrors]
+  downloaders = ["default"]
+  strategy = "random"
+
+[webserver]
+  secret = "Ahgho7aKetho4aiceiVoa3eiKu0chouY"
+`)
+				configFile.Close()
+
+				_, loadError := LoadFromFile(configFile.Name())
+				Expect(loadError.Error()).To(Equal("Pool mirrors has an invalid strategy random"))
+			})
+		})
+
+		Context("with a disk space reroute without fallback", func() {
+			It("return an error", func() {
+				configFile, _ := ioutil.TempFile("", "christopher-config")
+				defer os.Remove(configFile.Name())
+
+				configFile.WriteString(`
+db_path = "/tmp/christopher.db"
+
+[disk_space]
+  enabled = true
+  on_shortage = "reroute"
+
+[webserver]
+  secret = "Ahgho7aKetho4aiceiVoa3eiKu0chouY"
+`)
+				configFile.Close()
+
+				_, loadError := LoadFromFile(configFile.Name())
+				Expect(loadError.Error()).To(Equal("Disk space reroute needs a fallback downloader"))
+			})
+		})
+
+		Context("with a scraped feed without item selector", func() {
+			It("return an error", func() {
+				configFile, _ := ioutil.TempFile("", "christopher-config")
+				defer os.Remove(configFile.Name())
+
+				configFile.WriteString(`
+db_path = "/tmp/christopher.db"
+
+[feedwatcher]
+  [[feedwatcher.feeds]]
+    title = "My Tracker"
+    url = "https://mytracker.org/latest"
+    type = "scrape"
+    [feedwatcher.feeds.scrape]
+      link = "a.download"
+
+[webserver]
+  secret = "Ahgho7aKetho4aiceiVoa3eiKu0chouY"
+`)
+				configFile.Close()
+
+				_, loadError := LoadFromFile(configFile.Name())
+				Expect(loadError.Error()).To(Equal("Feed My Tracker needs an item selector"))
+			})
+		})
+
+		Context("with a JSON feed without link path", func() {
+			It("return an error", func() {
+				configFile, _ := ioutil.TempFile("", "christopher-config")
+				defer os.Remove(configFile.Name())
+
+				configFile.WriteString(`
+db_path = "/tmp/christopher.db"
+
+[feedwatcher]
+  [[feedwatcher.feeds]]
+    title = "Series"
+    url = "https://www.reddit.com/r/series.json"
+    type = "json"
+    [feedwatcher.feeds.json]
+      items = "data.children.*.data"
+
+[webserver]
+  secret = "Ahgho7aKetho4aiceiVoa3eiKu0chouY"
+`)
+				configFile.Close()
+
+				_, loadError := LoadFromFile(configFile.Name())
+				Expect(loadError.Error()).To(Equal("Feed Series needs a link path"))
+			})
+		})
+
+		Context("with an invalid feed filter regex", func() {
+			It("return an error", func() {
+				configFile, _ := ioutil.TempFile("", "christopher-config")
+				defer os.Remove(configFile.Name())
+
+				configFile.WriteString(`
+db_path = "/tmp/christopher.db"
+
+[feedwatcher]
+  [[feedwatcher.feeds]]
+    title = "DirectDownload Feed"
+    url = "https://directdownload.tv"
+    provider = "DirectDownload"
+    [feedwatcher.feeds.filters]
+      exclude = ["(sample"]
+
+[webserver]
+  secret = "Ahgho7aKetho4aiceiVoa3eiKu0chouY"
+`)
+				configFile.Close()
+
+				_, loadError := LoadFromFile(configFile.Name())
+				Expect(loadError.Error()).To(HavePrefix("Feed DirectDownload Feed has an invalid filter regex:"))
+			})
+		})
+
+		Context("with an invalid watchlist episode", func() {
+			It("return an error", func() {
+				configFile, _ := ioutil.TempFile("", "christopher-config")
+				defer os.Remove(configFile.Name())
+
+				configFile.WriteString(`
+db_path = "/tmp/christopher.db"
+
+[watchlist]
+  [[watchlist.shows]]
+    name = "Zombie One"
+    from = "pilot"
+
+[webserver]
+  secret = "Ahgho7aKetho4aiceiVoa3eiKu0chouY"
+`)
+				configFile.Close()
+
+				_, loadError := LoadFromFile(configFile.Name())
+				Expect(loadError.Error()).To(Equal("Watchlist show Zombie One has an invalid from episode pilot"))
+			})
+		})
+
+		Context("with an invalid download option template", func() {
+			It("return an error", func() {
+				configFile, _ := ioutil.TempFile("", "christopher-config")
+				defer os.Remove(configFile.Name())
+
+				configFile.WriteString(`
+db_path = "/tmp/christopher.db"
+
+[[routing.rules]]
+  [routing.rules.download_options]
+    dir = "/media/{{.Serie}}"
+
+[webserver]
+  secret = "Ahgho7aKetho4aiceiVoa3eiKu0chouY"
+`)
+				configFile.Close()
+
+				_, loadError := LoadFromFile(configFile.Name())
+				Expect(loadError.Error()).To(HavePrefix("Routing rule 1: Invalid download option dir:"))
+				Expect(loadError.Error()).To(ContainSubstring("can't evaluate field Serie"))
+			})
+		})
+
 		Context("with an invalid file", func() {
 			It("return an error", func() {
 				_, loadError := LoadFromFile("../testdata/basic_feed.xml")
@@ -0,0 +1,449 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// seenItemsRetention is the time a processed item is remembered once it is
+// no longer in its feed
+const seenItemsRetention = 30 * 24 * time.Hour
+
+// Database persists the feed watcher state in a JSON file so it survives
+// restarts
+//
+// The file is shared with the commands run alongside the feed watcher, so it
+// is read again before each change, and when replaced since, before reading.
+// Changes are made under a lock file shared by the processes.
+type Database struct {
+	// path is the database file, memory only if blank
+	path string
+
+	mutex sync.Mutex
+	data  *data
+
+	// saveMutex prevents concurrent reloads and writes of the database file
+	saveMutex sync.Mutex
+
+	// fileInfo is the database file when last read or written, nil if
+	// missing, guarded by saveMutex
+	fileInfo os.FileInfo
+}
+
+// data is the content of the database file
+type data struct {
+	// SeenItems are the last time each processed item was found in its feed,
+	// by feed and item key
+	SeenItems map[string]map[string]time.Time `json:"seen_items"`
+
+	// LastPolls are the start times of the last successful poll of each feed
+	LastPolls map[string]time.Time `json:"last_polls"`
+
+	// GrabbedReleases are the releases sent to download, by release key
+	GrabbedReleases map[string]*GrabbedRelease `json:"grabbed_releases"`
+
+	// WatchedShows are the shows added to the watchlist, by show key
+	WatchedShows map[string]*WatchedShow `json:"watched_shows"`
+
+	// GrabbedEpisodes are the episodes sent to download, by show key and
+	// episode key
+	GrabbedEpisodes map[string]map[string]*GrabbedEpisode `json:"grabbed_episodes"`
+}
+
+// WatchedShow is a TV show added to the watchlist
+type WatchedShow struct {
+	Name    string    `json:"name"`
+	From    string    `json:"from,omitempty"` // First episode wanted
+	AddedAt time.Time `json:"added_at"`
+}
+
+// GrabbedEpisode is a TV show episode sent to download
+type GrabbedEpisode struct {
+	Release   string    `json:"release"`
+	Quality   string    `json:"quality"`
+	GrabbedAt time.Time `json:"grabbed_at"`
+}
+
+// GrabbedRelease is a release sent to download, such as an episode
+type GrabbedRelease struct {
+	Quality   string    `json:"quality"`
+	GrabbedAt time.Time `json:"grabbed_at"`
+}
+
+// Open loads the database stored in path
+//
+// A missing database file is not an error, it will be created on first save.
+func Open(path string) (*Database, error) {
+	db := &Database{path: path, data: newData()}
+
+	if path != "" {
+		dbData, fileInfo, readError := readData(path)
+		if readError != nil {
+			return nil, readError
+		}
+
+		db.data = dbData
+		db.fileInfo = fileInfo
+	}
+
+	return db, nil
+}
+
+// newData returns an empty database content
+func newData() *data {
+	return &data{
+		SeenItems:       make(map[string]map[string]time.Time),
+		LastPolls:       make(map[string]time.Time),
+		GrabbedReleases: make(map[string]*GrabbedRelease),
+		WatchedShows:    make(map[string]*WatchedShow),
+		GrabbedEpisodes: make(map[string]map[string]*GrabbedEpisode),
+	}
+}
+
+// readData reads a database file and its infos, a missing file being empty
+// and without infos
+func readData(path string) (*data, os.FileInfo, error) {
+	dbData := newData()
+
+	file, openError := os.Open(path)
+	if os.IsNotExist(openError) {
+		return dbData, nil, nil
+	}
+
+	if openError != nil {
+		return nil, nil, openError
+	}
+
+	defer file.Close()
+
+	// Stating the opened file, as the path may be replaced meanwhile
+	fileInfo, statError := file.Stat()
+	if statError != nil {
+		return nil, nil, statError
+	}
+
+	fileData, readError := ioutil.ReadAll(file)
+	if readError != nil {
+		return nil, nil, readError
+	}
+
+	unmarshallError := json.Unmarshal(fileData, dbData)
+	if unmarshallError != nil {
+		return nil, nil, fmt.Errorf("Invalid database file: %v", unmarshallError)
+	}
+
+	// Filling the maps missing from the file
+	emptyData := newData()
+
+	if dbData.SeenItems == nil {
+		dbData.SeenItems = emptyData.SeenItems
+	}
+
+	if dbData.LastPolls == nil {
+		dbData.LastPolls = emptyData.LastPolls
+	}
+
+	if dbData.GrabbedReleases == nil {
+		dbData.GrabbedReleases = emptyData.GrabbedReleases
+	}
+
+	if dbData.WatchedShows == nil {
+		dbData.WatchedShows = emptyData.WatchedShows
+	}
+
+	if dbData.GrabbedEpisodes == nil {
+		dbData.GrabbedEpisodes = emptyData.GrabbedEpisodes
+	}
+
+	return dbData, fileInfo, nil
+}
+
+// sameFile indicates if two infos are about the same unchanged file
+//
+// Database files are replaced on each write, so another file is a change even
+// within the modification time resolution.
+func sameFile(fileInfo, otherInfo os.FileInfo) bool {
+	if fileInfo == nil || otherInfo == nil {
+		return fileInfo == otherInfo
+	}
+
+	return os.SameFile(fileInfo, otherInfo) && fileInfo.ModTime().Equal(otherInfo.ModTime()) && fileInfo.Size() == otherInfo.Size()
+}
+
+// refresh reads the database file again when replaced by another process
+//
+// The current content is kept when the file cannot be read.
+func (db *Database) refresh() {
+	if db.path == "" {
+		return
+	}
+
+	db.saveMutex.Lock()
+	defer db.saveMutex.Unlock()
+
+	fileInfo, statError := os.Stat(db.path)
+	if statError != nil || sameFile(fileInfo, db.fileInfo) {
+		return
+	}
+
+	dbData, fileInfo, readError := readData(db.path)
+	if readError != nil {
+		return
+	}
+
+	db.mutex.Lock()
+	db.data = dbData
+	db.mutex.Unlock()
+
+	db.fileInfo = fileInfo
+}
+
+// IsKnownFeed indicates if some items of a feed were already processed
+func (db *Database) IsKnownFeed(feed string) bool {
+	db.refresh()
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	_, exists := db.data.SeenItems[feed]
+	return exists
+}
+
+// IsSeen indicates if an item of a feed was already processed
+func (db *Database) IsSeen(feed, itemKey string) bool {
+	db.refresh()
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	_, exists := db.data.SeenItems[feed][itemKey]
+	return exists
+}
+
+// MarkSeen records the items currently in a feed as processed
+//
+// Items missing from the feed for too long are forgotten.
+func (db *Database) MarkSeen(feed string, itemKeys []string) error {
+	return db.update(func(dbData *data) {
+		now := time.Now()
+
+		seenItems, exists := dbData.SeenItems[feed]
+		if !exists {
+			seenItems = make(map[string]time.Time)
+			dbData.SeenItems[feed] = seenItems
+		}
+
+		for _, itemKey := range itemKeys {
+			seenItems[itemKey] = now
+		}
+
+		for itemKey, seenAt := range seenItems {
+			if now.Sub(seenAt) > seenItemsRetention {
+				delete(seenItems, itemKey)
+			}
+		}
+	})
+}
+
+// LastPoll returns the start time of the last successful poll of a feed,
+// zero if never polled
+func (db *Database) LastPoll(feed string) time.Time {
+	db.refresh()
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	return db.data.LastPolls[feed]
+}
+
+// SetLastPoll records the start time of a successful poll of a feed
+func (db *Database) SetLastPoll(feed string, polledAt time.Time) error {
+	return db.update(func(dbData *data) {
+		dbData.LastPolls[feed] = polledAt
+	})
+}
+
+// GrabbedQuality returns the quality a release was grabbed in, if grabbed
+func (db *Database) GrabbedQuality(releaseKey string) (string, bool) {
+	db.refresh()
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	grabbedRelease, exists := db.data.GrabbedReleases[releaseKey]
+	if !exists {
+		return "", false
+	}
+
+	return grabbedRelease.Quality, true
+}
+
+// SetGrabbed records a release as grabbed in a quality
+//
+// Releases grabbed for too long are forgotten.
+func (db *Database) SetGrabbed(releaseKey, quality string) error {
+	return db.update(func(dbData *data) {
+		now := time.Now()
+
+		dbData.GrabbedReleases[releaseKey] = &GrabbedRelease{Quality: quality, GrabbedAt: now}
+
+		for grabbedKey, grabbedRelease := range dbData.GrabbedReleases {
+			if now.Sub(grabbedRelease.GrabbedAt) > seenItemsRetention {
+				delete(dbData.GrabbedReleases, grabbedKey)
+			}
+		}
+	})
+}
+
+// WatchedShows returns a copy of the shows added to the watchlist, by show
+// key
+func (db *Database) WatchedShows() map[string]WatchedShow {
+	db.refresh()
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	watchedShows := make(map[string]WatchedShow, len(db.data.WatchedShows))
+	for showKey, watchedShow := range db.data.WatchedShows {
+		watchedShows[showKey] = *watchedShow
+	}
+
+	return watchedShows
+}
+
+// AddShow adds or replaces a show of the watchlist
+func (db *Database) AddShow(showKey string, show *WatchedShow) error {
+	return db.update(func(dbData *data) {
+		dbData.WatchedShows[showKey] = show
+	})
+}
+
+// RemoveShow removes a show from the watchlist, its grabbed episodes being
+// kept, and indicates if it was watched
+func (db *Database) RemoveShow(showKey string) (bool, error) {
+	var exists bool
+
+	updateError := db.update(func(dbData *data) {
+		_, exists = dbData.WatchedShows[showKey]
+		delete(dbData.WatchedShows, showKey)
+	})
+
+	return exists, updateError
+}
+
+// GrabbedEpisodes returns a copy of the grabbed episodes of a show, by
+// episode key
+func (db *Database) GrabbedEpisodes(showKey string) map[string]GrabbedEpisode {
+	db.refresh()
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	grabbedEpisodes := make(map[string]GrabbedEpisode, len(db.data.GrabbedEpisodes[showKey]))
+	for episodeKey, grabbedEpisode := range db.data.GrabbedEpisodes[showKey] {
+		grabbedEpisodes[episodeKey] = *grabbedEpisode
+	}
+
+	return grabbedEpisodes
+}
+
+// SetGrabbedEpisode records an episode of a show as grabbed
+func (db *Database) SetGrabbedEpisode(showKey, episodeKey string, episode *GrabbedEpisode) error {
+	return db.update(func(dbData *data) {
+		showEpisodes, exists := dbData.GrabbedEpisodes[showKey]
+		if !exists {
+			showEpisodes = make(map[string]*GrabbedEpisode)
+			dbData.GrabbedEpisodes[showKey] = showEpisodes
+		}
+
+		showEpisodes[episodeKey] = episode
+	})
+}
+
+// update applies a change to the database and writes it to its file
+//
+// The file is read again first under the lock file, so the changes made
+// meanwhile by another process are kept.
+func (db *Database) update(change func(dbData *data)) error {
+	if db.path == "" {
+		db.mutex.Lock()
+		change(db.data)
+		db.mutex.Unlock()
+
+		return nil
+	}
+
+	db.saveMutex.Lock()
+	defer db.saveMutex.Unlock()
+
+	dirError := os.MkdirAll(filepath.Dir(db.path), 0700)
+	if dirError != nil {
+		return dirError
+	}
+
+	lock, lockError := lockFile(db.path + ".lock")
+	if lockError != nil {
+		return lockError
+	}
+
+	defer lock.Close()
+
+	dbData, _, readError := readData(db.path)
+	if readError != nil {
+		return readError
+	}
+
+	change(dbData)
+
+	db.mutex.Lock()
+	db.data = dbData
+	db.mutex.Unlock()
+
+	encodedData, encodeError := json.MarshalIndent(dbData, "", "  ")
+	if encodeError != nil {
+		return encodeError
+	}
+
+	writeError := writeFile(db.path, encodedData)
+	if writeError != nil {
+		return writeError
+	}
+
+	fileInfo, statError := os.Stat(db.path)
+	if statError == nil {
+		db.fileInfo = fileInfo
+	}
+
+	return nil
+}
+
+// writeFile replaces a file at once with some data, written to a temporary
+// file of the same dir first
+func writeFile(path string, fileData []byte) error {
+	temporaryFile, createError := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if createError != nil {
+		return createError
+	}
+
+	_, writeError := temporaryFile.Write(fileData)
+	closeError := temporaryFile.Close()
+
+	if writeError == nil {
+		writeError = closeError
+	}
+
+	if writeError == nil {
+		writeError = os.Rename(temporaryFile.Name(), path)
+	}
+
+	if writeError != nil {
+		os.Remove(temporaryFile.Name())
+	}
+
+	return writeError
+}
@@ -0,0 +1,160 @@
+package database_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/davidderus/christopher/database"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestDatabase(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Database Suite")
+}
+
+var _ = Describe("Database", func() {
+	var dir string
+	var dbPath string
+
+	BeforeEach(func() {
+		dir, _ = ioutil.TempDir("", "christopher-database")
+		dbPath = filepath.Join(dir, "christopher", "database.db")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should start empty without database file", func() {
+		db, openError := Open(dbPath)
+
+		Expect(openError).NotTo(HaveOccurred())
+		Expect(db.IsKnownFeed("https://directdownload.tv")).To(BeFalse())
+		Expect(db.IsSeen("https://directdownload.tv", "guid:42")).To(BeFalse())
+	})
+
+	It("should remember the seen items across openings", func() {
+		db, _ := Open(dbPath)
+		Expect(db.MarkSeen("https://directdownload.tv", []string{"guid:42", "link:http://rapidgator.net/file/HTGAWM.mkv"})).To(Succeed())
+
+		db, _ = Open(dbPath)
+		Expect(db.IsKnownFeed("https://directdownload.tv")).To(BeTrue())
+		Expect(db.IsSeen("https://directdownload.tv", "guid:42")).To(BeTrue())
+		Expect(db.IsSeen("https://directdownload.tv", "guid:43")).To(BeFalse())
+		Expect(db.IsSeen("https://other.tv", "guid:42")).To(BeFalse())
+	})
+
+	It("should remember the last poll of each feed", func() {
+		polledAt := time.Date(2017, time.February, 25, 10, 30, 0, 0, time.UTC)
+
+		db, _ := Open(dbPath)
+		Expect(db.LastPoll("https://directdownload.tv").IsZero()).To(BeTrue())
+		Expect(db.SetLastPoll("https://directdownload.tv", polledAt)).To(Succeed())
+
+		db, _ = Open(dbPath)
+		Expect(db.LastPoll("https://directdownload.tv").Equal(polledAt)).To(BeTrue())
+	})
+
+	It("should remember the grabbed releases quality", func() {
+		db, _ := Open(dbPath)
+		_, isGrabbed := db.GrabbedQuality("zombie one s03e04")
+		Expect(isGrabbed).To(BeFalse())
+
+		Expect(db.SetGrabbed("zombie one s03e04", "720p")).To(Succeed())
+
+		db, _ = Open(dbPath)
+		quality, isGrabbed := db.GrabbedQuality("zombie one s03e04")
+		Expect(isGrabbed).To(BeTrue())
+		Expect(quality).To(Equal("720p"))
+	})
+
+	It("should remember the watched shows and their grabbed episodes", func() {
+		db, _ := Open(dbPath)
+		Expect(db.AddShow("zombie one", &WatchedShow{Name: "Zombie One", From: "S03E01"})).To(Succeed())
+		Expect(db.SetGrabbedEpisode("zombie one", "S03E04", &GrabbedEpisode{Release: "Zombie.One.S03E04.720p", Quality: "720p"})).To(Succeed())
+
+		db, _ = Open(dbPath)
+		Expect(db.WatchedShows()).To(HaveKeyWithValue("zombie one", WatchedShow{Name: "Zombie One", From: "S03E01"}))
+		Expect(db.GrabbedEpisodes("zombie one")["S03E04"].Quality).To(Equal("720p"))
+		Expect(db.GrabbedEpisodes("htgawm")).To(BeEmpty())
+
+		isRemoved, removeError := db.RemoveShow("zombie one")
+		Expect(removeError).NotTo(HaveOccurred())
+		Expect(isRemoved).To(BeTrue())
+
+		isRemoved, _ = db.RemoveShow("zombie one")
+		Expect(isRemoved).To(BeFalse())
+		Expect(db.WatchedShows()).To(BeEmpty())
+		Expect(db.GrabbedEpisodes("zombie one")).To(HaveLen(1))
+	})
+
+	It("should keep the changes made by another process", func() {
+		watcherDB, _ := Open(dbPath)
+		Expect(watcherDB.MarkSeen("https://directdownload.tv", []string{"guid:42"})).To(Succeed())
+
+		commandDB, _ := Open(dbPath)
+		Expect(commandDB.AddShow("zombie one", &WatchedShow{Name: "Zombie One"})).To(Succeed())
+
+		Expect(watcherDB.WatchedShows()).To(HaveKey("zombie one"))
+		Expect(watcherDB.SetLastPoll("https://directdownload.tv", time.Now())).To(Succeed())
+
+		db, _ := Open(dbPath)
+		Expect(db.WatchedShows()).To(HaveKey("zombie one"))
+		Expect(db.IsSeen("https://directdownload.tv", "guid:42")).To(BeTrue())
+		Expect(db.LastPoll("https://directdownload.tv").IsZero()).To(BeFalse())
+	})
+
+	It("should keep the concurrent changes of several processes", func() {
+		watcherDB, _ := Open(dbPath)
+		commandDB, _ := Open(dbPath)
+
+		var waitGroup sync.WaitGroup
+
+		for showIndex := 0; showIndex < 20; showIndex++ {
+			waitGroup.Add(2)
+
+			showKey := fmt.Sprintf("show %d", showIndex)
+
+			go func() {
+				defer waitGroup.Done()
+				Expect(watcherDB.AddShow("watcher "+showKey, &WatchedShow{Name: showKey})).To(Succeed())
+			}()
+
+			go func() {
+				defer waitGroup.Done()
+				Expect(commandDB.AddShow("command "+showKey, &WatchedShow{Name: showKey})).To(Succeed())
+			}()
+		}
+
+		waitGroup.Wait()
+
+		db, _ := Open(dbPath)
+		Expect(db.WatchedShows()).To(HaveLen(40))
+		Expect(watcherDB.WatchedShows()).To(HaveLen(40))
+		Expect(commandDB.WatchedShows()).To(HaveLen(40))
+	})
+
+	It("should know a feed without items", func() {
+		db, _ := Open("")
+		db.MarkSeen("https://directdownload.tv", nil)
+
+		Expect(db.IsKnownFeed("https://directdownload.tv")).To(BeTrue())
+	})
+
+	It("should refuse an invalid database file", func() {
+		os.MkdirAll(filepath.Dir(dbPath), 0700)
+		ioutil.WriteFile(dbPath, []byte("SQLite format 3"), 0600)
+
+		_, openError := Open(dbPath)
+
+		Expect(openError.Error()).To(HavePrefix("Invalid database file:"))
+	})
+})
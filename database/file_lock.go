@@ -0,0 +1,29 @@
+//go:build !windows
+// +build !windows
+
+package database
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockFile takes an exclusive lock on a file, waiting for the other
+// processes to release it
+//
+// The lock is released by closing the returned file.
+func lockFile(path string) (*os.File, error) {
+	file, openError := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if openError != nil {
+		return nil, openError
+	}
+
+	lockError := unix.Flock(int(file.Fd()), unix.LOCK_EX)
+	if lockError != nil {
+		file.Close()
+		return nil, lockError
+	}
+
+	return file, nil
+}
@@ -0,0 +1,9 @@
+package database
+
+import "os"
+
+// lockFile only opens a file on Windows, the processes sharing a database
+// not being locked out
+func lockFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+}
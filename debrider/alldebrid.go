@@ -9,6 +9,8 @@ import (
 	"net/http/cookiejar"
 	"net/url"
 	"regexp"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -20,6 +22,13 @@ type AllDebrid struct {
 	// client is an HTTP Client for the current session
 	client *http.Client
 
+	// authenticatedAt is the time of the last successful login
+	authenticatedAt time.Time
+
+	// sessionMutex guards the session fields, swapped on re-authentication
+	// while other events may be debriding
+	sessionMutex sync.RWMutex
+
 	// Allow to set a custom HTTP transport (for test purposes)
 	CustomTransport http.RoundTripper
 
@@ -28,8 +37,10 @@ type AllDebrid struct {
 
 // allDebridResponse represents parts of a debrid response
 type allDebridResponse struct {
-	Error string
-	Link  string
+	Error    string
+	Link     string
+	Filename string
+	Filesize int64
 }
 
 const (
@@ -41,6 +52,9 @@ const (
 	defaultTimeOut     = 10 * time.Second
 )
 
+// loggedOutMatcher detects debrid errors caused by a missing or expired login
+var loggedOutMatcher = regexp.MustCompile(`(?i)(not logged|must be logged|login required)`)
+
 // Init initializes some Alldebrid things
 func (ad *AllDebrid) Init() error {
 	// Building hosts regexp
@@ -64,19 +78,12 @@ func (ad *AllDebrid) Auth(infos map[string]string) error {
 	}
 
 	baseURL = infos["base_url"]
-	if baseURL != "" {
-		ad.baseURL = baseURL
-	} else {
-		ad.baseURL = defaultBaseURL
+	if baseURL == "" {
+		baseURL = defaultBaseURL
 	}
 
-	cookieJar, _ := cookiejar.New(nil)
-
-	ad.client = &http.Client{
-		Timeout:   defaultTimeOut,
-		Transport: ad.CustomTransport,
-		Jar:       cookieJar,
-	}
+	// Logging in with a new client, the current one being kept meanwhile
+	client := ad.newClient()
 
 	query := url.Values{}
 	query.Add("action", "login")
@@ -84,9 +91,9 @@ func (ad *AllDebrid) Auth(infos map[string]string) error {
 	query.Add("login_login", username)
 	query.Add("login_password", password)
 
-	finalURL := fmt.Sprintf("%s/%s?%s", ad.baseURL, authPath, query.Encode())
+	finalURL := fmt.Sprintf("%s/%s?%s", baseURL, authPath, query.Encode())
 
-	response, responseError := ad.client.Get(finalURL)
+	response, responseError := client.Get(finalURL)
 	if responseError != nil {
 		return responseError
 	}
@@ -94,42 +101,136 @@ func (ad *AllDebrid) Auth(infos map[string]string) error {
 	defer response.Body.Close()
 
 	newLocation := response.Request.URL.String()
-	if newLocation != fmt.Sprintf("%s%s", ad.baseURL, returnPath) {
+	if newLocation != fmt.Sprintf("%s%s", baseURL, returnPath) {
 		return errors.New("Invalid credentials")
 	}
 
+	ad.setSession(baseURL, client, time.Now())
+
 	return nil
 }
 
+// Session returns the current session cookies
+func (ad *AllDebrid) Session() *Session {
+	ad.sessionMutex.RLock()
+	defer ad.sessionMutex.RUnlock()
+
+	if ad.client == nil {
+		return nil
+	}
+
+	sessionURL, _ := url.Parse(ad.baseURL)
+
+	return &Session{
+		BaseURL:         ad.baseURL,
+		Cookies:         ad.client.Jar.Cookies(sessionURL),
+		AuthenticatedAt: ad.authenticatedAt,
+	}
+}
+
+// RestoreSession reuses some previously saved session cookies
+func (ad *AllDebrid) RestoreSession(session *Session) error {
+	if session == nil || session.BaseURL == "" || len(session.Cookies) == 0 {
+		return errors.New("Invalid session")
+	}
+
+	sessionURL, parseError := url.Parse(session.BaseURL)
+	if parseError != nil {
+		return parseError
+	}
+
+	client := ad.newClient()
+	client.Jar.SetCookies(sessionURL, session.Cookies)
+
+	ad.setSession(session.BaseURL, client, session.AuthenticatedAt)
+
+	return nil
+}
+
+// newClient returns a new HTTP client with an empty cookie jar
+func (ad *AllDebrid) newClient() *http.Client {
+	cookieJar, _ := cookiejar.New(nil)
+
+	return &http.Client{
+		Timeout:   defaultTimeOut,
+		Transport: ad.CustomTransport,
+		Jar:       cookieJar,
+	}
+}
+
+// setSession replaces the current session, debrids in progress keeping the
+// previous client
+func (ad *AllDebrid) setSession(baseURL string, client *http.Client, authenticatedAt time.Time) {
+	ad.sessionMutex.Lock()
+	defer ad.sessionMutex.Unlock()
+
+	ad.baseURL = baseURL
+	ad.client = client
+	ad.authenticatedAt = authenticatedAt
+}
+
+// currentSession returns the base URL and HTTP client of the current session
+func (ad *AllDebrid) currentSession() (string, *http.Client) {
+	ad.sessionMutex.RLock()
+	defer ad.sessionMutex.RUnlock()
+
+	return ad.baseURL, ad.client
+}
+
 // Debrid debrid a given uri
 func (ad *AllDebrid) Debrid(uri string, options map[string]interface{}) (string, error) {
+	link, debridError := ad.DebridLink(uri, options)
+	if debridError != nil {
+		return "", debridError
+	}
+
+	return link.URI, nil
+}
+
+// DebridLink debrids a given uri and returns the name and size of its file
+func (ad *AllDebrid) DebridLink(uri string, options map[string]interface{}) (*Link, error) {
 	query := url.Values{}
 	query.Add("link", uri)
 	query.Add("json", "true")
 
-	getURL := fmt.Sprintf("%s/%s?%s", ad.baseURL, debridPath, query.Encode())
+	baseURL, client := ad.currentSession()
+
+	getURL := fmt.Sprintf("%s/%s?%s", baseURL, debridPath, query.Encode())
 
 	// Hum, only GET seems to be supported…
-	response, responseError := ad.client.Get(getURL)
+	response, responseError := client.Get(getURL)
 	if responseError != nil {
-		return "", responseError
+		return nil, responseError
 	}
 
 	defer response.Body.Close()
 
+	// An expired session is redirected to the login page
+	if strings.Contains(response.Request.URL.Path, authPath) {
+		return nil, ErrSessionExpired
+	}
+
 	body, _ := ioutil.ReadAll(response.Body)
 	var debridResponse allDebridResponse
 
 	unmarshallError := json.Unmarshal(body, &debridResponse)
 	if unmarshallError != nil {
-		return "", unmarshallError
+		return nil, unmarshallError
 	}
 
 	if debridResponse.Error != "" {
-		return "", errors.New(debridResponse.Error)
+		if loggedOutMatcher.MatchString(debridResponse.Error) {
+			return nil, ErrSessionExpired
+		}
+
+		return nil, errors.New(debridResponse.Error)
 	}
 
-	return debridResponse.Link, nil
+	return &Link{
+		URI:      debridResponse.Link,
+		FileName: debridResponse.Filename,
+		Size:     debridResponse.Filesize,
+	}, nil
 }
 
 func (ad *AllDebrid) buildSupportedHosts() {
@@ -117,6 +117,25 @@ var _ = Describe("AllDebrid", func() {
 		})
 	})
 
+	Describe(".DebridLink()", func() {
+		Context("With a valid link", func() {
+			It("should give the file infos", func() {
+				link := "http://rapidgator.net/file/HTGAWM.mkv"
+
+				allDebrid, testRecorder := getClientForCassette("debrid_valid_link")
+
+				debridedLink, debridError := allDebrid.DebridLink(link, nil)
+
+				testRecorder.Stop()
+
+				Expect(debridError).NotTo(HaveOccurred())
+				Expect(debridedLink.URI).To(Equal("https://subdomain.alld.io/dl/ABC/HTGAWM.mkv"))
+				Expect(debridedLink.FileName).To(Equal("HTGAWM.mkv"))
+				Expect(debridedLink.Size).To(Equal(int64(2377121)))
+			})
+		})
+	})
+
 	Describe(".IsDebridable()", func() {
 		var debrider *AllDebrid
 
@@ -10,6 +10,29 @@ type Debrider interface {
 
 	// IsDebridable will be used to switch between multiple debriders
 	IsDebridable(uri string) bool
+
+	// Session returns the current session so it can be persisted
+	Session() *Session
+
+	// RestoreSession reuses a persisted session instead of logging in again
+	RestoreSession(session *Session) error
+}
+
+// Link is a debrided link along with the infos given by the debrider
+type Link struct {
+	URI string
+
+	// FileName is the name of the linked file, blank if unknown
+	FileName string
+
+	// Size is the size of the linked file in bytes, 0 if unknown
+	Size int64
+}
+
+// LinkDebrider is implemented by debriders giving infos about the files they
+// debrid
+type LinkDebrider interface {
+	DebridLink(uri string, options map[string]interface{}) (*Link, error)
 }
 
 // NewDebrider returns a new initialized debrider
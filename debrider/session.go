@@ -0,0 +1,249 @@
+package debrider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSessionExpired is returned by a debrider when its remote session is no
+// longer valid and a new authentication is required
+var ErrSessionExpired = errors.New("Debrider session expired")
+
+// Session is the persistable state of an authenticated debrider
+type Session struct {
+	BaseURL         string         `json:"base_url"`
+	Cookies         []*http.Cookie `json:"cookies"`
+	AuthenticatedAt time.Time      `json:"authenticated_at"`
+}
+
+// SessionPool keeps authenticated debriders in memory and persists their
+// sessions on disk so they can be reused across events and restarts
+type SessionPool struct {
+	// path is the file where sessions are persisted, memory only if blank
+	path string
+
+	mutex     sync.Mutex
+	sessions  map[string]*Session
+	debriders map[string]*sessionDebrider
+}
+
+// NewSessionPool returns a pool loaded with the sessions persisted in path
+//
+// A missing sessions file is not an error, it will be created on first save.
+func NewSessionPool(path string) (*SessionPool, error) {
+	pool := &SessionPool{
+		path:      path,
+		sessions:  make(map[string]*Session),
+		debriders: make(map[string]*sessionDebrider),
+	}
+
+	if path == "" {
+		return pool, nil
+	}
+
+	sessionsData, readError := ioutil.ReadFile(path)
+	if readError != nil {
+		if os.IsNotExist(readError) {
+			return pool, nil
+		}
+
+		return nil, readError
+	}
+
+	unmarshallError := json.Unmarshal(sessionsData, &pool.sessions)
+	if unmarshallError != nil {
+		return nil, fmt.Errorf("Invalid debrider sessions file: %v", unmarshallError)
+	}
+
+	return pool, nil
+}
+
+// Debrider returns an authenticated debrider for the given name and auth infos
+//
+// The debrider is taken from memory if possible, then from a persisted session
+// and finally authenticated against the remote service.
+func (sp *SessionPool) Debrider(name string, authInfos map[string]string) (Debrider, error) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+
+	key := sessionKey(name, authInfos)
+
+	if cachedDebrider, exists := sp.debriders[key]; exists {
+		return cachedDebrider, nil
+	}
+
+	debrider, debriderError := NewDebrider(name, nil)
+	if debriderError != nil {
+		return nil, debriderError
+	}
+
+	session, sessionExists := sp.sessions[key]
+	if sessionExists {
+		restoreError := debrider.RestoreSession(session)
+		if restoreError != nil {
+			sessionExists = false
+		}
+	}
+
+	if !sessionExists {
+		authError := debrider.Auth(authInfos)
+		if authError != nil {
+			return nil, authError
+		}
+
+		saveError := sp.store(key, debrider.Session())
+		if saveError != nil {
+			return nil, saveError
+		}
+	}
+
+	pooledDebrider := &sessionDebrider{Debrider: debrider, pool: sp, key: key, authInfos: authInfos}
+	sp.debriders[key] = pooledDebrider
+
+	return pooledDebrider, nil
+}
+
+// Save persists a session for the given key
+func (sp *SessionPool) Save(key string, session *Session) error {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+
+	return sp.store(key, session)
+}
+
+// store updates a session and writes all sessions to disk
+//
+// NOTE sp.mutex must be held by the caller
+func (sp *SessionPool) store(key string, session *Session) error {
+	sp.sessions[key] = session
+
+	if sp.path == "" {
+		return nil
+	}
+
+	sessionsData, marshallError := json.Marshal(sp.sessions)
+	if marshallError != nil {
+		return marshallError
+	}
+
+	dirError := os.MkdirAll(filepath.Dir(sp.path), 0700)
+	if dirError != nil {
+		return dirError
+	}
+
+	// Writing to a temporary file first so a crash never leaves a truncated file
+	tempPath := sp.path + ".tmp"
+	writeError := ioutil.WriteFile(tempPath, sessionsData, 0600)
+	if writeError != nil {
+		return writeError
+	}
+
+	return os.Rename(tempPath, sp.path)
+}
+
+// sessionKey identifies a session by debrider, user and service URL
+func sessionKey(name string, authInfos map[string]string) string {
+	key := fmt.Sprintf("%s:%s", strings.ToLower(name), authInfos["username"])
+
+	if baseURL := authInfos["base_url"]; baseURL != "" {
+		key += "@" + baseURL
+	}
+
+	return key
+}
+
+// sessionDebrider wraps a pooled debrider to authenticate it again when its
+// session expires
+type sessionDebrider struct {
+	Debrider
+
+	pool      *SessionPool
+	key       string
+	authInfos map[string]string
+	authMutex sync.Mutex
+}
+
+// Debrid debrids an uri, retrying once with a fresh session if needed
+func (sd *sessionDebrider) Debrid(uri string, options map[string]interface{}) (string, error) {
+	usedSession := sd.authenticatedAt()
+
+	debridedURI, debridError := sd.Debrider.Debrid(uri, options)
+	if debridError != ErrSessionExpired {
+		return debridedURI, debridError
+	}
+
+	reauthError := sd.reauthenticate(usedSession)
+	if reauthError != nil {
+		return "", reauthError
+	}
+
+	return sd.Debrider.Debrid(uri, options)
+}
+
+// DebridLink debrids an uri with its file infos, retrying once with a fresh
+// session if needed
+//
+// Debriders without file infos only give the debrided URI.
+func (sd *sessionDebrider) DebridLink(uri string, options map[string]interface{}) (*Link, error) {
+	linkDebrider, isLinkDebrider := sd.Debrider.(LinkDebrider)
+	if !isLinkDebrider {
+		debridedURI, debridError := sd.Debrid(uri, options)
+		if debridError != nil {
+			return nil, debridError
+		}
+
+		return &Link{URI: debridedURI}, nil
+	}
+
+	usedSession := sd.authenticatedAt()
+
+	link, debridError := linkDebrider.DebridLink(uri, options)
+	if debridError != ErrSessionExpired {
+		return link, debridError
+	}
+
+	reauthError := sd.reauthenticate(usedSession)
+	if reauthError != nil {
+		return nil, reauthError
+	}
+
+	return linkDebrider.DebridLink(uri, options)
+}
+
+// reauthenticate logs the debrider in again and persists the new session
+//
+// The expired session is the one authenticated at the given time, so
+// concurrent events log in once and reuse the session of the first one.
+func (sd *sessionDebrider) reauthenticate(expiredAt time.Time) error {
+	sd.authMutex.Lock()
+	defer sd.authMutex.Unlock()
+
+	if !sd.authenticatedAt().Equal(expiredAt) {
+		return nil
+	}
+
+	authError := sd.Debrider.Auth(sd.authInfos)
+	if authError != nil {
+		return authError
+	}
+
+	return sd.pool.Save(sd.key, sd.Debrider.Session())
+}
+
+// authenticatedAt returns the login time of the current session
+func (sd *sessionDebrider) authenticatedAt() time.Time {
+	session := sd.Debrider.Session()
+	if session == nil {
+		return time.Time{}
+	}
+
+	return session.AuthenticatedAt
+}
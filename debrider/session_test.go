@@ -0,0 +1,270 @@
+package debrider_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/davidderus/christopher/debrider"
+)
+
+// fakeAllDebrid is a minimal AllDebrid server handing out one valid session
+// at a time
+type fakeAllDebrid struct {
+	server       *httptest.Server
+	mutex        sync.Mutex
+	loginsCount  int
+	validSession string
+}
+
+func newFakeAllDebrid() *fakeAllDebrid {
+	fake := &fakeAllDebrid{}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/register/", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		// Login page without credentials
+		if query.Get("login_login") == "" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		if query.Get("login_login") != validInfos[0] || query.Get("login_password") != validInfos[1] {
+			http.Redirect(w, r, "/register/", http.StatusFound)
+			return
+		}
+
+		fake.mutex.Lock()
+		defer fake.mutex.Unlock()
+
+		fake.loginsCount++
+		fake.validSession = fmt.Sprintf("session-%d", fake.loginsCount)
+
+		http.SetCookie(w, &http.Cookie{Name: "uid", Value: fake.validSession, Path: "/"})
+		http.Redirect(w, r, query.Get("returnpage"), http.StatusFound)
+	})
+
+	mux.HandleFunc("/account/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	mux.HandleFunc("/service.php", func(w http.ResponseWriter, r *http.Request) {
+		fake.mutex.Lock()
+		validSession := fake.validSession
+		fake.mutex.Unlock()
+
+		cookie, cookieError := r.Cookie("uid")
+		if cookieError != nil || cookie.Value != validSession {
+			http.Redirect(w, r, "/register/", http.StatusFound)
+			return
+		}
+
+		fmt.Fprintf(w, `{"link":"https://subdomain.alld.io/dl/ABC/file.mkv","filename":"file.mkv","error":""}`)
+	})
+
+	fake.server = httptest.NewServer(mux)
+
+	return fake
+}
+
+// expireSession invalidates the current session on the server side
+func (fake *fakeAllDebrid) expireSession() {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	fake.validSession = ""
+}
+
+func (fake *fakeAllDebrid) authInfos() map[string]string {
+	return map[string]string{
+		"username": validInfos[0],
+		"password": validInfos[1],
+		"base_url": fake.server.URL,
+	}
+}
+
+var _ = Describe("SessionPool", func() {
+	var (
+		fakeServer   *fakeAllDebrid
+		sessionsDir  string
+		sessionsPath string
+	)
+
+	BeforeEach(func() {
+		fakeServer = newFakeAllDebrid()
+
+		sessionsDir, _ = ioutil.TempDir("", "christopher-sessions")
+		sessionsPath = filepath.Join(sessionsDir, "sessions.json")
+	})
+
+	AfterEach(func() {
+		fakeServer.server.Close()
+		os.RemoveAll(sessionsDir)
+	})
+
+	Context("with a single pool", func() {
+		It("should log in once and reuse the debrider", func() {
+			pool, poolError := NewSessionPool(sessionsPath)
+			Expect(poolError).NotTo(HaveOccurred())
+
+			firstDebrider, firstError := pool.Debrider("AllDebrid", fakeServer.authInfos())
+			Expect(firstError).NotTo(HaveOccurred())
+
+			secondDebrider, secondError := pool.Debrider("AllDebrid", fakeServer.authInfos())
+			Expect(secondError).NotTo(HaveOccurred())
+
+			Expect(secondDebrider).To(BeIdenticalTo(firstDebrider))
+			Expect(fakeServer.loginsCount).To(Equal(1))
+
+			By("Persisting the session")
+			Expect(sessionsPath).To(BeARegularFile())
+		})
+
+		It("should keep a session by service URL", func() {
+			otherServer := newFakeAllDebrid()
+			defer otherServer.server.Close()
+
+			pool, _ := NewSessionPool(sessionsPath)
+
+			firstDebrider, firstError := pool.Debrider("AllDebrid", fakeServer.authInfos())
+			Expect(firstError).NotTo(HaveOccurred())
+
+			otherDebrider, otherError := pool.Debrider("AllDebrid", otherServer.authInfos())
+			Expect(otherError).NotTo(HaveOccurred())
+
+			Expect(otherDebrider).NotTo(BeIdenticalTo(firstDebrider))
+			Expect(fakeServer.loginsCount).To(Equal(1))
+			Expect(otherServer.loginsCount).To(Equal(1))
+		})
+	})
+
+	Context("with a persisted session", func() {
+		It("should not log in again", func() {
+			firstPool, _ := NewSessionPool(sessionsPath)
+			firstPool.Debrider("AllDebrid", fakeServer.authInfos())
+
+			secondPool, poolError := NewSessionPool(sessionsPath)
+			Expect(poolError).NotTo(HaveOccurred())
+
+			debrider, debriderError := secondPool.Debrider("AllDebrid", fakeServer.authInfos())
+			Expect(debriderError).NotTo(HaveOccurred())
+
+			debridedLink, debridError := debrider.Debrid("http://rapidgator.net/file/file.mkv", nil)
+
+			Expect(debridError).NotTo(HaveOccurred())
+			Expect(debridedLink).To(Equal("https://subdomain.alld.io/dl/ABC/file.mkv"))
+			Expect(fakeServer.loginsCount).To(Equal(1))
+		})
+	})
+
+	Context("with an expired session", func() {
+		It("should log in again and retry", func() {
+			pool, _ := NewSessionPool(sessionsPath)
+			debrider, _ := pool.Debrider("AllDebrid", fakeServer.authInfos())
+
+			fakeServer.expireSession()
+
+			debridedLink, debridError := debrider.Debrid("http://rapidgator.net/file/file.mkv", nil)
+
+			Expect(debridError).NotTo(HaveOccurred())
+			Expect(debridedLink).To(Equal("https://subdomain.alld.io/dl/ABC/file.mkv"))
+			Expect(fakeServer.loginsCount).To(Equal(2))
+
+			By("Persisting the new session")
+			sessionsData, _ := ioutil.ReadFile(sessionsPath)
+			Expect(string(sessionsData)).To(ContainSubstring("session-2"))
+		})
+	})
+
+	Context("with an expired session and link infos", func() {
+		It("should log in again and give the link infos", func() {
+			pool, _ := NewSessionPool(sessionsPath)
+			debrider, _ := pool.Debrider("AllDebrid", fakeServer.authInfos())
+
+			fakeServer.expireSession()
+
+			link, linkError := debrider.(LinkDebrider).DebridLink("http://rapidgator.net/file/file.mkv", nil)
+
+			Expect(linkError).NotTo(HaveOccurred())
+			Expect(link.URI).To(Equal("https://subdomain.alld.io/dl/ABC/file.mkv"))
+			Expect(link.FileName).To(Equal("file.mkv"))
+			Expect(fakeServer.loginsCount).To(Equal(2))
+		})
+	})
+
+	Context("with an expired session and concurrent events", func() {
+		It("should debrid them all", func() {
+			pool, _ := NewSessionPool(sessionsPath)
+			debrider, _ := pool.Debrider("AllDebrid", fakeServer.authInfos())
+
+			fakeServer.expireSession()
+
+			debridErrors := make([]error, 5)
+
+			var waitGroup sync.WaitGroup
+			waitGroup.Add(len(debridErrors))
+
+			for eventIndex := range debridErrors {
+				go func(eventIndex int) {
+					defer waitGroup.Done()
+					_, debridErrors[eventIndex] = debrider.Debrid("http://rapidgator.net/file/file.mkv", nil)
+				}(eventIndex)
+			}
+
+			waitGroup.Wait()
+
+			Expect(debridErrors).To(Equal(make([]error, 5)))
+		})
+	})
+
+	Context("without a sessions path", func() {
+		It("should keep sessions in memory", func() {
+			pool, poolError := NewSessionPool("")
+			Expect(poolError).NotTo(HaveOccurred())
+
+			_, debriderError := pool.Debrider("AllDebrid", fakeServer.authInfos())
+
+			Expect(debriderError).NotTo(HaveOccurred())
+			Expect(sessionsPath).NotTo(BeAnExistingFile())
+		})
+	})
+
+	Context("with an invalid sessions file", func() {
+		It("should return an error", func() {
+			ioutil.WriteFile(sessionsPath, []byte("not json"), 0600)
+
+			_, poolError := NewSessionPool(sessionsPath)
+
+			Expect(poolError).To(HaveOccurred())
+			Expect(poolError.Error()).To(ContainSubstring("Invalid debrider sessions file"))
+		})
+	})
+})
+
+var _ = Describe("AllDebrid sessions", func() {
+	Context("when the session expired", func() {
+		It("should return ErrSessionExpired", func() {
+			fakeServer := newFakeAllDebrid()
+			defer fakeServer.server.Close()
+
+			allDebrid := &AllDebrid{}
+			allDebrid.Init()
+			allDebrid.Auth(fakeServer.authInfos())
+
+			fakeServer.expireSession()
+
+			_, debridError := allDebrid.Debrid("http://rapidgator.net/file/file.mkv", nil)
+
+			Expect(debridError).To(Equal(ErrSessionExpired))
+		})
+	})
+})
@@ -1,9 +1,13 @@
 package dispatcher
 
 import (
+	"regexp"
+	"sync"
+
 	"github.com/davidderus/christopher/config"
 	"github.com/davidderus/christopher/debrider"
 	"github.com/davidderus/christopher/downloader"
+	"github.com/davidderus/christopher/postprocess"
 	"github.com/davidderus/christopher/teller"
 )
 
@@ -24,9 +28,31 @@ type ChristopherStory struct {
 	withDebrider   bool
 	withDownloader bool
 
+	// withDeferral keeps the events deferred for lack of disk space
+	withDeferral bool
+
 	config *config.Config
 
 	teller *teller.Teller
+
+	// debriderSessions keeps debriders authenticated across events
+	debriderSessions      *debrider.SessionPool
+	debriderSessionsMutex sync.Mutex
+
+	// pools balance downloads across events
+	pools      *DownloaderPools
+	poolsMutex sync.Mutex
+
+	// ruleRegexes are the compiled regexes of the routing rules
+	ruleRegexes  []*regexp.Regexp
+	routingMutex sync.Mutex
+
+	// processors post-process the downloads by downloader instance id
+	processors map[string]*postprocess.Processor
+
+	// deferred are the events to play again
+	deferred      []*Event
+	deferredMutex sync.Mutex
 }
 
 const (
@@ -37,15 +63,24 @@ const (
 
 // Scenario is the main scenario of ChristopherStory
 func (cs *ChristopherStory) Scenario() *Scenario {
+	return cs.scenario(nil)
+}
+
+// scenario builds the story scenario
+//
+// If a batch is given, events ready to download are added to it instead of
+// being sent one by one to the downloader.
+func (cs *ChristopherStory) scenario(batch *downloadBatch) *Scenario {
 	var (
 		afterConfigStepName string
 		afterDebridStepName string
 		debriderConfig      *config.DebriderOptions
 		debriderInstance    debrider.Debrider
-		downloaderConfig    *config.DownloaderOptions
 		dlInstance          downloader.Downloader
 		err                 error
+		eventRoute          *route
 		isDebridable        bool
+		submitted           *submission
 	)
 
 	// By default we explicitly do nothing
@@ -68,11 +103,13 @@ func (cs *ChristopherStory) Scenario() *Scenario {
 		cs.teller.Log().Debugln("Enabling debrider")
 	}
 
-	scenario.From("config").To(afterConfigStepName).Do(func(_ *Event) error {
+	scenario.From("config").To(afterConfigStepName).Do(func(event *Event) error {
 		cs.teller.Log().Debugln("Loading config")
 
 		debriderConfig = &cs.config.Debrider
-		downloaderConfig = &cs.config.Downloader
+
+		// Keeping the event as submitted for routing
+		submitted = &submission{uri: event.Value, origin: event.Origin}
 
 		return nil
 	})
@@ -99,7 +136,16 @@ func (cs *ChristopherStory) Scenario() *Scenario {
 	})
 
 	scenario.From(debriderStep).To("debrided").Do(func(_ *Event) error {
-		debriderInstance, err = debrider.NewDebrider(debriderConfig.Name, debriderConfig.AuthInfos)
+		var sessions *debrider.SessionPool
+
+		// Sessions are shared by all the events played by the story
+		sessions, err = cs.sessionPool()
+		if err != nil {
+			cs.teller.Log().Errorln(err)
+			return err
+		}
+
+		debriderInstance, err = sessions.Debrider(debriderConfig.Name, debriderConfig.AuthInfos)
 		if err != nil {
 			cs.teller.Log().Errorln(err)
 			return err
@@ -113,7 +159,20 @@ func (cs *ChristopherStory) Scenario() *Scenario {
 	scenario.From("debrided").To(afterDebridStepName).Do(func(event *Event) error {
 		var debridedURI string
 
-		debridedURI, err = debriderInstance.Debrid(event.Value, nil)
+		// Keeping the file infos given by the debrider, if any
+		if linkDebrider, isLinkDebrider := debriderInstance.(debrider.LinkDebrider); isLinkDebrider {
+			var link *debrider.Link
+
+			link, err = linkDebrider.DebridLink(event.Value, nil)
+			if err == nil {
+				debridedURI = link.URI
+				event.FileName = link.FileName
+				event.Size = link.Size
+			}
+		} else {
+			debridedURI, err = debriderInstance.Debrid(event.Value, nil)
+		}
+
 		if err != nil {
 			cs.teller.Log().Errorln(err)
 			return err
@@ -131,8 +190,26 @@ func (cs *ChristopherStory) Scenario() *Scenario {
 		return nil
 	}).If(isDebridableFunc)
 
-	scenario.From(downloaderStep).To("downloading").Do(func(_ *Event) error {
-		dlInstance, err = downloader.NewDownloader(downloaderConfig.Name, downloaderConfig.AuthInfos)
+	scenario.From(downloaderStep).To("downloading").Do(func(event *Event) error {
+		eventRoute, err = cs.route(event, submitted)
+		if err != nil {
+			cs.teller.Log().Errorln(err)
+			return err
+		}
+
+		dlInstance, err = downloader.NewDownloader(eventRoute.downloaderConfig.Name, eventRoute.downloaderConfig.AuthInfos)
+		if err != nil {
+			cs.teller.Log().Errorln(err)
+			return err
+		}
+
+		// Shortages are already reported
+		eventRoute, dlInstance, err = cs.guardDiskSpace(event, submitted, eventRoute, dlInstance, batch)
+		if err != nil {
+			return err
+		}
+
+		err = cs.nameDownload(event, eventRoute)
 		if err != nil {
 			cs.teller.Log().Errorln(err)
 			return err
@@ -144,16 +221,22 @@ func (cs *ChristopherStory) Scenario() *Scenario {
 	scenario.From("downloading").To("notified").Do(func(event *Event) error {
 		var downloadID string
 
-		downloadID, err = dlInstance.Download(event.Value, downloaderConfig.DownloadOptions)
+		// Batched events are downloaded and notified by PlayBatch
+		if batch != nil {
+			batch.add(event, eventRoute, submitted)
+			return nil
+		}
+
+		downloadID, err = dlInstance.Download(event.Value, eventRoute.downloadOptions)
 		if err != nil {
 			cs.teller.Log().Errorln(err)
 			return err
 		}
 
 		cs.teller.LogWithFields(map[string]interface{}{
-			"downloadHandler": downloaderConfig.Name,
+			"downloadHandler": eventRoute.downloaderConfig.Name,
 			"downloadID":      downloadID,
-			"downloadOptions": downloaderConfig.DownloadOptions,
+			"downloadOptions": eventRoute.downloadOptions,
 			"downloadURI":     event.Value,
 		}).Infoln("Download started")
 
@@ -164,11 +247,9 @@ func (cs *ChristopherStory) Scenario() *Scenario {
 	})
 
 	// Ending current story with a notification
-	// NOTE notifierFunc must be set before scenario's play in order for the step
-	// to be run
-	if cs.notifierFunc != nil {
-		scenario.From("notified").Do(cs.notifierFunc)
-	}
+	scenario.From("notified").Do(func(event *Event) error {
+		return cs.notify(event, eventRoute, submitted)
+	}).If(func() bool { return batch == nil })
 
 	// Or ending with a print if no step are used
 	scenario.From("doNothing").Do(func(_ *Event) error {
@@ -178,6 +259,216 @@ func (cs *ChristopherStory) Scenario() *Scenario {
 	return scenario
 }
 
+// PlayBatch plays the story for several events at once
+//
+// Events are debrided concurrently, then all the events ready to download are
+// sent to the downloader in a single batch. Returned errors are indexed like
+// the given events.
+//
+// Events failing to be debrided or downloaded are played again with their
+// next mirror, if any.
+func (cs *ChristopherStory) PlayBatch(events []*Event) []error {
+	batch := &downloadBatch{}
+	playErrors := make([]error, len(events))
+
+	// Keeping the submission origins to play the mirrors
+	origins := make([]string, len(events))
+	for eventIndex, event := range events {
+		origins[eventIndex] = event.Origin
+	}
+
+	var waitGroup sync.WaitGroup
+	waitGroup.Add(len(events))
+
+	for eventIndex, event := range events {
+		go func(eventIndex int, event *Event) {
+			defer waitGroup.Done()
+
+			for {
+				// Scenarios are not meant to be shared between goroutines
+				scenario := cs.scenario(batch)
+				scenario.SetInitialStep("config")
+				scenario.Play(event)
+
+				playErrors[eventIndex] = scenario.RunError()
+
+				if !cs.nextMirror(event, origins[eventIndex], playErrors[eventIndex]) {
+					return
+				}
+			}
+		}(eventIndex, event)
+	}
+
+	waitGroup.Wait()
+
+	var retriedEvents []*Event
+	var retriedIndexes []int
+
+	// Keeping the submission order for the downloaders
+	for _, group := range batch.ordered(events) {
+		batchErrors := cs.downloadBatch(group.route, group.events, group.submissions)
+
+		for eventIndex, event := range events {
+			batchError, exists := batchErrors[event]
+			if !exists {
+				continue
+			}
+
+			playErrors[eventIndex] = batchError
+
+			if cs.nextMirror(event, origins[eventIndex], batchError) {
+				retriedEvents = append(retriedEvents, event)
+				retriedIndexes = append(retriedIndexes, eventIndex)
+			}
+		}
+	}
+
+	// Mirrors are played in a batch of their own
+	if len(retriedEvents) > 0 {
+		for retryIndex, retryError := range cs.PlayBatch(retriedEvents) {
+			playErrors[retriedIndexes[retryIndex]] = retryError
+		}
+	}
+
+	return playErrors
+}
+
+// nextMirror moves an event which failed to its next mirror, reporting if
+// there is one to play
+//
+// Disk space shortages are not related to the event URI, so they are not
+// worth another mirror.
+func (cs *ChristopherStory) nextMirror(event *Event, origin string, playError error) bool {
+	if playError == nil || len(event.Mirrors) == 0 {
+		return false
+	}
+
+	if _, isShortage := playError.(*DiskSpaceError); isShortage {
+		return false
+	}
+
+	cs.teller.LogWithFields(map[string]interface{}{
+		"failedURI": event.Value,
+		"mirrorURI": event.Mirrors[0],
+	}).Warnln("Trying the next mirror")
+
+	event.Value = event.Mirrors[0]
+	event.Mirrors = event.Mirrors[1:]
+	event.Origin = origin
+
+	// File infos were given by the debrider for the failed URI
+	event.FileName = ""
+	event.Size = 0
+
+	return true
+}
+
+// downloadBatch sends batched events sharing a route to their downloader
+// instance and notifies the started downloads
+func (cs *ChristopherStory) downloadBatch(eventRoute *route, events []*Event, submissions []*submission) map[*Event]error {
+	batchErrors := make(map[*Event]error)
+
+	failAll := func(batchError error) map[*Event]error {
+		cs.teller.Log().Errorln(batchError)
+		for _, event := range events {
+			batchErrors[event] = batchError
+		}
+		return batchErrors
+	}
+
+	downloaderConfig := eventRoute.downloaderConfig
+
+	uris := make([]string, len(events))
+	for eventIndex, event := range events {
+		uris[eventIndex] = event.Value
+	}
+
+	dlInstance, dlError := downloader.NewDownloader(downloaderConfig.Name, downloaderConfig.AuthInfos)
+	if dlError != nil {
+		return failAll(dlError)
+	}
+
+	results, batchError := dlInstance.DownloadBatch(uris, eventRoute.downloadOptions)
+	if batchError != nil {
+		return failAll(batchError)
+	}
+
+	for resultIndex, result := range results {
+		event := events[resultIndex]
+
+		if result.Error != nil {
+			cs.teller.LogWithFields(map[string]interface{}{
+				"downloadHandler": downloaderConfig.Name,
+				"downloadURI":     result.URI,
+			}).Errorln(result.Error)
+
+			batchErrors[event] = result.Error
+			continue
+		}
+
+		cs.teller.LogWithFields(map[string]interface{}{
+			"downloadHandler": downloaderConfig.Name,
+			"downloadID":      result.DownloadID,
+			"downloadOptions": eventRoute.downloadOptions,
+			"downloadURI":     result.URI,
+		}).Infoln("Download started")
+
+		event.Origin = downloaderStep
+		event.Value = result.DownloadID
+
+		notifierError := cs.notify(event, eventRoute, submissions[resultIndex])
+		if notifierError != nil {
+			batchErrors[event] = notifierError
+		}
+	}
+
+	return batchErrors
+}
+
+// notify hands a started download infos to the post-processor of its
+// downloader instance, then to the notifier
+func (cs *ChristopherStory) notify(event *Event, eventRoute *route, submitted *submission) error {
+	if processor, exists := cs.processors[eventRoute.downloaderID]; exists {
+		processor.Remember(event.Value, &postprocess.Origin{
+			Title:     event.Title,
+			Size:      event.Size,
+			Checksum:  event.Checksum,
+			URI:       submitted.uri,
+			Submitter: submitted.origin,
+			Feed:      event.Feed,
+			User:      event.User,
+		})
+	}
+
+	if cs.notifierFunc == nil {
+		return nil
+	}
+
+	return cs.notifierFunc(event)
+}
+
+// Redownload plays the story again for the origin of a download, returning
+// the id of the new download
+//
+// It is meant to be set as the Redownload of the post-processors.
+func (cs *ChristopherStory) Redownload(origin *postprocess.Origin) (string, error) {
+	event := &Event{
+		Value:    origin.URI,
+		Origin:   origin.Submitter,
+		User:     origin.User,
+		Feed:     origin.Feed,
+		Title:    origin.Title,
+		Checksum: origin.Checksum,
+	}
+
+	playError := cs.PlayBatch([]*Event{event})[0]
+	if playError != nil {
+		return "", playError
+	}
+
+	return event.Value, nil
+}
+
 // SetNotifier defines a nofier for the story
 func (cs *ChristopherStory) SetNotifier(notifierFunc func(event *Event) error) *ChristopherStory {
 	cs.notifierFunc = notifierFunc
@@ -196,9 +487,66 @@ func (cs *ChristopherStory) EnableDownloader() *ChristopherStory {
 	return cs
 }
 
+// EnableDeferral keeps the events deferred for lack of disk space, to be
+// played again once taken from Deferred
+//
+// Without deferral, such events are rejected.
+func (cs *ChristopherStory) EnableDeferral() *ChristopherStory {
+	cs.withDeferral = true
+	return cs
+}
+
 // SetConfig sets a given config instead of the default one
 func (cs *ChristopherStory) SetConfig(config *config.Config) *ChristopherStory {
 	cs.config = config
+
+	cs.routingMutex.Lock()
+	cs.ruleRegexes = nil
+	cs.routingMutex.Unlock()
+
+	return cs
+}
+
+// SetDebriderSessions shares a debrider session pool with the story
+//
+// If none is set, a pool is loaded from the debrider config on first debrid.
+func (cs *ChristopherStory) SetDebriderSessions(sessions *debrider.SessionPool) *ChristopherStory {
+	cs.debriderSessionsMutex.Lock()
+	defer cs.debriderSessionsMutex.Unlock()
+
+	cs.debriderSessions = sessions
+	return cs
+}
+
+// sessionPool returns the debrider sessions shared by the story events
+func (cs *ChristopherStory) sessionPool() (*debrider.SessionPool, error) {
+	cs.debriderSessionsMutex.Lock()
+	defer cs.debriderSessionsMutex.Unlock()
+
+	if cs.debriderSessions == nil {
+		sessions, sessionsError := debrider.NewSessionPool(cs.config.Debrider.SessionsPath)
+		if sessionsError != nil {
+			return nil, sessionsError
+		}
+
+		cs.debriderSessions = sessions
+	}
+
+	return cs.debriderSessions, nil
+}
+
+// SetDownloaderPools shares some downloader pools with the story
+//
+// If none are set, pools are loaded from the config on first use.
+func (cs *ChristopherStory) SetDownloaderPools(pools *DownloaderPools) *ChristopherStory {
+	cs.pools = pools
+	return cs
+}
+
+// SetProcessors shares the post-processors of the downloader instances, by
+// id, so they know the infos of the downloads they process
+func (cs *ChristopherStory) SetProcessors(processors map[string]*postprocess.Processor) *ChristopherStory {
+	cs.processors = processors
 	return cs
 }
 
@@ -207,3 +555,65 @@ func (cs *ChristopherStory) SetTeller(teller *teller.Teller) *ChristopherStory {
 	cs.teller = teller
 	return cs
 }
+
+// downloadBatch collects events ready to be downloaded, with the route
+// chosen for each of them and their submission
+type downloadBatch struct {
+	mutex       sync.Mutex
+	routes      map[*Event]*route
+	submissions map[*Event]*submission
+
+	// Disk space reserved by the events let through the disk space guard
+	spaceMutex   sync.Mutex
+	reservations map[*Event]spaceReservation
+}
+
+// batchGroup is a set of batched events sharing the same route, with their
+// submissions
+type batchGroup struct {
+	route       *route
+	events      []*Event
+	submissions []*submission
+}
+
+func (db *downloadBatch) add(event *Event, eventRoute *route, submitted *submission) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if db.routes == nil {
+		db.routes = make(map[*Event]*route)
+		db.submissions = make(map[*Event]*submission)
+	}
+
+	db.routes[event] = eventRoute
+	db.submissions[event] = submitted
+}
+
+// ordered returns the batched events grouped by route, sorted like the given
+// events
+func (db *downloadBatch) ordered(events []*Event) []*batchGroup {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	var groups []*batchGroup
+	groupsByKey := make(map[string]*batchGroup)
+
+	for _, event := range events {
+		eventRoute, batched := db.routes[event]
+		if !batched {
+			continue
+		}
+
+		group, exists := groupsByKey[eventRoute.key()]
+		if !exists {
+			group = &batchGroup{route: eventRoute}
+			groupsByKey[eventRoute.key()] = group
+			groups = append(groups, group)
+		}
+
+		group.events = append(group.events, event)
+		group.submissions = append(group.submissions, db.submissions[event])
+	}
+
+	return groups
+}
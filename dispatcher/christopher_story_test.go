@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 
 	"github.com/davidderus/christopher/config"
 	. "github.com/davidderus/christopher/dispatcher"
@@ -33,11 +36,16 @@ var _ = Describe("ChristopherStory", func() {
 	var appConfig *config.Config
 	var defaultHTTPTransport http.RoundTripper
 	var tellerInstance *teller.Teller
+	var sessionsDir string
 
 	BeforeEach(func() {
 		defaultHTTPTransport = http.DefaultTransport
 		appConfig, _ = config.LoadFromFile(validConfigSampleFile)
 
+		// Keeping debrider sessions away from the user config
+		sessionsDir, _ = ioutil.TempDir("", "christopher-sessions")
+		appConfig.Debrider.SessionsPath = filepath.Join(sessionsDir, "sessions.json")
+
 		// Getting logger
 		tellerInstance = teller.NewTeller("debug", "text")
 		tellerInstance.SetLogOutput(ioutil.Discard)
@@ -47,6 +55,7 @@ var _ = Describe("ChristopherStory", func() {
 	// the test suite
 	AfterEach(func() {
 		http.DefaultTransport = defaultHTTPTransport
+		os.RemoveAll(sessionsDir)
 	})
 
 	Context("with Downloader", func() {
@@ -129,6 +138,59 @@ var _ = Describe("ChristopherStory", func() {
 			})
 		})
 
+		Context("with a magnet link", func() {
+			It("should route it to the torrents downloader", func() {
+				transmissionServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					fmt.Fprint(w, `{"result":"success","arguments":{"torrent-added":{"hashString":"a1b2c3"}}}`)
+				}))
+				defer transmissionServer.Close()
+
+				appConfig.Downloaders["torrents"].AuthInfos["rpc_url"] = transmissionServer.URL
+
+				event := &Event{Origin: "test", Value: "magnet:?xt=urn:btih:a1b2c3"}
+
+				story = &ChristopherStory{}
+				story.SetConfig(appConfig).EnableDownloader()
+				story.SetTeller(tellerInstance)
+
+				scenario := story.Scenario()
+				scenario.SetInitialStep("config")
+				scenario.Play(event)
+
+				Expect(scenario.RunError()).To(BeNil())
+				Expect(event.Value).To(Equal("a1b2c3"))
+				Expect(event.Origin).To(Equal("downloader"))
+			})
+		})
+
+		Context("with an NZB link", func() {
+			It("should route it to the usenet downloader", func() {
+				nzbgetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					fmt.Fprint(w, `{"version":"1.1","result":12}`)
+				}))
+				defer nzbgetServer.Close()
+
+				appConfig.Downloaders["usenet"] = &config.DownloaderOptions{
+					Name:      "nzbget",
+					AuthInfos: map[string]interface{}{"rpc_url": nzbgetServer.URL + "/jsonrpc"},
+				}
+
+				event := &Event{Origin: "test", Value: "https://indexer.org/nzb/Zombie.One.S01E01.nzb"}
+
+				story = &ChristopherStory{}
+				story.SetConfig(appConfig).EnableDownloader()
+				story.SetTeller(tellerInstance)
+
+				scenario := story.Scenario()
+				scenario.SetInitialStep("config")
+				scenario.Play(event)
+
+				Expect(scenario.RunError()).To(BeNil())
+				Expect(event.Value).To(Equal("12"))
+				Expect(event.Origin).To(Equal("downloader"))
+			})
+		})
+
 		Context("reusing the same story for multiple events", func() {
 			It("should work", func() {
 				story = &ChristopherStory{}
@@ -174,6 +236,74 @@ var _ = Describe("ChristopherStory", func() {
 		})
 	})
 
+	Context("with a batch of events", func() {
+		It("should download them all at once", func() {
+			testRecorder := getRecorder("batch_downloader")
+			http.DefaultTransport = testRecorder
+
+			events := []*Event{
+				{Origin: "test", Value: "http://google.fr"},
+				{Origin: "test", Value: "http://google.com"},
+			}
+
+			notifiedCount := 0
+
+			story = &ChristopherStory{}
+			story.SetConfig(appConfig).EnableDownloader()
+			story.SetTeller(tellerInstance)
+			story.SetNotifier(func(_ *Event) error {
+				notifiedCount++
+				return nil
+			})
+
+			playErrors := story.PlayBatch(events)
+
+			testRecorder.Stop()
+
+			Expect(playErrors).To(Equal([]error{nil, nil}))
+
+			Expect(events[0].Value).To(Equal("96676fbc46cbbc04"))
+			Expect(events[0].Origin).To(Equal("downloader"))
+			Expect(events[1].Value).To(Equal("002eda8439d70942"))
+			Expect(events[1].Origin).To(Equal("downloader"))
+
+			Expect(notifiedCount).To(Equal(2))
+		})
+
+		It("should fall back to the next mirror of the failing events", func() {
+			aria2 := newStubAria2()
+			defer aria2.server.Close()
+
+			aria2.failingHost = "dead.example.com"
+			appConfig.Downloader.AuthInfos["rpc_url"] = aria2.server.URL + "/jsonrpc"
+			appConfig.Routing.Rules = nil
+
+			events := []*Event{
+				{Origin: "feed-watcher", Value: "http://dead.example.com/Zombie.One.part1.rar", Mirrors: []string{"http://dead.example.com/mirror/Zombie.One.part1.rar", "http://uploaded.net/Zombie.One.part1.rar"}},
+				{Origin: "feed-watcher", Value: "http://rapidgator.net/Zombie.One.part2.rar", Mirrors: []string{"http://uploaded.net/Zombie.One.part2.rar"}},
+				{Origin: "feed-watcher", Value: "http://dead.example.com/HTGAWM.mkv"},
+			}
+
+			story = &ChristopherStory{}
+			story.SetConfig(appConfig).EnableDownloader()
+			story.SetTeller(tellerInstance)
+
+			playErrors := story.PlayBatch(events)
+
+			Expect(playErrors[0]).NotTo(HaveOccurred())
+			Expect(playErrors[1]).NotTo(HaveOccurred())
+			Expect(playErrors[2]).To(MatchError("Host unreachable"))
+
+			Expect(aria2.optionsByURI).To(HaveLen(2))
+			Expect(aria2.optionsByURI).To(HaveKey("http://uploaded.net/Zombie.One.part1.rar"))
+			Expect(aria2.optionsByURI).To(HaveKey("http://rapidgator.net/Zombie.One.part2.rar"))
+
+			Expect(events[0].Origin).To(Equal("downloader"))
+			Expect(events[0].Mirrors).To(BeEmpty())
+			Expect(events[1].Mirrors).To(HaveLen(1))
+		})
+	})
+
 	Context("without Downloader and Debrider", func() {
 		It("should do nothing", func() {
 			event := &Event{Origin: "test", Value: "http://google.fr"}
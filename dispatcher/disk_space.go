@@ -0,0 +1,262 @@
+package dispatcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/davidderus/christopher/config"
+	"github.com/davidderus/christopher/downloader"
+)
+
+// megabyte is the unit of the disk space reserve
+const megabyte = 1024 * 1024
+
+// DiskSpaceError reports a downloader without enough free space for an event
+type DiskSpaceError struct {
+	DownloaderID string
+	FreeSpace    int64 // Free space of the downloader in bytes
+	NeededSpace  int64 // File size and reserve in bytes
+
+	// Deferred indicates that the event is played again at the next feed
+	// watcher scan
+	Deferred bool
+}
+
+func (dse *DiskSpaceError) Error() string {
+	message := fmt.Sprintf("Not enough disk space on downloader %s: %d MB free, %d MB needed",
+		dse.DownloaderID, dse.FreeSpace/megabyte, dse.NeededSpace/megabyte)
+
+	if dse.Deferred {
+		message += ", download deferred"
+	}
+
+	return message
+}
+
+// guardDiskSpace checks the free space of the route downloader before an
+// event is downloaded
+//
+// On shortage, the event is deferred, rerouted to the fallback downloader or
+// rejected. The route and downloader to use are returned. Within a batch, the
+// space reserved by the other events is not counted as free.
+func (cs *ChristopherStory) guardDiskSpace(event *Event, submitted *submission, eventRoute *route, dlInstance downloader.Downloader, batch *downloadBatch) (*route, downloader.Downloader, error) {
+	diskSpaceConfig := cs.config.DiskSpace
+
+	if !diskSpaceConfig.Enabled {
+		return eventRoute, dlInstance, nil
+	}
+
+	shortage := cs.checkDiskSpace(event, eventRoute, dlInstance, batch)
+	if shortage == nil {
+		return eventRoute, dlInstance, nil
+	}
+
+	switch diskSpaceConfig.OnShortage {
+	case config.ShortageReroute:
+		fallbackRoute, fallbackError := cs.resolveRoute(&route{downloaderID: diskSpaceConfig.Fallback, ruleIndex: -1}, nil, event, submitted)
+		if fallbackError != nil || fallbackRoute.downloaderID == eventRoute.downloaderID {
+			break
+		}
+
+		fallbackInstance, dlError := downloader.NewDownloader(fallbackRoute.downloaderConfig.Name, fallbackRoute.downloaderConfig.AuthInfos)
+		if dlError != nil {
+			break
+		}
+
+		fallbackShortage := cs.checkDiskSpace(event, fallbackRoute, fallbackInstance, batch)
+		if fallbackShortage == nil {
+			cs.teller.LogWithFields(map[string]interface{}{
+				"downloaderID": eventRoute.downloaderID,
+				"fallbackID":   fallbackRoute.downloaderID,
+				"downloadURI":  event.Value,
+			}).Warnln("Not enough disk space, download rerouted")
+
+			return fallbackRoute, fallbackInstance, nil
+		}
+
+		shortage = fallbackShortage
+	case config.ShortageDefer:
+		if cs.withDeferral {
+			cs.deferEvent(event, submitted)
+			shortage.Deferred = true
+		}
+	}
+
+	cs.teller.LogWithFields(map[string]interface{}{
+		"downloaderID": shortage.DownloaderID,
+		"downloadURI":  event.Value,
+		"freeSpace":    shortage.FreeSpace,
+		"neededSpace":  shortage.NeededSpace,
+	}).Warnln(shortage)
+
+	return nil, nil, shortage
+}
+
+// checkDiskSpace returns a shortage if the route downloader has not enough
+// free space for the event file and the reserve
+//
+// Events are let through if the free space is unknown. Within a batch, the
+// event file size is reserved on the route once let through, and released on
+// shortage.
+func (cs *ChristopherStory) checkDiskSpace(event *Event, eventRoute *route, dlInstance downloader.Downloader, batch *downloadBatch) *DiskSpaceError {
+	spaceKey := eventRoute.spaceKey()
+
+	// Checking and reserving at once, events being played concurrently
+	if batch != nil {
+		batch.spaceMutex.Lock()
+		defer batch.spaceMutex.Unlock()
+	}
+
+	freeSpace, spaceError := routeFreeSpace(eventRoute, dlInstance)
+	if spaceError != nil {
+		cs.teller.LogWithFields(map[string]interface{}{
+			"downloaderID": eventRoute.downloaderID,
+		}).Warnln("Free disk space unknown:", spaceError)
+
+		return nil
+	}
+
+	if batch != nil {
+		freeSpace -= batch.reservedSpace(spaceKey, event)
+	}
+
+	neededSpace := event.Size + cs.config.DiskSpace.Reserve*megabyte
+	if freeSpace >= neededSpace {
+		if batch != nil {
+			batch.reserveSpace(spaceKey, event)
+		}
+
+		return nil
+	}
+
+	if batch != nil {
+		delete(batch.reservations, event)
+	}
+
+	return &DiskSpaceError{DownloaderID: eventRoute.downloaderID, FreeSpace: freeSpace, NeededSpace: neededSpace}
+}
+
+// spaceKey identifies the disk space a route downloads to
+func (r *route) spaceKey() string {
+	dir, _ := r.downloadOptions["dir"].(string)
+	return r.downloaderID + "#" + dir
+}
+
+// routeFreeSpace returns the free space where a route downloads its files
+//
+// Downloaders reporting their free space are trusted, unless checked locally
+// with a "dir" download option. Others are checked locally, in their "dir"
+// download option or their default download dir, if running on this host.
+func routeFreeSpace(eventRoute *route, dlInstance downloader.Downloader) (int64, error) {
+	dir, _ := eventRoute.downloadOptions["dir"].(string)
+	dirReporter, isDirReporter := dlInstance.(downloader.DirReporter)
+
+	if reporter, isReporter := dlInstance.(downloader.SpaceReporter); isReporter && (dir == "" || !isDirReporter) {
+		return reporter.FreeSpace()
+	}
+
+	if isDirReporter && !dirReporter.IsLocal() {
+		return 0, fmt.Errorf("Downloader %s is not running on this host", eventRoute.downloaderID)
+	}
+
+	if dir == "" {
+		if !isDirReporter {
+			return 0, fmt.Errorf("Downloader %s has no download dir", eventRoute.downloaderID)
+		}
+
+		var dirError error
+
+		dir, dirError = dirReporter.DownloadDir()
+		if dirError != nil {
+			return 0, dirError
+		}
+	}
+
+	localDir := existingParent(dir)
+	if localDir == "" {
+		return 0, fmt.Errorf("Download dir %s is not reachable", dir)
+	}
+
+	return downloader.FreeDiskSpace(localDir)
+}
+
+// existingParent returns the closest existing dir of a path, as templated
+// download dirs are only created once downloading
+//
+// The root dir does not count, the path probably being the one of a remote
+// downloader.
+func existingParent(dir string) string {
+	dir = filepath.Clean(dir)
+
+	for {
+		parentDir := filepath.Dir(dir)
+		if parentDir == dir {
+			return ""
+		}
+
+		if _, statError := os.Stat(dir); statError == nil {
+			return dir
+		}
+
+		dir = parentDir
+	}
+}
+
+// spaceReservation is the disk space taken by a batched event
+type spaceReservation struct {
+	spaceKey string
+	size     int64
+}
+
+// reservedSpace returns the space reserved under a key by the batched events
+// other than the given one
+//
+// spaceMutex must be held.
+func (db *downloadBatch) reservedSpace(spaceKey string, event *Event) int64 {
+	var reserved int64
+
+	for reservedEvent, reservation := range db.reservations {
+		if reservedEvent != event && reservation.spaceKey == spaceKey {
+			reserved += reservation.size
+		}
+	}
+
+	return reserved
+}
+
+// reserveSpace reserves the event file size under a key, replacing any
+// reservation made for a previous mirror of the event
+//
+// spaceMutex must be held.
+func (db *downloadBatch) reserveSpace(spaceKey string, event *Event) {
+	if db.reservations == nil {
+		db.reservations = make(map[*Event]spaceReservation)
+	}
+
+	db.reservations[event] = spaceReservation{spaceKey: spaceKey, size: event.Size}
+}
+
+// deferEvent keeps an event as submitted to play it again later
+func (cs *ChristopherStory) deferEvent(event *Event, submitted *submission) {
+	deferredEvent := *event
+	deferredEvent.Value = submitted.uri
+	deferredEvent.Origin = submitted.origin
+
+	cs.deferredMutex.Lock()
+	defer cs.deferredMutex.Unlock()
+
+	cs.deferred = append(cs.deferred, &deferredEvent)
+}
+
+// Deferred returns the events put aside since the last call, to be played
+// again
+func (cs *ChristopherStory) Deferred() []*Event {
+	cs.deferredMutex.Lock()
+	defer cs.deferredMutex.Unlock()
+
+	deferred := cs.deferred
+	cs.deferred = nil
+
+	return deferred
+}
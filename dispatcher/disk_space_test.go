@@ -0,0 +1,173 @@
+package dispatcher_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/davidderus/christopher/config"
+	. "github.com/davidderus/christopher/dispatcher"
+	"github.com/davidderus/christopher/downloader"
+	"github.com/davidderus/christopher/teller"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ChristopherStory disk space guard", func() {
+	var appConfig *config.Config
+	var tellerInstance *teller.Teller
+	var aria2 *stubAria2
+	var story *ChristopherStory
+
+	playEvent := func(event *Event) error {
+		scenario := story.Scenario()
+		scenario.SetInitialStep("config")
+		scenario.Play(event)
+
+		return scenario.RunError()
+	}
+
+	BeforeEach(func() {
+		appConfig, _ = config.LoadFromFile(validConfigSampleFile)
+		appConfig.Routing.Rules = nil
+
+		aria2 = newStubAria2()
+		aria2.dir, _ = ioutil.TempDir("", "christopher-disk-space")
+		appConfig.Downloader.AuthInfos["rpc_url"] = aria2.server.URL + "/jsonrpc"
+
+		// No disk is that large
+		appConfig.DiskSpace = config.DiskSpaceOptions{
+			Enabled:    true,
+			Reserve:    1 << 40,
+			OnShortage: config.ShortageReject,
+		}
+
+		tellerInstance = teller.NewTeller("debug", "text")
+		tellerInstance.SetLogOutput(ioutil.Discard)
+
+		story = &ChristopherStory{}
+		story.SetConfig(appConfig).EnableDownloader()
+		story.SetTeller(tellerInstance)
+	})
+
+	AfterEach(func() {
+		aria2.server.Close()
+		os.RemoveAll(aria2.dir)
+	})
+
+	It("should download if there is enough space", func() {
+		appConfig.DiskSpace.Reserve = 0
+
+		Expect(playEvent(&Event{Origin: "cli", Value: "http://google.fr/Zombie.One.mkv", Size: 1024})).To(Succeed())
+		Expect(aria2.methods).To(Equal([]string{"aria2.getGlobalOption", "aria2.addUri"}))
+	})
+
+	It("should count the space taken by the other events of a batch", func() {
+		appConfig.DiskSpace.Reserve = 0
+
+		freeSpace, spaceError := downloader.FreeDiskSpace(aria2.dir)
+		Expect(spaceError).NotTo(HaveOccurred())
+
+		// Each file fits alone, but not both
+		playErrors := story.PlayBatch([]*Event{
+			{Origin: "cli", Value: "http://google.fr/Zombie.One.S01E01.mkv", Size: freeSpace * 2 / 3},
+			{Origin: "cli", Value: "http://google.fr/Zombie.One.S01E02.mkv", Size: freeSpace * 2 / 3},
+		})
+
+		Expect(playErrors).To(ContainElement(BeNil()))
+		Expect(playErrors).To(ContainElement(BeAssignableToTypeOf(&DiskSpaceError{})))
+		Expect(aria2.optionsByURI).To(HaveLen(1))
+	})
+
+	It("should check the dir download option", func() {
+		appConfig.Downloader.DownloadOptions = map[string]interface{}{"dir": aria2.dir + "/{{.Show}}"}
+
+		shortage, isShortage := playEvent(&Event{Origin: "cli", Value: "http://google.fr/Zombie.One.S01E01.mkv"}).(*DiskSpaceError)
+
+		Expect(isShortage).To(BeTrue())
+		Expect(aria2.methods).To(BeEmpty())
+		Expect(shortage.DownloaderID).To(Equal(config.DefaultDownloader))
+	})
+
+	It("should let the events through if the free space is unknown", func() {
+		aria2.dir = "/christopher/nowhere"
+
+		Expect(playEvent(&Event{Origin: "cli", Value: "http://google.fr/Zombie.One.mkv"})).To(Succeed())
+	})
+
+	Context("on reject", func() {
+		It("should return a clear error", func() {
+			playError := playEvent(&Event{Origin: "cli", Value: "http://google.fr/Zombie.One.mkv"})
+
+			Expect(playError).To(HaveOccurred())
+			Expect(playError.Error()).To(MatchRegexp(`^Not enough disk space on downloader default: \d+ MB free, 1099511627776 MB needed$`))
+			Expect(aria2.methods).NotTo(ContainElement("aria2.addUri"))
+			Expect(story.Deferred()).To(BeEmpty())
+		})
+	})
+
+	Context("on defer", func() {
+		BeforeEach(func() {
+			appConfig.DiskSpace.OnShortage = config.ShortageDefer
+		})
+
+		It("should keep the event as submitted", func() {
+			story.EnableDeferral()
+
+			playError := playEvent(&Event{Origin: "feed-watcher", Value: "http://google.fr/Zombie.One.mkv", Title: "Zombie One"})
+
+			Expect(playError.Error()).To(HaveSuffix(", download deferred"))
+			Expect(playError.(*DiskSpaceError).Deferred).To(BeTrue())
+
+			deferred := story.Deferred()
+			Expect(deferred).To(HaveLen(1))
+			Expect(deferred[0].Value).To(Equal("http://google.fr/Zombie.One.mkv"))
+			Expect(deferred[0].Origin).To(Equal("feed-watcher"))
+			Expect(deferred[0].Title).To(Equal("Zombie One"))
+			Expect(story.Deferred()).To(BeEmpty())
+		})
+
+		It("should reject the event without deferral", func() {
+			playError := playEvent(&Event{Origin: "cli", Value: "http://google.fr/Zombie.One.mkv"})
+
+			Expect(playError.(*DiskSpaceError).Deferred).To(BeFalse())
+			Expect(story.Deferred()).To(BeEmpty())
+		})
+	})
+
+	Context("on reroute", func() {
+		var mirror *stubAria2
+
+		BeforeEach(func() {
+			mirror = newStubAria2()
+
+			appConfig.Downloaders["mirror"] = &config.DownloaderOptions{
+				Name:      "aria2",
+				AuthInfos: map[string]interface{}{"rpc_url": mirror.server.URL + "/jsonrpc", "token": "mirror-token"},
+			}
+			appConfig.DiskSpace.OnShortage = config.ShortageReroute
+			appConfig.DiskSpace.Fallback = "mirror"
+		})
+
+		AfterEach(func() {
+			mirror.server.Close()
+		})
+
+		It("should download with the fallback downloader", func() {
+			// The mirror reports no dir, so its free space is unknown
+			Expect(playEvent(&Event{Origin: "cli", Value: "http://google.fr/Zombie.One.mkv"})).To(Succeed())
+
+			Expect(aria2.methods).NotTo(ContainElement("aria2.addUri"))
+			Expect(mirror.optionsByURI).To(HaveKey("http://google.fr/Zombie.One.mkv"))
+		})
+
+		It("should reject the event if the fallback lacks space too", func() {
+			mirror.dir = aria2.dir
+
+			playError := playEvent(&Event{Origin: "cli", Value: "http://google.fr/Zombie.One.mkv"})
+
+			Expect(playError.(*DiskSpaceError).DownloaderID).To(Equal("mirror"))
+			Expect(mirror.optionsByURI).To(BeEmpty())
+		})
+	})
+})
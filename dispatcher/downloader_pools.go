@@ -0,0 +1,71 @@
+package dispatcher
+
+import (
+	"sync"
+	"time"
+
+	"github.com/davidderus/christopher/config"
+	"github.com/davidderus/christopher/downloader"
+)
+
+// DownloaderPools keeps the downloader pools state across stories
+type DownloaderPools struct {
+	config *config.Config
+
+	mutex sync.Mutex
+	pools map[string]*downloader.Pool
+}
+
+// NewDownloaderPools returns the pools defined in a config
+func NewDownloaderPools(appConfig *config.Config) *DownloaderPools {
+	return &DownloaderPools{config: appConfig, pools: make(map[string]*downloader.Pool)}
+}
+
+// Select returns the downloader instance id to use for a download in a pool
+func (dp *DownloaderPools) Select(poolID string) (string, error) {
+	pool, poolError := dp.pool(poolID)
+	if poolError != nil {
+		return "", poolError
+	}
+
+	return pool.Select()
+}
+
+// pool returns a pool, creating it with its downloaders on first use
+func (dp *DownloaderPools) pool(poolID string) (*downloader.Pool, error) {
+	dp.mutex.Lock()
+	defer dp.mutex.Unlock()
+
+	if pool, exists := dp.pools[poolID]; exists {
+		return pool, nil
+	}
+
+	poolConfig := dp.config.Pools[poolID]
+
+	pool, poolError := downloader.NewPool(poolConfig.Strategy)
+	if poolError != nil {
+		return nil, poolError
+	}
+
+	if poolConfig.HealthCheckInterval > 0 {
+		pool.HealthCheckInterval = time.Duration(poolConfig.HealthCheckInterval) * time.Second
+	}
+
+	for _, downloaderID := range poolConfig.Downloaders {
+		downloaderConfig, configError := dp.config.DownloaderInstance(downloaderID)
+		if configError != nil {
+			return nil, configError
+		}
+
+		dlInstance, dlError := downloader.NewDownloader(downloaderConfig.Name, downloaderConfig.AuthInfos)
+		if dlError != nil {
+			return nil, dlError
+		}
+
+		pool.Add(downloaderID, dlInstance)
+	}
+
+	dp.pools[poolID] = pool
+
+	return pool, nil
+}
@@ -0,0 +1,221 @@
+package dispatcher
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/davidderus/christopher/config"
+	"github.com/davidderus/christopher/downloader"
+)
+
+// maxCollisionRenames is the number of names tried before giving up on
+// collisions
+const maxCollisionRenames = 1000
+
+// nameDownload sets the "out" download option of an HTTP download to the real
+// name of its file
+//
+// Names set by the download options are kept as is.
+func (cs *ChristopherStory) nameDownload(event *Event, eventRoute *route) error {
+	namingConfig := cs.config.Naming
+
+	if !namingConfig.Enabled {
+		return nil
+	}
+
+	if _, hasName := eventRoute.downloadOptions["out"]; hasName {
+		return nil
+	}
+
+	parsedURI, parseError := url.Parse(event.Value)
+	if parseError != nil || (parsedURI.Scheme != "http" && parsedURI.Scheme != "https") {
+		return nil
+	}
+
+	// Torrents and NZBs name their files themselves
+	if downloader.IsTorrent(event.Value) || downloader.IsNZB(event.Value) {
+		return nil
+	}
+
+	name := sanitizeFileName(discoverFileName(event, namingConfig.Timeout), &namingConfig)
+	if name == "" {
+		return nil
+	}
+
+	// Collisions are only detected if the download dir is reachable
+	dir, _ := eventRoute.downloadOptions["dir"].(string)
+	if dir != "" {
+		var collisionError error
+
+		name, collisionError = resolveCollision(dir, name, namingConfig.Collision)
+		if collisionError != nil {
+			return collisionError
+		}
+	}
+
+	eventRoute.downloadOptions = mergeOptions(eventRoute.downloadOptions, map[string]interface{}{"out": name})
+
+	return nil
+}
+
+// discoverFileName returns the best known name of the file of an event
+//
+// The name given by the debrider comes first, then the name given by the file
+// server, which is only asked without debrider name, and finally the feed
+// item title.
+func discoverFileName(event *Event, timeOut int) string {
+	if event.FileName != "" {
+		return event.FileName
+	}
+
+	if name := remoteFileName(event.Value, timeOut); name != "" {
+		return name
+	}
+
+	// A title is only usable with the extension of the file
+	if event.Title != "" {
+		extension := path.Ext(uriPath(event.Value))
+		if extension != "" && !strings.HasSuffix(strings.ToLower(event.Title), strings.ToLower(extension)) {
+			return event.Title + extension
+		}
+	}
+
+	return ""
+}
+
+// remoteFileName returns the name given by the Content-Disposition header of
+// the file server
+//
+// Servers refusing HEAD requests are asked for the first byte of the file.
+func remoteFileName(uri string, timeOut int) string {
+	client := &http.Client{Timeout: time.Duration(timeOut) * time.Second}
+
+	response, headError := client.Head(uri)
+	if headError == nil {
+		response.Body.Close()
+
+		if name := dispositionFileName(response); name != "" {
+			return name
+		}
+	}
+
+	request, requestError := http.NewRequest("GET", uri, nil)
+	if requestError != nil {
+		return ""
+	}
+	request.Header.Set("Range", "bytes=0-0")
+
+	response, getError := client.Do(request)
+	if getError != nil {
+		return ""
+	}
+	response.Body.Close()
+
+	return dispositionFileName(response)
+}
+
+// dispositionFileName returns the file name of a Content-Disposition header
+func dispositionFileName(response *http.Response) string {
+	if response.StatusCode >= http.StatusBadRequest {
+		return ""
+	}
+
+	_, dispositionParams, dispositionError := mime.ParseMediaType(response.Header.Get("Content-Disposition"))
+	if dispositionError != nil {
+		return ""
+	}
+
+	return dispositionParams["filename"]
+}
+
+// sanitizeFileName makes a name safe to use as a file name
+//
+// Invalid characters are replaced, control characters and leading dots are
+// removed and the name is shortened to the maximum length, keeping its
+// extension.
+func sanitizeFileName(name string, namingConfig *config.NamingOptions) string {
+	var sanitizedName bytes.Buffer
+
+	for _, character := range name {
+		switch {
+		case unicode.IsControl(character):
+		case character == '/' || strings.ContainsRune(namingConfig.InvalidCharacters, character):
+			sanitizedName.WriteString(namingConfig.Replacement)
+		default:
+			sanitizedName.WriteRune(character)
+		}
+	}
+
+	return shortenFileName(strings.TrimLeft(strings.TrimSpace(sanitizedName.String()), "."), namingConfig.MaxLength)
+}
+
+// shortenFileName truncates a name to a maximum length in bytes, keeping its
+// extension
+func shortenFileName(name string, maxLength int) string {
+	if maxLength <= 0 || len(name) <= maxLength {
+		return name
+	}
+
+	extension := filepath.Ext(name)
+	if len(extension) >= maxLength {
+		extension = ""
+	}
+
+	baseName := name[:len(name)-len(extension)]
+
+	baseLength := maxLength - len(extension)
+	if baseLength > len(baseName) {
+		baseLength = len(baseName)
+	}
+
+	// Not cutting a multi-byte character
+	for baseLength > 0 && !utf8.RuneStart(baseName[baseLength]) {
+		baseLength--
+	}
+
+	return baseName[:baseLength] + extension
+}
+
+// resolveCollision returns the name to use for a file in a dir according to
+// the collision mode
+func resolveCollision(dir, name, collision string) (string, error) {
+	if !fileExists(filepath.Join(dir, name)) {
+		return name, nil
+	}
+
+	switch collision {
+	case config.CollisionOverwrite:
+		return name, nil
+	case config.CollisionSkip:
+		return "", fmt.Errorf("File %s already exists in %s", name, dir)
+	}
+
+	extension := filepath.Ext(name)
+	baseName := strings.TrimSuffix(name, extension)
+
+	for renameIndex := 1; renameIndex <= maxCollisionRenames; renameIndex++ {
+		renamedName := fmt.Sprintf("%s (%d)%s", baseName, renameIndex, extension)
+
+		if !fileExists(filepath.Join(dir, renamedName)) {
+			return renamedName, nil
+		}
+	}
+
+	return "", fmt.Errorf("Too many files named like %s in %s", name, dir)
+}
+
+// fileExists indicates if a path exists
+func fileExists(filePath string) bool {
+	_, statError := os.Stat(filePath)
+	return statError == nil
+}
@@ -0,0 +1,171 @@
+package dispatcher_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/davidderus/christopher/config"
+	. "github.com/davidderus/christopher/dispatcher"
+	"github.com/davidderus/christopher/teller"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ChristopherStory naming", func() {
+	var appConfig *config.Config
+	var tellerInstance *teller.Teller
+	var aria2 *stubAria2
+	var fileServer *httptest.Server
+	var downloadDir string
+	var fileRequests int
+
+	playEvent := func(event *Event) error {
+		story := &ChristopherStory{}
+		story.SetConfig(appConfig).EnableDownloader()
+		story.SetTeller(tellerInstance)
+
+		scenario := story.Scenario()
+		scenario.SetInitialStep("config")
+		scenario.Play(event)
+
+		return scenario.RunError()
+	}
+
+	BeforeEach(func() {
+		appConfig, _ = config.LoadFromFile(validConfigSampleFile)
+		appConfig.Naming.Enabled = true
+
+		aria2 = newStubAria2()
+		appConfig.Downloader.AuthInfos["rpc_url"] = aria2.server.URL + "/jsonrpc"
+
+		downloadDir, _ = ioutil.TempDir("", "christopher-naming")
+		appConfig.Downloader.DownloadOptions = map[string]interface{}{"dir": downloadDir}
+
+		fileRequests = 0
+		fileServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fileRequests++
+
+			switch r.URL.Path {
+			case "/disposition/f4a2c1":
+				w.Header().Set("Content-Disposition", `attachment; filename="Zombie:One.S01E01.mkv"`)
+			case "/ranged/f4a2c1":
+				if r.Method == "HEAD" {
+					w.WriteHeader(http.StatusMethodNotAllowed)
+					return
+				}
+				w.Header().Set("Content-Disposition", `attachment; filename="Shark.Avocado.mkv"`)
+				w.WriteHeader(http.StatusPartialContent)
+			}
+		}))
+
+		tellerInstance = teller.NewTeller("debug", "text")
+		tellerInstance.SetLogOutput(ioutil.Discard)
+	})
+
+	AfterEach(func() {
+		aria2.server.Close()
+		fileServer.Close()
+		os.RemoveAll(downloadDir)
+	})
+
+	Context("with a Content-Disposition header", func() {
+		It("should use the sanitized server file name", func() {
+			uri := fileServer.URL + "/disposition/f4a2c1"
+
+			Expect(playEvent(&Event{Origin: "cli", Value: uri, Title: "Zombie.One"})).To(Succeed())
+			Expect(aria2.optionsByURI[uri]).To(HaveKeyWithValue("out", "Zombie_One.S01E01.mkv"))
+		})
+
+		It("should not ask the server with a debrider file name", func() {
+			uri := fileServer.URL + "/disposition/f4a2c1"
+
+			Expect(playEvent(&Event{Origin: "cli", Value: uri, FileName: "debrider.mkv"})).To(Succeed())
+			Expect(aria2.optionsByURI[uri]).To(HaveKeyWithValue("out", "debrider.mkv"))
+			Expect(fileRequests).To(BeZero())
+		})
+
+		It("should fall back to a ranged request", func() {
+			uri := fileServer.URL + "/ranged/f4a2c1"
+
+			Expect(playEvent(&Event{Origin: "cli", Value: uri})).To(Succeed())
+			Expect(aria2.optionsByURI[uri]).To(HaveKeyWithValue("out", "Shark.Avocado.mkv"))
+		})
+	})
+
+	Context("without Content-Disposition header", func() {
+		It("should use the debrider file name", func() {
+			uri := fileServer.URL + "/f4a2c1.mkv"
+
+			Expect(playEvent(&Event{Origin: "cli", Value: uri, FileName: "HTGAWM.mkv", Title: "How.To.Get.Away"})).To(Succeed())
+			Expect(aria2.optionsByURI[uri]).To(HaveKeyWithValue("out", "HTGAWM.mkv"))
+		})
+
+		It("should shorten a file name whose extension is too long", func() {
+			uri := fileServer.URL + "/f4a2c1.mkv"
+			appConfig.Naming.MaxLength = 255
+
+			Expect(playEvent(&Event{Origin: "cli", Value: uri, FileName: "a." + strings.Repeat("x", 300)})).To(Succeed())
+			Expect(aria2.optionsByURI[uri]).To(HaveKeyWithValue("out", "a."+strings.Repeat("x", 253)))
+		})
+
+		It("should use the feed item title and the URI extension", func() {
+			uri := fileServer.URL + "/f4a2c1.mkv"
+
+			Expect(playEvent(&Event{Origin: "feed-watcher", Value: uri, Title: "Zombie One S01E02 / 720p"})).To(Succeed())
+			Expect(aria2.optionsByURI[uri]).To(HaveKeyWithValue("out", "Zombie One S01E02 _ 720p.mkv"))
+		})
+
+		It("should not name unknown files", func() {
+			uri := fileServer.URL + "/f4a2c1"
+
+			Expect(playEvent(&Event{Origin: "cli", Value: uri})).To(Succeed())
+			Expect(aria2.optionsByURI[uri]).NotTo(HaveKey("out"))
+		})
+	})
+
+	Context("with an already existing file", func() {
+		BeforeEach(func() {
+			ioutil.WriteFile(filepath.Join(downloadDir, "HTGAWM.mkv"), []byte("Episode"), 0644)
+			ioutil.WriteFile(filepath.Join(downloadDir, "HTGAWM (1).mkv"), []byte("Episode"), 0644)
+		})
+
+		It("should rename the file by default", func() {
+			uri := fileServer.URL + "/f4a2c1.mkv"
+
+			Expect(playEvent(&Event{Origin: "cli", Value: uri, FileName: "HTGAWM.mkv"})).To(Succeed())
+			Expect(aria2.optionsByURI[uri]).To(HaveKeyWithValue("out", "HTGAWM (2).mkv"))
+		})
+
+		It("should keep the name when overwriting", func() {
+			appConfig.Naming.Collision = config.CollisionOverwrite
+			uri := fileServer.URL + "/f4a2c1.mkv"
+
+			Expect(playEvent(&Event{Origin: "cli", Value: uri, FileName: "HTGAWM.mkv"})).To(Succeed())
+			Expect(aria2.optionsByURI[uri]).To(HaveKeyWithValue("out", "HTGAWM.mkv"))
+		})
+
+		It("should refuse the download when skipping", func() {
+			appConfig.Naming.Collision = config.CollisionSkip
+			uri := fileServer.URL + "/f4a2c1.mkv"
+
+			playError := playEvent(&Event{Origin: "cli", Value: uri, FileName: "HTGAWM.mkv"})
+			Expect(playError.Error()).To(Equal("File HTGAWM.mkv already exists in " + downloadDir))
+			Expect(aria2.methods).To(BeEmpty())
+		})
+	})
+
+	Context("with a name in the download options", func() {
+		It("should keep it", func() {
+			appConfig.Downloader.DownloadOptions["out"] = "custom.mkv"
+			uri := fileServer.URL + "/disposition/f4a2c1"
+
+			Expect(playEvent(&Event{Origin: "cli", Value: uri})).To(Succeed())
+			Expect(aria2.optionsByURI[uri]).To(HaveKeyWithValue("out", "custom.mkv"))
+		})
+	})
+})
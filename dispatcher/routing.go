@@ -0,0 +1,283 @@
+package dispatcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/davidderus/christopher/config"
+	"github.com/davidderus/christopher/downloader"
+	"github.com/davidderus/christopher/release"
+)
+
+// route is the downloader instance and download options chosen for an event
+type route struct {
+	downloaderID     string
+	downloaderConfig *config.DownloaderOptions
+	downloadOptions  map[string]interface{}
+
+	// ruleIndex is the index of the matching routing rule, -1 if none
+	ruleIndex int
+}
+
+// key identifies the routes sharing a downloader and download options
+//
+// Templated options differ from an event to another, so the rendered options
+// are part of the key.
+func (r *route) key() string {
+	options, _ := json.Marshal(r.downloadOptions)
+	return fmt.Sprintf("%s#%d#%s", r.downloaderID, r.ruleIndex, options)
+}
+
+// submission is an event as it was submitted, before any debrid
+type submission struct {
+	uri    string
+	origin string
+}
+
+// route returns the downloader instance and download options of an event
+//
+// The first matching routing rule wins. Without matching rule, an uri goes to
+// the first downloader instance dedicated to its kind, or else to the routing
+// downloader. Pools are resolved to one of their downloader instances.
+func (cs *ChristopherStory) route(event *Event, submitted *submission) (*route, error) {
+	eventRoute := &route{downloaderID: config.DefaultDownloader, ruleIndex: -1}
+
+	var matchingRule *config.RoutingRule
+
+	ruleRegexes, regexError := cs.routingRegexes()
+	if regexError != nil {
+		return nil, regexError
+	}
+
+	for ruleIndex, rule := range cs.config.Routing.Rules {
+		if ruleMatches(rule, ruleRegexes[ruleIndex], event, submitted) {
+			matchingRule = rule
+			eventRoute.ruleIndex = ruleIndex
+			break
+		}
+	}
+
+	if matchingRule != nil {
+		if matchingRule.Downloader != "" {
+			eventRoute.downloaderID = matchingRule.Downloader
+		}
+	} else {
+		eventRoute.downloaderID = cs.routeDownloader(event.Value)
+	}
+
+	return cs.resolveRoute(eventRoute, matchingRule, event, submitted)
+}
+
+// resolveRoute sets the downloader config and the rendered download options
+// of a route, its pool being resolved to one of its downloader instances
+func (cs *ChristopherStory) resolveRoute(eventRoute *route, matchingRule *config.RoutingRule, event *Event, submitted *submission) (*route, error) {
+	if cs.config.IsPool(eventRoute.downloaderID) {
+		var selectError error
+
+		eventRoute.downloaderID, selectError = cs.downloaderPools().Select(eventRoute.downloaderID)
+		if selectError != nil {
+			return nil, selectError
+		}
+	}
+
+	downloaderConfig, configError := cs.config.DownloaderInstance(eventRoute.downloaderID)
+	if configError != nil {
+		return nil, configError
+	}
+
+	eventRoute.downloaderConfig = downloaderConfig
+	downloadOptions := downloaderConfig.DownloadOptions
+
+	if matchingRule != nil && len(matchingRule.DownloadOptions) > 0 {
+		downloadOptions = mergeOptions(downloaderConfig.DownloadOptions, matchingRule.DownloadOptions)
+	}
+
+	var renderError error
+
+	eventRoute.downloadOptions, renderError = config.RenderOptions(downloadOptions, optionFields(event, submitted, &cs.config.Naming))
+	if renderError != nil {
+		return nil, renderError
+	}
+
+	return eventRoute, nil
+}
+
+// optionFields returns the infos of an event used by download options
+// templates
+//
+// The texts coming from users and feeds are sanitized like file names, so
+// they can't escape the directories of the options.
+func optionFields(event *Event, submitted *submission, namingConfig *config.NamingOptions) *config.OptionFields {
+	fields := &config.OptionFields{
+		URI:    event.Value,
+		Origin: submitted.origin,
+		User:   sanitizeFileName(event.User, namingConfig),
+		Feed:   sanitizeFileName(event.Feed, namingConfig),
+		Title:  sanitizeFileName(event.Title, namingConfig),
+		Date:   time.Now(),
+	}
+
+	// The feed item title is the most reliable, debrided URIs come last
+	for _, name := range []string{event.Title, uriPath(submitted.uri), uriPath(event.Value)} {
+		parsedRelease := release.Parse(name)
+
+		if parsedRelease.IsEpisode() {
+			fields.Show = sanitizeFileName(parsedRelease.Show, namingConfig)
+			fields.Season = parsedRelease.Season
+			fields.Episode = parsedRelease.Episode
+			break
+		}
+	}
+
+	return fields
+}
+
+// uriPath returns the unescaped path of an uri
+func uriPath(uri string) string {
+	parsedURI, parseError := url.Parse(uri)
+	if parseError != nil {
+		return ""
+	}
+
+	return parsedURI.Path
+}
+
+// routeDownloader returns the downloader instance or pool for an uri
+//
+// Instances whose downloader is dedicated to this kind of uri come first,
+// the routing downloader handles everything else.
+func (cs *ChristopherStory) routeDownloader(uri string) string {
+	for _, downloaderID := range cs.config.DownloaderIDs() {
+		downloaderConfig := cs.config.Downloaders[downloaderID]
+
+		dlInstance, dlError := downloader.NewDownloader(downloaderConfig.Name, nil)
+		if dlError != nil {
+			continue
+		}
+
+		specialist, isSpecialist := dlInstance.(downloader.Specialist)
+		if isSpecialist && specialist.Handles(uri) {
+			return downloaderID
+		}
+	}
+
+	if cs.config.Routing.Downloader != "" {
+		return cs.config.Routing.Downloader
+	}
+
+	return config.DefaultDownloader
+}
+
+// downloaderPools returns the pools shared by the story events
+func (cs *ChristopherStory) downloaderPools() *DownloaderPools {
+	cs.poolsMutex.Lock()
+	defer cs.poolsMutex.Unlock()
+
+	if cs.pools == nil {
+		cs.pools = NewDownloaderPools(cs.config)
+	}
+
+	return cs.pools
+}
+
+// routingRegexes returns the compiled regexes of the routing rules, nil for
+// the rules without regex
+//
+// Regexes are compiled once, on first use.
+func (cs *ChristopherStory) routingRegexes() ([]*regexp.Regexp, error) {
+	cs.routingMutex.Lock()
+	defer cs.routingMutex.Unlock()
+
+	if cs.ruleRegexes != nil {
+		return cs.ruleRegexes, nil
+	}
+
+	ruleRegexes := make([]*regexp.Regexp, len(cs.config.Routing.Rules))
+
+	for ruleIndex, rule := range cs.config.Routing.Rules {
+		if rule.Regex == "" {
+			continue
+		}
+
+		var regexError error
+
+		ruleRegexes[ruleIndex], regexError = regexp.Compile(rule.Regex)
+		if regexError != nil {
+			return nil, fmt.Errorf("Routing rule %d has an invalid regex: %s", ruleIndex+1, regexError)
+		}
+	}
+
+	cs.ruleRegexes = ruleRegexes
+
+	return ruleRegexes, nil
+}
+
+// ruleMatches checks all the criteria of a rule against an event
+//
+// URI criteria match either the submitted URI or the debrided one.
+func ruleMatches(rule *config.RoutingRule, ruleRegex *regexp.Regexp, event *Event, submitted *submission) bool {
+	if rule.Origin != "" && rule.Origin != submitted.origin {
+		return false
+	}
+
+	if rule.User != "" && rule.User != event.User {
+		return false
+	}
+
+	if rule.Feed != "" && rule.Feed != event.Feed {
+		return false
+	}
+
+	return uriMatches(rule, ruleRegex, submitted.uri) || uriMatches(rule, ruleRegex, event.Value)
+}
+
+// uriMatches checks the host, regex and extension criteria of a rule
+func uriMatches(rule *config.RoutingRule, ruleRegex *regexp.Regexp, uri string) bool {
+	parsedURI, parseError := url.Parse(uri)
+	if parseError != nil {
+		return false
+	}
+
+	if rule.Host != "" {
+		host := strings.ToLower(parsedURI.Hostname())
+		ruleHost := strings.ToLower(rule.Host)
+
+		if host != ruleHost && !strings.HasSuffix(host, "."+ruleHost) {
+			return false
+		}
+	}
+
+	if rule.Extension != "" {
+		ruleExtension := "." + strings.TrimPrefix(rule.Extension, ".")
+
+		if !strings.EqualFold(path.Ext(parsedURI.Path), ruleExtension) {
+			return false
+		}
+	}
+
+	if ruleRegex != nil && !ruleRegex.MatchString(uri) {
+		return false
+	}
+
+	return true
+}
+
+// mergeOptions returns the base options overridden by some others
+func mergeOptions(baseOptions, overridingOptions map[string]interface{}) map[string]interface{} {
+	options := make(map[string]interface{}, len(baseOptions)+len(overridingOptions))
+
+	for optionName, optionValue := range baseOptions {
+		options[optionName] = optionValue
+	}
+
+	for optionName, optionValue := range overridingOptions {
+		options[optionName] = optionValue
+	}
+
+	return options
+}
@@ -0,0 +1,310 @@
+package dispatcher_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/davidderus/christopher/config"
+	. "github.com/davidderus/christopher/dispatcher"
+	"github.com/davidderus/christopher/postprocess"
+	"github.com/davidderus/christopher/teller"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// stubAria2 records the download options of the aria2 requests it receives
+type stubAria2 struct {
+	server *httptest.Server
+
+	mutex          sync.Mutex
+	methods        []string
+	optionsByURI   map[string]map[string]interface{}
+	downloadsCount int
+
+	// dir is the global download dir reported by the stub
+	dir string
+
+	// failingHost is a host whose downloads are refused in batches
+	failingHost string
+}
+
+func newStubAria2() *stubAria2 {
+	stub := &stubAria2{optionsByURI: make(map[string]map[string]interface{})}
+
+	stub.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID     uint64
+			Method string
+			Params []interface{}
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+
+		stub.mutex.Lock()
+		defer stub.mutex.Unlock()
+
+		stub.methods = append(stub.methods, request.Method)
+
+		var result interface{}
+
+		switch request.Method {
+		case "aria2.addUri":
+			result = stub.addURI(request.Params)
+		case "aria2.tellActive":
+			result = []interface{}{}
+		case "aria2.getGlobalOption":
+			result = map[string]string{"dir": stub.dir}
+		case "system.multicall":
+			var results []interface{}
+			for _, call := range request.Params[0].([]interface{}) {
+				params := call.(map[string]interface{})["params"].([]interface{})
+				if stub.failingHost != "" && strings.Contains(params[1].([]interface{})[0].(string), stub.failingHost) {
+					results = append(results, map[string]interface{}{"code": 1, "message": "Host unreachable"})
+					continue
+				}
+
+				results = append(results, []string{stub.addURI(params)})
+			}
+			result = results
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": request.ID, "result": result})
+	}))
+
+	return stub
+}
+
+// addURI records the options of an aria2.addUri call and returns a gid
+func (stub *stubAria2) addURI(params []interface{}) string {
+	uri := params[1].([]interface{})[0].(string)
+
+	options := map[string]interface{}{}
+	if len(params) > 2 {
+		options = params[2].(map[string]interface{})
+	}
+	stub.optionsByURI[uri] = options
+
+	stub.downloadsCount++
+	return fmt.Sprintf("%016d", stub.downloadsCount)
+}
+
+var _ = Describe("ChristopherStory routing", func() {
+	var appConfig *config.Config
+	var tellerInstance *teller.Teller
+	var aria2 *stubAria2
+
+	playEvent := func(event *Event) error {
+		story := &ChristopherStory{}
+		story.SetConfig(appConfig).EnableDownloader()
+		story.SetTeller(tellerInstance)
+
+		scenario := story.Scenario()
+		scenario.SetInitialStep("config")
+		scenario.Play(event)
+
+		return scenario.RunError()
+	}
+
+	BeforeEach(func() {
+		appConfig, _ = config.LoadFromFile(validConfigSampleFile)
+
+		aria2 = newStubAria2()
+		appConfig.Downloader.AuthInfos["rpc_url"] = aria2.server.URL + "/jsonrpc"
+		appConfig.Downloader.DownloadOptions = map[string]interface{}{"max-connection-per-server": "4"}
+
+		appConfig.Routing.Rules = []*config.RoutingRule{
+			{Feed: "Series", DownloadOptions: map[string]interface{}{"dir": "/media/series"}},
+			{Host: "google.fr", Origin: "cli", DownloadOptions: map[string]interface{}{"dir": "/media/google", "out": "google.html"}},
+			{Regex: `\.iso$`, Downloader: "torrents"},
+		}
+
+		tellerInstance = teller.NewTeller("debug", "text")
+		tellerInstance.SetLogOutput(ioutil.Discard)
+	})
+
+	AfterEach(func() {
+		aria2.server.Close()
+	})
+
+	Context("with a matching rule", func() {
+		It("should merge the rule download options", func() {
+			event := &Event{Origin: "feed-watcher", Value: "http://google.fr/Zombie.One.mkv", Feed: "Series"}
+
+			Expect(playEvent(event)).To(Succeed())
+
+			Expect(aria2.optionsByURI["http://google.fr/Zombie.One.mkv"]).To(Equal(map[string]interface{}{
+				"dir":                       "/media/series",
+				"max-connection-per-server": "4",
+			}))
+		})
+
+		It("should match subdomains and origin", func() {
+			event := &Event{Origin: "cli", Value: "http://www.google.fr/index.html"}
+
+			Expect(playEvent(event)).To(Succeed())
+
+			Expect(aria2.optionsByURI["http://www.google.fr/index.html"]).To(HaveKeyWithValue("out", "google.html"))
+		})
+
+		It("should use the rule downloader", func() {
+			transmissionServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"result":"success","arguments":{"torrent-added":{"hashString":"a1b2c3"}}}`)
+			}))
+			defer transmissionServer.Close()
+
+			appConfig.Downloaders["torrents"].AuthInfos["rpc_url"] = transmissionServer.URL
+
+			event := &Event{Origin: "cli", Value: "http://releases.org/distribution.iso"}
+
+			Expect(playEvent(event)).To(Succeed())
+
+			Expect(event.Value).To(Equal("a1b2c3"))
+			Expect(aria2.methods).To(BeEmpty())
+		})
+
+		It("should refuse an invalid rule regex", func() {
+			appConfig.Routing.Rules[2].Regex = `\.(iso$`
+
+			playError := playEvent(&Event{Origin: "cli", Value: "http://releases.org/distribution.iso"})
+
+			Expect(playError).To(MatchError(HavePrefix("Routing rule 3 has an invalid regex")))
+			Expect(aria2.methods).To(BeEmpty())
+		})
+	})
+
+	Context("with templated download options", func() {
+		It("should render the options with the event infos", func() {
+			appConfig.Routing.Rules[0].DownloadOptions = map[string]interface{}{
+				"dir": "/media/{{.Feed}}/{{.Show}}/Season {{printf \"%02d\" .Season}}",
+				"out": "{{.Origin}}-{{.Episode}}.mkv",
+			}
+
+			events := []*Event{
+				{Origin: "feed-watcher", Value: "http://google.com/f4a2c1.mkv", Feed: "Series", Title: "Zombie.One.S03E04.720p"},
+				{Origin: "feed-watcher", Value: "http://google.com/Shark.Avocado.1x02.mkv", Feed: "Series"},
+			}
+
+			story := &ChristopherStory{}
+			story.SetConfig(appConfig).EnableDownloader()
+			story.SetTeller(tellerInstance)
+
+			Expect(story.PlayBatch(events)).To(Equal([]error{nil, nil}))
+
+			Expect(aria2.optionsByURI["http://google.com/f4a2c1.mkv"]).To(HaveKeyWithValue("dir", "/media/Series/Zombie One/Season 03"))
+			Expect(aria2.optionsByURI["http://google.com/f4a2c1.mkv"]).To(HaveKeyWithValue("out", "feed-watcher-4.mkv"))
+			Expect(aria2.optionsByURI["http://google.com/Shark.Avocado.1x02.mkv"]).To(HaveKeyWithValue("dir", "/media/Series/Shark Avocado/Season 01"))
+		})
+
+		It("should not let the event infos escape the options dirs", func() {
+			appConfig.Routing.Rules[0].DownloadOptions = map[string]interface{}{
+				"dir": "/media/{{.Feed}}/{{.Title}}",
+			}
+
+			event := &Event{Origin: "feed-watcher", Value: "http://google.com/f4a2c1.mkv", Feed: "Series", Title: "../../etc/cron.d"}
+
+			story := &ChristopherStory{}
+			story.SetConfig(appConfig).EnableDownloader()
+			story.SetTeller(tellerInstance)
+
+			Expect(story.PlayBatch([]*Event{event})).To(Equal([]error{nil}))
+
+			Expect(aria2.optionsByURI["http://google.com/f4a2c1.mkv"]).To(HaveKeyWithValue("dir", "/media/Series/_.._etc_cron.d"))
+		})
+
+		It("should route a download again like its submission", func() {
+			story := &ChristopherStory{}
+			story.SetConfig(appConfig).EnableDownloader()
+			story.SetTeller(tellerInstance)
+
+			downloadID, redownloadError := story.Redownload(&postprocess.Origin{
+				URI:       "http://google.com/f4a2c1.mkv",
+				Submitter: "feed-watcher",
+				Feed:      "Series",
+				Title:     "Zombie.One.S03E04.720p",
+			})
+
+			Expect(redownloadError).NotTo(HaveOccurred())
+			Expect(downloadID).To(Equal("0000000000000001"))
+			Expect(aria2.optionsByURI["http://google.com/f4a2c1.mkv"]).To(HaveKeyWithValue("dir", "/media/series"))
+		})
+	})
+
+	Context("without matching rule", func() {
+		It("should use the downloader options", func() {
+			event := &Event{Origin: "feed-watcher", Value: "http://google.fr/Zombie.One.mkv"}
+
+			Expect(playEvent(event)).To(Succeed())
+
+			Expect(aria2.optionsByURI["http://google.fr/Zombie.One.mkv"]).To(Equal(map[string]interface{}{
+				"max-connection-per-server": "4",
+			}))
+		})
+	})
+
+	Context("with a downloader pool", func() {
+		var mirror *stubAria2
+
+		BeforeEach(func() {
+			mirror = newStubAria2()
+
+			appConfig.Downloaders["mirror"] = &config.DownloaderOptions{
+				Name:      "aria2",
+				AuthInfos: map[string]interface{}{"rpc_url": mirror.server.URL + "/jsonrpc", "token": "mirror-token"},
+			}
+			appConfig.Pools = map[string]*config.PoolOptions{
+				"mirrors": {Downloaders: []string{"default", "mirror"}},
+			}
+			appConfig.Routing.Downloader = "mirrors"
+		})
+
+		AfterEach(func() {
+			mirror.server.Close()
+		})
+
+		It("should balance downloads between the pool downloaders", func() {
+			pools := NewDownloaderPools(appConfig)
+
+			for _, uri := range []string{"http://google.com/first.mkv", "http://google.com/second.mkv", "http://google.com/third.mkv"} {
+				story := &ChristopherStory{}
+				story.SetConfig(appConfig).EnableDownloader()
+				story.SetTeller(tellerInstance)
+				story.SetDownloaderPools(pools)
+
+				scenario := story.Scenario()
+				scenario.SetInitialStep("config")
+				scenario.Play(&Event{Origin: "cli", Value: uri})
+
+				Expect(scenario.RunError()).NotTo(HaveOccurred())
+			}
+
+			Expect(aria2.optionsByURI).To(HaveKey("http://google.com/first.mkv"))
+			Expect(mirror.optionsByURI).To(HaveKey("http://google.com/second.mkv"))
+			Expect(aria2.optionsByURI).To(HaveKey("http://google.com/third.mkv"))
+		})
+	})
+
+	Context("with a batch of events", func() {
+		It("should send one batch per route", func() {
+			events := []*Event{
+				{Origin: "feed-watcher", Value: "http://google.com/Zombie.One.S01E01.mkv", Feed: "Series"},
+				{Origin: "feed-watcher", Value: "http://google.com/Shark.Avocado.mkv"},
+				{Origin: "feed-watcher", Value: "http://google.com/Zombie.One.S01E02.mkv", Feed: "Series"},
+			}
+
+			story := &ChristopherStory{}
+			story.SetConfig(appConfig).EnableDownloader()
+			story.SetTeller(tellerInstance)
+
+			Expect(story.PlayBatch(events)).To(Equal([]error{nil, nil, nil}))
+
+			Expect(aria2.methods).To(Equal([]string{"system.multicall", "system.multicall"}))
+			Expect(aria2.optionsByURI["http://google.com/Zombie.One.S01E02.mkv"]).To(HaveKeyWithValue("dir", "/media/series"))
+			Expect(aria2.optionsByURI["http://google.com/Shark.Avocado.mkv"]).NotTo(HaveKey("dir"))
+		})
+	})
+})
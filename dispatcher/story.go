@@ -4,6 +4,20 @@ package dispatcher
 type Event struct {
 	Value  string // A valid URI
 	Origin string // Previous handler (submitter, debrider, downloader…)
+
+	// Mirrors are some alternative URIs of Value, tried in turn when Value
+	// fails to be debrided or downloaded
+	Mirrors []string
+
+	// Optional infos about the URI submission, kept along the story
+	User  string // Webserver user having submitted the URI
+	Feed  string // Title of the feed the URI comes from
+	Title string // Title of the feed item the URI comes from
+
+	// Optional infos about the file, given by the debrider or the feed item
+	FileName string // Name of the file, blank if unknown
+	Size     int64  // Size of the file in bytes, 0 if unknown
+	Checksum string // Checksum such as "md5:d41d8cd9…", blank if unknown
 }
 
 // Story is the implementation of a scenario
@@ -11,3 +25,19 @@ type Story interface {
 	// Scenario defines the story scenario
 	Scenario() *Scenario
 }
+
+// BatchStory is a story able to play several events at once
+type BatchStory interface {
+	Story
+
+	// PlayBatch plays the story for all events and returns their errors
+	PlayBatch(events []*Event) []error
+}
+
+// DeferringStory is a story able to put some events aside to play them later
+type DeferringStory interface {
+	BatchStory
+
+	// Deferred returns the events put aside since the last call
+	Deferred() []*Event
+}
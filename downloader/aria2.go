@@ -2,9 +2,12 @@ package downloader
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"time"
 
 	// Instead of writing our own json2 support, we're using this one
@@ -22,6 +25,9 @@ type Aria2 struct {
 	// rpcURL is the full RPC URL to the aria2 JSON-RPC endpoint
 	rpcURL string
 
+	// wsURL is the aria2 WebSocket endpoint used to receive notifications
+	wsURL string
+
 	// timeOut is the maximum time for a request to take in seconds
 	timeOut time.Duration
 
@@ -32,6 +38,9 @@ type Aria2 struct {
 const (
 	// ariaDownloaderDefaulttimeOut is the default timeout for http requests in seconds
 	ariaDownloaderDefaulttimeOut = 10
+
+	// ariaListLimit is the maximum number of waiting or stopped downloads listed
+	ariaListLimit = 1000
 )
 
 // Auth initializes the Aria2
@@ -48,6 +57,18 @@ func (ad *Aria2) Auth(infos map[string]interface{}) error {
 		return errors.New("Invalid token")
 	}
 
+	// WebSocket URL defaults to the RPC URL with a ws scheme
+	wsURL, wsURLOkay := infos["ws_url"].(string)
+	if !wsURLOkay || wsURL == "" {
+		var wsURLError error
+
+		wsURL, wsURLError = webSocketURL(ad.rpcURL)
+		if wsURLError != nil {
+			return errors.New("Invalid RPC url")
+		}
+	}
+	ad.wsURL = wsURL
+
 	timeOut, timeOutOkay := infos["timeout"].(int)
 	if !timeOutOkay || timeOut == 0 {
 		timeOut = ariaDownloaderDefaulttimeOut
@@ -106,16 +127,179 @@ func (ad *Aria2) Download(uri string, options map[string]interface{}) (string, e
 	return gid, nil
 }
 
+// DownloadBatch starts the download of several uris in a single request
+// thanks to system.multicall
+func (ad *Aria2) DownloadBatch(uris []string, options map[string]interface{}) ([]*BatchResult, error) {
+	calls := make([]map[string]interface{}, len(uris))
+
+	for uriIndex, uri := range uris {
+		var params []interface{}
+
+		if options != nil {
+			params = ad.appendParams([]string{uri}, options)
+		} else {
+			params = ad.appendParams([]string{uri})
+		}
+
+		calls[uriIndex] = map[string]interface{}{
+			"methodName": "aria2.addUri",
+			"params":     params,
+		}
+	}
+
+	var responses []json.RawMessage
+
+	callError := ad.call("system.multicall", []interface{}{calls}, &responses)
+	if callError != nil {
+		return nil, callError
+	}
+
+	if len(responses) != len(uris) {
+		return nil, fmt.Errorf("Invalid multicall response: %d results for %d uris", len(responses), len(uris))
+	}
+
+	results := make([]*BatchResult, len(uris))
+
+	// Each response is either a one item array or a fault struct
+	for responseIndex, response := range responses {
+		result := &BatchResult{URI: uris[responseIndex]}
+
+		var gids []string
+		if json.Unmarshal(response, &gids) == nil && len(gids) == 1 {
+			result.DownloadID = gids[0]
+		} else {
+			var fault struct {
+				Code    int
+				Message string
+			}
+
+			json.Unmarshal(response, &fault)
+			result.Error = errors.New(fault.Message)
+		}
+
+		results[responseIndex] = result
+	}
+
+	return results, nil
+}
+
 // DownloadStatus returns some status infos about the download
-func (ad *Aria2) DownloadStatus(downloadID string) (map[string]interface{}, error) {
-	var status map[string]interface{}
+func (ad *Aria2) DownloadStatus(downloadID string) (*DownloadStatus, error) {
+	var status aria2Status
 
 	callError := ad.call("aria2.tellStatus", ad.appendParams(downloadID), &status)
 	if callError != nil {
 		return nil, callError
 	}
 
-	return status, nil
+	return status.downloadStatus(), nil
+}
+
+// Pause pauses a download
+func (ad *Aria2) Pause(downloadID string) error {
+	var gid string
+
+	return ad.call("aria2.pause", ad.appendParams(downloadID), &gid)
+}
+
+// Resume resumes a paused download
+func (ad *Aria2) Resume(downloadID string) error {
+	var gid string
+
+	return ad.call("aria2.unpause", ad.appendParams(downloadID), &gid)
+}
+
+// Remove removes a download, stopping it if in progress
+func (ad *Aria2) Remove(downloadID string) error {
+	var gid string
+
+	return ad.call("aria2.remove", ad.appendParams(downloadID), &gid)
+}
+
+// List returns all the downloads in a given state
+func (ad *Aria2) List(state DownloadState) ([]*DownloadStatus, error) {
+	var (
+		method  string
+		params  []interface{}
+		results []*aria2Status
+	)
+
+	switch state {
+	case StateActive:
+		method = "aria2.tellActive"
+		params = ad.appendParams()
+	case StateWaiting:
+		method = "aria2.tellWaiting"
+		params = ad.appendParams(0, ariaListLimit)
+	case StateStopped:
+		method = "aria2.tellStopped"
+		params = ad.appendParams(0, ariaListLimit)
+	default:
+		return nil, fmt.Errorf("Invalid download state %s", state)
+	}
+
+	callError := ad.call(method, params, &results)
+	if callError != nil {
+		return nil, callError
+	}
+
+	statuses := make([]*DownloadStatus, len(results))
+	for resultIndex, result := range results {
+		statuses[resultIndex] = result.downloadStatus()
+	}
+
+	return statuses, nil
+}
+
+// Purge removes completed, failed and removed downloads from aria2 memory
+func (ad *Aria2) Purge() error {
+	var result string
+
+	return ad.call("aria2.purgeDownloadResult", ad.appendParams(), &result)
+}
+
+// DownloadDir returns the global download dir of aria2
+func (ad *Aria2) DownloadDir() (string, error) {
+	var options map[string]string
+
+	callError := ad.call("aria2.getGlobalOption", ad.appendParams(), &options)
+	if callError != nil {
+		return "", callError
+	}
+
+	return options["dir"], nil
+}
+
+// FreeSpace returns the free space of the global download dir, checked
+// locally as aria2 can't report it, so only for an aria2 on this host
+func (ad *Aria2) FreeSpace() (int64, error) {
+	if !ad.IsLocal() {
+		return 0, errors.New("aria2 is not running on this host")
+	}
+
+	dir, dirError := ad.DownloadDir()
+	if dirError != nil {
+		return 0, dirError
+	}
+
+	return FreeDiskSpace(dir)
+}
+
+// IsLocal indicates if aria2 is reached through a loopback address or a Unix
+// socket
+func (ad *Aria2) IsLocal() bool {
+	parsedURL, parseError := url.Parse(ad.rpcURL)
+	if parseError != nil {
+		return false
+	}
+
+	if parsedURL.Scheme == "unix" || parsedURL.Hostname() == "localhost" {
+		return true
+	}
+
+	hostIP := net.ParseIP(parsedURL.Hostname())
+
+	return hostIP != nil && hostIP.IsLoopback()
 }
 
 // appendParams append all given params and wrap them with a token if any
@@ -0,0 +1,103 @@
+package downloader
+
+import (
+	"errors"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// aria2Notification is a notification pushed by aria2 over its WebSocket
+type aria2Notification struct {
+	Method string
+	Params []struct {
+		GID string
+	}
+}
+
+// aria2EventTypes maps aria2 notification methods to download events
+var aria2EventTypes = map[string]DownloadEventType{
+	"aria2.onDownloadStart":      EventStart,
+	"aria2.onDownloadPause":      EventPause,
+	"aria2.onDownloadStop":       EventStop,
+	"aria2.onDownloadComplete":   EventComplete,
+	"aria2.onDownloadError":      EventError,
+	"aria2.onBtDownloadComplete": EventBtComplete,
+}
+
+// Listen sends aria2 download events received over its WebSocket interface
+func (ad *Aria2) Listen(events chan<- *DownloadEvent, stop <-chan struct{}) error {
+	if ad.wsURL == "" {
+		return errors.New("Invalid WebSocket url")
+	}
+
+	originURL, _ := url.Parse(ad.rpcURL)
+	originURL.Path = "/"
+
+	wsConfig, configError := websocket.NewConfig(ad.wsURL, originURL.String())
+	if configError != nil {
+		return configError
+	}
+
+	connection, dialError := websocket.DialConfig(wsConfig)
+	if dialError != nil {
+		return dialError
+	}
+
+	// Closing the connection on stop to unblock the reading loop
+	closed := make(chan struct{})
+	defer close(closed)
+
+	go func() {
+		select {
+		case <-stop:
+		case <-closed:
+		}
+		connection.Close()
+	}()
+
+	for {
+		var notification aria2Notification
+
+		receiveError := websocket.JSON.Receive(connection, &notification)
+		if receiveError != nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+				return receiveError
+			}
+		}
+
+		eventType, isEvent := aria2EventTypes[notification.Method]
+		if !isEvent {
+			continue
+		}
+
+		for _, param := range notification.Params {
+			select {
+			case events <- &DownloadEvent{Type: eventType, DownloadID: param.GID, Time: time.Now()}:
+			case <-stop:
+				return nil
+			}
+		}
+	}
+}
+
+// webSocketURL derives the aria2 WebSocket URL from its RPC URL
+func webSocketURL(rpcURL string) (string, error) {
+	parsedURL, parseError := url.Parse(rpcURL)
+	if parseError != nil {
+		return "", parseError
+	}
+
+	switch parsedURL.Scheme {
+	case "https":
+		parsedURL.Scheme = "wss"
+	default:
+		parsedURL.Scheme = "ws"
+	}
+
+	return parsedURL.String(), nil
+}
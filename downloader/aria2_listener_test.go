@@ -0,0 +1,148 @@
+package downloader_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"golang.org/x/net/websocket"
+
+	. "github.com/davidderus/christopher/downloader"
+)
+
+// newNotifyingAria2 starts a WebSocket server pushing the given notifications
+// to every client
+func newNotifyingAria2(notifications ...string) *httptest.Server {
+	return httptest.NewServer(websocket.Handler(func(connection *websocket.Conn) {
+		for _, notification := range notifications {
+			websocket.Message.Send(connection, notification)
+		}
+
+		// Keeping the connection open until the client leaves
+		var message string
+		websocket.Message.Receive(connection, &message)
+	}))
+}
+
+func getListeningClient(serverURL string) *Aria2 {
+	authInfos := make(map[string]interface{})
+	authInfos["token"] = RpcToken
+	authInfos["rpc_url"] = serverURL + "/jsonrpc"
+
+	ariaDownloader := &Aria2{}
+	ariaDownloader.Auth(authInfos)
+
+	return ariaDownloader
+}
+
+var _ = Describe("Aria2 events", func() {
+	Describe(".Listen()", func() {
+		It("Should send the download events", func() {
+			server := newNotifyingAria2(
+				`{"jsonrpc":"2.0","method":"aria2.onDownloadStart","params":[{"gid":"96676fbc46cbbc04"}]}`,
+				`{"jsonrpc":"2.0","id":"1","result":"OK"}`,
+				`{"jsonrpc":"2.0","method":"aria2.onDownloadComplete","params":[{"gid":"96676fbc46cbbc04"}]}`,
+				`{"jsonrpc":"2.0","method":"aria2.onDownloadError","params":[{"gid":"002eda8439d70942"}]}`,
+			)
+			defer server.Close()
+
+			ariaDownloader := getListeningClient(server.URL)
+
+			events := make(chan *DownloadEvent)
+			stop := make(chan struct{})
+			listenDone := make(chan error)
+
+			go func() {
+				listenDone <- ariaDownloader.Listen(events, stop)
+			}()
+
+			firstEvent := <-events
+			Expect(firstEvent.Type).To(Equal(EventStart))
+			Expect(firstEvent.DownloadID).To(Equal("96676fbc46cbbc04"))
+
+			secondEvent := <-events
+			Expect(secondEvent.Type).To(Equal(EventComplete))
+
+			thirdEvent := <-events
+			Expect(thirdEvent.Type).To(Equal(EventError))
+			Expect(thirdEvent.DownloadID).To(Equal("002eda8439d70942"))
+
+			By("Stopping the listener")
+			close(stop)
+			Expect(<-listenDone).NotTo(HaveOccurred())
+		})
+
+		It("Should return an error when aria2 is unreachable", func() {
+			server := newNotifyingAria2()
+			serverURL := server.URL
+			server.Close()
+
+			ariaDownloader := getListeningClient(serverURL)
+			listenError := ariaDownloader.Listen(make(chan *DownloadEvent), make(chan struct{}))
+
+			Expect(listenError).To(HaveOccurred())
+		})
+	})
+})
+
+var _ = Describe("EventStream", func() {
+	It("Should publish the listened events to all subscribers", func() {
+		server := newNotifyingAria2(`{"jsonrpc":"2.0","method":"aria2.onDownloadComplete","params":[{"gid":"96676fbc46cbbc04"}]}`)
+		defer server.Close()
+
+		ariaDownloader := getListeningClient(server.URL)
+
+		firstReceived := make(chan *DownloadEvent, 1)
+		secondReceived := make(chan *DownloadEvent, 1)
+
+		eventStream := NewEventStream()
+		eventStream.Subscribe(func(event *DownloadEvent) {
+			firstReceived <- event
+		}).Subscribe(func(event *DownloadEvent) {
+			secondReceived <- event
+		})
+
+		stop := make(chan struct{})
+		defer close(stop)
+
+		go eventStream.Listen(ariaDownloader, stop)
+
+		Eventually(firstReceived).Should(Receive(WithTransform(func(event *DownloadEvent) string {
+			return event.DownloadID
+		}, Equal("96676fbc46cbbc04"))))
+		Eventually(secondReceived).Should(Receive())
+	})
+
+	It("Should report listening errors and retry", func() {
+		server := newNotifyingAria2()
+		serverURL := server.URL
+		server.Close()
+
+		ariaDownloader := getListeningClient(serverURL)
+
+		listenErrors := make(chan error, 10)
+
+		eventStream := NewEventStream()
+		eventStream.RetryDelay = time.Millisecond
+		eventStream.OnError = func(err error) {
+			select {
+			case listenErrors <- err:
+			default:
+			}
+		}
+
+		stop := make(chan struct{})
+		defer close(stop)
+
+		go eventStream.Listen(ariaDownloader, stop)
+
+		var firstError, secondError error
+		Eventually(listenErrors).Should(Receive(&firstError))
+		Eventually(listenErrors).Should(Receive(&secondError))
+
+		Expect(strings.ToLower(firstError.Error())).To(ContainSubstring("dial"))
+	})
+})
@@ -0,0 +1,73 @@
+package downloader
+
+import (
+	"path/filepath"
+	"strconv"
+)
+
+// aria2Status is the raw result of aria2.tellStatus, numbers being strings
+type aria2Status struct {
+	GID             string
+	Status          string
+	Dir             string
+	TotalLength     string
+	CompletedLength string
+	DownloadSpeed   string
+	ErrorCode       string
+	ErrorMessage    string
+	Files           []struct {
+		Path            string
+		Length          string
+		CompletedLength string
+		URIs            []struct {
+			URI string
+		} `json:"uris"`
+	}
+}
+
+// downloadStatus maps an aria2 status to a DownloadStatus
+func (as *aria2Status) downloadStatus() *DownloadStatus {
+	status := &DownloadStatus{
+		ID:             as.GID,
+		State:          DownloadState(as.Status),
+		Dir:            as.Dir,
+		TotalBytes:     parseAria2Int(as.TotalLength),
+		CompletedBytes: parseAria2Int(as.CompletedLength),
+		DownloadSpeed:  parseAria2Int(as.DownloadSpeed),
+		Files:          make([]*DownloadFile, len(as.Files)),
+	}
+
+	status.ETA = estimateETA(status.TotalBytes, status.CompletedBytes, status.DownloadSpeed)
+
+	// aria2 sets an error code of 0 on successful downloads
+	if as.ErrorCode != "" && as.ErrorCode != "0" {
+		status.ErrorCode = as.ErrorCode
+		status.ErrorMessage = as.ErrorMessage
+	}
+
+	for fileIndex, file := range as.Files {
+		uris := make([]string, len(file.URIs))
+		for uriIndex, uri := range file.URIs {
+			uris[uriIndex] = uri.URI
+		}
+
+		status.Files[fileIndex] = &DownloadFile{
+			Path:           file.Path,
+			TotalBytes:     parseAria2Int(file.Length),
+			CompletedBytes: parseAria2Int(file.CompletedLength),
+			URIs:           uris,
+		}
+	}
+
+	if len(status.Files) > 0 && status.Files[0].Path != "" {
+		status.Name = filepath.Base(status.Files[0].Path)
+	}
+
+	return status
+}
+
+// parseAria2Int converts aria2 string encoded numbers, defaulting to 0
+func parseAria2Int(value string) int64 {
+	number, _ := strconv.ParseInt(value, 10, 64)
+	return number
+}
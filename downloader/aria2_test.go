@@ -2,6 +2,7 @@ package downloader_test
 
 import (
 	"fmt"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -93,6 +94,33 @@ var _ = Describe("Aria2", func() {
 		})
 	})
 
+	Describe(".IsLocal()", func() {
+		It("Should only be local through a loopback address", func() {
+			for rpcURL, isLocal := range map[string]bool{
+				"http://localhost:6800/jsonrpc":    true,
+				"http://127.0.0.1:6800/jsonrpc":    true,
+				"http://[::1]:6800/jsonrpc":        true,
+				"http://192.168.1.10:6800/jsonrpc": false,
+				"https://aria2.example.org/rpc":    false,
+			} {
+				ariaDownloader := &Aria2{}
+				ariaDownloader.Auth(map[string]interface{}{"rpc_url": rpcURL, "token": ""})
+
+				Expect(ariaDownloader.IsLocal()).To(Equal(isLocal), rpcURL)
+			}
+		})
+	})
+
+	Describe(".FreeSpace()", func() {
+		It("Should not check the free space of a remote aria2", func() {
+			ariaDownloader := &Aria2{}
+			ariaDownloader.Auth(map[string]interface{}{"rpc_url": "http://192.168.1.10:6800/jsonrpc", "token": ""})
+
+			_, spaceError := ariaDownloader.FreeSpace()
+			Expect(spaceError).To(HaveOccurred())
+		})
+	})
+
 	Context("Once authenticated", func() {
 		Describe(".Download()", func() {
 			Context("with an HTTP Link", func() {
@@ -133,6 +161,29 @@ var _ = Describe("Aria2", func() {
 			})
 		})
 
+		Describe(".DownloadBatch()", func() {
+			It("Should return a result for each uri", func() {
+				ariaDownloader, testRecorder := getClientForCassette("download_batch")
+
+				results, batchError := ariaDownloader.DownloadBatch([]string{"http://google.fr", "not-a-link", "http://google.com"}, nil)
+
+				testRecorder.Stop()
+
+				Expect(batchError).NotTo(HaveOccurred())
+				Expect(len(results)).To(Equal(3))
+
+				Expect(results[0].URI).To(Equal("http://google.fr"))
+				Expect(results[0].DownloadID).To(Equal("96676fbc46cbbc04"))
+				Expect(results[0].Error).NotTo(HaveOccurred())
+
+				Expect(results[1].URI).To(Equal("not-a-link"))
+				Expect(results[1].DownloadID).To(BeEmpty())
+				Expect(results[1].Error.Error()).To(Equal("No URI to download."))
+
+				Expect(results[2].DownloadID).To(Equal("002eda8439d70942"))
+			})
+		})
+
 		Describe(".DownloadStatus()", func() {
 			Context("With a valid GID", func() {
 				It("Should return the status of a download", func() {
@@ -144,7 +195,30 @@ var _ = Describe("Aria2", func() {
 					status, _ := ariaDownloader02.DownloadStatus(gid)
 					testRecorder02.Stop()
 
-					Expect(status["status"]).To(Equal("active"))
+					Expect(status.State).To(Equal(StateActive))
+				})
+			})
+
+			Context("With a known download", func() {
+				It("Should map aria2 fields to the status", func() {
+					ariaDownloader, testRecorder := getClientForCassette("list_active_downloads")
+					downloads, _ := ariaDownloader.List(StateActive)
+					testRecorder.Stop()
+
+					status := downloads[0]
+
+					Expect(status.Name).To(Equal("Zombie-One.mkv"))
+					Expect(status.Dir).To(Equal("/downloads"))
+					Expect(status.TotalBytes).To(Equal(int64(3145728)))
+					Expect(status.CompletedBytes).To(Equal(int64(1048576)))
+					Expect(status.DownloadSpeed).To(Equal(int64(524288)))
+					Expect(status.ETA).To(Equal(4 * time.Second))
+					Expect(status.Progress()).To(BeNumerically("~", 0.33, 0.01))
+					Expect(status.ErrorCode).To(BeEmpty())
+
+					Expect(len(status.Files)).To(Equal(1))
+					Expect(status.Files[0].Path).To(Equal("/downloads/Zombie-One.mkv"))
+					Expect(status.Files[0].URIs).To(Equal([]string{"http://google.fr/Zombie-One.mkv"}))
 				})
 			})
 
@@ -158,5 +232,104 @@ var _ = Describe("Aria2", func() {
 				})
 			})
 		})
+
+		Describe(".Pause()", func() {
+			Context("With a valid GID", func() {
+				It("Should pause the download", func() {
+					ariaDownloader, testRecorder := getClientForCassette("pause_download")
+					pauseError := ariaDownloader.Pause("96676fbc46cbbc04")
+					testRecorder.Stop()
+
+					Expect(pauseError).NotTo(HaveOccurred())
+				})
+			})
+
+			Context("With an invalid GID", func() {
+				It("Should return an error", func() {
+					ariaDownloader, testRecorder := getClientForCassette("pause_download_with_invalid_gid")
+					pauseError := ariaDownloader.Pause("111")
+					testRecorder.Stop()
+
+					Expect(pauseError.Error()).To(Equal("GID 111 is not found"))
+				})
+			})
+		})
+
+		Describe(".Resume()", func() {
+			It("Should resume the download", func() {
+				ariaDownloader, testRecorder := getClientForCassette("resume_download")
+				resumeError := ariaDownloader.Resume("96676fbc46cbbc04")
+				testRecorder.Stop()
+
+				Expect(resumeError).NotTo(HaveOccurred())
+			})
+		})
+
+		Describe(".Remove()", func() {
+			It("Should remove the download", func() {
+				ariaDownloader, testRecorder := getClientForCassette("remove_download")
+				removeError := ariaDownloader.Remove("96676fbc46cbbc04")
+				testRecorder.Stop()
+
+				Expect(removeError).NotTo(HaveOccurred())
+			})
+		})
+
+		Describe(".List()", func() {
+			Context("With active downloads", func() {
+				It("Should return the active downloads", func() {
+					ariaDownloader, testRecorder := getClientForCassette("list_active_downloads")
+					downloads, listError := ariaDownloader.List(StateActive)
+					testRecorder.Stop()
+
+					Expect(listError).NotTo(HaveOccurred())
+					Expect(len(downloads)).To(Equal(1))
+					Expect(downloads[0].ID).To(Equal("96676fbc46cbbc04"))
+				})
+			})
+
+			Context("With waiting downloads", func() {
+				It("Should return the waiting and paused downloads", func() {
+					ariaDownloader, testRecorder := getClientForCassette("list_waiting_downloads")
+					downloads, listError := ariaDownloader.List(StateWaiting)
+					testRecorder.Stop()
+
+					Expect(listError).NotTo(HaveOccurred())
+					Expect(len(downloads)).To(Equal(2))
+					Expect(downloads[0].State).To(Equal(StatePaused))
+				})
+			})
+
+			Context("Without stopped downloads", func() {
+				It("Should return nothing", func() {
+					ariaDownloader, testRecorder := getClientForCassette("list_stopped_downloads")
+					downloads, listError := ariaDownloader.List(StateStopped)
+					testRecorder.Stop()
+
+					Expect(listError).NotTo(HaveOccurred())
+					Expect(downloads).To(BeEmpty())
+				})
+			})
+
+			Context("With an invalid state", func() {
+				It("Should return an error", func() {
+					ariaDownloader, testRecorder := getClientForCassette("list_stopped_downloads")
+					_, listError := ariaDownloader.List(DownloadState("sleeping"))
+					testRecorder.Stop()
+
+					Expect(listError.Error()).To(Equal("Invalid download state sleeping"))
+				})
+			})
+		})
+
+		Describe(".Purge()", func() {
+			It("Should purge stopped downloads", func() {
+				ariaDownloader, testRecorder := getClientForCassette("purge_downloads")
+				purgeError := ariaDownloader.Purge()
+				testRecorder.Stop()
+
+				Expect(purgeError).NotTo(HaveOccurred())
+			})
+		})
 	})
 })
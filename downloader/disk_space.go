@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package downloader
+
+import "golang.org/x/sys/unix"
+
+// FreeDiskSpace returns the space available to the user in a local directory
+func FreeDiskSpace(dir string) (int64, error) {
+	var stats unix.Statfs_t
+
+	statsError := unix.Statfs(dir, &stats)
+	if statsError != nil {
+		return 0, statsError
+	}
+
+	return int64(stats.Bavail) * int64(stats.Bsize), nil
+}
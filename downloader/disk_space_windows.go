@@ -0,0 +1,8 @@
+package downloader
+
+import "errors"
+
+// FreeDiskSpace is not supported on Windows
+func FreeDiskSpace(dir string) (int64, error) {
+	return 0, errors.New("Free disk space is not available on Windows")
+}
@@ -0,0 +1,58 @@
+package downloader
+
+import "time"
+
+// DownloadStatus is a downloader agnostic status of a download
+type DownloadStatus struct {
+	// ID is the download identifier in its downloader
+	ID string `json:"id"`
+
+	// Name is the name of the downloaded file or torrent
+	Name string `json:"name"`
+
+	State DownloadState `json:"state"`
+
+	// Dir is the directory where files are downloaded
+	Dir string `json:"dir"`
+
+	TotalBytes     int64 `json:"total_bytes"`
+	CompletedBytes int64 `json:"completed_bytes"`
+
+	// DownloadSpeed is expressed in bytes per second
+	DownloadSpeed int64 `json:"download_speed"`
+
+	// ETA is the estimated remaining time, zero if unknown
+	ETA time.Duration `json:"eta"`
+
+	Files []*DownloadFile `json:"files"`
+
+	// ErrorCode and ErrorMessage are only set on failed downloads
+	ErrorCode    string `json:"error_code,omitempty"`
+	ErrorMessage string `json:"error_message,omitempty"`
+}
+
+// DownloadFile is a file belonging to a download
+type DownloadFile struct {
+	Path           string   `json:"path"`
+	TotalBytes     int64    `json:"total_bytes"`
+	CompletedBytes int64    `json:"completed_bytes"`
+	URIs           []string `json:"uris"`
+}
+
+// Progress returns the download completion ratio between 0 and 1
+func (ds *DownloadStatus) Progress() float64 {
+	if ds.TotalBytes == 0 {
+		return 0
+	}
+
+	return float64(ds.CompletedBytes) / float64(ds.TotalBytes)
+}
+
+// estimateETA computes the remaining time from the current speed
+func estimateETA(totalBytes, completedBytes, speed int64) time.Duration {
+	if speed <= 0 || totalBytes <= completedBytes {
+		return 0
+	}
+
+	return time.Duration((totalBytes-completedBytes)/speed) * time.Second
+}
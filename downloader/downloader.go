@@ -1,12 +1,134 @@
 package downloader
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// DownloadState is the state of a download in the downloader queue
+type DownloadState string
+
+const (
+	// StateActive is for downloads in progress
+	StateActive DownloadState = "active"
+
+	// StateWaiting is for queued or paused downloads
+	StateWaiting DownloadState = "waiting"
+
+	// StateStopped is for completed, failed or removed downloads
+	StateStopped DownloadState = "stopped"
+
+	// StatePaused is for paused downloads
+	StatePaused DownloadState = "paused"
+
+	// StateComplete is for successfully completed downloads
+	StateComplete DownloadState = "complete"
+
+	// StateError is for failed downloads
+	StateError DownloadState = "error"
+
+	// StateRemoved is for downloads removed by the user
+	StateRemoved DownloadState = "removed"
+)
 
 // Downloader takes uri and download them
 type Downloader interface {
 	Auth(infos map[string]interface{}) error
 	Download(uri string, options map[string]interface{}) (string, error)
-	DownloadStatus(downloadID string) (map[string]interface{}, error)
+
+	// DownloadBatch starts the download of several uris at once
+	DownloadBatch(uris []string, options map[string]interface{}) ([]*BatchResult, error)
+	DownloadStatus(downloadID string) (*DownloadStatus, error)
+
+	// Pause pauses an active or waiting download
+	Pause(downloadID string) error
+
+	// Resume resumes a paused download
+	Resume(downloadID string) error
+
+	// Remove stops a download and removes it from the queue
+	Remove(downloadID string) error
+
+	// List returns the status of all downloads in a given state
+	List(state DownloadState) ([]*DownloadStatus, error)
+
+	// Purge clears completed, failed and removed downloads from memory
+	Purge() error
+}
+
+// BatchResult is the outcome of a single uri of a batch download
+type BatchResult struct {
+	URI        string
+	DownloadID string
+	Error      error
+}
+
+// downloadEach is a DownloadBatch fallback for downloaders without native
+// batch support, downloading uris one at a time
+func downloadEach(downloader Downloader, uris []string, options map[string]interface{}) []*BatchResult {
+	results := make([]*BatchResult, len(uris))
+
+	for uriIndex, uri := range uris {
+		downloadID, downloadError := downloader.Download(uri, options)
+		results[uriIndex] = &BatchResult{URI: uri, DownloadID: downloadID, Error: downloadError}
+	}
+
+	return results
+}
+
+// listStateOf returns the List state a download state belongs to
+func listStateOf(state DownloadState) DownloadState {
+	switch state {
+	case StateActive:
+		return StateActive
+	case StateWaiting, StatePaused:
+		return StateWaiting
+	default:
+		return StateStopped
+	}
+}
+
+// ParseDownloadState returns a listable DownloadState from its name
+func ParseDownloadState(state string) (DownloadState, error) {
+	switch DownloadState(state) {
+	case StateActive, StateWaiting, StateStopped:
+		return DownloadState(state), nil
+	default:
+		return "", fmt.Errorf("Invalid download state %s", state)
+	}
+}
+
+// Specialist is implemented by downloaders only able to handle some uris
+type Specialist interface {
+	// Handles indicates if the downloader is able to download an uri
+	Handles(uri string) bool
+}
+
+// DirReporter is implemented by downloaders able to report their default
+// download dir
+type DirReporter interface {
+	// DownloadDir returns the dir where files are downloaded by default
+	DownloadDir() (string, error)
+
+	// IsLocal indicates if the downloader runs on this host, so its dirs can
+	// be checked locally
+	IsLocal() bool
+}
+
+// IsTorrent indicates if an uri is a magnet link or a torrent file
+func IsTorrent(uri string) bool {
+	if strings.HasPrefix(uri, "magnet:") {
+		return true
+	}
+
+	parsedURI, parseError := url.Parse(uri)
+	if parseError != nil {
+		return false
+	}
+
+	return strings.HasSuffix(strings.ToLower(parsedURI.Path), ".torrent")
 }
 
 // NewDownloader returns a new authenticated downloader
@@ -16,6 +138,14 @@ func NewDownloader(name string, authInfos map[string]interface{}) (Downloader, e
 	switch name {
 	case "Aria2", "aria2", "aria":
 		downloader = &Aria2{}
+	case "Transmission", "transmission":
+		downloader = &Transmission{}
+	case "QBittorrent", "qBittorrent", "qbittorrent":
+		downloader = &QBittorrent{}
+	case "Native", "native":
+		downloader = &Native{}
+	case "NZBGet", "nzbget":
+		downloader = &NZBGet{}
 	default:
 		return nil, errors.New("Invalid downloader given")
 	}
@@ -23,6 +23,42 @@ var _ = Describe("NewDownloader", func() {
 		})
 	})
 
+	Context("With Transmission", func() {
+		It("Should return an instantiated downloader", func() {
+			dlInstance, downloaderError := downloader.NewDownloader("transmission", nil)
+
+			Expect(downloaderError).NotTo(HaveOccurred())
+			Expect(dlInstance).To(BeEquivalentTo(&downloader.Transmission{}))
+		})
+	})
+
+	Context("With qBittorrent", func() {
+		It("Should return an instantiated downloader", func() {
+			dlInstance, downloaderError := downloader.NewDownloader("qbittorrent", nil)
+
+			Expect(downloaderError).NotTo(HaveOccurred())
+			Expect(dlInstance).To(BeEquivalentTo(&downloader.QBittorrent{}))
+		})
+	})
+
+	Context("With Native", func() {
+		It("Should return an instantiated downloader", func() {
+			dlInstance, downloaderError := downloader.NewDownloader("native", nil)
+
+			Expect(downloaderError).NotTo(HaveOccurred())
+			Expect(dlInstance).To(BeEquivalentTo(&downloader.Native{}))
+		})
+	})
+
+	Context("With NZBGet", func() {
+		It("Should return an instantiated downloader", func() {
+			dlInstance, downloaderError := downloader.NewDownloader("nzbget", nil)
+
+			Expect(downloaderError).NotTo(HaveOccurred())
+			Expect(dlInstance).To(BeEquivalentTo(&downloader.NZBGet{}))
+		})
+	})
+
 	Context("With an invalid downloader", func() {
 		It("Should return an error", func() {
 			_, downloaderError := downloader.NewDownloader("Fake", nil)
@@ -31,3 +67,39 @@ var _ = Describe("NewDownloader", func() {
 		})
 	})
 })
+
+var _ = Describe("ParseDownloadState", func() {
+	Context("With a valid state", func() {
+		It("Should return the state", func() {
+			state, stateError := downloader.ParseDownloadState("waiting")
+
+			Expect(stateError).NotTo(HaveOccurred())
+			Expect(state).To(Equal(downloader.StateWaiting))
+		})
+	})
+
+	Context("With an invalid state", func() {
+		It("Should return an error", func() {
+			_, stateError := downloader.ParseDownloadState("sleeping")
+
+			Expect(stateError.Error()).To(Equal("Invalid download state sleeping"))
+		})
+	})
+})
+
+var _ = Describe("IsTorrent", func() {
+	It("Should detect magnets and torrent files", func() {
+		Expect(downloader.IsTorrent("magnet:?xt=urn:btih:a1b2c3")).To(BeTrue())
+		Expect(downloader.IsTorrent("https://google.fr/file.TORRENT")).To(BeTrue())
+		Expect(downloader.IsTorrent("https://google.fr/file.mkv")).To(BeFalse())
+	})
+})
+
+var _ = Describe("IsNZB", func() {
+	It("Should detect NZB files and newznab links", func() {
+		Expect(downloader.IsNZB("https://indexer.org/nzb/Zombie.One.S01E01.NZB")).To(BeTrue())
+		Expect(downloader.IsNZB("https://indexer.org/api?t=get&id=a1b2c3&apikey=key")).To(BeTrue())
+		Expect(downloader.IsNZB("https://indexer.org/api?t=search&q=zombie")).To(BeFalse())
+		Expect(downloader.IsNZB("http://rapidgator.net/file/08987898765/HTGAWM.mkv")).To(BeFalse())
+	})
+})
@@ -0,0 +1,116 @@
+package downloader
+
+import (
+	"sync"
+	"time"
+)
+
+// DownloadEventType is the kind of a download event
+type DownloadEventType string
+
+const (
+	// EventStart is sent when a download starts
+	EventStart DownloadEventType = "start"
+
+	// EventPause is sent when a download is paused
+	EventPause DownloadEventType = "pause"
+
+	// EventStop is sent when a download is stopped by the user
+	EventStop DownloadEventType = "stop"
+
+	// EventComplete is sent when a download completes
+	EventComplete DownloadEventType = "complete"
+
+	// EventError is sent when a download fails
+	EventError DownloadEventType = "error"
+
+	// EventBtComplete is sent when a torrent is downloaded but still seeding
+	EventBtComplete DownloadEventType = "bt-complete"
+)
+
+// defaultListenRetryDelay is the delay before listening again to a downloader
+// whose connection was lost
+const defaultListenRetryDelay = 10 * time.Second
+
+// DownloadEvent is a notification about a download sent by a downloader
+type DownloadEvent struct {
+	Type       DownloadEventType
+	DownloadID string
+	Time       time.Time
+}
+
+// Listener is implemented by downloaders able to push download events
+type Listener interface {
+	// Listen sends download events until stop is closed or the connection
+	// is lost
+	Listen(events chan<- *DownloadEvent, stop <-chan struct{}) error
+}
+
+// EventStream dispatches download events to its subscribers
+type EventStream struct {
+	// RetryDelay is the delay before listening again after an error
+	RetryDelay time.Duration
+
+	// OnError is called with listening errors if set
+	OnError func(err error)
+
+	mutex    sync.RWMutex
+	handlers []func(event *DownloadEvent)
+}
+
+// NewEventStream returns an EventStream without subscribers
+func NewEventStream() *EventStream {
+	return &EventStream{RetryDelay: defaultListenRetryDelay}
+}
+
+// Subscribe registers a handler called for every published event
+func (es *EventStream) Subscribe(handler func(event *DownloadEvent)) *EventStream {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	es.handlers = append(es.handlers, handler)
+	return es
+}
+
+// Publish sends an event to all the subscribers
+func (es *EventStream) Publish(event *DownloadEvent) {
+	es.mutex.RLock()
+	defer es.mutex.RUnlock()
+
+	for _, handler := range es.handlers {
+		handler(event)
+	}
+}
+
+// Listen publishes the events of a listener until stop is closed
+//
+// The listener is listened to again after RetryDelay if its connection is lost.
+func (es *EventStream) Listen(listener Listener, stop <-chan struct{}) {
+	events := make(chan *DownloadEvent)
+	listenerDone := make(chan error)
+
+	for {
+		go func() {
+			listenerDone <- listener.Listen(events, stop)
+		}()
+
+	pumping:
+		for {
+			select {
+			case event := <-events:
+				es.Publish(event)
+			case listenError := <-listenerDone:
+				if listenError != nil && es.OnError != nil {
+					es.OnError(listenError)
+				}
+				break pumping
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(es.RetryDelay):
+		}
+	}
+}
@@ -0,0 +1,595 @@
+package downloader
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Native is an in-process HTTP(S) downloader
+//
+// Downloads are split in range requests fetched in parallel, and their
+// progress is saved to a state file so they resume after a restart.
+// All the Native instances sharing a state file share the same downloads.
+// Transfers only run in processes calling SetNativeTransfers, the others
+// reading the state file without changing it.
+type Native struct {
+	manager *nativeManager
+
+	// Allow to set a custom HTTP transport (for test purposes)
+	CustomTransport http.RoundTripper
+}
+
+const (
+	// nativeDefaultTimeOut is the default timeout for http requests in seconds
+	nativeDefaultTimeOut = 30
+
+	// nativeDefaultSegments is the default number of parallel range requests
+	nativeDefaultSegments = 4
+
+	// nativeDefaultRetries is the default number of retries of a segment
+	nativeDefaultRetries = 3
+
+	// nativeDefaultRetryDelay is the default delay between retries in seconds
+	nativeDefaultRetryDelay = 5
+
+	// nativeStateFileName is the default state file name in the download dir
+	nativeStateFileName = ".christopher_downloads.json"
+
+	// nativePartExtension is appended to files being downloaded
+	nativePartExtension = ".part"
+)
+
+var errNativeUnknownDownload = errors.New("Unknown download")
+
+var errNativeReadOnly = errors.New("Native downloads are only managed by the feed watcher or the webserver")
+
+// nativeManagers holds the running managers by state file
+var nativeManagers = struct {
+	sync.Mutex
+	byStatePath map[string]*nativeManager
+
+	// transfersEnabled is set by long-running processes
+	transfersEnabled bool
+
+	// onSaveError is called with the errors of the saves done in background
+	onSaveError func(err error)
+}{byStatePath: make(map[string]*nativeManager)}
+
+// SetNativeTransfers allows the Native downloaders of the process to run
+// transfers and to save the state file
+//
+// Only long-running processes should enable them, as a process exiting
+// stops its transfers and its state would overwrite the one of the others.
+func SetNativeTransfers(enabled bool) {
+	nativeManagers.Lock()
+	nativeManagers.transfersEnabled = enabled
+	nativeManagers.Unlock()
+}
+
+// OnNativeSaveError sets a handler of the state file saves failing during
+// the transfers, as no caller gets their error
+func OnNativeSaveError(handler func(err error)) {
+	nativeManagers.Lock()
+	nativeManagers.onSaveError = handler
+	nativeManagers.Unlock()
+}
+
+// nativeManager runs and persists the downloads of a state file
+type nativeManager struct {
+	client     *http.Client
+	dir        string
+	statePath  string
+	segments   int
+	retries    int
+	retryDelay time.Duration
+	limiter    *rateLimiter
+
+	// readOnly managers neither run transfers nor save the state file
+	readOnly bool
+
+	mutex     sync.Mutex
+	downloads map[string]*nativeDownload
+
+	// saveMutex keeps the state file saves in order
+	saveMutex sync.Mutex
+
+	// order keeps downloads in submission order
+	order []string
+
+	listeners map[chan *DownloadEvent]struct{}
+}
+
+// nativeDownload is a download and its persisted progress
+type nativeDownload struct {
+	ID           string
+	URI          string
+	Name         string
+	Dir          string
+	State        DownloadState
+	TotalBytes   int64
+	Segments     []*nativeSegment
+	ErrorMessage string
+
+	// stop is closed to interrupt the running transfer
+	stop chan struct{}
+
+	// startedAt and startBytes are used to compute the download speed
+	startedAt  time.Time
+	startBytes int64
+}
+
+// nativeSegment is a byte range of a download
+type nativeSegment struct {
+	// Start and End are inclusive offsets, End is -1 for an unknown size
+	Start int64
+	End   int64
+
+	// Done is the number of bytes written from Start
+	Done int64
+}
+
+// Auth initializes the Native downloader
+//
+// Infos are the download dir, the state_path, the number of segments,
+// retries and retry_delay, a max_speed in bytes per second and a timeout.
+// Interrupted downloads of the state file are resumed if transfers are
+// enabled.
+func (nd *Native) Auth(infos map[string]interface{}) error {
+	dir, _ := infos["dir"].(string)
+	if dir == "" {
+		dir = "."
+	}
+
+	absoluteDir, dirError := filepath.Abs(dir)
+	if dirError != nil {
+		return dirError
+	}
+
+	statePath, _ := infos["state_path"].(string)
+	if statePath == "" {
+		statePath = filepath.Join(absoluteDir, nativeStateFileName)
+	}
+
+	nativeManagers.Lock()
+	defer nativeManagers.Unlock()
+
+	if manager, hasManager := nativeManagers.byStatePath[statePath]; hasManager {
+		nd.manager = manager
+		return nil
+	}
+
+	manager := &nativeManager{
+		client: &http.Client{
+			Timeout:   time.Duration(intOption(infos, "timeout", nativeDefaultTimeOut)) * time.Second,
+			Transport: nd.CustomTransport,
+		},
+		dir:        absoluteDir,
+		statePath:  statePath,
+		segments:   intOption(infos, "segments", nativeDefaultSegments),
+		retries:    intOption(infos, "retries", nativeDefaultRetries),
+		retryDelay: time.Duration(intOption(infos, "retry_delay", nativeDefaultRetryDelay)) * time.Second,
+		limiter:    &rateLimiter{bytesPerSecond: int64(intOption(infos, "max_speed", 0))},
+		readOnly:   !nativeManagers.transfersEnabled,
+		downloads:  make(map[string]*nativeDownload),
+		listeners:  make(map[chan *DownloadEvent]struct{}),
+	}
+
+	if manager.segments < 1 {
+		manager.segments = 1
+	}
+
+	loadError := manager.load()
+	if loadError != nil {
+		return loadError
+	}
+
+	nativeManagers.byStatePath[statePath] = manager
+	nd.manager = manager
+
+	return nil
+}
+
+// intOption reads an integer option, TOML numbers being int64
+func intOption(infos map[string]interface{}, name string, defaultValue int) int {
+	switch value := infos[name].(type) {
+	case int:
+		return value
+	case int64:
+		return int(value)
+	case float64:
+		return int(value)
+	default:
+		return defaultValue
+	}
+}
+
+// Download starts the download of an HTTP(S) uri in background
+//
+// The dir and out options override the download dir and file name.
+func (nd *Native) Download(uri string, options map[string]interface{}) (string, error) {
+	if nd.manager.readOnly {
+		return "", errNativeReadOnly
+	}
+
+	downloadID, idError := newNativeID()
+	if idError != nil {
+		return "", idError
+	}
+
+	download := &nativeDownload{
+		ID:    downloadID,
+		URI:   uri,
+		Dir:   nd.manager.dir,
+		State: StateWaiting,
+	}
+
+	if dir, hasDir := options["dir"].(string); hasDir && dir != "" {
+		download.Dir = dir
+	}
+
+	if name, hasName := options["out"].(string); hasName && name != "" {
+		download.Name = filepath.Base(name)
+	}
+
+	nd.manager.mutex.Lock()
+	nd.manager.downloads[downloadID] = download
+	nd.manager.order = append(nd.manager.order, downloadID)
+	nd.manager.start(download)
+	nd.manager.mutex.Unlock()
+
+	return downloadID, nd.manager.save()
+}
+
+// DownloadBatch starts several downloads
+func (nd *Native) DownloadBatch(uris []string, options map[string]interface{}) ([]*BatchResult, error) {
+	return downloadEach(nd, uris, options), nil
+}
+
+// DownloadStatus returns the status of a download
+func (nd *Native) DownloadStatus(downloadID string) (*DownloadStatus, error) {
+	nd.manager.mutex.Lock()
+	defer nd.manager.mutex.Unlock()
+
+	download, hasDownload := nd.manager.downloads[downloadID]
+	if !hasDownload {
+		return nil, errNativeUnknownDownload
+	}
+
+	return download.downloadStatus(), nil
+}
+
+// Pause interrupts an active or waiting download
+func (nd *Native) Pause(downloadID string) error {
+	_, interruptError := nd.manager.interrupt(downloadID, StatePaused, EventPause)
+	return interruptError
+}
+
+// Resume restarts a paused or failed download where it stopped
+func (nd *Native) Resume(downloadID string) error {
+	if nd.manager.readOnly {
+		return errNativeReadOnly
+	}
+
+	nd.manager.mutex.Lock()
+
+	download, hasDownload := nd.manager.downloads[downloadID]
+	if !hasDownload {
+		nd.manager.mutex.Unlock()
+		return errNativeUnknownDownload
+	}
+
+	if download.State != StatePaused && download.State != StateError {
+		nd.manager.mutex.Unlock()
+		return fmt.Errorf("Download %s is not paused", downloadID)
+	}
+
+	download.State = StateWaiting
+	download.ErrorMessage = ""
+	nd.manager.start(download)
+	nd.manager.mutex.Unlock()
+
+	return nd.manager.save()
+}
+
+// Remove interrupts a download and deletes its partial file
+func (nd *Native) Remove(downloadID string) error {
+	download, interruptError := nd.manager.interrupt(downloadID, StateRemoved, EventStop)
+	if interruptError != nil {
+		return interruptError
+	}
+
+	nd.manager.mutex.Lock()
+	partPath := download.partPath()
+	nd.manager.mutex.Unlock()
+
+	removeError := os.Remove(partPath)
+	if removeError != nil && !os.IsNotExist(removeError) {
+		return removeError
+	}
+
+	return nil
+}
+
+// List returns the status of all downloads in a given state
+func (nd *Native) List(state DownloadState) ([]*DownloadStatus, error) {
+	nd.manager.mutex.Lock()
+	defer nd.manager.mutex.Unlock()
+
+	statuses := make([]*DownloadStatus, 0)
+
+	for _, downloadID := range nd.manager.order {
+		status := nd.manager.downloads[downloadID].downloadStatus()
+
+		if listStateOf(status.State) == state {
+			statuses = append(statuses, status)
+		}
+	}
+
+	return statuses, nil
+}
+
+// Purge forgets completed, failed and removed downloads
+func (nd *Native) Purge() error {
+	if nd.manager.readOnly {
+		return errNativeReadOnly
+	}
+
+	nd.manager.mutex.Lock()
+
+	remainingIDs := make([]string, 0, len(nd.manager.order))
+
+	for _, downloadID := range nd.manager.order {
+		if listStateOf(nd.manager.downloads[downloadID].State) == StateStopped {
+			delete(nd.manager.downloads, downloadID)
+			continue
+		}
+
+		remainingIDs = append(remainingIDs, downloadID)
+	}
+
+	nd.manager.order = remainingIDs
+	nd.manager.mutex.Unlock()
+
+	return nd.manager.save()
+}
+
+// Listen sends the events of the downloads until stop is closed
+func (nd *Native) Listen(events chan<- *DownloadEvent, stop <-chan struct{}) error {
+	listenerEvents := make(chan *DownloadEvent, 64)
+
+	nd.manager.mutex.Lock()
+	nd.manager.listeners[listenerEvents] = struct{}{}
+	nd.manager.mutex.Unlock()
+
+	defer func() {
+		nd.manager.mutex.Lock()
+		delete(nd.manager.listeners, listenerEvents)
+		nd.manager.mutex.Unlock()
+	}()
+
+	for {
+		select {
+		case event := <-listenerEvents:
+			select {
+			case events <- event:
+			case <-stop:
+				return nil
+			}
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+// FreeSpace returns the free disk space of the download dir
+func (nd *Native) FreeSpace() (int64, error) {
+	return FreeDiskSpace(nd.manager.dir)
+}
+
+// newNativeID returns a random download id, as long as an aria2 gid
+func newNativeID() (string, error) {
+	randomBytes := make([]byte, 8)
+
+	_, randomError := rand.Read(randomBytes)
+	if randomError != nil {
+		return "", randomError
+	}
+
+	return hex.EncodeToString(randomBytes), nil
+}
+
+// load restores the downloads of the state file, resuming the unfinished ones
+// unless the manager is read-only
+func (nm *nativeManager) load() error {
+	stateData, readError := ioutil.ReadFile(nm.statePath)
+	if os.IsNotExist(readError) {
+		return nil
+	}
+	if readError != nil {
+		return readError
+	}
+
+	var downloads []*nativeDownload
+
+	decodeError := json.Unmarshal(stateData, &downloads)
+	if decodeError != nil {
+		return fmt.Errorf("Invalid native downloader state file: %s", decodeError)
+	}
+
+	nm.mutex.Lock()
+	defer nm.mutex.Unlock()
+
+	for _, download := range downloads {
+		nm.downloads[download.ID] = download
+		nm.order = append(nm.order, download.ID)
+
+		if !nm.readOnly && (download.State == StateActive || download.State == StateWaiting) {
+			nm.start(download)
+		}
+	}
+
+	return nil
+}
+
+// save writes the downloads to the state file
+//
+// Saves are serialized, so the last snapshot taken is the one written last.
+func (nm *nativeManager) save() error {
+	nm.saveMutex.Lock()
+	defer nm.saveMutex.Unlock()
+
+	nm.mutex.Lock()
+
+	downloads := make([]*nativeDownload, len(nm.order))
+	for downloadIndex, downloadID := range nm.order {
+		downloads[downloadIndex] = nm.downloads[downloadID]
+	}
+
+	stateData, encodeError := json.MarshalIndent(downloads, "", "  ")
+	nm.mutex.Unlock()
+
+	if encodeError != nil {
+		return encodeError
+	}
+
+	temporaryPath := nm.statePath + ".tmp"
+
+	writeError := ioutil.WriteFile(temporaryPath, stateData, 0600)
+	if writeError != nil {
+		return writeError
+	}
+
+	return os.Rename(temporaryPath, nm.statePath)
+}
+
+// saveInBackground saves the downloads, reporting a failure to the save error
+// handler
+func (nm *nativeManager) saveInBackground() {
+	saveError := nm.save()
+	if saveError == nil {
+		return
+	}
+
+	nativeManagers.Lock()
+	onSaveError := nativeManagers.onSaveError
+	nativeManagers.Unlock()
+
+	if onSaveError != nil {
+		onSaveError(fmt.Errorf("Native state %s not saved: %s", nm.statePath, saveError))
+	}
+}
+
+// interrupt stops a running download, setting it to a final state
+//
+// The download is returned as it may be purged once the mutex is released.
+func (nm *nativeManager) interrupt(downloadID string, state DownloadState, eventType DownloadEventType) (*nativeDownload, error) {
+	if nm.readOnly {
+		return nil, errNativeReadOnly
+	}
+
+	nm.mutex.Lock()
+
+	download, hasDownload := nm.downloads[downloadID]
+	if !hasDownload {
+		nm.mutex.Unlock()
+		return nil, errNativeUnknownDownload
+	}
+
+	if state == StatePaused && download.State != StateActive && download.State != StateWaiting {
+		nm.mutex.Unlock()
+		return nil, fmt.Errorf("Download %s is not active", downloadID)
+	}
+
+	if download.stop != nil {
+		close(download.stop)
+		download.stop = nil
+	}
+
+	download.State = state
+	nm.publish(eventType, downloadID)
+	nm.mutex.Unlock()
+
+	return download, nm.save()
+}
+
+// publish sends an event to the listeners, dropping it for slow listeners
+//
+// Must be called with the manager mutex held.
+func (nm *nativeManager) publish(eventType DownloadEventType, downloadID string) {
+	event := &DownloadEvent{Type: eventType, DownloadID: downloadID, Time: time.Now()}
+
+	for listenerEvents := range nm.listeners {
+		select {
+		case listenerEvents <- event:
+		default:
+		}
+	}
+}
+
+// partPath is the path of the file while downloading
+func (download *nativeDownload) partPath() string {
+	return download.path() + nativePartExtension
+}
+
+// path is the path of the downloaded file
+func (download *nativeDownload) path() string {
+	name := download.Name
+	if name == "" {
+		name = download.ID
+	}
+
+	return filepath.Join(download.Dir, name)
+}
+
+// completedBytes is the sum of the bytes downloaded by all segments
+func (download *nativeDownload) completedBytes() int64 {
+	var completedBytes int64
+
+	for _, segment := range download.Segments {
+		completedBytes += segment.Done
+	}
+
+	return completedBytes
+}
+
+// downloadStatus maps a native download to a DownloadStatus
+//
+// Must be called with the manager mutex held.
+func (download *nativeDownload) downloadStatus() *DownloadStatus {
+	status := &DownloadStatus{
+		ID:             download.ID,
+		Name:           download.Name,
+		State:          download.State,
+		Dir:            download.Dir,
+		TotalBytes:     download.TotalBytes,
+		CompletedBytes: download.completedBytes(),
+		ErrorMessage:   download.ErrorMessage,
+	}
+
+	if download.State == StateActive {
+		elapsed := time.Since(download.startedAt).Seconds()
+		if elapsed > 0 {
+			status.DownloadSpeed = int64(float64(status.CompletedBytes-download.startBytes) / elapsed)
+		}
+	}
+
+	status.ETA = estimateETA(status.TotalBytes, status.CompletedBytes, status.DownloadSpeed)
+
+	status.Files = []*DownloadFile{{
+		Path:           download.path(),
+		TotalBytes:     status.TotalBytes,
+		CompletedBytes: status.CompletedBytes,
+		URIs:           []string{download.URI},
+	}}
+
+	return status
+}
@@ -0,0 +1,337 @@
+package downloader_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/davidderus/christopher/downloader"
+)
+
+// stubFileServer serves a file with range support, counting the requests
+type stubFileServer struct {
+	server  *httptest.Server
+	content []byte
+
+	mutex    sync.Mutex
+	ranges   []string
+	failures int
+
+	// gate blocks GET requests until closed if set
+	gate chan struct{}
+}
+
+func newStubFileServer(size int, withRanges bool) *stubFileServer {
+	stub := &stubFileServer{content: bytes.Repeat([]byte("christopher"), size/11+1)[:size]}
+
+	stub.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.mkv" {
+			http.NotFound(w, r)
+			return
+		}
+
+		if r.Method == "GET" {
+			stub.mutex.Lock()
+			stub.ranges = append(stub.ranges, r.Header.Get("Range"))
+			gate := stub.gate
+			isFailing := stub.failures > 0
+			if isFailing {
+				stub.failures--
+			}
+			stub.mutex.Unlock()
+
+			if isFailing {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if gate != nil {
+				<-gate
+			}
+		}
+
+		if !withRanges {
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", len(stub.content)))
+			if r.Method == "GET" {
+				w.Write(stub.content)
+			}
+			return
+		}
+
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(stub.content))
+	}))
+
+	return stub
+}
+
+func (stub *stubFileServer) requestedRanges() []string {
+	stub.mutex.Lock()
+	defer stub.mutex.Unlock()
+
+	return append([]string{}, stub.ranges...)
+}
+
+func getNativeClient(downloadDir string, infos map[string]interface{}) *Native {
+	native := &Native{}
+
+	authInfos := map[string]interface{}{"dir": downloadDir, "retry_delay": 0}
+	for infoName, infoValue := range infos {
+		authInfos[infoName] = infoValue
+	}
+
+	authError := native.Auth(authInfos)
+	Expect(authError).NotTo(HaveOccurred())
+
+	return native
+}
+
+func nativeState(native *Native, downloadID string) func() DownloadState {
+	return func() DownloadState {
+		status, _ := native.DownloadStatus(downloadID)
+		return status.State
+	}
+}
+
+var _ = Describe("Native", func() {
+	var downloadDir string
+	var stub *stubFileServer
+
+	BeforeEach(func() {
+		downloadDir, _ = ioutil.TempDir("", "christopher-native")
+		stub = newStubFileServer(10000, true)
+		SetNativeTransfers(true)
+	})
+
+	AfterEach(func() {
+		SetNativeTransfers(false)
+		stub.server.Close()
+		os.RemoveAll(downloadDir)
+	})
+
+	Describe(".Download()", func() {
+		It("Should download the file in parallel segments", func() {
+			native := getNativeClient(downloadDir, map[string]interface{}{"segments": int64(4)})
+
+			downloadID, downloadError := native.Download(stub.server.URL+"/HTGAWM.mkv", nil)
+
+			Expect(downloadError).NotTo(HaveOccurred())
+			Expect(downloadID).To(HaveLen(16))
+			Eventually(nativeState(native, downloadID)).Should(Equal(StateComplete))
+
+			content, _ := ioutil.ReadFile(filepath.Join(downloadDir, "HTGAWM.mkv"))
+			Expect(content).To(Equal(stub.content))
+			Expect(stub.requestedRanges()).To(ConsistOf("bytes=0-2499", "bytes=2500-4999", "bytes=5000-7499", "bytes=7500-9999"))
+
+			status, _ := native.DownloadStatus(downloadID)
+			Expect(status.Name).To(Equal("HTGAWM.mkv"))
+			Expect(status.Progress()).To(Equal(1.0))
+		})
+
+		It("Should use the dir and out options", func() {
+			native := getNativeClient(downloadDir, nil)
+			outputDir := filepath.Join(downloadDir, "series")
+
+			downloadID, _ := native.Download(stub.server.URL+"/HTGAWM.mkv", map[string]interface{}{"dir": outputDir, "out": "episode.mkv"})
+
+			Eventually(nativeState(native, downloadID)).Should(Equal(StateComplete))
+			Expect(filepath.Join(outputDir, "episode.mkv")).To(BeARegularFile())
+		})
+
+		It("Should download in one request without ranges support", func() {
+			stub = newStubFileServer(10000, false)
+			native := getNativeClient(downloadDir, nil)
+
+			downloadID, _ := native.Download(stub.server.URL+"/HTGAWM.mkv", nil)
+
+			Eventually(nativeState(native, downloadID)).Should(Equal(StateComplete))
+			Expect(stub.requestedRanges()).To(Equal([]string{""}))
+		})
+
+		It("Should retry failing requests", func() {
+			stub.failures = 2
+			native := getNativeClient(downloadDir, map[string]interface{}{"segments": 1, "retries": 2})
+
+			downloadID, _ := native.Download(stub.server.URL+"/HTGAWM.mkv", nil)
+
+			Eventually(nativeState(native, downloadID)).Should(Equal(StateComplete))
+			Expect(len(stub.requestedRanges())).To(Equal(3))
+		})
+
+		It("Should fail once out of retries", func() {
+			native := getNativeClient(downloadDir, map[string]interface{}{"retries": 1})
+
+			downloadID, _ := native.Download(stub.server.URL+"/missing.mkv", nil)
+
+			Eventually(nativeState(native, downloadID)).Should(Equal(StateError))
+
+			status, _ := native.DownloadStatus(downloadID)
+			Expect(status.ErrorMessage).To(Equal("Unexpected HTTP status: 404 Not Found"))
+		})
+
+		It("Should limit the bandwidth", func() {
+			native := getNativeClient(downloadDir, map[string]interface{}{"max_speed": 20000})
+			startedAt := time.Now()
+
+			downloadID, _ := native.Download(stub.server.URL+"/HTGAWM.mkv", nil)
+
+			Eventually(nativeState(native, downloadID), 2*time.Second).Should(Equal(StateComplete))
+			Expect(time.Since(startedAt)).To(BeNumerically(">=", 400*time.Millisecond))
+		})
+	})
+
+	Describe(".Pause() and .Resume()", func() {
+		It("Should resume the download where it stopped", func() {
+			stub.gate = make(chan struct{})
+			native := getNativeClient(downloadDir, map[string]interface{}{"segments": 2})
+
+			downloadID, _ := native.Download(stub.server.URL+"/HTGAWM.mkv", nil)
+			Eventually(nativeState(native, downloadID)).Should(Equal(StateActive))
+
+			Expect(native.Pause(downloadID)).To(Succeed())
+			Expect(nativeState(native, downloadID)()).To(Equal(StatePaused))
+
+			paused, _ := native.List(StateWaiting)
+			Expect(paused[0].ID).To(Equal(downloadID))
+
+			close(stub.gate)
+			Expect(native.Resume(downloadID)).To(Succeed())
+
+			Eventually(nativeState(native, downloadID)).Should(Equal(StateComplete))
+
+			content, _ := ioutil.ReadFile(filepath.Join(downloadDir, "HTGAWM.mkv"))
+			Expect(content).To(Equal(stub.content))
+		})
+
+		It("Should return an error for an unknown download", func() {
+			native := getNativeClient(downloadDir, nil)
+
+			Expect(native.Pause("unknown").Error()).To(Equal("Unknown download"))
+		})
+	})
+
+	Describe(".Remove() and .Purge()", func() {
+		It("Should remove the download and forget it", func() {
+			stub.gate = make(chan struct{})
+			defer close(stub.gate)
+			native := getNativeClient(downloadDir, nil)
+
+			downloadID, _ := native.Download(stub.server.URL+"/HTGAWM.mkv", nil)
+			Eventually(nativeState(native, downloadID)).Should(Equal(StateActive))
+
+			Expect(native.Remove(downloadID)).To(Succeed())
+			Expect(filepath.Join(downloadDir, "HTGAWM.mkv.part")).NotTo(BeAnExistingFile())
+
+			stopped, _ := native.List(StateStopped)
+			Expect(stopped[0].State).To(Equal(StateRemoved))
+
+			Expect(native.Purge()).To(Succeed())
+
+			stopped, _ = native.List(StateStopped)
+			Expect(stopped).To(BeEmpty())
+		})
+	})
+
+	Context("with an interrupted download in the state file", func() {
+		It("Should resume it on start", func() {
+			statePath := filepath.Join(downloadDir, "downloads.json")
+			state := fmt.Sprintf(`[{"ID":"96676fbc46cbbc04","URI":"%s/HTGAWM.mkv","Name":"HTGAWM.mkv","Dir":"%s","State":"active","TotalBytes":10000,"Segments":[{"Start":0,"End":9999,"Done":5000}]}]`, stub.server.URL, downloadDir)
+			ioutil.WriteFile(statePath, []byte(state), 0600)
+			ioutil.WriteFile(filepath.Join(downloadDir, "HTGAWM.mkv.part"), stub.content[:5000], 0644)
+
+			native := getNativeClient(downloadDir, map[string]interface{}{"state_path": statePath})
+
+			Eventually(nativeState(native, "96676fbc46cbbc04")).Should(Equal(StateComplete))
+			Expect(stub.requestedRanges()).To(Equal([]string{"bytes=5000-9999"}))
+
+			content, _ := ioutil.ReadFile(filepath.Join(downloadDir, "HTGAWM.mkv"))
+			Expect(content).To(Equal(stub.content))
+
+			stateData, _ := ioutil.ReadFile(statePath)
+			Expect(strings.Contains(string(stateData), `"State": "complete"`)).To(BeTrue())
+		})
+
+		It("Should only read it without transfers", func() {
+			SetNativeTransfers(false)
+
+			statePath := filepath.Join(downloadDir, "downloads.json")
+			state := fmt.Sprintf(`[{"ID":"96676fbc46cbbc04","URI":"%s/HTGAWM.mkv","Name":"HTGAWM.mkv","Dir":"%s","State":"active","TotalBytes":10000,"Segments":[{"Start":0,"End":9999,"Done":5000}]}]`, stub.server.URL, downloadDir)
+			ioutil.WriteFile(statePath, []byte(state), 0600)
+
+			native := getNativeClient(downloadDir, map[string]interface{}{"state_path": statePath})
+
+			statuses, listError := native.List(StateActive)
+			Expect(listError).NotTo(HaveOccurred())
+			Expect(statuses).To(HaveLen(1))
+			Expect(statuses[0].CompletedBytes).To(Equal(int64(5000)))
+
+			_, downloadError := native.Download(stub.server.URL+"/HTGAWM.mkv", nil)
+			Expect(downloadError).To(HaveOccurred())
+			Expect(native.Pause("96676fbc46cbbc04")).NotTo(Succeed())
+			Expect(native.Remove("96676fbc46cbbc04")).NotTo(Succeed())
+			Expect(native.Purge()).NotTo(Succeed())
+
+			Consistently(stub.requestedRanges, "50ms").Should(BeEmpty())
+
+			stateData, _ := ioutil.ReadFile(statePath)
+			Expect(string(stateData)).To(Equal(state))
+		})
+	})
+
+	Describe("state file", func() {
+		AfterEach(func() {
+			OnNativeSaveError(nil)
+		})
+
+		It("Should report the saves failing during the transfers", func() {
+			stateDir := filepath.Join(downloadDir, "state")
+			os.Mkdir(stateDir, 0700)
+
+			saveErrors := make(chan error, 10)
+			OnNativeSaveError(func(err error) { saveErrors <- err })
+
+			stub.gate = make(chan struct{})
+			native := getNativeClient(downloadDir, map[string]interface{}{"state_path": filepath.Join(stateDir, "downloads.json")})
+
+			downloadID, _ := native.Download(stub.server.URL+"/HTGAWM.mkv", nil)
+			Eventually(nativeState(native, downloadID)).Should(Equal(StateActive))
+
+			os.RemoveAll(stateDir)
+			close(stub.gate)
+
+			Eventually(nativeState(native, downloadID)).Should(Equal(StateComplete))
+			Eventually(saveErrors).Should(Receive(MatchError(HavePrefix("Native state " + stateDir))))
+		})
+	})
+
+	Describe(".Listen()", func() {
+		It("Should send the download events", func() {
+			native := getNativeClient(downloadDir, nil)
+			events := make(chan *DownloadEvent, 10)
+			stop := make(chan struct{})
+			defer close(stop)
+
+			go native.Listen(events, stop)
+			time.Sleep(10 * time.Millisecond)
+
+			downloadID, _ := native.Download(stub.server.URL+"/HTGAWM.mkv", nil)
+
+			var startEvent, completeEvent *DownloadEvent
+			Eventually(events).Should(Receive(&startEvent))
+			Eventually(events).Should(Receive(&completeEvent))
+
+			Expect(startEvent.Type).To(Equal(EventStart))
+			Expect(completeEvent.Type).To(Equal(EventComplete))
+			Expect(completeEvent.DownloadID).To(Equal(downloadID))
+		})
+	})
+})
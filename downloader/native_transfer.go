@@ -0,0 +1,363 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// nativeSaveInterval is the interval between two saves of running downloads
+const nativeSaveInterval = time.Second
+
+// nativeBufferSize is the size of the chunks read from responses
+const nativeBufferSize = 32 * 1024
+
+// errNativeStopped interrupts a transfer stopped by the user
+var errNativeStopped = errors.New("Download stopped")
+
+// rateLimiter delays transfers to stay under a shared bandwidth
+type rateLimiter struct {
+	// bytesPerSecond is the maximum speed, zero meaning unlimited
+	bytesPerSecond int64
+
+	mutex sync.Mutex
+	next  time.Time
+}
+
+// wait blocks until byteCount bytes may be transferred
+func (rl *rateLimiter) wait(byteCount int) {
+	if rl.bytesPerSecond <= 0 {
+		return
+	}
+
+	rl.mutex.Lock()
+	now := time.Now()
+	if rl.next.Before(now) {
+		rl.next = now
+	}
+	rl.next = rl.next.Add(time.Duration(int64(byteCount) * int64(time.Second) / rl.bytesPerSecond))
+	wakeUpAt := rl.next
+	rl.mutex.Unlock()
+
+	time.Sleep(time.Until(wakeUpAt))
+}
+
+// start runs a download in background
+//
+// Must be called with the manager mutex held.
+func (nm *nativeManager) start(download *nativeDownload) {
+	download.stop = make(chan struct{})
+	go nm.run(download, download.stop)
+}
+
+// run downloads all the remaining segments then moves the file in place
+func (nm *nativeManager) run(download *nativeDownload, stop chan struct{}) {
+	transferError := nm.transfer(download, stop)
+
+	nm.mutex.Lock()
+
+	select {
+	case <-stop:
+		// Paused or removed, the state is already set
+		nm.mutex.Unlock()
+		nm.saveInBackground()
+		return
+	default:
+	}
+
+	download.stop = nil
+
+	if transferError == nil {
+		transferError = os.Rename(download.partPath(), download.path())
+	}
+
+	if transferError != nil {
+		download.State = StateError
+		download.ErrorMessage = transferError.Error()
+		nm.publish(EventError, download.ID)
+	} else {
+		download.State = StateComplete
+		nm.publish(EventComplete, download.ID)
+	}
+
+	nm.mutex.Unlock()
+	nm.saveInBackground()
+}
+
+// transfer fetches the segments of a download in parallel
+func (nm *nativeManager) transfer(download *nativeDownload, stop chan struct{}) error {
+	nm.mutex.Lock()
+	isProbed := len(download.Segments) > 0
+	nm.mutex.Unlock()
+
+	if !isProbed {
+		probeError := nm.retry(stop, func() error { return nm.probe(download) })
+		if probeError != nil {
+			return probeError
+		}
+	}
+
+	nm.mutex.Lock()
+	select {
+	case <-stop:
+		nm.mutex.Unlock()
+		return errNativeStopped
+	default:
+	}
+
+	download.State = StateActive
+	download.startedAt = time.Now()
+	download.startBytes = download.completedBytes()
+	segments := download.Segments
+	partPath := download.partPath()
+	nm.publish(EventStart, download.ID)
+	nm.mutex.Unlock()
+
+	mkdirError := os.MkdirAll(filepath.Dir(partPath), 0755)
+	if mkdirError != nil {
+		return mkdirError
+	}
+
+	partFile, openError := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, 0644)
+	if openError != nil {
+		return openError
+	}
+	defer partFile.Close()
+
+	// Saving progress regularly to resume after a restart
+	transferDone := make(chan struct{})
+	defer close(transferDone)
+
+	go func() {
+		ticker := time.NewTicker(nativeSaveInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				nm.saveInBackground()
+			case <-transferDone:
+				return
+			}
+		}
+	}()
+
+	segmentErrors := make(chan error, len(segments))
+
+	for _, segment := range segments {
+		go func(segment *nativeSegment) {
+			segmentErrors <- nm.retry(stop, func() error {
+				return nm.fetch(download, segment, partFile, stop)
+			})
+		}(segment)
+	}
+
+	var transferError error
+
+	for range segments {
+		segmentError := <-segmentErrors
+		if segmentError != nil && transferError == nil {
+			transferError = segmentError
+		}
+	}
+
+	return transferError
+}
+
+// retry calls action until it succeeds, is stopped or has no retries left
+func (nm *nativeManager) retry(stop chan struct{}, action func() error) error {
+	var actionError error
+
+	for attempt := 0; attempt <= nm.retries; attempt++ {
+		actionError = action()
+		if actionError == nil || actionError == errNativeStopped {
+			return actionError
+		}
+
+		select {
+		case <-stop:
+			return errNativeStopped
+		case <-time.After(nm.retryDelay):
+		}
+	}
+
+	return actionError
+}
+
+// probe gets the download size and name, and splits it into segments
+func (nm *nativeManager) probe(download *nativeDownload) error {
+	response, headError := nm.client.Head(download.URI)
+	if headError != nil {
+		return headError
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unexpected HTTP status: %s", response.Status)
+	}
+
+	nm.mutex.Lock()
+	defer nm.mutex.Unlock()
+
+	if download.Name == "" {
+		download.Name = responseFileName(response)
+	}
+
+	// Without ranges or size, the download is a single segment
+	if response.ContentLength <= 0 || response.Header.Get("Accept-Ranges") != "bytes" {
+		download.TotalBytes = response.ContentLength
+		if download.TotalBytes < 0 {
+			download.TotalBytes = 0
+		}
+		download.Segments = []*nativeSegment{{Start: 0, End: -1}}
+		return nil
+	}
+
+	download.TotalBytes = response.ContentLength
+
+	segmentsCount := int64(nm.segments)
+	if segmentsCount > download.TotalBytes {
+		segmentsCount = download.TotalBytes
+	}
+
+	segmentSize := download.TotalBytes / segmentsCount
+
+	for segmentIndex := int64(0); segmentIndex < segmentsCount; segmentIndex++ {
+		segment := &nativeSegment{Start: segmentIndex * segmentSize, End: (segmentIndex+1)*segmentSize - 1}
+		if segmentIndex == segmentsCount-1 {
+			segment.End = download.TotalBytes - 1
+		}
+
+		download.Segments = append(download.Segments, segment)
+	}
+
+	return nil
+}
+
+// fetch downloads the remaining bytes of a segment into the part file
+func (nm *nativeManager) fetch(download *nativeDownload, segment *nativeSegment, partFile *os.File, stop chan struct{}) error {
+	nm.mutex.Lock()
+	// Servers without ranges always send the whole file
+	if segment.End < 0 {
+		segment.Done = 0
+	}
+	offset := segment.Start + segment.Done
+	isComplete := segment.End >= 0 && offset > segment.End
+	nm.mutex.Unlock()
+
+	if isComplete {
+		return nil
+	}
+
+	request, requestError := http.NewRequest("GET", download.URI, nil)
+	if requestError != nil {
+		return requestError
+	}
+
+	if segment.End >= 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, segment.End))
+	}
+
+	response, responseError := nm.client.Do(request)
+	if responseError != nil {
+		return responseError
+	}
+	defer response.Body.Close()
+
+	expectedStatus := http.StatusOK
+	if segment.End >= 0 {
+		expectedStatus = http.StatusPartialContent
+	}
+
+	if response.StatusCode != expectedStatus {
+		return fmt.Errorf("Unexpected HTTP status: %s", response.Status)
+	}
+
+	buffer := make([]byte, nativeBufferSize)
+
+	for {
+		select {
+		case <-stop:
+			return errNativeStopped
+		default:
+		}
+
+		readCount, readError := response.Body.Read(buffer)
+
+		if readCount > 0 {
+			nm.limiter.wait(readCount)
+
+			writeError := nm.write(segment, partFile, buffer[:readCount], offset, stop)
+			if writeError != nil {
+				return writeError
+			}
+
+			offset += int64(readCount)
+		}
+
+		if readError == io.EOF {
+			break
+		}
+		if readError != nil {
+			return readError
+		}
+	}
+
+	nm.mutex.Lock()
+	defer nm.mutex.Unlock()
+
+	if segment.End >= 0 && segment.Start+segment.Done <= segment.End {
+		return io.ErrUnexpectedEOF
+	}
+
+	// Size was unknown until now
+	if segment.End < 0 {
+		download.TotalBytes = segment.Done
+	}
+
+	return nil
+}
+
+// write saves a chunk of a segment unless the download was stopped meanwhile
+func (nm *nativeManager) write(segment *nativeSegment, partFile *os.File, chunk []byte, offset int64, stop chan struct{}) error {
+	nm.mutex.Lock()
+	defer nm.mutex.Unlock()
+
+	select {
+	case <-stop:
+		return errNativeStopped
+	default:
+	}
+
+	_, writeError := partFile.WriteAt(chunk, offset)
+	if writeError != nil {
+		return writeError
+	}
+
+	segment.Done += int64(len(chunk))
+
+	return nil
+}
+
+// responseFileName returns the file name given by Content-Disposition or the
+// last part of the requested path
+func responseFileName(response *http.Response) string {
+	_, dispositionParams, dispositionError := mime.ParseMediaType(response.Header.Get("Content-Disposition"))
+	if dispositionError == nil && dispositionParams["filename"] != "" {
+		return filepath.Base(dispositionParams["filename"])
+	}
+
+	name := path.Base(response.Request.URL.Path)
+	if name == "/" || name == "." {
+		return ""
+	}
+
+	return name
+}
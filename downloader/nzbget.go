@@ -0,0 +1,399 @@
+package downloader
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/rpc/v2/json2"
+)
+
+// NZBGet is a downloader interface for the NZBGet JSON-RPC API
+// see https://nzbget.net/api/ for more infos
+type NZBGet struct {
+	client *http.Client
+
+	// rpcURL is the full URL to the NZBGet JSON-RPC endpoint
+	rpcURL string
+
+	// username and password are the NZBGet control credentials
+	username string
+	password string
+
+	// Allow to set a custom HTTP transport (for test purposes)
+	CustomTransport http.RoundTripper
+}
+
+// nzbgetDefaultTimeOut is the default timeout for http requests in seconds
+const nzbgetDefaultTimeOut = 10
+
+// nzbgetGroup is a queued NZB as returned by listgroups
+type nzbgetGroup struct {
+	NZBID           int
+	NZBName         string
+	Status          string
+	DestDir         string
+	FileSizeLo      uint32
+	FileSizeHi      uint32
+	RemainingSizeLo uint32
+	RemainingSizeHi uint32
+	URL             string
+}
+
+// nzbgetHistoryItem is a finished NZB as returned by history
+type nzbgetHistoryItem struct {
+	NZBID            int
+	Name             string
+	Status           string
+	DestDir          string
+	FileSizeLo       uint32
+	FileSizeHi       uint32
+	DownloadedSizeLo uint32
+	DownloadedSizeHi uint32
+	URL              string
+}
+
+// Auth initializes the NZBGet client
+func (nd *NZBGet) Auth(infos map[string]interface{}) error {
+	var rpcURLOkay bool
+
+	nd.rpcURL, rpcURLOkay = infos["rpc_url"].(string)
+	if !rpcURLOkay || nd.rpcURL == "" {
+		return errors.New("Invalid RPC url")
+	}
+
+	nd.username, _ = infos["username"].(string)
+	nd.password, _ = infos["password"].(string)
+
+	timeOut, timeOutOkay := infos["timeout"].(int)
+	if !timeOutOkay || timeOut == 0 {
+		timeOut = nzbgetDefaultTimeOut
+	}
+
+	nd.client = &http.Client{
+		Timeout:   time.Duration(timeOut) * time.Second,
+		Transport: nd.CustomTransport,
+	}
+
+	return nil
+}
+
+// Handles indicates that NZBGet only downloads NZB files
+func (nd *NZBGet) Handles(uri string) bool {
+	return IsNZB(uri)
+}
+
+// call sends a request to NZBGet
+func (nd *NZBGet) call(method string, params []interface{}, result interface{}) error {
+	message, encodeError := json2.EncodeClientRequest(method, params)
+	if encodeError != nil {
+		return encodeError
+	}
+
+	request, requestError := http.NewRequest("POST", nd.rpcURL, bytes.NewBuffer(message))
+	if requestError != nil {
+		return requestError
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+
+	if nd.username != "" {
+		request.SetBasicAuth(nd.username, nd.password)
+	}
+
+	response, responseError := nd.client.Do(request)
+	if responseError != nil {
+		return responseError
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("NZBGet RPC error: %s", response.Status)
+	}
+
+	return json2.DecodeClientResponse(response.Body, result)
+}
+
+// Download appends an NZB url to the queue
+//
+// Options are the category, the priority and the nzb_name shown in NZBGet.
+func (nd *NZBGet) Download(uri string, options map[string]interface{}) (string, error) {
+	nzbName, _ := options["nzb_name"].(string)
+	if nzbName == "" {
+		nzbName = nzbNameOf(uri)
+	}
+
+	category, _ := options["category"].(string)
+	priority := intOption(options, "priority", 0)
+
+	var nzbID int
+
+	callError := nd.call("append", []interface{}{
+		nzbName, uri, category, priority,
+		false, false, "", 0, "SCORE", []interface{}{},
+	}, &nzbID)
+	if callError != nil {
+		return "", callError
+	}
+
+	if nzbID <= 0 {
+		return "", fmt.Errorf("NZBGet refused %s", uri)
+	}
+
+	return strconv.Itoa(nzbID), nil
+}
+
+// DownloadBatch appends several NZB urls, one request at a time
+func (nd *NZBGet) DownloadBatch(uris []string, options map[string]interface{}) ([]*BatchResult, error) {
+	return downloadEach(nd, uris, options), nil
+}
+
+// DownloadStatus returns the status of a queued or finished NZB
+func (nd *NZBGet) DownloadStatus(downloadID string) (*DownloadStatus, error) {
+	statuses, statusesError := nd.statuses()
+	if statusesError != nil {
+		return nil, statusesError
+	}
+
+	for _, status := range statuses {
+		if status.ID == downloadID {
+			return status, nil
+		}
+	}
+
+	return nil, fmt.Errorf("NZB %s is not found", downloadID)
+}
+
+// Pause pauses a queued NZB
+func (nd *NZBGet) Pause(downloadID string) error {
+	return nd.editQueue("GroupPause", downloadID)
+}
+
+// Resume resumes a paused NZB
+func (nd *NZBGet) Resume(downloadID string) error {
+	return nd.editQueue("GroupResume", downloadID)
+}
+
+// Remove deletes a queued NZB, or hides it from the history once finished
+func (nd *NZBGet) Remove(downloadID string) error {
+	status, statusError := nd.DownloadStatus(downloadID)
+	if statusError != nil {
+		return statusError
+	}
+
+	if listStateOf(status.State) == StateStopped {
+		return nd.editQueue("HistoryDelete", downloadID)
+	}
+
+	return nd.editQueue("GroupDelete", downloadID)
+}
+
+// List returns all the NZBs in a given state
+func (nd *NZBGet) List(state DownloadState) ([]*DownloadStatus, error) {
+	statuses, statusesError := nd.statuses()
+	if statusesError != nil {
+		return nil, statusesError
+	}
+
+	filteredStatuses := make([]*DownloadStatus, 0)
+
+	for _, status := range statuses {
+		if listStateOf(status.State) == state {
+			filteredStatuses = append(filteredStatuses, status)
+		}
+	}
+
+	return filteredStatuses, nil
+}
+
+// Purge hides all the NZBs from the history
+func (nd *NZBGet) Purge() error {
+	var history []*nzbgetHistoryItem
+
+	callError := nd.call("history", []interface{}{false}, &history)
+	if callError != nil {
+		return callError
+	}
+
+	if len(history) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(history))
+	for itemIndex, item := range history {
+		ids[itemIndex] = strconv.Itoa(item.NZBID)
+	}
+
+	return nd.editQueue("HistoryDelete", ids...)
+}
+
+// FreeSpace returns the free disk space of the NZBGet destination dir
+func (nd *NZBGet) FreeSpace() (int64, error) {
+	var status struct {
+		FreeDiskSpaceLo uint32
+		FreeDiskSpaceHi uint32
+	}
+
+	callError := nd.call("status", []interface{}{}, &status)
+	if callError != nil {
+		return 0, callError
+	}
+
+	return nzbgetSize(status.FreeDiskSpaceLo, status.FreeDiskSpaceHi), nil
+}
+
+// editQueue runs an editqueue command on some NZBs
+func (nd *NZBGet) editQueue(command string, downloadIDs ...string) error {
+	ids := make([]int, len(downloadIDs))
+
+	for idIndex, downloadID := range downloadIDs {
+		id, idError := strconv.Atoi(downloadID)
+		if idError != nil {
+			return fmt.Errorf("Invalid NZB id %s", downloadID)
+		}
+
+		ids[idIndex] = id
+	}
+
+	var isEdited bool
+
+	callError := nd.call("editqueue", []interface{}{command, "", ids}, &isEdited)
+	if callError != nil {
+		return callError
+	}
+
+	if !isEdited {
+		return fmt.Errorf("NZBGet could not %s %s", command, strings.Join(downloadIDs, ", "))
+	}
+
+	return nil
+}
+
+// statuses returns the queue then the history as download statuses
+func (nd *NZBGet) statuses() ([]*DownloadStatus, error) {
+	var groups []*nzbgetGroup
+	var history []*nzbgetHistoryItem
+
+	callError := nd.call("listgroups", []interface{}{0}, &groups)
+	if callError != nil {
+		return nil, callError
+	}
+
+	callError = nd.call("history", []interface{}{false}, &history)
+	if callError != nil {
+		return nil, callError
+	}
+
+	statuses := make([]*DownloadStatus, 0, len(groups)+len(history))
+
+	for _, group := range groups {
+		statuses = append(statuses, group.downloadStatus())
+	}
+
+	for _, item := range history {
+		statuses = append(statuses, item.downloadStatus())
+	}
+
+	return statuses, nil
+}
+
+// nzbgetSize joins the two 32 bits parts of an NZBGet size
+func nzbgetSize(low, high uint32) int64 {
+	return int64(high)<<32 | int64(low)
+}
+
+// downloadStatus maps a queued NZB to a DownloadStatus
+func (ng *nzbgetGroup) downloadStatus() *DownloadStatus {
+	status := &DownloadStatus{
+		ID:         strconv.Itoa(ng.NZBID),
+		Name:       ng.NZBName,
+		Dir:        ng.DestDir,
+		TotalBytes: nzbgetSize(ng.FileSizeLo, ng.FileSizeHi),
+	}
+
+	status.CompletedBytes = status.TotalBytes - nzbgetSize(ng.RemainingSizeLo, ng.RemainingSizeHi)
+	status.Files = []*DownloadFile{{
+		Path:           status.Dir,
+		TotalBytes:     status.TotalBytes,
+		CompletedBytes: status.CompletedBytes,
+		URIs:           []string{ng.URL},
+	}}
+
+	switch ng.Status {
+	case "QUEUED":
+		status.State = StateWaiting
+	case "PAUSED":
+		status.State = StatePaused
+	default:
+		// Downloading, fetching or post-processing
+		status.State = StateActive
+	}
+
+	return status
+}
+
+// downloadStatus maps a finished NZB to a DownloadStatus
+func (nh *nzbgetHistoryItem) downloadStatus() *DownloadStatus {
+	status := &DownloadStatus{
+		ID:             strconv.Itoa(nh.NZBID),
+		Name:           nh.Name,
+		Dir:            nh.DestDir,
+		TotalBytes:     nzbgetSize(nh.FileSizeLo, nh.FileSizeHi),
+		CompletedBytes: nzbgetSize(nh.DownloadedSizeLo, nh.DownloadedSizeHi),
+	}
+
+	status.Files = []*DownloadFile{{
+		Path:           status.Dir,
+		TotalBytes:     status.TotalBytes,
+		CompletedBytes: status.CompletedBytes,
+		URIs:           []string{nh.URL},
+	}}
+
+	// Statuses are formatted as "SUCCESS/ALL", "FAILURE/PAR"…
+	switch strings.SplitN(nh.Status, "/", 2)[0] {
+	case "SUCCESS", "WARNING":
+		status.State = StateComplete
+	case "DELETED":
+		status.State = StateRemoved
+	default:
+		status.State = StateError
+		status.ErrorMessage = nh.Status
+	}
+
+	return status
+}
+
+// IsNZB indicates if an uri is an NZB file or a newznab download link
+func IsNZB(uri string) bool {
+	parsedURI, parseError := url.Parse(uri)
+	if parseError != nil {
+		return false
+	}
+
+	if strings.HasSuffix(strings.ToLower(parsedURI.Path), ".nzb") {
+		return true
+	}
+
+	// Newznab indexers serve NZBs through their API
+	return strings.HasSuffix(parsedURI.Path, "/api") && parsedURI.Query().Get("t") == "get"
+}
+
+// nzbNameOf returns a file name for an NZB uri
+func nzbNameOf(uri string) string {
+	parsedURI, parseError := url.Parse(uri)
+	if parseError == nil {
+		name := path.Base(parsedURI.Path)
+		if strings.HasSuffix(strings.ToLower(name), ".nzb") {
+			return name
+		}
+	}
+
+	return ""
+}
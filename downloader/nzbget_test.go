@@ -0,0 +1,203 @@
+package downloader_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/davidderus/christopher/downloader"
+)
+
+// stubNZBGet is a minimal NZBGet JSON-RPC server
+type stubNZBGet struct {
+	server   *httptest.Server
+	requests []map[string]interface{}
+}
+
+func newStubNZBGet() *stubNZBGet {
+	stub := &stubNZBGet{}
+
+	groups := []map[string]interface{}{
+		{"NZBID": 12, "NZBName": "Zombie.One.S01E01", "Status": "DOWNLOADING", "DestDir": "/downloads/inter/Zombie.One.S01E01", "FileSizeLo": 1000, "FileSizeHi": 1, "RemainingSizeLo": 600, "RemainingSizeHi": 0},
+		{"NZBID": 13, "NZBName": "Shark.Avocado", "Status": "PAUSED", "FileSizeLo": 500},
+	}
+
+	history := []map[string]interface{}{
+		{"NZBID": 10, "Name": "HTGAWM", "Status": "SUCCESS/ALL", "FileSizeLo": 500, "DownloadedSizeLo": 500},
+		{"NZBID": 11, "Name": "Broken", "Status": "FAILURE/PAR", "FileSizeLo": 500},
+	}
+
+	stub.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, _ := r.BasicAuth()
+		if username != "nzbget" || password != "tegbzn6789" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var request map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&request)
+		stub.requests = append(stub.requests, request)
+
+		params := request["params"].([]interface{})
+		response := map[string]interface{}{"version": "1.1"}
+
+		switch request["method"] {
+		case "append":
+			if params[1] == "https://indexer.org/nzb/invalid.nzb" {
+				response["result"] = 0
+				break
+			}
+			response["result"] = 12
+		case "listgroups":
+			response["result"] = groups
+		case "history":
+			response["result"] = history
+		case "editqueue":
+			response["result"] = true
+		default:
+			response["error"] = map[string]interface{}{"name": "JSONRPCError", "code": 1, "message": "Invalid procedure"}
+		}
+
+		json.NewEncoder(w).Encode(response)
+	}))
+
+	return stub
+}
+
+func (stub *stubNZBGet) lastParams() []interface{} {
+	return stub.requests[len(stub.requests)-1]["params"].([]interface{})
+}
+
+func getNZBGetClient(stub *stubNZBGet) *NZBGet {
+	nzbget := &NZBGet{}
+	nzbget.Auth(map[string]interface{}{
+		"rpc_url":  stub.server.URL + "/jsonrpc",
+		"username": "nzbget",
+		"password": "tegbzn6789",
+	})
+
+	return nzbget
+}
+
+var _ = Describe("NZBGet", func() {
+	var stub *stubNZBGet
+	var nzbget *NZBGet
+
+	BeforeEach(func() {
+		stub = newStubNZBGet()
+		nzbget = getNZBGetClient(stub)
+	})
+
+	AfterEach(func() {
+		stub.server.Close()
+	})
+
+	Describe(".Auth()", func() {
+		It("Should return an error on missing url", func() {
+			authError := (&NZBGet{}).Auth(map[string]interface{}{})
+
+			Expect(authError.Error()).To(Equal("Invalid RPC url"))
+		})
+	})
+
+	Describe(".Handles()", func() {
+		It("Should only handle NZBs", func() {
+			Expect(nzbget.Handles("https://indexer.org/nzb/Zombie.One.S01E01.nzb")).To(BeTrue())
+			Expect(nzbget.Handles("magnet:?xt=urn:btih:a1b2c3")).To(BeFalse())
+		})
+	})
+
+	Describe(".Download()", func() {
+		It("Should append the NZB with its options", func() {
+			downloadOptions := map[string]interface{}{"category": "Series", "priority": int64(50)}
+
+			nzbID, downloadError := nzbget.Download("https://indexer.org/nzb/Zombie.One.S01E01.nzb", downloadOptions)
+
+			Expect(downloadError).NotTo(HaveOccurred())
+			Expect(nzbID).To(Equal("12"))
+
+			params := stub.lastParams()
+			Expect(params[0]).To(Equal("Zombie.One.S01E01.nzb"))
+			Expect(params[1]).To(Equal("https://indexer.org/nzb/Zombie.One.S01E01.nzb"))
+			Expect(params[2]).To(Equal("Series"))
+			Expect(params[3]).To(BeEquivalentTo(50))
+		})
+
+		It("Should return an error when refused", func() {
+			_, downloadError := nzbget.Download("https://indexer.org/nzb/invalid.nzb", nil)
+
+			Expect(downloadError.Error()).To(Equal("NZBGet refused https://indexer.org/nzb/invalid.nzb"))
+		})
+	})
+
+	Describe(".DownloadStatus()", func() {
+		It("Should map a queued NZB", func() {
+			status, statusError := nzbget.DownloadStatus("12")
+
+			Expect(statusError).NotTo(HaveOccurred())
+			Expect(status.Name).To(Equal("Zombie.One.S01E01"))
+			Expect(status.State).To(Equal(StateActive))
+			Expect(status.TotalBytes).To(Equal(int64(4294968296)))
+			Expect(status.CompletedBytes).To(Equal(int64(4294967696)))
+		})
+
+		It("Should map a finished NZB", func() {
+			status, _ := nzbget.DownloadStatus("11")
+
+			Expect(status.State).To(Equal(StateError))
+			Expect(status.ErrorMessage).To(Equal("FAILURE/PAR"))
+		})
+
+		It("Should return an error for an unknown NZB", func() {
+			_, statusError := nzbget.DownloadStatus("42")
+
+			Expect(statusError.Error()).To(Equal("NZB 42 is not found"))
+		})
+	})
+
+	Describe(".List()", func() {
+		It("Should filter queue and history by state", func() {
+			active, _ := nzbget.List(StateActive)
+			waiting, _ := nzbget.List(StateWaiting)
+			stopped, _ := nzbget.List(StateStopped)
+
+			Expect(active[0].ID).To(Equal("12"))
+			Expect(waiting[0].State).To(Equal(StatePaused))
+			Expect(stopped[0].State).To(Equal(StateComplete))
+			Expect(len(stopped)).To(Equal(2))
+		})
+	})
+
+	Describe(".Pause(), .Resume() and .Remove()", func() {
+		It("Should edit the queue", func() {
+			Expect(nzbget.Pause("12")).To(Succeed())
+			Expect(stub.lastParams()[0]).To(Equal("GroupPause"))
+
+			Expect(nzbget.Resume("12")).To(Succeed())
+			Expect(stub.lastParams()[0]).To(Equal("GroupResume"))
+
+			Expect(nzbget.Remove("12")).To(Succeed())
+			Expect(stub.lastParams()[0]).To(Equal("GroupDelete"))
+
+			Expect(nzbget.Remove("10")).To(Succeed())
+			Expect(stub.lastParams()[0]).To(Equal("HistoryDelete"))
+		})
+
+		It("Should reject invalid ids", func() {
+			Expect(nzbget.Pause("a1b2c3").Error()).To(Equal("Invalid NZB id a1b2c3"))
+		})
+	})
+
+	Describe(".Purge()", func() {
+		It("Should delete the history", func() {
+			Expect(nzbget.Purge()).To(Succeed())
+
+			params := stub.lastParams()
+			Expect(params[0]).To(Equal("HistoryDelete"))
+			Expect(params[2]).To(Equal([]interface{}{10.0, 11.0}))
+		})
+	})
+})
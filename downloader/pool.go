@@ -0,0 +1,232 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PoolStrategy is the way a Pool chooses the downloader of the next download
+type PoolStrategy string
+
+const (
+	// StrategyRoundRobin uses the pool downloaders one after another
+	StrategyRoundRobin PoolStrategy = "round-robin"
+
+	// StrategyFewestActive uses the downloader with the fewest active downloads
+	StrategyFewestActive PoolStrategy = "fewest-active"
+
+	// StrategyMostFreeSpace uses the downloader reporting the most free disk
+	// space, downloaders unable to report it coming last
+	StrategyMostFreeSpace PoolStrategy = "most-free-space"
+)
+
+// defaultHealthCheckInterval is the default time a downloader health is
+// trusted before being checked again
+const defaultHealthCheckInterval = 30 * time.Second
+
+var errPoolUnavailable = errors.New("No reachable downloader in pool")
+
+// SpaceReporter is implemented by downloaders able to report their free disk
+// space
+type SpaceReporter interface {
+	// FreeSpace returns the free space in bytes where files are downloaded
+	FreeSpace() (int64, error)
+}
+
+// Pool balances downloads between several downloaders
+//
+// Downloaders are checked by listing their active downloads. Unreachable
+// downloaders are taken out of rotation until their next health check.
+type Pool struct {
+	strategy PoolStrategy
+
+	// HealthCheckInterval is the time a downloader health is trusted
+	HealthCheckInterval time.Duration
+
+	mutex   sync.Mutex
+	members []*poolMember
+
+	// next is the index of the next round-robin candidate
+	next int
+}
+
+// poolMember is a downloader of a pool and its last known state
+type poolMember struct {
+	id         string
+	downloader Downloader
+
+	checkedAt   time.Time
+	healthy     bool
+	activeCount int
+
+	// freeSpace is -1 if unknown
+	freeSpace int64
+}
+
+// ParsePoolStrategy returns a PoolStrategy from its name, round-robin being
+// the default
+func ParsePoolStrategy(strategy string) (PoolStrategy, error) {
+	switch PoolStrategy(strategy) {
+	case "":
+		return StrategyRoundRobin, nil
+	case StrategyRoundRobin, StrategyFewestActive, StrategyMostFreeSpace:
+		return PoolStrategy(strategy), nil
+	default:
+		return "", fmt.Errorf("Invalid pool strategy %s", strategy)
+	}
+}
+
+// NewPool returns an empty pool using a given strategy
+func NewPool(strategy string) (*Pool, error) {
+	poolStrategy, strategyError := ParsePoolStrategy(strategy)
+	if strategyError != nil {
+		return nil, strategyError
+	}
+
+	return &Pool{strategy: poolStrategy, HealthCheckInterval: defaultHealthCheckInterval}, nil
+}
+
+// Add adds a downloader to the pool under a given id
+func (p *Pool) Add(id string, downloader Downloader) *Pool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.members = append(p.members, &poolMember{id: id, downloader: downloader, freeSpace: -1})
+	return p
+}
+
+// Select returns the id of the downloader to use for the next download
+//
+// Outdated members are checked without holding the pool mutex, so a slow
+// downloader does not block the other selections.
+func (p *Pool) Select() (string, error) {
+	p.mutex.Lock()
+
+	var outdatedMembers []*poolMember
+	for _, member := range p.members {
+		if member.checkedAt.IsZero() || time.Since(member.checkedAt) >= p.HealthCheckInterval {
+			outdatedMembers = append(outdatedMembers, member)
+		}
+	}
+
+	p.mutex.Unlock()
+
+	healths := make([]*poolHealth, len(outdatedMembers))
+	for memberIndex, member := range outdatedMembers {
+		healths[memberIndex] = checkHealth(member.downloader)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for memberIndex, member := range outdatedMembers {
+		health := healths[memberIndex]
+
+		member.checkedAt = time.Now()
+		member.healthy = health.healthy
+		member.activeCount = health.activeCount
+		member.freeSpace = health.freeSpace
+	}
+
+	var selected *poolMember
+
+	switch p.strategy {
+	case StrategyFewestActive:
+		selected = p.fewestActive()
+	case StrategyMostFreeSpace:
+		selected = p.mostFreeSpace()
+	default:
+		selected = p.roundRobin()
+	}
+
+	if selected == nil {
+		return "", errPoolUnavailable
+	}
+
+	// Counting the upcoming download until the next health check
+	selected.activeCount++
+
+	return selected.id, nil
+}
+
+// poolHealth is the state of a downloader found by a health check
+type poolHealth struct {
+	healthy     bool
+	activeCount int
+
+	// freeSpace is -1 if unknown
+	freeSpace int64
+}
+
+// checkHealth lists the active downloads of a downloader and its free space
+func checkHealth(downloader Downloader) *poolHealth {
+	health := &poolHealth{freeSpace: -1}
+
+	activeDownloads, listError := downloader.List(StateActive)
+	if listError != nil {
+		return health
+	}
+
+	health.healthy = true
+	health.activeCount = len(activeDownloads)
+
+	reporter, isReporter := downloader.(SpaceReporter)
+	if isReporter {
+		freeSpace, spaceError := reporter.FreeSpace()
+		if spaceError == nil {
+			health.freeSpace = freeSpace
+		}
+	}
+
+	return health
+}
+
+// roundRobin returns the next healthy member after the previous one
+func (p *Pool) roundRobin() *poolMember {
+	membersCount := len(p.members)
+
+	for offset := 0; offset < membersCount; offset++ {
+		memberIndex := (p.next + offset) % membersCount
+
+		if p.members[memberIndex].healthy {
+			p.next = memberIndex + 1
+			return p.members[memberIndex]
+		}
+	}
+
+	return nil
+}
+
+// fewestActive returns the healthy member with the fewest active downloads
+func (p *Pool) fewestActive() *poolMember {
+	var selected *poolMember
+
+	for _, member := range p.members {
+		if member.healthy && (selected == nil || member.activeCount < selected.activeCount) {
+			selected = member
+		}
+	}
+
+	return selected
+}
+
+// mostFreeSpace returns the healthy member with the most free space, the
+// fewest active downloads breaking ties
+func (p *Pool) mostFreeSpace() *poolMember {
+	var selected *poolMember
+
+	for _, member := range p.members {
+		if !member.healthy {
+			continue
+		}
+
+		if selected == nil || member.freeSpace > selected.freeSpace ||
+			(member.freeSpace == selected.freeSpace && member.activeCount < selected.activeCount) {
+			selected = member
+		}
+	}
+
+	return selected
+}
@@ -0,0 +1,159 @@
+package downloader_test
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/davidderus/christopher/downloader"
+)
+
+// fakeDownloader reports a fixed number of active downloads and free space
+type fakeDownloader struct {
+	Downloader
+
+	activeCount int
+	freeSpace   int64
+	unreachable bool
+
+	// release delays the listing until closed, if set
+	release chan struct{}
+}
+
+func (fd *fakeDownloader) List(state DownloadState) ([]*DownloadStatus, error) {
+	if fd.release != nil {
+		<-fd.release
+	}
+
+	if fd.unreachable {
+		return nil, errors.New("Connection refused")
+	}
+
+	return make([]*DownloadStatus, fd.activeCount), nil
+}
+
+func (fd *fakeDownloader) FreeSpace() (int64, error) {
+	if fd.freeSpace < 0 {
+		return 0, errors.New("Unknown free space")
+	}
+
+	return fd.freeSpace, nil
+}
+
+var _ = Describe("Pool", func() {
+	selectN := func(pool *Pool, count int) []string {
+		var ids []string
+
+		for selection := 0; selection < count; selection++ {
+			id, selectError := pool.Select()
+			Expect(selectError).NotTo(HaveOccurred())
+			ids = append(ids, id)
+		}
+
+		return ids
+	}
+
+	Describe("NewPool", func() {
+		It("should default to round-robin", func() {
+			_, poolError := NewPool("")
+			Expect(poolError).NotTo(HaveOccurred())
+		})
+
+		It("should reject unknown strategies", func() {
+			_, poolError := NewPool("random")
+			Expect(poolError.Error()).To(Equal("Invalid pool strategy random"))
+		})
+	})
+
+	Context("with the round-robin strategy", func() {
+		It("should use the downloaders one after another", func() {
+			pool, _ := NewPool("round-robin")
+			pool.Add("first", &fakeDownloader{}).Add("second", &fakeDownloader{}).Add("third", &fakeDownloader{})
+
+			Expect(selectN(pool, 4)).To(Equal([]string{"first", "second", "third", "first"}))
+		})
+
+		It("should skip unreachable downloaders", func() {
+			pool, _ := NewPool("round-robin")
+			pool.Add("first", &fakeDownloader{}).Add("second", &fakeDownloader{unreachable: true}).Add("third", &fakeDownloader{})
+
+			Expect(selectN(pool, 3)).To(Equal([]string{"first", "third", "first"}))
+		})
+	})
+
+	Context("with the fewest-active strategy", func() {
+		It("should count the selected downloads", func() {
+			pool, _ := NewPool("fewest-active")
+			pool.Add("busy", &fakeDownloader{activeCount: 2}).Add("idle", &fakeDownloader{})
+
+			Expect(selectN(pool, 4)).To(Equal([]string{"idle", "idle", "busy", "idle"}))
+		})
+	})
+
+	Context("with the most-free-space strategy", func() {
+		It("should prefer the downloader with the most free space", func() {
+			pool, _ := NewPool("most-free-space")
+			pool.Add("unknown", &fakeDownloader{freeSpace: -1}).
+				Add("small", &fakeDownloader{freeSpace: 1000}).
+				Add("large", &fakeDownloader{freeSpace: 5000, unreachable: true}).
+				Add("medium", &fakeDownloader{freeSpace: 3000})
+
+			Expect(selectN(pool, 2)).To(Equal([]string{"medium", "medium"}))
+		})
+	})
+
+	Context("with a health check interval", func() {
+		It("should check downloaders again once expired", func() {
+			flaky := &fakeDownloader{unreachable: true}
+
+			pool, _ := NewPool("round-robin")
+			pool.Add("flaky", flaky).Add("stable", &fakeDownloader{})
+
+			Expect(selectN(pool, 2)).To(Equal([]string{"stable", "stable"}))
+
+			flaky.unreachable = false
+			Expect(selectN(pool, 1)).To(Equal([]string{"stable"}))
+
+			pool.HealthCheckInterval = 0
+			Expect(selectN(pool, 2)).To(Equal([]string{"flaky", "stable"}))
+		})
+	})
+
+	Context("with a slow downloader", func() {
+		It("should not lock the pool while checking it", func() {
+			slow := &fakeDownloader{release: make(chan struct{})}
+
+			pool, _ := NewPool("round-robin")
+			pool.Add("slow", slow)
+
+			selectedIDs := make(chan string, 1)
+			go func() {
+				id, _ := pool.Select()
+				selectedIDs <- id
+			}()
+
+			added := make(chan struct{})
+			go func() {
+				pool.Add("fast", &fakeDownloader{})
+				close(added)
+			}()
+
+			Eventually(added).Should(BeClosed())
+			Consistently(selectedIDs).ShouldNot(Receive())
+
+			close(slow.release)
+			Eventually(selectedIDs).Should(Receive(Equal("slow")))
+		})
+	})
+
+	Context("without reachable downloader", func() {
+		It("should return an error", func() {
+			pool, _ := NewPool("fewest-active")
+			pool.Add("down", &fakeDownloader{unreachable: true})
+
+			_, selectError := pool.Select()
+			Expect(selectError.Error()).To(Equal("No reachable downloader in pool"))
+		})
+	})
+})
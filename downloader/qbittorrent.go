@@ -0,0 +1,577 @@
+package downloader
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QBittorrent is a downloader interface for the qBittorrent Web API
+// see https://github.com/qbittorrent/qBittorrent/wiki/WebUI-API-(qBittorrent-4.1)
+type QBittorrent struct {
+	client *http.Client
+
+	// baseURL is the qBittorrent WebUI root URL
+	baseURL string
+
+	username string
+	password string
+
+	// loggedIn is true once the session cookie is set
+	loggedIn      bool
+	loggedInMutex sync.Mutex
+
+	// Allow to set a custom HTTP transport (for test purposes)
+	CustomTransport http.RoundTripper
+}
+
+const (
+	// qbittorrentDefaultTimeOut is the default timeout for http requests in seconds
+	qbittorrentDefaultTimeOut = 10
+
+	// qbittorrentOkay is the body of a successful qBittorrent request
+	qbittorrentOkay = "Ok."
+)
+
+var errQBittorrentLogin = errors.New("Invalid qBittorrent credentials")
+
+// maxTorrentFileSize bounds the torrent files fetched to compute their hash
+const maxTorrentFileSize = 10 * 1024 * 1024
+
+// qbittorrentTorrent is a torrent as returned by /api/v2/torrents/info
+type qbittorrentTorrent struct {
+	Hash      string `json:"hash"`
+	Name      string `json:"name"`
+	State     string `json:"state"`
+	SavePath  string `json:"save_path"`
+	Size      int64  `json:"size"`
+	Completed int64  `json:"completed"`
+	DLSpeed   int64  `json:"dlspeed"`
+	ETA       int64  `json:"eta"`
+	MagnetURI string `json:"magnet_uri"`
+}
+
+// qbittorrentFile is a torrent file as returned by /api/v2/torrents/files
+type qbittorrentFile struct {
+	Name     string  `json:"name"`
+	Size     int64   `json:"size"`
+	Progress float64 `json:"progress"`
+}
+
+// Auth initializes the qBittorrent client
+//
+// Login happens on the first request and each time the session expires.
+func (qb *QBittorrent) Auth(infos map[string]interface{}) error {
+	var baseURLOkay bool
+
+	qb.baseURL, baseURLOkay = infos["base_url"].(string)
+	if !baseURLOkay || qb.baseURL == "" {
+		return errors.New("Invalid base url")
+	}
+	qb.baseURL = strings.TrimSuffix(qb.baseURL, "/")
+
+	qb.username, _ = infos["username"].(string)
+	qb.password, _ = infos["password"].(string)
+
+	timeOut, timeOutOkay := infos["timeout"].(int)
+	if !timeOutOkay || timeOut == 0 {
+		timeOut = qbittorrentDefaultTimeOut
+	}
+
+	cookieJar, jarError := cookiejar.New(nil)
+	if jarError != nil {
+		return jarError
+	}
+
+	qb.client = &http.Client{
+		Timeout:   time.Duration(timeOut) * time.Second,
+		Transport: qb.CustomTransport,
+		Jar:       cookieJar,
+	}
+
+	return nil
+}
+
+// Handles indicates that qBittorrent only downloads torrents and magnets
+func (qb *QBittorrent) Handles(uri string) bool {
+	return IsTorrent(uri)
+}
+
+// login opens a new qBittorrent session
+func (qb *QBittorrent) login() error {
+	form := url.Values{}
+	form.Set("username", qb.username)
+	form.Set("password", qb.password)
+
+	request, requestError := http.NewRequest("POST", qb.baseURL+"/api/v2/auth/login", strings.NewReader(form.Encode()))
+	if requestError != nil {
+		return requestError
+	}
+
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// qBittorrent CSRF protection requires a matching Referer
+	request.Header.Set("Referer", qb.baseURL)
+
+	response, responseError := qb.client.Do(request)
+	if responseError != nil {
+		return responseError
+	}
+	defer response.Body.Close()
+
+	body, _ := ioutil.ReadAll(response.Body)
+	if response.StatusCode != http.StatusOK || string(body) != qbittorrentOkay {
+		return errQBittorrentLogin
+	}
+
+	qb.loggedIn = true
+
+	return nil
+}
+
+// call sends a request to the Web API, logging in again on expired session
+//
+// A nil form sends a GET request with params as query.
+func (qb *QBittorrent) call(path string, params url.Values, form url.Values) ([]byte, error) {
+	qb.loggedInMutex.Lock()
+	defer qb.loggedInMutex.Unlock()
+
+	if !qb.loggedIn {
+		loginError := qb.login()
+		if loginError != nil {
+			return nil, loginError
+		}
+	}
+
+	statusCode, body, callError := qb.send(path, params, form)
+	if callError != nil {
+		return nil, callError
+	}
+
+	// Session cookie expired or was revoked
+	if statusCode == http.StatusForbidden {
+		qb.loggedIn = false
+
+		loginError := qb.login()
+		if loginError != nil {
+			return nil, loginError
+		}
+
+		statusCode, body, callError = qb.send(path, params, form)
+		if callError != nil {
+			return nil, callError
+		}
+	}
+
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("qBittorrent API error: %d %s", statusCode, strings.TrimSpace(string(body)))
+	}
+
+	return body, nil
+}
+
+// send performs a single Web API request
+func (qb *QBittorrent) send(path string, params url.Values, form url.Values) (int, []byte, error) {
+	var request *http.Request
+	var requestError error
+
+	endpoint := qb.baseURL + path
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+
+	if form == nil {
+		request, requestError = http.NewRequest("GET", endpoint, nil)
+	} else {
+		request, requestError = http.NewRequest("POST", endpoint, strings.NewReader(form.Encode()))
+		if request != nil {
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+	if requestError != nil {
+		return 0, nil, requestError
+	}
+
+	request.Header.Set("Referer", qb.baseURL)
+
+	response, responseError := qb.client.Do(request)
+	if responseError != nil {
+		return 0, nil, responseError
+	}
+	defer response.Body.Close()
+
+	body, readError := ioutil.ReadAll(response.Body)
+
+	return response.StatusCode, body, readError
+}
+
+// Download adds a torrent from an URL or a magnet link
+//
+// Options are sent as torrents/add fields, such as category or savepath.
+// The torrent hash is read from magnet links, or computed from the torrent
+// file fetched beforehand as qBittorrent adds torrents asynchronously.
+func (qb *QBittorrent) Download(uri string, options map[string]interface{}) (string, error) {
+	hash := magnetHash(uri)
+	if hash == "" {
+		var hashError error
+
+		hash, hashError = qb.torrentFileHash(uri)
+		if hashError != nil {
+			return "", hashError
+		}
+	}
+
+	form := url.Values{}
+	for optionName, optionValue := range options {
+		form.Set(optionName, fmt.Sprint(optionValue))
+	}
+	form.Set("urls", uri)
+
+	body, callError := qb.call("/api/v2/torrents/add", nil, form)
+	if callError != nil {
+		return "", callError
+	}
+
+	if strings.TrimSpace(string(body)) != qbittorrentOkay {
+		return "", fmt.Errorf("qBittorrent refused %s", uri)
+	}
+
+	return hash, nil
+}
+
+// torrentFileHash fetches a torrent file and returns its info hash
+func (qb *QBittorrent) torrentFileHash(uri string) (string, error) {
+	client := &http.Client{Timeout: qb.client.Timeout, Transport: qb.CustomTransport}
+
+	response, responseError := client.Get(uri)
+	if responseError != nil {
+		return "", responseError
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Unable to fetch %s: %s", uri, response.Status)
+	}
+
+	torrentData, readError := ioutil.ReadAll(io.LimitReader(response.Body, maxTorrentFileSize))
+	if readError != nil {
+		return "", readError
+	}
+
+	return torrentHash(torrentData)
+}
+
+// DownloadBatch adds several torrents, one request at a time
+func (qb *QBittorrent) DownloadBatch(uris []string, options map[string]interface{}) ([]*BatchResult, error) {
+	return downloadEach(qb, uris, options), nil
+}
+
+// DownloadStatus returns the status of a torrent and its files
+func (qb *QBittorrent) DownloadStatus(downloadID string) (*DownloadStatus, error) {
+	torrents, torrentsError := qb.torrents(url.Values{"hashes": {downloadID}})
+	if torrentsError != nil {
+		return nil, torrentsError
+	}
+
+	if len(torrents) == 0 {
+		return nil, fmt.Errorf("Torrent %s is not found", downloadID)
+	}
+
+	status := torrents[0].downloadStatus()
+
+	body, callError := qb.call("/api/v2/torrents/files", url.Values{"hash": {downloadID}}, nil)
+	if callError != nil {
+		return nil, callError
+	}
+
+	var files []*qbittorrentFile
+
+	decodeError := json.Unmarshal(body, &files)
+	if decodeError != nil {
+		return nil, decodeError
+	}
+
+	for _, file := range files {
+		status.Files = append(status.Files, &DownloadFile{
+			Path:           strings.TrimSuffix(status.Dir, "/") + "/" + file.Name,
+			TotalBytes:     file.Size,
+			CompletedBytes: int64(float64(file.Size) * file.Progress),
+			URIs:           []string{torrents[0].MagnetURI},
+		})
+	}
+
+	return status, nil
+}
+
+// Pause pauses a torrent
+func (qb *QBittorrent) Pause(downloadID string) error {
+	_, callError := qb.call("/api/v2/torrents/pause", nil, url.Values{"hashes": {downloadID}})
+	return callError
+}
+
+// Resume resumes a paused torrent
+func (qb *QBittorrent) Resume(downloadID string) error {
+	_, callError := qb.call("/api/v2/torrents/resume", nil, url.Values{"hashes": {downloadID}})
+	return callError
+}
+
+// Remove removes a torrent, keeping its downloaded data
+func (qb *QBittorrent) Remove(downloadID string) error {
+	_, callError := qb.call("/api/v2/torrents/delete", nil, url.Values{
+		"hashes":      {downloadID},
+		"deleteFiles": {"false"},
+	})
+	return callError
+}
+
+// List returns all the torrents in a given state
+func (qb *QBittorrent) List(state DownloadState) ([]*DownloadStatus, error) {
+	torrents, torrentsError := qb.torrents(nil)
+	if torrentsError != nil {
+		return nil, torrentsError
+	}
+
+	statuses := make([]*DownloadStatus, 0)
+
+	for _, torrent := range torrents {
+		status := torrent.downloadStatus()
+
+		if listStateOf(status.State) == state {
+			statuses = append(statuses, status)
+		}
+	}
+
+	return statuses, nil
+}
+
+// Purge removes the paused torrents which are finished or failed, keeping
+// their data
+//
+// Seeding torrents are kept until qBittorrent pauses them, once their share
+// ratio or seeding time limit is reached.
+func (qb *QBittorrent) Purge() error {
+	torrents, torrentsError := qb.torrents(nil)
+	if torrentsError != nil {
+		return torrentsError
+	}
+
+	var hashes []string
+	for _, torrent := range torrents {
+		switch torrent.State {
+		case "pausedUP", "stoppedUP", "error", "missingFiles":
+			hashes = append(hashes, torrent.Hash)
+		}
+	}
+
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	return qb.Remove(strings.Join(hashes, "|"))
+}
+
+// FreeSpace returns the free disk space reported by qBittorrent
+func (qb *QBittorrent) FreeSpace() (int64, error) {
+	body, callError := qb.call("/api/v2/sync/maindata", nil, nil)
+	if callError != nil {
+		return 0, callError
+	}
+
+	var mainData struct {
+		ServerState struct {
+			FreeSpaceOnDisk int64 `json:"free_space_on_disk"`
+		} `json:"server_state"`
+	}
+
+	decodeError := json.Unmarshal(body, &mainData)
+	if decodeError != nil {
+		return 0, decodeError
+	}
+
+	return mainData.ServerState.FreeSpaceOnDisk, nil
+}
+
+// torrents gets the torrents matching the given filters
+func (qb *QBittorrent) torrents(filters url.Values) ([]*qbittorrentTorrent, error) {
+	body, callError := qb.call("/api/v2/torrents/info", filters, nil)
+	if callError != nil {
+		return nil, callError
+	}
+
+	var torrents []*qbittorrentTorrent
+
+	decodeError := json.Unmarshal(body, &torrents)
+	if decodeError != nil {
+		return nil, decodeError
+	}
+
+	return torrents, nil
+}
+
+// downloadStatus maps a qBittorrent torrent to a DownloadStatus
+func (qt *qbittorrentTorrent) downloadStatus() *DownloadStatus {
+	status := &DownloadStatus{
+		ID:             qt.Hash,
+		Name:           qt.Name,
+		Dir:            qt.SavePath,
+		TotalBytes:     qt.Size,
+		CompletedBytes: qt.Completed,
+		DownloadSpeed:  qt.DLSpeed,
+		Files:          make([]*DownloadFile, 0),
+	}
+
+	// qBittorrent uses 8640000 (100 days) for an unknown ETA
+	if qt.ETA > 0 && qt.ETA < 8640000 {
+		status.ETA = time.Duration(qt.ETA) * time.Second
+	}
+
+	switch qt.State {
+	case "error", "missingFiles":
+		status.State = StateError
+		status.ErrorMessage = qt.State
+	case "downloading", "stalledDL", "forcedDL", "metaDL", "forcedMetaDL":
+		status.State = StateActive
+	case "queuedDL", "checkingDL", "allocating", "checkingResumeData", "moving":
+		status.State = StateWaiting
+	case "pausedDL", "stoppedDL":
+		status.State = StatePaused
+	case "uploading", "stalledUP", "queuedUP", "forcedUP", "checkingUP", "pausedUP", "stoppedUP":
+		status.State = StateComplete
+	default:
+		status.State = StateWaiting
+	}
+
+	return status
+}
+
+// torrentHash returns the lowercased hex info hash of a torrent file, the
+// SHA-1 of its bencoded info dictionary
+func torrentHash(torrentData []byte) (string, error) {
+	invalidTorrentError := errors.New("Invalid torrent file")
+
+	if len(torrentData) == 0 || torrentData[0] != 'd' {
+		return "", invalidTorrentError
+	}
+
+	// Looking for the info key among the torrent keys
+	position := 1
+	for position < len(torrentData) && torrentData[position] != 'e' {
+		keyEnd, keyError := bencodeEnd(torrentData, position)
+		if keyError != nil {
+			return "", invalidTorrentError
+		}
+
+		valueEnd, valueError := bencodeEnd(torrentData, keyEnd)
+		if valueError != nil {
+			return "", invalidTorrentError
+		}
+
+		if string(torrentData[position:keyEnd]) == "4:info" {
+			infoHash := sha1.Sum(torrentData[keyEnd:valueEnd])
+			return hex.EncodeToString(infoHash[:]), nil
+		}
+
+		position = valueEnd
+	}
+
+	return "", invalidTorrentError
+}
+
+// bencodeEnd returns the position following the bencoded value starting at
+// a given position
+func bencodeEnd(data []byte, start int) (int, error) {
+	if start >= len(data) {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	switch {
+	case data[start] == 'i':
+		end := bytes.IndexByte(data[start:], 'e')
+		if end < 0 {
+			return 0, io.ErrUnexpectedEOF
+		}
+
+		return start + end + 1, nil
+	case data[start] == 'l' || data[start] == 'd':
+		position := start + 1
+		for position < len(data) && data[position] != 'e' {
+			var itemError error
+
+			position, itemError = bencodeEnd(data, position)
+			if itemError != nil {
+				return 0, itemError
+			}
+		}
+
+		if position >= len(data) {
+			return 0, io.ErrUnexpectedEOF
+		}
+
+		return position + 1, nil
+	case data[start] >= '0' && data[start] <= '9':
+		colon := bytes.IndexByte(data[start:], ':')
+		if colon < 0 {
+			return 0, io.ErrUnexpectedEOF
+		}
+
+		length, lengthError := strconv.Atoi(string(data[start : start+colon]))
+		if lengthError != nil {
+			return 0, lengthError
+		}
+
+		end := start + colon + 1 + length
+		if end > len(data) {
+			return 0, io.ErrUnexpectedEOF
+		}
+
+		return end, nil
+	default:
+		return 0, fmt.Errorf("Invalid bencode value at %d", start)
+	}
+}
+
+// magnetHash returns the lowercased hex info hash of a magnet link, if any
+func magnetHash(uri string) string {
+	if !strings.HasPrefix(uri, "magnet:") {
+		return ""
+	}
+
+	parsedURI, parseError := url.Parse(uri)
+	if parseError != nil {
+		return ""
+	}
+
+	for _, exactTopic := range parsedURI.Query()["xt"] {
+		if !strings.HasPrefix(exactTopic, "urn:btih:") {
+			continue
+		}
+
+		hash := strings.TrimPrefix(exactTopic, "urn:btih:")
+
+		// Base32 encoded hashes are converted to hex as qBittorrent does
+		if len(hash) == 32 {
+			decodedHash, decodeError := base32.StdEncoding.DecodeString(strings.ToUpper(hash))
+			if decodeError != nil {
+				return ""
+			}
+
+			return hex.EncodeToString(decodedHash)
+		}
+
+		return strings.ToLower(hash)
+	}
+
+	return ""
+}
@@ -0,0 +1,241 @@
+package downloader_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/davidderus/christopher/downloader"
+)
+
+// stubQBittorrent is a minimal qBittorrent Web API server
+type stubQBittorrent struct {
+	server       *httptest.Server
+	loginsCount  int
+	validSession string
+	lastPath     string
+	lastForm     url.Values
+}
+
+func newStubQBittorrent() *stubQBittorrent {
+	stub := &stubQBittorrent{}
+
+	torrents := []map[string]interface{}{
+		{"hash": "c12fe1c06bba254a9dc9f519b335aa7c1367a88a", "name": "Zombie.One.S01E01", "state": "downloading", "save_path": "/downloads/", "size": 1000, "completed": 400, "dlspeed": 100, "eta": 6, "magnet_uri": "magnet:?xt=urn:btih:c12fe1c06bba254a9dc9f519b335aa7c1367a88a"},
+		{"hash": "d4e5f6", "name": "Shark.Avocado", "state": "pausedDL", "size": 500},
+		{"hash": "g7h8i9", "name": "HTGAWM", "state": "stalledUP", "size": 500, "completed": 500},
+		{"hash": "j0k1l2", "name": "Broken", "state": "missingFiles", "size": 500, "eta": 8640000},
+		{"hash": "m3n4o5", "name": "Finished", "state": "pausedUP", "size": 500, "completed": 500},
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/HTGAWM.torrent", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "d8:announce22:http://tracker.org/ann4:infod6:lengthi500e4:name6:HTGAWM12:piece lengthi16384e6:pieces20:aaaaaaaaaaaaaaaaaaaaee")
+	})
+
+	mux.HandleFunc("/invalid.torrent", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html>Not a torrent</html>")
+	})
+
+	mux.HandleFunc("/api/v2/auth/login", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+
+		if r.PostForm.Get("username") != "admin" || r.PostForm.Get("password") != "adminadmin" {
+			fmt.Fprint(w, "Fails.")
+			return
+		}
+
+		stub.loginsCount++
+		stub.validSession = fmt.Sprintf("session-%d", stub.loginsCount)
+
+		http.SetCookie(w, &http.Cookie{Name: "SID", Value: stub.validSession, Path: "/"})
+		fmt.Fprint(w, "Ok.")
+	})
+
+	mux.HandleFunc("/api/v2/", func(w http.ResponseWriter, r *http.Request) {
+		cookie, cookieError := r.Cookie("SID")
+		if cookieError != nil || cookie.Value != stub.validSession {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, "Forbidden")
+			return
+		}
+
+		r.ParseForm()
+		stub.lastPath = r.URL.Path
+		stub.lastForm = r.PostForm
+
+		switch r.URL.Path {
+		case "/api/v2/torrents/add":
+			fmt.Fprint(w, "Ok.")
+		case "/api/v2/torrents/info":
+			selected := torrents
+			if hashes := r.URL.Query().Get("hashes"); hashes != "" {
+				selected = nil
+				for _, torrent := range torrents {
+					if torrent["hash"] == hashes {
+						selected = append(selected, torrent)
+					}
+				}
+			}
+			json.NewEncoder(w).Encode(selected)
+		case "/api/v2/torrents/files":
+			fmt.Fprint(w, `[{"name":"Zombie.One.S01E01.mkv","size":1000,"progress":0.4}]`)
+		default:
+			fmt.Fprint(w, "")
+		}
+	})
+
+	stub.server = httptest.NewServer(mux)
+
+	return stub
+}
+
+func getQBittorrentClient(stub *stubQBittorrent, password string) *QBittorrent {
+	qbittorrent := &QBittorrent{}
+	qbittorrent.Auth(map[string]interface{}{
+		"base_url": stub.server.URL,
+		"username": "admin",
+		"password": password,
+	})
+
+	return qbittorrent
+}
+
+var _ = Describe("QBittorrent", func() {
+	var stub *stubQBittorrent
+	var qbittorrent *QBittorrent
+
+	BeforeEach(func() {
+		stub = newStubQBittorrent()
+		qbittorrent = getQBittorrentClient(stub, "adminadmin")
+	})
+
+	AfterEach(func() {
+		stub.server.Close()
+	})
+
+	Describe(".Auth()", func() {
+		It("Should return an error on missing url", func() {
+			authError := (&QBittorrent{}).Auth(map[string]interface{}{})
+
+			Expect(authError.Error()).To(Equal("Invalid base url"))
+		})
+
+		It("Should return an error on invalid credentials", func() {
+			qbittorrent = getQBittorrentClient(stub, "invalid")
+
+			_, listError := qbittorrent.List(StateActive)
+
+			Expect(listError.Error()).To(Equal("Invalid qBittorrent credentials"))
+		})
+	})
+
+	Describe(".Download()", func() {
+		It("Should add a magnet with its options and return its hash", func() {
+			downloadOptions := map[string]interface{}{"category": "series", "savepath": "/media/series"}
+
+			hash, downloadError := qbittorrent.Download("magnet:?xt=urn:btih:C12FE1C06BBA254A9DC9F519B335AA7C1367A88A&dn=Zombie", downloadOptions)
+
+			Expect(downloadError).NotTo(HaveOccurred())
+			Expect(hash).To(Equal("c12fe1c06bba254a9dc9f519b335aa7c1367a88a"))
+			Expect(stub.lastForm.Get("urls")).To(HavePrefix("magnet:"))
+			Expect(stub.lastForm.Get("category")).To(Equal("series"))
+			Expect(stub.lastForm.Get("savepath")).To(Equal("/media/series"))
+		})
+
+		It("Should decode base32 magnet hashes", func() {
+			hash, _ := qbittorrent.Download("magnet:?xt=urn:btih:YEX6DQDLXISUVHOJ6UM3GNNKPQJWPKEK", nil)
+
+			Expect(hash).To(Equal("c12fe1c06bba254a9dc9f519b335aa7c1367a88a"))
+		})
+
+		It("Should compute the info hash of torrent files", func() {
+			hash, downloadError := qbittorrent.Download(stub.server.URL+"/HTGAWM.torrent", nil)
+
+			Expect(downloadError).NotTo(HaveOccurred())
+			Expect(hash).To(Equal("ffd66d0274d092c8c76bb2d34977c0815614ae47"))
+			Expect(stub.lastForm.Get("urls")).To(Equal(stub.server.URL + "/HTGAWM.torrent"))
+		})
+
+		It("Should refuse invalid torrent files", func() {
+			_, downloadError := qbittorrent.Download(stub.server.URL+"/invalid.torrent", nil)
+
+			Expect(downloadError).To(MatchError("Invalid torrent file"))
+			Expect(stub.lastPath).NotTo(Equal("/api/v2/torrents/add"))
+		})
+	})
+
+	Describe(".DownloadStatus()", func() {
+		It("Should map the torrent and its files to a status", func() {
+			status, statusError := qbittorrent.DownloadStatus("c12fe1c06bba254a9dc9f519b335aa7c1367a88a")
+
+			Expect(statusError).NotTo(HaveOccurred())
+			Expect(status.Name).To(Equal("Zombie.One.S01E01"))
+			Expect(status.State).To(Equal(StateActive))
+			Expect(status.CompletedBytes).To(Equal(int64(400)))
+			Expect(status.Files[0].Path).To(Equal("/downloads/Zombie.One.S01E01.mkv"))
+			Expect(status.Files[0].CompletedBytes).To(Equal(int64(400)))
+		})
+
+		It("Should return an error for an unknown torrent", func() {
+			_, statusError := qbittorrent.DownloadStatus("unknown")
+
+			Expect(statusError.Error()).To(Equal("Torrent unknown is not found"))
+		})
+	})
+
+	Describe(".List()", func() {
+		It("Should filter torrents by state", func() {
+			active, _ := qbittorrent.List(StateActive)
+			waiting, _ := qbittorrent.List(StateWaiting)
+			stopped, _ := qbittorrent.List(StateStopped)
+
+			Expect(len(active)).To(Equal(1))
+			Expect(waiting[0].State).To(Equal(StatePaused))
+			Expect(stopped[0].State).To(Equal(StateComplete))
+			Expect(stopped[1].State).To(Equal(StateError))
+			Expect(stopped[1].ETA).To(BeZero())
+		})
+	})
+
+	Describe(".Pause(), .Resume() and .Remove()", func() {
+		It("Should call the matching endpoints", func() {
+			Expect(qbittorrent.Pause("d4e5f6")).To(Succeed())
+			Expect(stub.lastPath).To(Equal("/api/v2/torrents/pause"))
+
+			Expect(qbittorrent.Resume("d4e5f6")).To(Succeed())
+			Expect(stub.lastPath).To(Equal("/api/v2/torrents/resume"))
+
+			Expect(qbittorrent.Remove("d4e5f6")).To(Succeed())
+			Expect(stub.lastPath).To(Equal("/api/v2/torrents/delete"))
+			Expect(stub.lastForm.Get("deleteFiles")).To(Equal("false"))
+		})
+	})
+
+	Describe(".Purge()", func() {
+		It("Should remove the finished and failed torrents, not the seeding ones", func() {
+			Expect(qbittorrent.Purge()).To(Succeed())
+
+			Expect(stub.lastForm.Get("hashes")).To(Equal("j0k1l2|m3n4o5"))
+		})
+	})
+
+	Context("with an expired session", func() {
+		It("Should log in again and retry", func() {
+			qbittorrent.List(StateActive)
+			stub.validSession = ""
+
+			active, listError := qbittorrent.List(StateActive)
+
+			Expect(listError).NotTo(HaveOccurred())
+			Expect(len(active)).To(Equal(1))
+			Expect(stub.loginsCount).To(Equal(2))
+		})
+	})
+})
@@ -0,0 +1,389 @@
+package downloader
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Transmission is a downloader interface for the Transmission RPC
+// see https://github.com/transmission/transmission/blob/master/extras/rpc-spec.txt
+type Transmission struct {
+	client *http.Client
+
+	// rpcURL is the full URL to the Transmission RPC endpoint
+	rpcURL string
+
+	// username and password are optional basic auth credentials
+	username string
+	password string
+
+	// sessionID is the CSRF token handed out by Transmission
+	sessionID      string
+	sessionIDMutex sync.RWMutex
+
+	// Allow to set a custom HTTP transport (for test purposes)
+	CustomTransport http.RoundTripper
+}
+
+const (
+	// transmissionDefaultTimeOut is the default timeout for http requests in seconds
+	transmissionDefaultTimeOut = 10
+
+	// transmissionSessionHeader is the header carrying the Transmission session id
+	transmissionSessionHeader = "X-Transmission-Session-Id"
+)
+
+// Transmission torrent status codes
+const (
+	transmissionStopped = iota
+	transmissionCheckWait
+	transmissionCheck
+	transmissionDownloadWait
+	transmissionDownload
+	transmissionSeedWait
+	transmissionSeed
+)
+
+// transmissionTorrentFields are the fields asked for on torrent-get
+var transmissionTorrentFields = []string{
+	"hashString", "name", "status", "error", "errorString", "downloadDir",
+	"sizeWhenDone", "leftUntilDone", "rateDownload", "eta", "percentDone",
+	"files", "magnetLink",
+}
+
+type transmissionRequest struct {
+	Method    string      `json:"method"`
+	Arguments interface{} `json:"arguments,omitempty"`
+}
+
+type transmissionResponse struct {
+	Result    string          `json:"result"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type transmissionTorrent struct {
+	HashString    string
+	Name          string
+	Status        int
+	Error         int
+	ErrorString   string
+	DownloadDir   string
+	SizeWhenDone  int64
+	LeftUntilDone int64
+	RateDownload  int64
+	ETA           int64
+	PercentDone   float64
+	MagnetLink    string
+	Files         []struct {
+		Name           string
+		Length         int64
+		BytesCompleted int64
+	}
+}
+
+// Auth initializes the Transmission client
+func (td *Transmission) Auth(infos map[string]interface{}) error {
+	var rpcURLOkay bool
+
+	td.rpcURL, rpcURLOkay = infos["rpc_url"].(string)
+	if !rpcURLOkay || td.rpcURL == "" {
+		return errors.New("Invalid RPC url")
+	}
+
+	td.username, _ = infos["username"].(string)
+	td.password, _ = infos["password"].(string)
+
+	timeOut, timeOutOkay := infos["timeout"].(int)
+	if !timeOutOkay || timeOut == 0 {
+		timeOut = transmissionDefaultTimeOut
+	}
+
+	td.client = &http.Client{
+		Timeout:   time.Duration(timeOut) * time.Second,
+		Transport: td.CustomTransport,
+	}
+
+	return nil
+}
+
+// Handles indicates that Transmission only downloads torrents and magnets
+func (td *Transmission) Handles(uri string) bool {
+	return IsTorrent(uri)
+}
+
+// call sends a request to Transmission, renewing the session id if needed
+func (td *Transmission) call(method string, arguments interface{}, result interface{}) error {
+	message, encodeError := json.Marshal(transmissionRequest{Method: method, Arguments: arguments})
+	if encodeError != nil {
+		return encodeError
+	}
+
+	response, responseError := td.post(message)
+	if responseError != nil {
+		return responseError
+	}
+
+	// A 409 is returned with a new session id on first call or expiry
+	if response.StatusCode == http.StatusConflict {
+		response.Body.Close()
+
+		td.sessionIDMutex.Lock()
+		td.sessionID = response.Header.Get(transmissionSessionHeader)
+		td.sessionIDMutex.Unlock()
+
+		response, responseError = td.post(message)
+		if responseError != nil {
+			return responseError
+		}
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("Transmission RPC error: %s", response.Status)
+	}
+
+	var rpcResponse transmissionResponse
+
+	decodeError := json.NewDecoder(response.Body).Decode(&rpcResponse)
+	if decodeError != nil {
+		return decodeError
+	}
+
+	if rpcResponse.Result != "success" {
+		return errors.New(rpcResponse.Result)
+	}
+
+	if result != nil && len(rpcResponse.Arguments) > 0 {
+		return json.Unmarshal(rpcResponse.Arguments, result)
+	}
+
+	return nil
+}
+
+// post sends a raw message with the current session id
+func (td *Transmission) post(message []byte) (*http.Response, error) {
+	request, requestError := http.NewRequest("POST", td.rpcURL, bytes.NewBuffer(message))
+	if requestError != nil {
+		return nil, requestError
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+
+	td.sessionIDMutex.RLock()
+	request.Header.Set(transmissionSessionHeader, td.sessionID)
+	td.sessionIDMutex.RUnlock()
+
+	if td.username != "" {
+		request.SetBasicAuth(td.username, td.password)
+	}
+
+	return td.client.Do(request)
+}
+
+// Download adds a torrent from an URL or a magnet link
+//
+// Options are passed as torrent-add arguments (download-dir, paused…)
+func (td *Transmission) Download(uri string, options map[string]interface{}) (string, error) {
+	arguments := make(map[string]interface{})
+	for optionName, optionValue := range options {
+		arguments[optionName] = optionValue
+	}
+	arguments["filename"] = uri
+
+	var added struct {
+		TorrentAdded     *transmissionTorrent `json:"torrent-added"`
+		TorrentDuplicate *transmissionTorrent `json:"torrent-duplicate"`
+	}
+
+	callError := td.call("torrent-add", arguments, &added)
+	if callError != nil {
+		return "", callError
+	}
+
+	if added.TorrentAdded != nil {
+		return added.TorrentAdded.HashString, nil
+	}
+
+	if added.TorrentDuplicate != nil {
+		return added.TorrentDuplicate.HashString, nil
+	}
+
+	return "", errors.New("No torrent added")
+}
+
+// DownloadBatch adds several torrents, one request at a time
+func (td *Transmission) DownloadBatch(uris []string, options map[string]interface{}) ([]*BatchResult, error) {
+	return downloadEach(td, uris, options), nil
+}
+
+// DownloadStatus returns the status of a torrent
+func (td *Transmission) DownloadStatus(downloadID string) (*DownloadStatus, error) {
+	torrents, torrentsError := td.torrents([]string{downloadID})
+	if torrentsError != nil {
+		return nil, torrentsError
+	}
+
+	if len(torrents) == 0 {
+		return nil, fmt.Errorf("Torrent %s is not found", downloadID)
+	}
+
+	return torrents[0].downloadStatus(), nil
+}
+
+// Pause stops a torrent
+func (td *Transmission) Pause(downloadID string) error {
+	return td.call("torrent-stop", map[string]interface{}{"ids": []string{downloadID}}, nil)
+}
+
+// Resume starts a stopped torrent
+func (td *Transmission) Resume(downloadID string) error {
+	return td.call("torrent-start", map[string]interface{}{"ids": []string{downloadID}}, nil)
+}
+
+// Remove removes a torrent, keeping its downloaded data
+func (td *Transmission) Remove(downloadID string) error {
+	return td.call("torrent-remove", map[string]interface{}{
+		"ids":               []string{downloadID},
+		"delete-local-data": false,
+	}, nil)
+}
+
+// List returns all the torrents in a given state
+func (td *Transmission) List(state DownloadState) ([]*DownloadStatus, error) {
+	torrents, torrentsError := td.torrents(nil)
+	if torrentsError != nil {
+		return nil, torrentsError
+	}
+
+	statuses := make([]*DownloadStatus, 0)
+
+	for _, torrent := range torrents {
+		status := torrent.downloadStatus()
+
+		if listStateOf(status.State) == state {
+			statuses = append(statuses, status)
+		}
+	}
+
+	return statuses, nil
+}
+
+// Purge removes the stopped torrents which are finished or failed, keeping
+// their data
+//
+// Seeding torrents are kept until Transmission stops them, once their seed
+// ratio or idle limit is reached.
+func (td *Transmission) Purge() error {
+	torrents, torrentsError := td.torrents(nil)
+	if torrentsError != nil {
+		return torrentsError
+	}
+
+	var ids []string
+	for _, torrent := range torrents {
+		if torrent.Status == transmissionStopped && (torrent.Error != 0 || torrent.PercentDone >= 1) {
+			ids = append(ids, torrent.HashString)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return td.call("torrent-remove", map[string]interface{}{
+		"ids":               ids,
+		"delete-local-data": false,
+	}, nil)
+}
+
+// FreeSpace returns the free disk space of the default download dir
+func (td *Transmission) FreeSpace() (int64, error) {
+	var session struct {
+		DownloadDir string `json:"download-dir"`
+	}
+
+	callError := td.call("session-get", map[string]interface{}{"fields": []string{"download-dir"}}, &session)
+	if callError != nil {
+		return 0, callError
+	}
+
+	var freeSpace struct {
+		SizeBytes int64 `json:"size-bytes"`
+	}
+
+	callError = td.call("free-space", map[string]interface{}{"path": session.DownloadDir}, &freeSpace)
+	if callError != nil {
+		return 0, callError
+	}
+
+	return freeSpace.SizeBytes, nil
+}
+
+// torrents gets the given torrents, or all of them if ids is nil
+func (td *Transmission) torrents(ids []string) ([]*transmissionTorrent, error) {
+	arguments := map[string]interface{}{"fields": transmissionTorrentFields}
+	if ids != nil {
+		arguments["ids"] = ids
+	}
+
+	var result struct {
+		Torrents []*transmissionTorrent
+	}
+
+	callError := td.call("torrent-get", arguments, &result)
+	if callError != nil {
+		return nil, callError
+	}
+
+	return result.Torrents, nil
+}
+
+// downloadStatus maps a Transmission torrent to a DownloadStatus
+func (tt *transmissionTorrent) downloadStatus() *DownloadStatus {
+	status := &DownloadStatus{
+		ID:             tt.HashString,
+		Name:           tt.Name,
+		Dir:            tt.DownloadDir,
+		TotalBytes:     tt.SizeWhenDone,
+		CompletedBytes: tt.SizeWhenDone - tt.LeftUntilDone,
+		DownloadSpeed:  tt.RateDownload,
+		Files:          make([]*DownloadFile, len(tt.Files)),
+	}
+
+	if tt.ETA > 0 {
+		status.ETA = time.Duration(tt.ETA) * time.Second
+	}
+
+	for fileIndex, file := range tt.Files {
+		status.Files[fileIndex] = &DownloadFile{
+			Path:           strings.TrimSuffix(tt.DownloadDir, "/") + "/" + file.Name,
+			TotalBytes:     file.Length,
+			CompletedBytes: file.BytesCompleted,
+			URIs:           []string{tt.MagnetLink},
+		}
+	}
+
+	switch {
+	case tt.Error != 0:
+		status.State = StateError
+		status.ErrorCode = fmt.Sprintf("%d", tt.Error)
+		status.ErrorMessage = tt.ErrorString
+	case tt.Status == transmissionDownload:
+		status.State = StateActive
+	case tt.Status == transmissionCheckWait, tt.Status == transmissionCheck, tt.Status == transmissionDownloadWait:
+		status.State = StateWaiting
+	case tt.Status == transmissionSeedWait, tt.Status == transmissionSeed, tt.PercentDone >= 1:
+		status.State = StateComplete
+	default:
+		status.State = StatePaused
+	}
+
+	return status
+}
@@ -0,0 +1,196 @@
+package downloader_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/davidderus/christopher/downloader"
+)
+
+const stubSessionID = "stub-session-id"
+
+// stubTransmission is a minimal Transmission RPC server
+type stubTransmission struct {
+	server   *httptest.Server
+	requests []map[string]interface{}
+	torrents []map[string]interface{}
+}
+
+func newStubTransmission() *stubTransmission {
+	stub := &stubTransmission{}
+
+	stub.torrents = []map[string]interface{}{
+		{"hashString": "a1b2c3", "name": "Zombie.One.S01E01", "status": 4, "error": 0, "downloadDir": "/downloads", "sizeWhenDone": 1000, "leftUntilDone": 600, "rateDownload": 100, "eta": 6, "percentDone": 0.4, "files": []map[string]interface{}{{"name": "Zombie.One.S01E01.mkv", "length": 1000, "bytesCompleted": 400}}},
+		{"hashString": "d4e5f6", "name": "Shark.Avocado", "status": 0, "error": 0, "sizeWhenDone": 500, "leftUntilDone": 500, "percentDone": 0},
+		{"hashString": "g7h8i9", "name": "HTGAWM", "status": 6, "error": 0, "sizeWhenDone": 500, "leftUntilDone": 0, "percentDone": 1},
+		{"hashString": "j0k1l2", "name": "Broken", "status": 0, "error": 3, "errorString": "No data found", "sizeWhenDone": 500, "leftUntilDone": 500},
+	}
+
+	stub.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Session id handshake
+		if r.Header.Get("X-Transmission-Session-Id") != stubSessionID {
+			w.Header().Set("X-Transmission-Session-Id", stubSessionID)
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		var request map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&request)
+		stub.requests = append(stub.requests, request)
+
+		arguments, _ := request["arguments"].(map[string]interface{})
+		response := map[string]interface{}{"result": "success"}
+
+		switch request["method"] {
+		case "torrent-add":
+			if arguments["filename"] == "magnet:?xt=urn:btih:invalid" {
+				response["result"] = "invalid or corrupt torrent file"
+				break
+			}
+			response["arguments"] = map[string]interface{}{
+				"torrent-added": map[string]interface{}{"hashString": "a1b2c3", "id": 1, "name": "Zombie.One.S01E01"},
+			}
+		case "torrent-get":
+			torrents := stub.torrents
+			if ids, hasIDs := arguments["ids"].([]interface{}); hasIDs {
+				torrents = nil
+				for _, torrent := range stub.torrents {
+					if torrent["hashString"] == ids[0] {
+						torrents = append(torrents, torrent)
+					}
+				}
+			}
+			response["arguments"] = map[string]interface{}{"torrents": torrents}
+		}
+
+		json.NewEncoder(w).Encode(response)
+	}))
+
+	return stub
+}
+
+func (stub *stubTransmission) lastRequest() map[string]interface{} {
+	return stub.requests[len(stub.requests)-1]
+}
+
+func getTransmissionClient(stub *stubTransmission) *Transmission {
+	transmission := &Transmission{}
+	transmission.Auth(map[string]interface{}{"rpc_url": stub.server.URL + "/transmission/rpc"})
+
+	return transmission
+}
+
+var _ = Describe("Transmission", func() {
+	var stub *stubTransmission
+	var transmission *Transmission
+
+	BeforeEach(func() {
+		stub = newStubTransmission()
+		transmission = getTransmissionClient(stub)
+	})
+
+	AfterEach(func() {
+		stub.server.Close()
+	})
+
+	Describe(".Auth()", func() {
+		It("Should return an error on missing url", func() {
+			authError := (&Transmission{}).Auth(map[string]interface{}{})
+
+			Expect(authError.Error()).To(Equal("Invalid RPC url"))
+		})
+	})
+
+	Describe(".Handles()", func() {
+		It("Should only handle torrents and magnets", func() {
+			Expect(transmission.Handles("magnet:?xt=urn:btih:a1b2c3")).To(BeTrue())
+			Expect(transmission.Handles("http://google.fr/Zombie.One.torrent?key=1")).To(BeTrue())
+			Expect(transmission.Handles("http://google.fr/Zombie.One.mkv")).To(BeFalse())
+		})
+	})
+
+	Describe(".Download()", func() {
+		It("Should add the torrent after the session handshake", func() {
+			downloadOptions := map[string]interface{}{"download-dir": "/media/series"}
+
+			hash, downloadError := transmission.Download("magnet:?xt=urn:btih:a1b2c3", downloadOptions)
+
+			Expect(downloadError).NotTo(HaveOccurred())
+			Expect(hash).To(Equal("a1b2c3"))
+
+			arguments := stub.lastRequest()["arguments"].(map[string]interface{})
+			Expect(arguments["filename"]).To(Equal("magnet:?xt=urn:btih:a1b2c3"))
+			Expect(arguments["download-dir"]).To(Equal("/media/series"))
+		})
+
+		It("Should return Transmission errors", func() {
+			_, downloadError := transmission.Download("magnet:?xt=urn:btih:invalid", nil)
+
+			Expect(downloadError.Error()).To(Equal("invalid or corrupt torrent file"))
+		})
+	})
+
+	Describe(".DownloadStatus()", func() {
+		It("Should map the torrent to a status", func() {
+			status, statusError := transmission.DownloadStatus("a1b2c3")
+
+			Expect(statusError).NotTo(HaveOccurred())
+			Expect(status.ID).To(Equal("a1b2c3"))
+			Expect(status.Name).To(Equal("Zombie.One.S01E01"))
+			Expect(status.State).To(Equal(StateActive))
+			Expect(status.TotalBytes).To(Equal(int64(1000)))
+			Expect(status.CompletedBytes).To(Equal(int64(400)))
+			Expect(status.Files[0].Path).To(Equal("/downloads/Zombie.One.S01E01.mkv"))
+		})
+
+		It("Should return an error for an unknown torrent", func() {
+			_, statusError := transmission.DownloadStatus("unknown")
+
+			Expect(statusError.Error()).To(Equal("Torrent unknown is not found"))
+		})
+	})
+
+	Describe(".List()", func() {
+		It("Should filter torrents by state", func() {
+			active, _ := transmission.List(StateActive)
+			waiting, _ := transmission.List(StateWaiting)
+			stopped, _ := transmission.List(StateStopped)
+
+			Expect(len(active)).To(Equal(1))
+			Expect(waiting[0].State).To(Equal(StatePaused))
+			Expect(len(stopped)).To(Equal(2))
+			Expect(stopped[0].State).To(Equal(StateComplete))
+			Expect(stopped[1].State).To(Equal(StateError))
+			Expect(stopped[1].ErrorMessage).To(Equal("No data found"))
+		})
+	})
+
+	Describe(".Pause(), .Resume() and .Remove()", func() {
+		It("Should send the matching methods", func() {
+			Expect(transmission.Pause("a1b2c3")).To(Succeed())
+			Expect(stub.lastRequest()["method"]).To(Equal("torrent-stop"))
+
+			Expect(transmission.Resume("a1b2c3")).To(Succeed())
+			Expect(stub.lastRequest()["method"]).To(Equal("torrent-start"))
+
+			Expect(transmission.Remove("a1b2c3")).To(Succeed())
+			Expect(stub.lastRequest()["method"]).To(Equal("torrent-remove"))
+			Expect(stub.lastRequest()["arguments"]).To(HaveKeyWithValue("delete-local-data", false))
+		})
+	})
+
+	Describe(".Purge()", func() {
+		It("Should remove the finished and failed torrents, not the seeding ones", func() {
+			stub.torrents = append(stub.torrents, map[string]interface{}{"hashString": "m3n4o5", "name": "Finished", "status": 0, "error": 0, "sizeWhenDone": 500, "leftUntilDone": 0, "percentDone": 1})
+
+			Expect(transmission.Purge()).To(Succeed())
+
+			arguments := stub.lastRequest()["arguments"].(map[string]interface{})
+			Expect(arguments["ids"]).To(Equal([]interface{}{"j0k1l2", "m3n4o5"}))
+		})
+	})
+})
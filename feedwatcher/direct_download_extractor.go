@@ -3,6 +3,7 @@ package feedwatcher
 import (
 	"fmt"
 	"regexp"
+	"strings"
 
 	"github.com/davidderus/christopher/config"
 )
@@ -68,3 +69,14 @@ func (dd *DirectDownload) Extract(feedItem *RemoteFeedItem) string {
 
 	return dd.extractFirst(description)
 }
+
+// ExtractMirrors extracts all the links from DirectDownload feed items, by
+// mirror
+func (dd *DirectDownload) ExtractMirrors(feedItem *RemoteFeedItem) []*Mirror {
+	links := urlMatcher.FindAllString(feedItem.Description, -1)
+	for linkIndex, link := range links {
+		links[linkIndex] = strings.TrimSpace(link)
+	}
+
+	return favoriteMirrors(groupMirrors(links), dd.options.FavoriteHosts)
+}
@@ -1,6 +1,8 @@
 package feedwatcher_test
 
 import (
+	"time"
+
 	"github.com/davidderus/christopher/config"
 	. "github.com/davidderus/christopher/feedwatcher"
 
@@ -14,12 +16,11 @@ var _ = Describe("FeedExtractor", func() {
 			var myRemoteFeed RemoteFeed
 			var newItems []*RemoteFeedItem
 			var extractor FeedExtractor
-			var extractorError error
 
 			BeforeEach(func() {
 				myRemoteFeed = RemoteFeed{Title: "New items feed", URL: "directdownload", Provider: "DirectDownload"}
 				newItems, _ = myRemoteFeed.NewItems(feedSinceDateWithItems, customFeedParser)
-				extractor, extractorError = NewFeedExtractor(myRemoteFeed.Provider, nil)
+				extractor, _ = NewFeedExtractor(myRemoteFeed.Provider, nil)
 			})
 
 			It("Should return the right extractor", func() {
@@ -58,6 +59,79 @@ var _ = Describe("FeedExtractor", func() {
 			})
 		})
 
+		Context("With mirrors", func() {
+			var newItems []*RemoteFeedItem
+
+			// hostsOf returns the host of each mirror
+			hostsOf := func(mirrors []*Mirror) []string {
+				hosts := make([]string, len(mirrors))
+				for mirrorIndex, mirror := range mirrors {
+					hosts[mirrorIndex] = mirror.Host
+				}
+
+				return hosts
+			}
+
+			BeforeEach(func() {
+				remoteFeed := RemoteFeed{Title: "New items feed", URL: "directdownload", Provider: "DirectDownload"}
+				newItems, _ = remoteFeed.NewItems(feedSinceDateWithItems, customFeedParser)
+			})
+
+			It("should return every host link", func() {
+				extractor, _ := NewFeedExtractor("DirectDownload", nil)
+
+				mirrors := newItems[1].DownloadMirrors(extractor)
+				Expect(hostsOf(mirrors)).To(Equal([]string{"rapidgator.net", "oboom.com", "k2s.cc"}))
+				Expect(mirrors[1].Links).To(Equal([]string{"https://www.oboom.com/file/HTGAWM.mkv"}))
+			})
+
+			It("should only return the favorite hosts, in order", func() {
+				extractor, _ := NewFeedExtractor("DirectDownload", config.ProviderOptions{FavoriteHosts: []string{"uploaded.net", "rapidgator.net"}})
+
+				Expect(hostsOf(newItems[0].DownloadMirrors(extractor))).To(Equal([]string{"uploaded.net", "rapidgator.net"}))
+				Expect(newItems[2].DownloadMirrors(extractor)).To(BeEmpty())
+			})
+
+			It("should group the parts of a split file", func() {
+				extractor, _ := NewFeedExtractor("DirectDownload", nil)
+
+				feedItem := &RemoteFeedItem{Description: `Zombie One (HDTV)<br />
+http://rapidgator.net/file/Zombie-One.part1.rar
+<br />http://rapidgator.net/file/Zombie-One.part2.rar
+<br />http://uploaded.net/file/Zombie-One.part1.rar
+<br />http://uploaded.net/file/Zombie-One.part2.rar
+<br />http://k2s.cc/file/Zombie-One.mkv
+<br />`}
+
+				Expect(feedItem.DownloadMirrors(extractor)).To(Equal([]*Mirror{
+					{Host: "rapidgator.net", Links: []string{"http://rapidgator.net/file/Zombie-One.part1.rar", "http://rapidgator.net/file/Zombie-One.part2.rar"}},
+					{Host: "uploaded.net", Links: []string{"http://uploaded.net/file/Zombie-One.part1.rar", "http://uploaded.net/file/Zombie-One.part2.rar"}},
+					{Host: "k2s.cc", Links: []string{"http://k2s.cc/file/Zombie-One.mkv"}},
+				}))
+			})
+
+			It("should give a feed link for each part, with its mirrors", func() {
+				splitItemParser := func(feedURL string) ([]*RemoteFeedItem, error) {
+					return []*RemoteFeedItem{{
+						GUID:        "split",
+						Title:       "Zombie One",
+						Description: "MD5: d41d8cd98f00b204e9800998ecf8427e\nhttp://rapidgator.net/file/Zombie-One.r00\nhttp://rapidgator.net/file/Zombie-One.r01\nhttp://uploaded.net/file/Zombie-One.r00\nhttp://uploaded.net/file/Zombie-One.r01\nhttp://k2s.cc/file/Zombie-One.mkv",
+						PublishedAt: time.Now(),
+					}}, nil
+				}
+
+				remoteFeed := RemoteFeed{Title: "Split feed", URL: "split", Provider: "DirectDownload"}
+
+				feedLinks, linksError := remoteFeed.NewFeedLinks(feedSinceDateWithItems, splitItemParser)
+				Expect(linksError).NotTo(HaveOccurred())
+
+				Expect(feedLinks).To(Equal([]*FeedLink{
+					{Link: "http://rapidgator.net/file/Zombie-One.r00", Feed: "Split feed", Title: "Zombie One", Mirrors: []string{"http://uploaded.net/file/Zombie-One.r00"}, ItemKey: "guid:split"},
+					{Link: "http://rapidgator.net/file/Zombie-One.r01", Feed: "Split feed", Title: "Zombie One", Mirrors: []string{"http://uploaded.net/file/Zombie-One.r01"}, ItemKey: "guid:split"},
+				}))
+			})
+		})
+
 		Context("With an unknown feed", func() {
 			It("should return nil", func() {
 				remoteFeed := RemoteFeed{Title: "New items feed", URL: "basic", Provider: "BBDown"}
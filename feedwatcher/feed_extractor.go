@@ -1,6 +1,10 @@
 package feedwatcher
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/davidderus/christopher/config"
+)
 
 // FeedExtractor takes feed items and return urls to download
 type FeedExtractor interface {
@@ -11,12 +15,21 @@ type FeedExtractor interface {
 }
 
 // NewFeedExtractor returns an extractor with some options
+//
+// Providers options may name the extractor to use, so several providers can
+// share a configurable extractor.
 func NewFeedExtractor(name string, options interface{}) (FeedExtractor, error) {
 	var extractor FeedExtractor
 
+	if providerOptions, isProviderOptions := options.(config.ProviderOptions); isProviderOptions && providerOptions.Extractor != "" {
+		name = providerOptions.Extractor
+	}
+
 	switch name {
 	case "DirectDownload", "directdownload", "dd", "directdownload.tv":
 		extractor = &DirectDownload{}
+	case "Generic", "generic", "rss", "atom":
+		extractor = &Generic{}
 	default:
 		return nil, errors.New("Invalid Feed Extractor")
 	}
@@ -28,7 +41,10 @@ func NewFeedExtractor(name string, options interface{}) (FeedExtractor, error) {
 		}
 	}
 
-	extractor.Init()
+	initError := extractor.Init()
+	if initError != nil {
+		return nil, initError
+	}
 
 	return extractor, nil
 }
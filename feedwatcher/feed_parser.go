@@ -1,10 +1,22 @@
 package feedwatcher
 
-import "github.com/mmcdole/gofeed"
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/mmcdole/gofeed/extensions"
+)
 
 // FeedParser abstracts a basic parser function
+//
+// Scraper.Parse and JSONParser.Parse are FeedParsers for other feed formats.
 type FeedParser func(feedURL string) ([]*RemoteFeedItem, error)
 
+// feedTimeOut is the timeout in seconds of a feed request
+const feedTimeOut = 30
+
 // GofeedParser is a an abstraction of the gofeed library returning feed items
 func GofeedParser(feedURL string) ([]*RemoteFeedItem, error) {
 	feedParser := gofeed.NewParser()
@@ -18,11 +30,82 @@ func GofeedParser(feedURL string) ([]*RemoteFeedItem, error) {
 
 	for index, feedItem := range parsedFeed.Items {
 		remoteFeedItems[index] = &RemoteFeedItem{
+			GUID:        feedItem.GUID,
 			Title:       feedItem.Title,
 			Link:        feedItem.Link,
 			Description: feedItem.Description,
-			PublishedAt: *feedItem.PublishedParsed}
+			Content:     feedItem.Content,
+			Elements:    extensionElements(feedItem.Extensions),
+		}
+
+		// RSS contents are only parsed as a custom element
+		if encodedContents := remoteFeedItems[index].Elements["content:encoded"]; feedItem.Content == "" && len(encodedContents) > 0 {
+			remoteFeedItems[index].Content = encodedContents[0]
+		}
+
+		for _, enclosure := range feedItem.Enclosures {
+			remoteFeedItems[index].Enclosures = append(remoteFeedItems[index].Enclosures, enclosure.URL)
+
+			// Torrent enclosures length is the one of the torrent file
+			if remoteFeedItems[index].Size == 0 && enclosure.Type != "application/x-bittorrent" {
+				remoteFeedItems[index].Size, _ = strconv.ParseInt(enclosure.Length, 10, 64)
+			}
+		}
+
+		if feedItem.PublishedParsed != nil {
+			remoteFeedItems[index].PublishedAt = *feedItem.PublishedParsed
+		} else if feedItem.UpdatedParsed != nil {
+			remoteFeedItems[index].PublishedAt = *feedItem.UpdatedParsed
+		}
 	}
 
 	return remoteFeedItems, nil
 }
+
+// extensionElements flattens the namespaced elements of an item by
+// "prefix:name", the url attribute being used for empty elements
+func extensionElements(extensions ext.Extensions) map[string][]string {
+	elements := make(map[string][]string)
+
+	for prefix, extensionsByName := range extensions {
+		for name, namedExtensions := range extensionsByName {
+			for _, extension := range namedExtensions {
+				value := extension.Value
+				if value == "" {
+					value = extension.Attrs["url"]
+				}
+
+				if value != "" {
+					elements[prefix+":"+name] = append(elements[prefix+":"+name], value)
+				}
+			}
+		}
+	}
+
+	return elements
+}
+
+// fetchFeed requests a feed with the given user agent, the response being
+// only returned on success
+func fetchFeed(client *http.Client, feedURL string, userAgent string) (*http.Response, error) {
+	request, requestError := http.NewRequest("GET", feedURL, nil)
+	if requestError != nil {
+		return nil, requestError
+	}
+
+	if userAgent != "" {
+		request.Header.Set("User-Agent", userAgent)
+	}
+
+	response, responseError := client.Do(request)
+	if responseError != nil {
+		return nil, responseError
+	}
+
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, fmt.Errorf("Unable to fetch %s: %s", feedURL, response.Status)
+	}
+
+	return response, nil
+}
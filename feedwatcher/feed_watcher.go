@@ -17,6 +17,10 @@ type FeedWatcher struct {
 	SinceDate time.Time
 	Scenario  *dispatcher.Scenario
 
+	// Story plays all the new links at once, it is used instead of Scenario
+	// if set
+	Story dispatcher.BatchStory
+
 	interval time.Duration
 	teller   *teller.Teller
 }
@@ -34,24 +38,63 @@ func NewFeedWatcher(interval time.Duration) (*FeedWatcher, error) {
 	return feedWatcher, nil
 }
 
+// feedLinks are the new links of a feed
+type feedLinks struct {
+	feed  *RemoteFeed
+	links []*FeedLink
+}
+
 // feedNewItems get all new items for a given feed
-func (fw *FeedWatcher) feedNewItems(feed *RemoteFeed, sinceDate time.Time, linksChan chan []string, errorsChan chan string) {
-	newItems, newItemsError := feed.NewItemsLinks(sinceDate, fw.Parser)
+func (fw *FeedWatcher) feedNewItems(feed *RemoteFeed, sinceDate time.Time, linksChan chan *feedLinks, errorsChan chan string) {
+	feedParser := fw.Parser
+	if feed.Parser != nil {
+		feedParser = feed.Parser
+	}
+
+	if feed.Teller == nil {
+		feed.Teller = fw.teller
+	}
+
+	newItems, newItemsError := feed.NewFeedLinks(sinceDate, feedParser)
 
 	if newItemsError != nil {
 		errorsChan <- fmt.Sprintf("%s: %s", feed.Title, newItemsError)
 		return
 	}
 
-	linksChan <- newItems
+	linksChan <- &feedLinks{feed: feed, links: newItems}
 }
 
 // NewLinks returns new links across all feeds
 func (fw *FeedWatcher) NewLinks(sinceDate time.Time) ([]string, error) {
-	feedsCount := len(fw.Feeds)
+	newFeedLinks, linksError := fw.NewFeedLinks(sinceDate)
 
 	var newLinks []string
-	newLinksChan := make(chan []string, feedsCount)
+	for _, feedLink := range newFeedLinks {
+		newLinks = append(newLinks, feedLink.Link)
+	}
+
+	return newLinks, linksError
+}
+
+// NewFeedLinks returns new links across all feeds along with their feed items
+func (fw *FeedWatcher) NewFeedLinks(sinceDate time.Time) ([]*FeedLink, error) {
+	feedsLinks, linksError := fw.newFeedsLinks(sinceDate)
+
+	var newLinks []*FeedLink
+	for _, newFeedLinks := range feedsLinks {
+		newLinks = append(newLinks, newFeedLinks.links...)
+	}
+
+	return newLinks, linksError
+}
+
+// newFeedsLinks returns the new links of each feed
+func (fw *FeedWatcher) newFeedsLinks(sinceDate time.Time) ([]*feedLinks, error) {
+	feedsCount := len(fw.Feeds)
+
+	var newLinks []*feedLinks
+	newLinksChan := make(chan *feedLinks, feedsCount)
 	defer close(newLinksChan)
 
 	var errorMessages []string
@@ -59,15 +102,15 @@ func (fw *FeedWatcher) NewLinks(sinceDate time.Time) ([]string, error) {
 	defer close(errorsMessagesChan)
 
 	// Parsing feeds concurrently
-	for _, feed := range fw.Feeds {
-		go fw.feedNewItems(&feed, sinceDate, newLinksChan, errorsMessagesChan)
+	for feedIndex := range fw.Feeds {
+		go fw.feedNewItems(&fw.Feeds[feedIndex], sinceDate, newLinksChan, errorsMessagesChan)
 	}
 
 	// Waiting for answers
 	for feedIndex := 0; feedIndex < feedsCount; feedIndex++ {
 		select {
 		case newItemsLinks := <-newLinksChan:
-			newLinks = append(newLinks, newItemsLinks...)
+			newLinks = append(newLinks, newItemsLinks)
 		case newError := <-errorsMessagesChan:
 			errorMessages = append(errorMessages, newError)
 		}
@@ -83,23 +126,105 @@ func (fw *FeedWatcher) NewLinks(sinceDate time.Time) ([]string, error) {
 }
 
 // processNewLinks send new links to others (download, debrid…)
-// TODO Handle errors
-// TODO Allow concurrent dispatch
+//
+// The feed items are recorded as processed once all their links are
+// dispatched, the others being found again at the next poll.
 func (fw *FeedWatcher) processNewLinks(sinceDate time.Time) (int, error) {
-	newLinks, linkErrors := fw.NewLinks(sinceDate)
+	feedsLinks, linkErrors := fw.newFeedsLinks(sinceDate)
+
+	var newLinks []*FeedLink
+	var events []*dispatcher.Event
+
+	for _, newFeedLinks := range feedsLinks {
+		for _, newLink := range newFeedLinks.links {
+			newLinks = append(newLinks, newLink)
+			events = append(events, newLinkEvent(newLink))
+		}
+	}
+
+	var dispatchErrors []error
 
-	var currentEvent *dispatcher.Event
+	if fw.Story != nil {
+		var deferredEvents []*dispatcher.Event
 
-	scenario := fw.Scenario
-	if scenario != nil {
-		for _, newLink := range newLinks {
-			currentEvent = &dispatcher.Event{Origin: "feed-watcher", Value: newLink}
-			scenario.SetInitialStep("config")
-			scenario.Play(currentEvent)
+		// Playing the events deferred by the previous scans first
+		if deferringStory, isDeferring := fw.Story.(dispatcher.DeferringStory); isDeferring {
+			deferredEvents = replayedEvents(deferringStory.Deferred(), newLinks)
 		}
+
+		dispatchErrors = fw.Story.PlayBatch(append(deferredEvents, events...))[len(deferredEvents):]
+	} else if fw.Scenario != nil {
+		dispatchErrors = make([]error, len(events))
+
+		for eventIndex, event := range events {
+			// The scenario keeps its last error across plays
+			previousError := fw.Scenario.RunError()
+
+			fw.Scenario.SetInitialStep("config")
+			fw.Scenario.Play(event)
+
+			if runError := fw.Scenario.RunError(); runError != previousError {
+				dispatchErrors[eventIndex] = runError
+			}
+		}
+	}
+
+	errorMessages := []string{}
+	if linkErrors != nil {
+		errorMessages = append(errorMessages, linkErrors.Error())
 	}
 
-	return len(newLinks), linkErrors
+	linkIndex := 0
+
+	for _, newFeedLinks := range feedsLinks {
+		var feedErrors []error
+		if dispatchErrors != nil {
+			feedErrors = dispatchErrors[linkIndex : linkIndex+len(newFeedLinks.links)]
+		}
+
+		linkIndex += len(newFeedLinks.links)
+
+		recordError := newFeedLinks.feed.recordLinksDispatch(newFeedLinks.links, feedErrors)
+		if recordError != nil {
+			errorMessages = append(errorMessages, fmt.Sprintf("%s: %s", newFeedLinks.feed.Title, recordError))
+		}
+	}
+
+	if len(errorMessages) > 0 {
+		return len(newLinks), errors.New(strings.Join(errorMessages, "\n"))
+	}
+
+	return len(newLinks), nil
+}
+
+// replayedEvents returns the deferred events to play again, except the ones
+// of the feed items found again as new
+func replayedEvents(deferredEvents []*dispatcher.Event, newLinks []*FeedLink) []*dispatcher.Event {
+	isNew := make(map[string]bool)
+	for _, newLink := range newLinks {
+		isNew[newLink.Feed+"\n"+newLink.Title] = true
+	}
+
+	var events []*dispatcher.Event
+	for _, deferredEvent := range deferredEvents {
+		if deferredEvent.Title == "" || !isNew[deferredEvent.Feed+"\n"+deferredEvent.Title] {
+			events = append(events, deferredEvent)
+		}
+	}
+
+	return events
+}
+
+// newLinkEvent returns the event to play for a new link
+func newLinkEvent(newLink *FeedLink) *dispatcher.Event {
+	return &dispatcher.Event{
+		Origin:   "feed-watcher",
+		Value:    newLink.Link,
+		Mirrors:  newLink.Mirrors,
+		Feed:     newLink.Feed,
+		Title:    newLink.Title,
+		Checksum: newLink.Checksum,
+	}
 }
 
 // Run starts the FeedWatcher cycle.
@@ -126,7 +251,7 @@ func (fw *FeedWatcher) Run(maxRunCount int) (string, error) {
 
 	tick := time.Tick(fw.interval)
 
-	// TODO replace by previous launch time
+	// Feeds with a database resume from their last successful poll
 	sinceDate := fw.SinceDate
 
 	fw.teller.LogWithFields(map[string]interface{}{
@@ -162,6 +287,29 @@ func (fw *FeedWatcher) Run(maxRunCount int) (string, error) {
 	return fmt.Sprintf("%d runs done, %d items found", runCount, newItemsTotal), nil
 }
 
+// RunOnce gets the new links of all feeds a single time, right away
+func (fw *FeedWatcher) RunOnce() (string, error) {
+	if len(fw.Feeds) == 0 {
+		return "", errors.New("No feeds in config")
+	}
+
+	if fw.SinceDate.IsZero() {
+		return "", errors.New("Invalid SinceDate")
+	}
+
+	fw.teller.LogWithFields(map[string]interface{}{
+		"feedsCount": len(fw.Feeds),
+		"sinceDate":  fw.SinceDate,
+	}).Infoln("Running FeedWatcher once")
+
+	newItemsCount, newItemErrors := fw.processNewLinks(fw.SinceDate)
+	if newItemErrors != nil {
+		fw.teller.Log().WithField("errors", newItemErrors).Errorln("Error with new items")
+	}
+
+	return fmt.Sprintf("1 run done, %d items found", newItemsCount), nil
+}
+
 // SetTeller defines the teller used to report the feed watcher adventures
 func (fw *FeedWatcher) SetTeller(teller *teller.Teller) *FeedWatcher {
 	fw.teller = teller
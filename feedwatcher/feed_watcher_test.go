@@ -2,11 +2,14 @@ package feedwatcher_test
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"time"
 
 	"github.com/davidderus/christopher/config"
+	"github.com/davidderus/christopher/database"
+	"github.com/davidderus/christopher/dispatcher"
 	. "github.com/davidderus/christopher/feedwatcher"
 	"github.com/davidderus/christopher/teller"
 
@@ -60,6 +63,50 @@ func customFeedParser(feedURL string) ([]*RemoteFeedItem, error) {
 	return remoteFeedItems, nil
 }
 
+// batchRecordingStory records the batches it is asked to play
+type batchRecordingStory struct {
+	batches [][]*dispatcher.Event
+}
+
+func (brs *batchRecordingStory) Scenario() *dispatcher.Scenario {
+	return &dispatcher.Scenario{}
+}
+
+func (brs *batchRecordingStory) PlayBatch(events []*dispatcher.Event) []error {
+	brs.batches = append(brs.batches, events)
+	return make([]error, len(events))
+}
+
+// failingStory is a batchRecordingStory failing to play some URIs
+type failingStory struct {
+	batchRecordingStory
+	failingValues map[string]bool
+}
+
+func (fs *failingStory) PlayBatch(events []*dispatcher.Event) []error {
+	playErrors := fs.batchRecordingStory.PlayBatch(events)
+
+	for eventIndex, event := range events {
+		if fs.failingValues[event.Value] {
+			playErrors[eventIndex] = errors.New("Download failed")
+		}
+	}
+
+	return playErrors
+}
+
+// deferringStory is a batchRecordingStory with some deferred events
+type deferringStory struct {
+	batchRecordingStory
+	deferred []*dispatcher.Event
+}
+
+func (ds *deferringStory) Deferred() []*dispatcher.Event {
+	deferred := ds.deferred
+	ds.deferred = nil
+	return deferred
+}
+
 var _ = Describe("FeedWatcher", func() {
 	var feedWatcher FeedWatcher
 
@@ -166,6 +213,162 @@ var _ = Describe("FeedWatcher", func() {
 			Expect(logString).To(ContainSubstring(`level=debug msg="Reaching maxRunCount, breaking!"`))
 		})
 
+		It("should play new links as a batch with a story", func() {
+			feedWatcher, _ := NewFeedWatcher(5 * time.Microsecond)
+
+			teller := teller.NewTeller("debug", "text")
+			teller.SetLogOutput(&bytes.Buffer{})
+			feedWatcher.SetTeller(teller)
+
+			feedWatcher.SinceDate = feedSinceDateWithItems
+			feedWatcher.Parser = customFeedParser
+			feedWatcher.Feeds = []RemoteFeed{{Title: "Run Feed", URL: "directdownload", Provider: "DirectDownload"}}
+
+			story := &batchRecordingStory{}
+			feedWatcher.Story = story
+
+			feedWatcher.Run(1)
+
+			Expect(len(story.batches)).To(Equal(1))
+			Expect(len(story.batches[0])).To(Equal(3))
+			Expect(story.batches[0][0].Origin).To(Equal("feed-watcher"))
+			Expect(story.batches[0][0].Value).To(Equal("http://www.filefactory.com/file/Zombie-One.mkv"))
+			Expect(story.batches[0][0].Feed).To(Equal("Run Feed"))
+			Expect(story.batches[0][0].Title).To(Equal("Zombie One"))
+		})
+
+		It("should play the deferred events again first", func() {
+			feedWatcher, _ := NewFeedWatcher(5 * time.Microsecond)
+
+			teller := teller.NewTeller("debug", "text")
+			teller.SetLogOutput(&bytes.Buffer{})
+			feedWatcher.SetTeller(teller)
+
+			feedWatcher.SinceDate = feedSinceDateWithItems
+			feedWatcher.Parser = customFeedParser
+			feedWatcher.Feeds = []RemoteFeed{{Title: "Run Feed", URL: "directdownload", Provider: "DirectDownload"}}
+
+			deferredEvent := &dispatcher.Event{Origin: "feed-watcher", Value: "http://www.filefactory.com/file/Shark-Avocado.mkv"}
+
+			story := &deferringStory{deferred: []*dispatcher.Event{deferredEvent}}
+			feedWatcher.Story = story
+
+			feedWatcher.Run(2)
+
+			Expect(len(story.batches)).To(Equal(2))
+			Expect(len(story.batches[0])).To(Equal(4))
+			Expect(story.batches[0][0]).To(Equal(deferredEvent))
+			Expect(story.batches[1]).To(BeEmpty())
+		})
+
+		It("should find the items failing to be dispatched again", func() {
+			feedWatcher, _ := NewFeedWatcher(5 * time.Microsecond)
+
+			teller := teller.NewTeller("debug", "text")
+			teller.SetLogOutput(&bytes.Buffer{})
+			feedWatcher.SetTeller(teller)
+
+			db, _ := database.Open("")
+
+			feedWatcher.SinceDate = feedSinceDateWithItems
+			feedWatcher.Parser = customFeedParser
+			feedWatcher.Feeds = []RemoteFeed{{Title: "Run Feed", URL: "directdownload", Provider: "DirectDownload", Database: db}}
+
+			story := &failingStory{failingValues: map[string]bool{"http://rapidgator.net/file/HTGAWM.mkv": true}}
+			feedWatcher.Story = story
+
+			feedWatcher.Run(2)
+
+			Expect(len(story.batches)).To(Equal(2))
+			Expect(len(story.batches[0])).To(Equal(3))
+			Expect(len(story.batches[1])).To(Equal(1))
+			Expect(story.batches[1][0].Value).To(Equal("http://rapidgator.net/file/HTGAWM.mkv"))
+		})
+
+		It("should only send the failed parts of an item again", func() {
+			feedWatcher, _ := NewFeedWatcher(5 * time.Microsecond)
+
+			teller := teller.NewTeller("debug", "text")
+			teller.SetLogOutput(&bytes.Buffer{})
+			feedWatcher.SetTeller(teller)
+
+			db, _ := database.Open("")
+
+			feedWatcher.SinceDate = feedSinceDateWithItems
+			feedWatcher.Parser = func(feedURL string) ([]*RemoteFeedItem, error) {
+				return []*RemoteFeedItem{{
+					GUID:        "split",
+					Title:       "Zombie One",
+					Description: "http://rapidgator.net/file/Zombie-One.r00\nhttp://rapidgator.net/file/Zombie-One.r01",
+					PublishedAt: time.Now(),
+				}}, nil
+			}
+			feedWatcher.Feeds = []RemoteFeed{{Title: "Run Feed", URL: "split", Provider: "DirectDownload", Database: db}}
+
+			story := &failingStory{failingValues: map[string]bool{"http://rapidgator.net/file/Zombie-One.r01": true}}
+			feedWatcher.Story = story
+
+			feedWatcher.Run(2)
+
+			Expect(len(story.batches)).To(Equal(2))
+			Expect(len(story.batches[0])).To(Equal(2))
+			Expect(len(story.batches[1])).To(Equal(1))
+			Expect(story.batches[1][0].Value).To(Equal("http://rapidgator.net/file/Zombie-One.r01"))
+			Expect(db.IsSeen("split", "guid:split")).To(BeFalse())
+		})
+
+		It("should record the items without link right away", func() {
+			feedWatcher, _ := NewFeedWatcher(5 * time.Microsecond)
+
+			teller := teller.NewTeller("debug", "text")
+			teller.SetLogOutput(&bytes.Buffer{})
+			feedWatcher.SetTeller(teller)
+
+			db, _ := database.Open("")
+
+			feedWatcher.SinceDate = feedSinceDateWithItems
+			feedWatcher.Parser = customFeedParser
+			feedWatcher.Feeds = []RemoteFeed{{
+				Title:           "Run Feed",
+				URL:             "directdownload",
+				Provider:        "DirectDownload",
+				ProviderOptions: config.ProviderOptions{FavoriteHosts: []string{"uploaded.net", "rapidgator.net"}},
+				Database:        db,
+			}}
+
+			story := &batchRecordingStory{}
+			feedWatcher.Story = story
+
+			feedWatcher.Run(2)
+
+			Expect(len(story.batches)).To(Equal(2))
+			Expect(len(story.batches[0])).To(Equal(2))
+			Expect(story.batches[1]).To(BeEmpty())
+		})
+
+		It("should not play the deferred events of the items found again", func() {
+			feedWatcher, _ := NewFeedWatcher(5 * time.Microsecond)
+
+			teller := teller.NewTeller("debug", "text")
+			teller.SetLogOutput(&bytes.Buffer{})
+			feedWatcher.SetTeller(teller)
+
+			feedWatcher.SinceDate = feedSinceDateWithItems
+			feedWatcher.Parser = customFeedParser
+			feedWatcher.Feeds = []RemoteFeed{{Title: "Run Feed", URL: "directdownload", Provider: "DirectDownload"}}
+
+			deferredEvent := &dispatcher.Event{Origin: "feed-watcher", Value: "http://www.filefactory.com/file/Shark-Avocado.mkv", Feed: "Run Feed", Title: "Shark Avocado"}
+
+			story := &deferringStory{deferred: []*dispatcher.Event{deferredEvent}}
+			feedWatcher.Story = story
+
+			feedWatcher.Run(1)
+
+			Expect(len(story.batches)).To(Equal(1))
+			Expect(len(story.batches[0])).To(Equal(3))
+			Expect(story.batches[0]).NotTo(ContainElement(deferredEvent))
+		})
+
 		It("should exit if there is no feeds", func() {
 			feedWatcher, _ := NewFeedWatcher(1 * time.Microsecond)
 			_, runError := feedWatcher.Run(1)
@@ -173,4 +376,35 @@ var _ = Describe("FeedWatcher", func() {
 			Expect(runError.Error()).To(Equal("No feeds in config"))
 		})
 	})
+
+	Describe(".RunOnce()", func() {
+		It("should get the new links right away", func() {
+			// An interval this long would block Run
+			feedWatcher, _ := NewFeedWatcher(time.Hour)
+
+			teller := teller.NewTeller("debug", "text")
+			teller.SetLogOutput(&bytes.Buffer{})
+			feedWatcher.SetTeller(teller)
+
+			feedWatcher.SinceDate = feedSinceDateWithItems
+			feedWatcher.Parser = customFeedParser
+			feedWatcher.Feeds = []RemoteFeed{{Title: "Run Feed", URL: "directdownload", Provider: "DirectDownload"}}
+
+			story := &batchRecordingStory{}
+			feedWatcher.Story = story
+
+			runSummary, runError := feedWatcher.RunOnce()
+
+			Expect(runError).NotTo(HaveOccurred())
+			Expect(runSummary).To(Equal("1 run done, 3 items found"))
+			Expect(story.batches).To(HaveLen(1))
+		})
+
+		It("should exit if there is no feeds", func() {
+			feedWatcher, _ := NewFeedWatcher(time.Hour)
+			_, runError := feedWatcher.RunOnce()
+
+			Expect(runError.Error()).To(Equal("No feeds in config"))
+		})
+	})
 })
@@ -0,0 +1,248 @@
+package feedwatcher
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/davidderus/christopher/config"
+)
+
+// defaultGenericSources are the parts of the items looked for links, in order
+var defaultGenericSources = []string{"enclosure", "link", "description", "content"}
+
+// defaultGenericSelector selects the anchors of an HTML description
+const defaultGenericSelector = "a[href]"
+
+// elementSourcePrefix prefixes the custom element sources
+const elementSourcePrefix = "element:"
+
+// Generic is a configurable extractor for any RSS or Atom feed
+//
+// Links are looked for in the enclosures, the link, the HTML anchors of the
+// description and content, or some custom elements, then filtered by regex
+// and hosts.
+type Generic struct {
+	options config.ProviderOptions
+
+	sources  []string
+	selector string
+	matcher  *regexp.Regexp
+
+	// mirrorSources are the sources of the mirrors, the item link being the
+	// item page unless given as source
+	mirrorSources []string
+}
+
+// Init sets up the extractor defaults and compiles its regex
+func (ge *Generic) Init() error {
+	ge.sources = ge.options.Sources
+	ge.mirrorSources = ge.options.Sources
+	if len(ge.sources) == 0 {
+		ge.sources = defaultGenericSources
+
+		for _, source := range defaultGenericSources {
+			if source != "link" {
+				ge.mirrorSources = append(ge.mirrorSources, source)
+			}
+		}
+	}
+
+	ge.selector = ge.options.Selector
+	if ge.selector == "" {
+		ge.selector = defaultGenericSelector
+	}
+
+	if ge.options.Regex != "" {
+		var regexError error
+
+		ge.matcher, regexError = regexp.Compile(ge.options.Regex)
+		if regexError != nil {
+			return regexError
+		}
+	}
+
+	return nil
+}
+
+// SourceURL returns a blank host as generic feeds come from anywhere
+func (ge *Generic) SourceURL() string {
+	return ""
+}
+
+// SetOptions defines the options for Generic
+func (ge *Generic) SetOptions(options interface{}) error {
+	ge.options = options.(config.ProviderOptions)
+	return nil
+}
+
+// Extract returns the preferred link of a feed item
+//
+// With favorite hosts, the first link of the first favorite host found is
+// returned, nothing otherwise.
+func (ge *Generic) Extract(feedItem *RemoteFeedItem) string {
+	links := ge.links(feedItem, ge.sources)
+
+	if len(ge.options.FavoriteHosts) == 0 {
+		if len(links) == 0 {
+			return ""
+		}
+
+		return links[0]
+	}
+
+	for _, favoriteHost := range ge.options.FavoriteHosts {
+		for _, link := range links {
+			if hostMatches(link, favoriteHost) {
+				return link
+			}
+		}
+	}
+
+	return ""
+}
+
+// ExtractMirrors returns all the links of a feed item accepted by the regex
+// or the favorite hosts, by mirror
+//
+// Without regex nor favorite hosts, any anchor would be a mirror, so only the
+// preferred link is returned.
+func (ge *Generic) ExtractMirrors(feedItem *RemoteFeedItem) []*Mirror {
+	if ge.matcher == nil && len(ge.options.FavoriteHosts) == 0 {
+		link := ge.Extract(feedItem)
+		if link == "" {
+			return nil
+		}
+
+		return []*Mirror{{Host: linkHost(link), Links: []string{link}}}
+	}
+
+	return favoriteMirrors(groupMirrors(ge.links(feedItem, ge.mirrorSources)), ge.options.FavoriteHosts)
+}
+
+// links returns all the links of some sources of a feed item matching the
+// regex and the hosts filters, in sources order
+func (ge *Generic) links(feedItem *RemoteFeedItem, sources []string) []string {
+	var links []string
+	knownLinks := make(map[string]bool)
+
+	for _, source := range sources {
+		for _, candidate := range ge.candidates(feedItem, source) {
+			link, isMatching := ge.match(strings.TrimSpace(candidate))
+			if !isMatching || knownLinks[link] || ge.isExcluded(link) {
+				continue
+			}
+
+			knownLinks[link] = true
+			links = append(links, link)
+		}
+	}
+
+	return links
+}
+
+// candidates returns the possible links in a source of a feed item
+func (ge *Generic) candidates(feedItem *RemoteFeedItem, source string) []string {
+	switch {
+	case source == "enclosure":
+		return feedItem.Enclosures
+	case source == "link":
+		return []string{feedItem.Link}
+	case source == "description":
+		return ge.htmlCandidates(feedItem.Description)
+	case source == "content":
+		return ge.htmlCandidates(feedItem.Content)
+	case strings.HasPrefix(source, elementSourcePrefix):
+		var candidates []string
+
+		for _, value := range feedItem.Elements[strings.TrimPrefix(source, elementSourcePrefix)] {
+			candidates = append(candidates, value)
+			candidates = append(candidates, ge.textCandidates(value)...)
+		}
+
+		return candidates
+	default:
+		return nil
+	}
+}
+
+// htmlCandidates returns the selected links of an HTML text, then the links
+// written as text if a regex is set
+func (ge *Generic) htmlCandidates(html string) []string {
+	if html == "" {
+		return nil
+	}
+
+	var candidates []string
+
+	document, documentError := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if documentError == nil {
+		document.Find(ge.selector).Each(func(_ int, selection *goquery.Selection) {
+			if href, hasHref := selection.Attr("href"); hasHref {
+				candidates = append(candidates, href)
+			} else if src, hasSrc := selection.Attr("src"); hasSrc {
+				candidates = append(candidates, src)
+			} else {
+				candidates = append(candidates, selection.Text())
+			}
+		})
+	}
+
+	return append(candidates, ge.textCandidates(html)...)
+}
+
+// textCandidates returns the links matching the regex in a text
+func (ge *Generic) textCandidates(text string) []string {
+	if ge.matcher == nil {
+		return nil
+	}
+
+	return ge.matcher.FindAllString(text, -1)
+}
+
+// match checks a candidate against the regex, returning the link it holds
+func (ge *Generic) match(candidate string) (string, bool) {
+	if candidate == "" {
+		return "", false
+	}
+
+	if ge.matcher == nil {
+		return candidate, true
+	}
+
+	matches := ge.matcher.FindStringSubmatch(candidate)
+	if matches == nil {
+		return "", false
+	}
+
+	if len(matches) > 1 && matches[1] != "" {
+		return matches[1], true
+	}
+
+	return matches[0], true
+}
+
+// isExcluded indicates if a link host is excluded
+func (ge *Generic) isExcluded(link string) bool {
+	for _, excludedHost := range ge.options.ExcludedHosts {
+		if hostMatches(link, excludedHost) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hostMatches indicates if a link is on a host or one of its subdomains
+func hostMatches(link, host string) bool {
+	parsedLink, parseError := url.Parse(link)
+	if parseError != nil {
+		return false
+	}
+
+	linkHost := strings.ToLower(parsedLink.Hostname())
+	host = strings.ToLower(host)
+
+	return linkHost == host || strings.HasSuffix(linkHost, "."+host)
+}
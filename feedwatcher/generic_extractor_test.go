@@ -0,0 +1,142 @@
+package feedwatcher_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/davidderus/christopher/config"
+	. "github.com/davidderus/christopher/feedwatcher"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Generic FeedExtractor", func() {
+	var feedServer *httptest.Server
+	var feedItems []*RemoteFeedItem
+
+	// extractAll returns the link of each feed item
+	extractAll := func(options config.ProviderOptions) []string {
+		extractor, extractorError := NewFeedExtractor("MyTracker", options)
+		Expect(extractorError).NotTo(HaveOccurred())
+
+		links := make([]string, len(feedItems))
+		for itemIndex, feedItem := range feedItems {
+			links[itemIndex] = feedItem.DownloadLink(extractor)
+		}
+
+		return links
+	}
+
+	BeforeEach(func() {
+		feedServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.ServeFile(w, r, "../testdata/generic_feed.xml")
+		}))
+
+		feedItems, _ = GofeedParser(feedServer.URL)
+	})
+
+	AfterEach(func() {
+		feedServer.Close()
+	})
+
+	It("should parse the enclosures, contents and custom elements", func() {
+		Expect(feedItems).To(HaveLen(3))
+		Expect(feedItems[0].GUID).To(Equal("mytracker-1"))
+		Expect(feedItems[0].Enclosures).To(Equal([]string{"http://mytracker.org/download/1.torrent"}))
+		Expect(feedItems[2].Content).To(ContainSubstring("3.torrent"))
+		Expect(feedItems[2].Elements["torrent:magnetURI"]).To(Equal([]string{"magnet:?xt=urn:btih:a1b2c3&dn=HTGAWM.S03E10.720p"}))
+	})
+
+	It("should use the extractor named by the provider options", func() {
+		_, extractorError := NewFeedExtractor("MyTracker", config.ProviderOptions{})
+		Expect(extractorError.Error()).To(Equal("Invalid Feed Extractor"))
+
+		extractor, _ := NewFeedExtractor("MyTracker", config.ProviderOptions{Extractor: "generic"})
+		Expect(extractor).To(BeAssignableToTypeOf(&Generic{}))
+	})
+
+	It("should look in the enclosures, link, description and content by default", func() {
+		Expect(extractAll(config.ProviderOptions{Extractor: "generic"})).To(Equal([]string{
+			"http://mytracker.org/download/1.torrent",
+			"http://mytracker.org/view/2",
+			"http://mytracker.org/view/3",
+		}))
+	})
+
+	It("should look in the given sources with a selector", func() {
+		options := config.ProviderOptions{
+			Extractor: "generic",
+			Sources:   []string{"content", "element:torrent:magnetURI", "enclosure"},
+			Selector:  "a.download",
+		}
+
+		Expect(extractAll(options)).To(Equal([]string{
+			"http://mytracker.org/download/1.torrent",
+			"",
+			"http://mytracker.org/download/3.torrent",
+		}))
+
+		options.Sources = []string{"element:torrent:magnetURI"}
+		Expect(extractAll(options)[2]).To(Equal("magnet:?xt=urn:btih:a1b2c3&dn=HTGAWM.S03E10.720p"))
+	})
+
+	It("should filter the links by regex and hosts", func() {
+		options := config.ProviderOptions{
+			Extractor:     "generic",
+			Sources:       []string{"description"},
+			ExcludedHosts: []string{"example.com"},
+		}
+
+		Expect(extractAll(options)[1]).To(Equal("http://www.filefactory.com/file/Shark-Avocado.mkv"))
+
+		options.FavoriteHosts = []string{"uploaded.net", "rapidgator.net"}
+		Expect(extractAll(options)[1]).To(Equal("http://rapidgator.net/file/Shark-Avocado.mkv"))
+
+		// Links written as text are found with a regex
+		options.Regex = `https?://\S+\.mkv`
+		Expect(extractAll(options)[1]).To(Equal("http://uploaded.net/file/Shark-Avocado.mkv"))
+	})
+
+	It("should return the mirrors of the favorite hosts", func() {
+		extractor, _ := NewFeedExtractor("MyTracker", config.ProviderOptions{
+			Extractor:     "generic",
+			Sources:       []string{"description"},
+			Regex:         `https?://\S+\.mkv`,
+			FavoriteHosts: []string{"uploaded.net", "rapidgator.net"},
+		})
+
+		Expect(feedItems[1].DownloadMirrors(extractor)).To(Equal([]*Mirror{
+			{Host: "uploaded.net", Links: []string{"http://uploaded.net/file/Shark-Avocado.mkv"}},
+			{Host: "rapidgator.net", Links: []string{"http://rapidgator.net/file/Shark-Avocado.mkv"}},
+		}))
+	})
+
+	It("should only return the links accepted by the filters as mirrors", func() {
+		extractor, _ := NewFeedExtractor("MyTracker", config.ProviderOptions{Extractor: "generic"})
+
+		Expect(feedItems[1].DownloadMirrors(extractor)).To(Equal([]*Mirror{
+			{Host: "mytracker.org", Links: []string{"http://mytracker.org/view/2"}},
+		}))
+
+		extractor, _ = NewFeedExtractor("MyTracker", config.ProviderOptions{
+			Extractor: "generic",
+			Regex:     `^https?://\S+\.(?:mkv|torrent)$`,
+		})
+
+		Expect(feedItems[1].DownloadMirrors(extractor)).To(Equal([]*Mirror{
+			{Host: "filefactory.com", Links: []string{"http://www.filefactory.com/file/Shark-Avocado.mkv"}},
+			{Host: "rapidgator.net", Links: []string{"http://rapidgator.net/file/Shark-Avocado.mkv"}},
+		}))
+	})
+
+	It("should use the first regex group as link", func() {
+		options := config.ProviderOptions{
+			Extractor: "generic",
+			Sources:   []string{"link"},
+			Regex:     `^http://mytracker\.org/view/(\d+)$`,
+		}
+
+		Expect(extractAll(options)).To(Equal([]string{"1", "2", "3"}))
+	})
+})
@@ -0,0 +1,274 @@
+package feedwatcher
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/davidderus/christopher/config"
+	"github.com/davidderus/christopher/database"
+	"github.com/davidderus/christopher/release"
+)
+
+// unknownQuality stands for the items without quality in the accepted
+// qualities
+const unknownQuality = "unknown"
+
+// megabyte is the unit of the size bounds
+const megabyte = 1024 * 1024
+
+// keywordSeparators matches the characters used as spaces in item titles
+var keywordSeparators = regexp.MustCompile(`[^\pL\pN]+`)
+
+// itemFilter rejects the feed items not matching the feed rules and waits for
+// the preferred qualities
+type itemFilter struct {
+	options config.FilterOptions
+
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+
+	// database remembers the grabbed releases, lesser qualities being accepted
+	// right away without it
+	database *database.Database
+}
+
+// filterResult is the fate of a feed item
+type filterResult struct {
+	item *RemoteFeedItem
+
+	// rule is the rule rejecting the item, blank if accepted
+	rule string
+
+	// held items wait for a better quality, to be checked again later
+	held bool
+}
+
+// newItemFilter compiles the filter rules of a feed
+func newItemFilter(options config.FilterOptions, db *database.Database) (*itemFilter, error) {
+	filter := &itemFilter{options: options, database: db}
+
+	for _, includeRegex := range options.Include {
+		compiledRegex, regexError := regexp.Compile(includeRegex)
+		if regexError != nil {
+			return nil, fmt.Errorf("Invalid filter regex: %s", regexError)
+		}
+
+		filter.include = append(filter.include, compiledRegex)
+	}
+
+	for _, excludeRegex := range options.Exclude {
+		compiledRegex, regexError := regexp.Compile(excludeRegex)
+		if regexError != nil {
+			return nil, fmt.Errorf("Invalid filter regex: %s", regexError)
+		}
+
+		filter.exclude = append(filter.exclude, compiledRegex)
+	}
+
+	return filter, nil
+}
+
+// filter returns the fate of each item, in order
+func (f *itemFilter) filter(items []*RemoteFeedItem, now time.Time) []*filterResult {
+	results := make([]*filterResult, len(items))
+
+	// Best items of each release, by release key
+	bestResults := make(map[string]*filterResult)
+	var releaseKeys []string
+
+	for itemIndex, item := range items {
+		results[itemIndex] = &filterResult{item: item, rule: f.rejectingRule(item)}
+
+		if results[itemIndex].rule != "" || len(f.options.Qualities) == 0 {
+			continue
+		}
+
+		itemRelease := release.Parse(item.Title)
+		releaseKey := qualityLessKey(itemRelease)
+
+		bestResult, exists := bestResults[releaseKey]
+		if !exists {
+			bestResults[releaseKey] = results[itemIndex]
+			releaseKeys = append(releaseKeys, releaseKey)
+			continue
+		}
+
+		// Only the best quality of a release is kept
+		if f.qualityRank(itemRelease.Quality) < f.qualityRank(release.Parse(bestResult.item.Title).Quality) {
+			bestResult.rule = "better quality " + itemQuality(itemRelease) + " found"
+			bestResults[releaseKey] = results[itemIndex]
+		} else {
+			results[itemIndex].rule = "better quality " + qualityOf(bestResult.item) + " found"
+		}
+	}
+
+	for _, releaseKey := range releaseKeys {
+		f.preferQuality(bestResults[releaseKey], releaseKey, now)
+	}
+
+	return results
+}
+
+// rejectingRule returns the first rule an item fails, blank if none
+func (f *itemFilter) rejectingRule(item *RemoteFeedItem) string {
+	text := item.Title + "\n" + item.Description
+
+	if len(f.include) > 0 {
+		isIncluded := false
+
+		for _, includeRegex := range f.include {
+			if includeRegex.MatchString(text) {
+				isIncluded = true
+				break
+			}
+		}
+
+		if !isIncluded {
+			return "include regexes"
+		}
+	}
+
+	for _, excludeRegex := range f.exclude {
+		if excludeRegex.MatchString(text) {
+			return "exclude regex " + excludeRegex.String()
+		}
+	}
+
+	if len(f.options.Keywords) > 0 {
+		isIncluded := false
+
+		for _, keyword := range f.options.Keywords {
+			if hasKeyword(text, keyword) {
+				isIncluded = true
+				break
+			}
+		}
+
+		if !isIncluded {
+			return "keywords"
+		}
+	}
+
+	for _, keyword := range f.options.ExcludedKeywords {
+		if hasKeyword(text, keyword) {
+			return "excluded keyword " + keyword
+		}
+	}
+
+	for _, rejectedQuality := range f.options.RejectedQualities {
+		if hasKeyword(item.Title, rejectedQuality) {
+			return "rejected quality " + rejectedQuality
+		}
+	}
+
+	if size := item.FileSize(); size > 0 {
+		if f.options.MinSize > 0 && size < f.options.MinSize*megabyte {
+			return fmt.Sprintf("min size %d MB", f.options.MinSize)
+		}
+
+		if f.options.MaxSize > 0 && size > f.options.MaxSize*megabyte {
+			return fmt.Sprintf("max size %d MB", f.options.MaxSize)
+		}
+	}
+
+	if len(f.options.Qualities) > 0 && f.qualityRank(release.Parse(item.Title).Quality) < 0 {
+		return "quality " + qualityOf(item) + " not accepted"
+	}
+
+	return ""
+}
+
+// preferQuality accepts the best item of a release if no better quality was
+// grabbed, lesser qualities waiting for the preferred one first
+func (f *itemFilter) preferQuality(result *filterResult, releaseKey string, now time.Time) {
+	if f.database == nil {
+		return
+	}
+
+	rank := f.qualityRank(release.Parse(result.item.Title).Quality)
+
+	if grabbedQuality, isGrabbed := f.database.GrabbedQuality(releaseKey); isGrabbed && f.qualityRank(grabbedQuality) <= rank {
+		result.rule = "quality " + grabbedQuality + " already grabbed"
+		return
+	}
+
+	waitDuration := time.Duration(f.options.QualityWait) * time.Hour
+	if rank > 0 && !result.item.PublishedAt.IsZero() && now.Sub(result.item.PublishedAt) < waitDuration {
+		result.held = true
+	}
+}
+
+// grab records the quality of an accepted item release
+func (f *itemFilter) grab(item *RemoteFeedItem) error {
+	if f.database == nil || len(f.options.Qualities) == 0 {
+		return nil
+	}
+
+	itemRelease := release.Parse(item.Title)
+
+	return f.database.SetGrabbed(qualityLessKey(itemRelease), itemQuality(itemRelease))
+}
+
+// qualityRank returns the preference of a quality, lower being better, -1 if
+// not accepted
+func (f *itemFilter) qualityRank(quality string) int {
+	if quality == "" {
+		quality = unknownQuality
+	}
+
+	for rank, acceptedQuality := range f.options.Qualities {
+		if strings.EqualFold(acceptedQuality, quality) {
+			return rank
+		}
+	}
+
+	return -1
+}
+
+// qualityLessKey identifies a release whatever its quality, by episode or by
+// name
+func qualityLessKey(itemRelease *release.Release) string {
+	if itemRelease.IsEpisode() {
+		return fmt.Sprintf("%s s%02de%02d", strings.ToLower(itemRelease.Show), itemRelease.Season, itemRelease.Episode)
+	}
+
+	words := strings.Fields(keywordSeparators.ReplaceAllString(strings.ToLower(itemRelease.Name), " "))
+
+	var keyWords []string
+	for _, word := range words {
+		if word != itemRelease.Quality {
+			keyWords = append(keyWords, word)
+		}
+	}
+
+	return strings.Join(keyWords, " ")
+}
+
+// itemQuality returns the quality of a release, "unknown" if none
+func itemQuality(itemRelease *release.Release) string {
+	if itemRelease.Quality == "" {
+		return unknownQuality
+	}
+
+	return itemRelease.Quality
+}
+
+// qualityOf returns the quality of an item, "unknown" if none
+func qualityOf(item *RemoteFeedItem) string {
+	return itemQuality(release.Parse(item.Title))
+}
+
+// hasKeyword indicates if a text contains a keyword as whole words, whatever
+// the case and separators
+func hasKeyword(text, keyword string) bool {
+	normalizedText := " " + strings.Join(strings.Fields(keywordSeparators.ReplaceAllString(strings.ToLower(text), " ")), " ") + " "
+	normalizedKeyword := strings.Join(strings.Fields(keywordSeparators.ReplaceAllString(strings.ToLower(keyword), " ")), " ")
+
+	if normalizedKeyword == "" {
+		return false
+	}
+
+	return strings.Contains(normalizedText, " "+normalizedKeyword+" ")
+}
@@ -0,0 +1,182 @@
+package feedwatcher_test
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/davidderus/christopher/config"
+	"github.com/davidderus/christopher/database"
+	. "github.com/davidderus/christopher/feedwatcher"
+	"github.com/davidderus/christopher/teller"
+	"github.com/davidderus/christopher/watchlist"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Feed filters", func() {
+	var feedItems []*RemoteFeedItem
+	var logOutput *bytes.Buffer
+
+	sinceDate := time.Date(2017, time.February, 1, 0, 0, 0, 0, time.UTC)
+
+	itemsParser := func(feedURL string) ([]*RemoteFeedItem, error) {
+		return feedItems, nil
+	}
+
+	// newTitles returns the titles of the feed new items, recorded as
+	// dispatched
+	newTitles := func(remoteFeed *RemoteFeed) []string {
+		newItems, newItemsError := remoteFeed.NewItems(sinceDate, itemsParser)
+		Expect(newItemsError).NotTo(HaveOccurred())
+		Expect(remoteFeed.RecordDispatch(newItems, nil)).To(Succeed())
+
+		titles := []string{}
+		for _, newItem := range newItems {
+			titles = append(titles, newItem.Title)
+		}
+
+		return titles
+	}
+
+	BeforeEach(func() {
+		publishedAt := time.Date(2017, time.February, 10, 20, 0, 0, 0, time.UTC)
+
+		feedItems = []*RemoteFeedItem{
+			{GUID: "1", Title: "Zombie.One.S03E04.1080p.WEB-DL", Description: "Size: 1.4 GB", PublishedAt: publishedAt},
+			{GUID: "2", Title: "Zombie.One.S03E04.720p.WEB-DL", Description: "Size: 700 MB", PublishedAt: publishedAt},
+			{GUID: "3", Title: "HTGAWM.S03E10.720p.HDTV", Description: "Size: 350 MB", PublishedAt: publishedAt},
+			{GUID: "4", Title: "Shark.Avocado.2017.HDCAM", Description: "Size: 1 GB", PublishedAt: publishedAt},
+			{GUID: "5", Title: "Shark Avocado 2017 480p", Description: "Sample", PublishedAt: publishedAt},
+		}
+
+		logOutput = &bytes.Buffer{}
+	})
+
+	It("should keep every item without filters", func() {
+		remoteFeed := &RemoteFeed{Title: "Feed", URL: "filters"}
+
+		Expect(newTitles(remoteFeed)).To(HaveLen(5))
+	})
+
+	It("should filter the items by regex and keywords", func() {
+		remoteFeed := &RemoteFeed{Title: "Feed", URL: "filters", Filters: config.FilterOptions{
+			Include: []string{"(?i)zombie", "(?i)shark"},
+			Exclude: []string{`\b1080p\b`},
+		}}
+		Expect(newTitles(remoteFeed)).To(Equal([]string{
+			"Zombie.One.S03E04.720p.WEB-DL",
+			"Shark.Avocado.2017.HDCAM",
+			"Shark Avocado 2017 480p",
+		}))
+
+		remoteFeed.Filters = config.FilterOptions{
+			Keywords:         []string{"zombie one", "shark avocado"},
+			ExcludedKeywords: []string{"web dl"},
+		}
+		Expect(newTitles(remoteFeed)).To(Equal([]string{
+			"Shark.Avocado.2017.HDCAM",
+			"Shark Avocado 2017 480p",
+		}))
+	})
+
+	It("should filter the items by size, those of unknown size passing", func() {
+		remoteFeed := &RemoteFeed{Title: "Feed", URL: "filters", Filters: config.FilterOptions{MinSize: 500, MaxSize: 1024}}
+
+		Expect(newTitles(remoteFeed)).To(Equal([]string{
+			"Zombie.One.S03E04.720p.WEB-DL",
+			"Shark.Avocado.2017.HDCAM",
+			"Shark Avocado 2017 480p",
+		}))
+	})
+
+	It("should keep the preferred quality of each release and log the rejections", func() {
+		appTeller := teller.NewTeller("info", "text")
+		appTeller.SetLogOutput(logOutput)
+
+		remoteFeed := &RemoteFeed{Title: "Feed", URL: "filters", Teller: appTeller, Filters: config.FilterOptions{
+			Qualities:         []string{"1080p", "720p", "unknown"},
+			RejectedQualities: []string{"CAM", "HDCAM"},
+		}}
+
+		Expect(newTitles(remoteFeed)).To(Equal([]string{
+			"Zombie.One.S03E04.1080p.WEB-DL",
+			"HTGAWM.S03E10.720p.HDTV",
+		}))
+
+		Expect(logOutput.String()).To(ContainSubstring(`item=Zombie.One.S03E04.720p.WEB-DL rule="better quality 1080p found"`))
+		Expect(logOutput.String()).To(ContainSubstring(`item=Shark.Avocado.2017.HDCAM rule="rejected quality HDCAM"`))
+		Expect(logOutput.String()).To(ContainSubstring(`item="Shark Avocado 2017 480p" rule="quality 480p not accepted"`))
+	})
+
+	Context("with a database", func() {
+		var db *database.Database
+
+		BeforeEach(func() {
+			db, _ = database.Open("")
+
+			// Only lesser qualities first
+			feedItems = feedItems[1:3]
+		})
+
+		It("should wait for the preferred quality before accepting a lesser one", func() {
+			remoteFeed := &RemoteFeed{Title: "Feed", URL: "filters", Database: db, Filters: config.FilterOptions{
+				Qualities:   []string{"1080p", "720p"},
+				QualityWait: 24 * 365 * 100,
+			}}
+
+			Expect(newTitles(remoteFeed)).To(BeEmpty())
+
+			// The waiting items are checked again
+			feedItems = append(feedItems, &RemoteFeedItem{GUID: "6", Title: "HTGAWM.S03E10.1080p.WEB-DL", PublishedAt: time.Now()})
+			Expect(newTitles(remoteFeed)).To(Equal([]string{"HTGAWM.S03E10.1080p.WEB-DL"}))
+
+			// Once the wait is over
+			remoteFeed.Filters.QualityWait = 1
+			Expect(newTitles(remoteFeed)).To(Equal([]string{"Zombie.One.S03E04.720p.WEB-DL"}))
+			Expect(newTitles(remoteFeed)).To(BeEmpty())
+		})
+
+		It("should upgrade a release grabbed in a lesser quality only", func() {
+			remoteFeed := &RemoteFeed{Title: "Feed", URL: "filters", Database: db, Filters: config.FilterOptions{
+				Qualities: []string{"1080p", "720p"},
+			}}
+
+			Expect(newTitles(remoteFeed)).To(Equal([]string{
+				"Zombie.One.S03E04.720p.WEB-DL",
+				"HTGAWM.S03E10.720p.HDTV",
+			}))
+
+			feedItems = append(feedItems,
+				&RemoteFeedItem{GUID: "7", Title: "Zombie.One.S03E04.720p.HDTV", PublishedAt: time.Now()},
+				&RemoteFeedItem{GUID: "8", Title: "HTGAWM.S03E10.1080p.WEB-DL", PublishedAt: time.Now()},
+			)
+			Expect(newTitles(remoteFeed)).To(Equal([]string{"HTGAWM.S03E10.1080p.WEB-DL"}))
+		})
+	})
+
+	It("should only let the watched episodes through, once", func() {
+		appTeller := teller.NewTeller("info", "text")
+		appTeller.SetLogOutput(logOutput)
+
+		db, _ := database.Open("")
+		showsWatchlist := watchlist.New(config.WatchlistOptions{Shows: []*config.WatchlistShow{{Name: "Zombie One"}}}, db)
+
+		remoteFeed := &RemoteFeed{Title: "Feed", URL: "filters", Database: db, Watchlist: showsWatchlist, Teller: appTeller}
+		Expect(newTitles(remoteFeed)).To(Equal([]string{"Zombie.One.S03E04.1080p.WEB-DL"}))
+
+		Expect(logOutput.String()).To(ContainSubstring(`item=Zombie.One.S03E04.720p.WEB-DL rule="watchlist: episode S03E04 already claimed by Zombie.One.S03E04.1080p.WEB-DL"`))
+		Expect(logOutput.String()).To(ContainSubstring(`item=HTGAWM.S03E10.720p.HDTV rule="watchlist: show HTGAWM not watched"`))
+
+		// Another feed of the same episode
+		otherFeed := &RemoteFeed{Title: "Other Feed", URL: "other", Database: db, Watchlist: showsWatchlist}
+		Expect(newTitles(otherFeed)).To(BeEmpty())
+	})
+
+	It("should return the invalid regexes", func() {
+		remoteFeed := &RemoteFeed{Title: "Feed", URL: "filters", Filters: config.FilterOptions{Include: []string{"(zombie"}}}
+
+		_, newItemsError := remoteFeed.NewItems(sinceDate, itemsParser)
+		Expect(newItemsError.Error()).To(HavePrefix("Invalid filter regex:"))
+	})
+})
@@ -0,0 +1,184 @@
+package feedwatcher
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davidderus/christopher/config"
+)
+
+// unixDateFormat parses dates given in seconds since epoch
+const unixDateFormat = "unix"
+
+// JSONParser reads the items of a JSON document, such as a JSON Feed or a
+// Reddit listing, thanks to some paths
+type JSONParser struct {
+	options config.JSONOptions
+
+	client *http.Client
+}
+
+// NewJSONParser returns a JSON parser for the given paths
+func NewJSONParser(options config.JSONOptions) *JSONParser {
+	jsonParser := &JSONParser{options: options}
+
+	if jsonParser.options.DateFormat == "" {
+		jsonParser.options.DateFormat = time.RFC3339
+	}
+
+	jsonParser.client = &http.Client{Timeout: feedTimeOut * time.Second}
+
+	return jsonParser
+}
+
+// Parse returns the items of a JSON document
+func (jp *JSONParser) Parse(feedURL string) ([]*RemoteFeedItem, error) {
+	response, responseError := fetchFeed(jp.client, feedURL, jp.options.UserAgent)
+	if responseError != nil {
+		return nil, responseError
+	}
+	defer response.Body.Close()
+
+	var document interface{}
+
+	// Keeping the numbers as written, large ids not fitting in a float64
+	decoder := json.NewDecoder(response.Body)
+	decoder.UseNumber()
+
+	decodeError := decoder.Decode(&document)
+	if decodeError != nil {
+		return nil, decodeError
+	}
+
+	items := jsonValues(document, jp.options.Items)
+
+	// The items path usually leads to an array
+	if len(items) == 1 {
+		if itemsArray, isArray := items[0].([]interface{}); isArray {
+			items = itemsArray
+		}
+	}
+
+	remoteFeedItems := make([]*RemoteFeedItem, len(items))
+
+	for itemIndex, item := range items {
+		remoteFeedItems[itemIndex] = jp.feedItem(item)
+	}
+
+	return remoteFeedItems, nil
+}
+
+// feedItem maps a JSON item to a feed item
+func (jp *JSONParser) feedItem(item interface{}) *RemoteFeedItem {
+	feedItem := &RemoteFeedItem{
+		GUID:        jsonString(item, jp.options.GUID),
+		Title:       jsonString(item, jp.options.Title),
+		Link:        jsonString(item, jp.options.Link),
+		Description: jsonString(item, jp.options.Description),
+	}
+
+	if jp.options.Enclosures != "" {
+		for _, enclosure := range jsonValues(item, jp.options.Enclosures) {
+			if enclosureURL := jsonText(enclosure); enclosureURL != "" {
+				feedItem.Enclosures = append(feedItem.Enclosures, enclosureURL)
+			}
+		}
+	}
+
+	if jp.options.Date != "" {
+		feedItem.PublishedAt = jp.parseDate(jsonString(item, jp.options.Date))
+	}
+
+	return feedItem
+}
+
+// parseDate reads a date in the parser format, zero if invalid
+func (jp *JSONParser) parseDate(value string) time.Time {
+	if jp.options.DateFormat == unixDateFormat {
+		seconds, parseError := strconv.ParseFloat(value, 64)
+		if parseError != nil {
+			return time.Time{}
+		}
+
+		return time.Unix(int64(seconds), 0).UTC()
+	}
+
+	date, parseError := time.Parse(jp.options.DateFormat, value)
+	if parseError != nil {
+		return time.Time{}
+	}
+
+	return date
+}
+
+// jsonValues returns the values found at a path of a JSON value
+//
+// Keys are separated by dots, numbers index arrays and "*" stands for all the
+// elements of an array or object.
+func jsonValues(value interface{}, path string) []interface{} {
+	values := []interface{}{value}
+
+	if path == "" {
+		return values
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		var nextValues []interface{}
+
+		for _, currentValue := range values {
+			switch typedValue := currentValue.(type) {
+			case map[string]interface{}:
+				if key == "*" {
+					for _, child := range typedValue {
+						nextValues = append(nextValues, child)
+					}
+				} else if child, exists := typedValue[key]; exists {
+					nextValues = append(nextValues, child)
+				}
+			case []interface{}:
+				if key == "*" {
+					nextValues = append(nextValues, typedValue...)
+				} else if index, indexError := strconv.Atoi(key); indexError == nil && index >= 0 && index < len(typedValue) {
+					nextValues = append(nextValues, typedValue[index])
+				}
+			}
+		}
+
+		values = nextValues
+	}
+
+	return values
+}
+
+// jsonString returns the first text found at a path of a JSON value, blank if
+// none
+func jsonString(value interface{}, path string) string {
+	if path == "" {
+		return ""
+	}
+
+	for _, foundValue := range jsonValues(value, path) {
+		if text := jsonText(foundValue); text != "" {
+			return text
+		}
+	}
+
+	return ""
+}
+
+// jsonText returns a JSON string, number or boolean as text
+func jsonText(value interface{}) string {
+	switch typedValue := value.(type) {
+	case string:
+		return strings.TrimSpace(typedValue)
+	case json.Number:
+		return typedValue.String()
+	case bool:
+		return strconv.FormatBool(typedValue)
+	}
+
+	return ""
+}
@@ -0,0 +1,143 @@
+package feedwatcher_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/davidderus/christopher/config"
+	. "github.com/davidderus/christopher/feedwatcher"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("JSONParser", func() {
+	var jsonServer *httptest.Server
+	var userAgent string
+
+	BeforeEach(func() {
+		jsonServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userAgent = r.UserAgent()
+
+			switch r.URL.Path {
+			case "/feed.json":
+				http.ServeFile(w, r, "../testdata/json_feed.json")
+			case "/r/series.json":
+				http.ServeFile(w, r, "../testdata/reddit_listing.json")
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+	})
+
+	AfterEach(func() {
+		jsonServer.Close()
+	})
+
+	It("should map a JSON Feed", func() {
+		jsonParser := NewJSONParser(config.JSONOptions{
+			Items:       "items",
+			GUID:        "id",
+			Title:       "title",
+			Link:        "url",
+			Description: "content_html",
+			Enclosures:  "attachments.*.url",
+			Date:        "date_published",
+		})
+
+		feedItems, parseError := jsonParser.Parse(jsonServer.URL + "/feed.json")
+		Expect(parseError).NotTo(HaveOccurred())
+
+		Expect(feedItems).To(HaveLen(2))
+		Expect(feedItems[0].GUID).To(Equal("mytracker-4"))
+		Expect(feedItems[0].Title).To(Equal("Zombie.One.S03E04.720p"))
+		Expect(feedItems[0].Link).To(Equal("http://mytracker.org/view/4"))
+		Expect(feedItems[0].Description).To(ContainSubstring("4.torrent"))
+		Expect(feedItems[0].Enclosures).To(Equal([]string{"http://mytracker.org/download/4.torrent", "http://mirror.example.com/4.mkv"}))
+		Expect(feedItems[0].PublishedAt).To(Equal(time.Date(2017, time.February, 10, 20, 0, 0, 0, time.UTC)))
+
+		Expect(feedItems[1].Enclosures).To(BeEmpty())
+		Expect(feedItems[1].PublishedAt.IsZero()).To(BeTrue())
+	})
+
+	It("should map a Reddit listing with unix dates and the user agent", func() {
+		jsonParser := NewJSONParser(config.JSONOptions{
+			Items:       "data.children.*.data",
+			GUID:        "id",
+			Title:       "title",
+			Link:        "url",
+			Description: "selftext",
+			Date:        "created_utc",
+			DateFormat:  "unix",
+			UserAgent:   "Christopher/1.0",
+		})
+
+		feedItems, parseError := jsonParser.Parse(jsonServer.URL + "/r/series.json")
+		Expect(parseError).NotTo(HaveOccurred())
+		Expect(userAgent).To(Equal("Christopher/1.0"))
+
+		Expect(feedItems).To(HaveLen(2))
+		Expect(feedItems[0].Link).To(Equal("http://uploaded.net/file/zombie-one-s03e04"))
+		Expect(feedItems[0].PublishedAt).To(Equal(time.Date(2017, time.February, 10, 20, 0, 0, 0, time.UTC)))
+		Expect(feedItems[1].GUID).To(Equal("5u3"))
+		Expect(feedItems[1].Title).To(Equal("HTGAWM.S03E10.720p"))
+	})
+
+	It("should read indexed paths", func() {
+		jsonParser := NewJSONParser(config.JSONOptions{Items: "items.0", Link: "attachments.1.url"})
+
+		feedItems, _ := jsonParser.Parse(jsonServer.URL + "/feed.json")
+
+		Expect(feedItems).To(HaveLen(1))
+		Expect(feedItems[0].Link).To(Equal("http://mirror.example.com/4.mkv"))
+	})
+
+	It("should keep the numeric ids as written", func() {
+		numericServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"items":[{"id":9007199254740993,"url":"http://mytracker.org/view/1"}]}`))
+		}))
+		defer numericServer.Close()
+
+		jsonParser := NewJSONParser(config.JSONOptions{Items: "items", GUID: "id", Link: "url"})
+
+		feedItems, parseError := jsonParser.Parse(numericServer.URL)
+		Expect(parseError).NotTo(HaveOccurred())
+
+		Expect(feedItems[0].GUID).To(Equal("9007199254740993"))
+	})
+
+	It("should return the request and decoding errors", func() {
+		jsonParser := NewJSONParser(config.JSONOptions{Link: "url"})
+
+		_, parseError := jsonParser.Parse(jsonServer.URL + "/missing.json")
+		Expect(parseError.Error()).To(ContainSubstring("404 Not Found"))
+
+		htmlServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.ServeFile(w, r, "../testdata/scrape_page_1.html")
+		}))
+		defer htmlServer.Close()
+
+		_, parseError = jsonParser.Parse(htmlServer.URL)
+		Expect(parseError).To(HaveOccurred())
+	})
+
+	It("should feed the feed watcher new items", func() {
+		jsonParser := NewJSONParser(config.JSONOptions{
+			Items:      "items",
+			Title:      "title",
+			Link:       "url",
+			Enclosures: "attachments.*.url",
+			Date:       "date_published",
+		})
+
+		remoteFeed := RemoteFeed{Title: "MyTracker", URL: jsonServer.URL + "/feed.json", Provider: "generic", Parser: jsonParser.Parse}
+		feedWatcher := FeedWatcher{Feeds: []RemoteFeed{remoteFeed}, Parser: failingFeedParser}
+
+		feedLinks, linksError := feedWatcher.NewFeedLinks(time.Date(2017, time.February, 1, 0, 0, 0, 0, time.UTC))
+		Expect(linksError).NotTo(HaveOccurred())
+
+		Expect(feedLinks).To(HaveLen(1))
+		Expect(feedLinks[0].Link).To(Equal("http://mytracker.org/download/4.torrent"))
+	})
+})
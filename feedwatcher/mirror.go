@@ -0,0 +1,128 @@
+package feedwatcher
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// partPattern matches the links of the parts of a split file, such as
+// "Show.part1.rar", "Show.r00" or "Show.mkv.001"
+var partPattern = regexp.MustCompile(`(?i)(?:[._ -]part[._ -]?\d+|\.r\d{2,3}|\.\d{3})(?:$|[._ -])`)
+
+// Mirror is a host serving a whole feed item file, in one or several parts
+type Mirror struct {
+	Host  string
+	Links []string // Links of the file parts, in order
+}
+
+// MirrorExtractor is an extractor returning all the links of feed items,
+// grouped by mirror
+type MirrorExtractor interface {
+	FeedExtractor
+
+	// ExtractMirrors returns the mirrors of a feed item, preferred first
+	ExtractMirrors(feedItem *RemoteFeedItem) []*Mirror
+}
+
+// DownloadMirrors returns the mirrors of a RemoteFeedItem, preferred first
+//
+// Extractors unable to return mirrors give a single mirror of their link.
+func (rfi *RemoteFeedItem) DownloadMirrors(extractor FeedExtractor) []*Mirror {
+	if mirrorExtractor, isMirrorExtractor := extractor.(MirrorExtractor); isMirrorExtractor {
+		return mirrorExtractor.ExtractMirrors(rfi)
+	}
+
+	link := extractor.Extract(rfi)
+	if link == "" {
+		return nil
+	}
+
+	return []*Mirror{{Host: linkHost(link), Links: []string{link}}}
+}
+
+// groupMirrors groups some links by host, in order of appearance
+//
+// The parts of a split file found on a host make a single mirror, the other
+// links of the host being alternative mirrors. Links must be download links
+// only, as any other link would become a mirror too.
+func groupMirrors(links []string) []*Mirror {
+	var hosts []string
+	linksByHost := make(map[string][]string)
+
+	for _, link := range links {
+		host := linkHost(link)
+
+		if _, exists := linksByHost[host]; !exists {
+			hosts = append(hosts, host)
+		}
+
+		linksByHost[host] = append(linksByHost[host], link)
+	}
+
+	var mirrors []*Mirror
+
+	for _, host := range hosts {
+		var parts, others []string
+
+		for _, link := range linksByHost[host] {
+			if isPart(link) {
+				parts = append(parts, link)
+			} else {
+				others = append(others, link)
+			}
+		}
+
+		if len(parts) > 0 {
+			mirrors = append(mirrors, &Mirror{Host: host, Links: parts})
+		}
+
+		for _, link := range others {
+			mirrors = append(mirrors, &Mirror{Host: host, Links: []string{link}})
+		}
+	}
+
+	return mirrors
+}
+
+// favoriteMirrors returns the mirrors of the favorite hosts only, in favorite
+// hosts order, or all the mirrors without favorite hosts
+func favoriteMirrors(mirrors []*Mirror, favoriteHosts []string) []*Mirror {
+	if len(favoriteHosts) == 0 {
+		return mirrors
+	}
+
+	var favorites []*Mirror
+	isFavorite := make(map[*Mirror]bool)
+
+	for _, favoriteHost := range favoriteHosts {
+		for _, mirror := range mirrors {
+			if !isFavorite[mirror] && hostMatches(mirror.Links[0], favoriteHost) {
+				isFavorite[mirror] = true
+				favorites = append(favorites, mirror)
+			}
+		}
+	}
+
+	return favorites
+}
+
+// isPart indicates if a link is a part of a split file
+func isPart(link string) bool {
+	parsedLink, parseError := url.Parse(link)
+	if parseError != nil {
+		return false
+	}
+
+	return partPattern.MatchString(parsedLink.Path)
+}
+
+// linkHost returns the host of a link without "www.", blank if invalid
+func linkHost(link string) string {
+	parsedLink, parseError := url.Parse(link)
+	if parseError != nil {
+		return ""
+	}
+
+	return strings.TrimPrefix(strings.ToLower(parsedLink.Hostname()), "www.")
+}
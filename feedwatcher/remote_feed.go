@@ -1,9 +1,17 @@
 package feedwatcher
 
 import (
+	"crypto/sha1"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/davidderus/christopher/config"
+	"github.com/davidderus/christopher/database"
+	"github.com/davidderus/christopher/teller"
+	"github.com/davidderus/christopher/watchlist"
 )
 
 // RemoteFeed is the access informations of a feed on the Internet
@@ -13,15 +21,60 @@ type RemoteFeed struct {
 	Provider        string                 // The feed provider
 	ProviderOptions config.ProviderOptions // The feed provider options
 	remoteFeedItems []*RemoteFeedItem      // Storing last parsed feed for functions to consume
+	polledAt        time.Time              // Start time of the last poll
+
+	// Parser reads the feed items, instead of the feed watcher one if set,
+	// such as the Parse method of a Scraper
+	Parser FeedParser
+
+	// Database keeps the processed items across runs. If set, new items are
+	// the ones never processed instead of the ones published since a date.
+	Database *database.Database
+
+	// Filters rejects the new items not matching the feed rules
+	Filters config.FilterOptions
+
+	// Watchlist only lets the episodes of the watched shows through, once, if
+	// set
+	Watchlist *watchlist.Watchlist
+
+	// Teller reports the rejected items, if set
+	Teller *teller.Teller
 }
 
 // RemoteFeedItem represents a simplified RSS item
 // Here we only includes relevant infos for future download
 type RemoteFeedItem struct {
+	GUID        string
 	Title       string
 	Link        string
 	Description string
+	Content     string
+
+	// PublishedAt is zero for undated items, only found through the database
 	PublishedAt time.Time
+
+	// Enclosures are the urls of the item enclosures
+	Enclosures []string
+
+	// Size is the size in bytes of the item file, 0 if unknown
+	Size int64
+
+	// Elements are the values of the item custom elements, by "prefix:name"
+	Elements map[string][]string
+}
+
+// Key identifies a feed item across runs, by GUID, link or content
+func (rfi *RemoteFeedItem) Key() string {
+	if rfi.GUID != "" {
+		return "guid:" + rfi.GUID
+	}
+
+	if rfi.Link != "" {
+		return "link:" + rfi.Link
+	}
+
+	return fmt.Sprintf("hash:%x", sha1.Sum([]byte(rfi.Title+"\n"+rfi.Description)))
 }
 
 func (rf *RemoteFeed) itemsSince(date time.Time) []*RemoteFeedItem {
@@ -43,7 +96,22 @@ func (rfi *RemoteFeedItem) DownloadLink(extractor FeedExtractor) string {
 }
 
 // NewItems returns the feed new items since the given date
+//
+// With a database, new items are the ones never processed, whatever their
+// date. The date only applies to a feed never processed before, and is moved
+// back to the last successful poll of the feed if older.
+//
+// Items rejected by the feed filters are left out, while the ones waiting for
+// a better quality are checked again at the next poll. New items are only
+// recorded as processed by RecordDispatch, once sent to download.
 func (rf *RemoteFeed) NewItems(sinceDate time.Time, feedParserFunction FeedParser) ([]*RemoteFeedItem, error) {
+	polledAt := time.Now()
+
+	filter, filterError := newItemFilter(rf.Filters, rf.Database)
+	if filterError != nil {
+		return nil, filterError
+	}
+
 	parsedFeedItems, parsingError := feedParserFunction(rf.URL)
 
 	if parsingError != nil {
@@ -51,28 +119,446 @@ func (rf *RemoteFeed) NewItems(sinceDate time.Time, feedParserFunction FeedParse
 	}
 
 	rf.remoteFeedItems = parsedFeedItems
+	rf.polledAt = polledAt
+
+	if rf.Database == nil {
+		newItems, _ := rf.filterItems(filter, rf.itemsSince(sinceDate), polledAt)
+		return rf.watchedItems(newItems), nil
+	}
+
+	var newItems []*RemoteFeedItem
+
+	if rf.Database.IsKnownFeed(rf.URL) {
+		newItems = rf.unseenItems()
+	} else {
+		newItems = rf.itemsSince(rf.SinceDate(sinceDate))
+	}
+
+	newItems, heldItems := rf.filterItems(filter, newItems, polledAt)
+	newItems = rf.watchedItems(newItems)
 
-	return rf.itemsSince(sinceDate), nil
+	markError := rf.markSeen(append(heldItems, newItems...))
+	if markError != nil {
+		rf.releaseItems(newItems)
+		return nil, markError
+	}
+
+	return newItems, nil
 }
 
-// NewItemsLinks returns the feed new items links since the given date
-func (rf *RemoteFeed) NewItemsLinks(sinceDate time.Time, feedParserFunction FeedParser) ([]string, error) {
-	newItems, newItemsError := rf.NewItems(sinceDate, feedParserFunction)
+// RecordDispatch records the new items sent to download as processed, the
+// failed ones being found again at the next poll
+func (rf *RemoteFeed) RecordDispatch(dispatchedItems, failedItems []*RemoteFeedItem) error {
+	rf.releaseItems(failedItems)
 
-	if newItemsError != nil {
-		return nil, newItemsError
+	filter := &itemFilter{options: rf.Filters, database: rf.Database}
+
+	for _, dispatchedItem := range dispatchedItems {
+		grabError := filter.grab(dispatchedItem)
+		if grabError != nil {
+			return grabError
+		}
+
+		if rf.Watchlist != nil {
+			watchlistError := rf.Watchlist.Grab(dispatchedItem.Title)
+			if watchlistError != nil {
+				return watchlistError
+			}
+		}
+	}
+
+	if rf.Database == nil {
+		return nil
+	}
+
+	itemKeys := make([]string, len(dispatchedItems))
+	for itemIndex, dispatchedItem := range dispatchedItems {
+		itemKeys[itemIndex] = dispatchedItem.Key()
+	}
+
+	markError := rf.Database.MarkSeen(rf.URL, itemKeys)
+	if markError != nil {
+		return markError
+	}
+
+	return rf.Database.SetLastPoll(rf.URL, rf.polledAt)
+}
+
+// releaseItems gives up the watchlist claims of some items
+func (rf *RemoteFeed) releaseItems(items []*RemoteFeedItem) {
+	if rf.Watchlist == nil {
+		return
+	}
+
+	for _, item := range items {
+		rf.Watchlist.Release(item.Title)
+	}
+}
+
+// filterItems returns the items accepted by the feed filters, and the ones
+// waiting for a better quality
+func (rf *RemoteFeed) filterItems(filter *itemFilter, items []*RemoteFeedItem, now time.Time) ([]*RemoteFeedItem, []*RemoteFeedItem) {
+	acceptedItems := []*RemoteFeedItem{}
+	var heldItems []*RemoteFeedItem
+
+	for _, result := range filter.filter(items, now) {
+		switch {
+		case result.rule != "":
+			rf.logRejection(result.item, result.rule)
+		case result.held:
+			if rf.Teller != nil {
+				rf.Teller.LogWithFields(map[string]interface{}{
+					"feed": rf.Title,
+					"item": result.item.Title,
+				}).Debugln("Feed item waiting for a better quality")
+			}
+
+			heldItems = append(heldItems, result.item)
+		default:
+			acceptedItems = append(acceptedItems, result.item)
+		}
+	}
+
+	return acceptedItems, heldItems
+}
+
+// SinceDate returns the date from when the feed items are new, the given
+// one or the last successful poll of the feed if older
+func (rf *RemoteFeed) SinceDate(sinceDate time.Time) time.Time {
+	if rf.Database == nil {
+		return sinceDate
+	}
+
+	lastPoll := rf.Database.LastPoll(rf.URL)
+	if !lastPoll.IsZero() && lastPoll.Before(sinceDate) {
+		return lastPoll
+	}
+
+	return sinceDate
+}
+
+// unseenItems returns the last parsed items never processed
+func (rf *RemoteFeed) unseenItems() []*RemoteFeedItem {
+	newItems := []*RemoteFeedItem{}
+
+	for _, feedItem := range rf.remoteFeedItems {
+		if !rf.Database.IsSeen(rf.URL, feedItem.Key()) {
+			newItems = append(newItems, feedItem)
+		}
+	}
+
+	return newItems
+}
+
+// watchedItems returns the items of the episodes wanted by the watchlist,
+// claiming them, all the items without watchlist
+func (rf *RemoteFeed) watchedItems(items []*RemoteFeedItem) []*RemoteFeedItem {
+	if rf.Watchlist == nil {
+		return items
+	}
+
+	watchedItems := []*RemoteFeedItem{}
+
+	for _, item := range items {
+		rule := rf.Watchlist.Claim(item.Title)
+		if rule != "" {
+			rf.logRejection(item, "watchlist: "+rule)
+			continue
+		}
+
+		watchedItems = append(watchedItems, item)
+	}
+
+	return watchedItems
+}
+
+// logRejection reports an item rejected by a rule
+func (rf *RemoteFeed) logRejection(item *RemoteFeedItem, rule string) {
+	if rf.Teller == nil {
+		return
+	}
+
+	rf.Teller.LogWithFields(map[string]interface{}{
+		"feed": rf.Title,
+		"item": item.Title,
+		"rule": rule,
+	}).Infoln("Feed item rejected")
+}
+
+// markSeen records the last parsed items as processed, except the pending
+// ones to be checked again later or once dispatched
+//
+// The feed is known from then on, even without any item processed.
+func (rf *RemoteFeed) markSeen(pendingItems []*RemoteFeedItem) error {
+	isPending := make(map[*RemoteFeedItem]bool)
+	for _, pendingItem := range pendingItems {
+		isPending[pendingItem] = true
+	}
+
+	var itemKeys []string
+	for _, feedItem := range rf.remoteFeedItems {
+		if !isPending[feedItem] {
+			itemKeys = append(itemKeys, feedItem.Key())
+		}
+	}
+
+	return rf.Database.MarkSeen(rf.URL, itemKeys)
+}
+
+// FeedLink is a download link along with the feed item it comes from
+type FeedLink struct {
+	Link  string
+	Feed  string // Remote feed title
+	Title string // Feed item title
+
+	// Mirrors are the same link on the other mirrors of the feed item, in order
+	// of preference
+	Mirrors []string
+
+	// Checksum is the checksum given by the feed item, such as "md5:d41d8…"
+	Checksum string
+
+	// ItemKey identifies the feed item, to record it once dispatched
+	ItemKey string
+}
+
+// partKey identifies a part of a feed item, recorded once dispatched so only
+// the failed parts are sent again
+func partKey(itemKey, link string) string {
+	return itemKey + "#" + link
+}
+
+// checksumPattern matches checksums given in feed items, such as
+// "MD5: d41d8cd98f00b204e9800998ecf8427e"
+var checksumPattern = regexp.MustCompile(`(?i)\b(md5|sha-?1|sha-?256|crc-?32)\s*(?:hash|sum)?\s*[:=]\s*([0-9a-f]{8,64})\b`)
+
+// checksumLengths are the hex digits counts of the checksum algorithms
+var checksumLengths = map[string]int{"crc32": 8, "md5": 32, "sha1": 40, "sha256": 64}
+
+// Checksum returns the checksum given by a feed item, blank if none
+//
+// Checksums not as long as their algorithm digests are ignored.
+func (rfi *RemoteFeedItem) Checksum() string {
+	for _, matches := range checksumPattern.FindAllStringSubmatch(rfi.Title+"\n"+rfi.Description, -1) {
+		algorithm := strings.Replace(strings.ToLower(matches[1]), "-", "", -1)
+
+		if len(matches[2]) == checksumLengths[algorithm] {
+			return algorithm + ":" + strings.ToLower(matches[2])
+		}
+	}
+
+	return ""
+}
+
+// sizePattern matches sizes given in feed items, such as "Size: 350 MB"
+var sizePattern = regexp.MustCompile(`(?i)\bsize\s*[:=]\s*(\d+(?:[.,]\d+)?)\s*([kmgt]i?b|o|bytes)\b`)
+
+// sizeUnits are the bytes counts of the size units
+var sizeUnits = map[string]float64{
+	"k": 1024,
+	"m": 1024 * 1024,
+	"g": 1024 * 1024 * 1024,
+	"t": 1024 * 1024 * 1024 * 1024,
+}
+
+// FileSize returns the size in bytes of the item file, given by the feed or
+// in the item title and description, 0 if unknown
+func (rfi *RemoteFeedItem) FileSize() int64 {
+	if rfi.Size > 0 {
+		return rfi.Size
+	}
+
+	if contentLengths := rfi.Elements["torrent:contentLength"]; len(contentLengths) > 0 {
+		contentLength, parseError := strconv.ParseInt(strings.TrimSpace(contentLengths[0]), 10, 64)
+		if parseError == nil {
+			return contentLength
+		}
+	}
+
+	matches := sizePattern.FindStringSubmatch(rfi.Title + "\n" + rfi.Description)
+	if matches == nil {
+		return 0
 	}
 
-	links := make([]string, len(newItems))
+	size, _ := strconv.ParseFloat(strings.Replace(matches[1], ",", ".", 1), 64)
 
+	if unit, hasUnit := sizeUnits[strings.ToLower(matches[2][:1])]; hasUnit {
+		size *= unit
+	}
+
+	return int64(size)
+}
+
+// NewFeedLinks returns the feed new items links since the given date, along
+// with the items titles
+//
+// Items split in several parts give a link for each part of their preferred
+// mirror, the other mirrors with as many parts serving as fallbacks. The
+// parts dispatched by a previous poll are left out. The feed watcher records
+// the items once their links are dispatched, while the items without link
+// are recorded as processed right away.
+func (rf *RemoteFeed) NewFeedLinks(sinceDate time.Time, feedParserFunction FeedParser) ([]*FeedLink, error) {
 	extractor, extractorError := NewFeedExtractor(rf.Provider, rf.ProviderOptions)
 	if extractorError != nil {
 		return nil, extractorError
 	}
 
-	for index, item := range newItems {
-		links[index] = item.DownloadLink(extractor)
+	newItems, newItemsError := rf.NewItems(sinceDate, feedParserFunction)
+
+	if newItemsError != nil {
+		return nil, newItemsError
+	}
+
+	feedLinks := make([]*FeedLink, 0, len(newItems))
+	var linklessItems, dispatchedItems []*RemoteFeedItem
+
+	for _, item := range newItems {
+		mirrors := item.DownloadMirrors(extractor)
+
+		if len(mirrors) == 0 {
+			rf.logRejection(item, "no download link")
+			linklessItems = append(linklessItems, item)
+			continue
+		}
+
+		itemLinks := rf.mirrorsLinks(item, mirrors)
+		if len(itemLinks) == 0 {
+			// All the parts were dispatched by the previous polls
+			dispatchedItems = append(dispatchedItems, item)
+			continue
+		}
+
+		feedLinks = append(feedLinks, itemLinks...)
+	}
+
+	rf.releaseItems(linklessItems)
+
+	if rf.Database != nil && len(linklessItems) > 0 {
+		itemKeys := make([]string, len(linklessItems))
+		for itemIndex, linklessItem := range linklessItems {
+			itemKeys[itemIndex] = linklessItem.Key()
+		}
+
+		markError := rf.Database.MarkSeen(rf.URL, itemKeys)
+		if markError != nil {
+			rf.releaseItems(newItems)
+			return nil, markError
+		}
+	}
+
+	if len(dispatchedItems) > 0 {
+		recordError := rf.RecordDispatch(dispatchedItems, nil)
+		if recordError != nil {
+			rf.releaseItems(newItems)
+			return nil, recordError
+		}
+	}
+
+	return feedLinks, nil
+}
+
+// mirrorsLinks returns the links of the parts of an item preferred mirror not
+// dispatched yet, with their fallbacks on the other mirrors
+func (rf *RemoteFeed) mirrorsLinks(item *RemoteFeedItem, mirrors []*Mirror) []*FeedLink {
+	var feedLinks []*FeedLink
+
+	preferredMirror := mirrors[0]
+
+	for partIndex, link := range preferredMirror.Links {
+		if rf.Database != nil && rf.Database.IsSeen(rf.URL, partKey(item.Key(), link)) {
+			continue
+		}
+
+		feedLink := &FeedLink{Link: link, Feed: rf.Title, Title: item.Title, ItemKey: item.Key()}
+
+		// The item checksum is the one of the whole file
+		if len(preferredMirror.Links) == 1 {
+			feedLink.Checksum = item.Checksum()
+		}
+
+		for _, mirror := range mirrors[1:] {
+			if len(mirror.Links) == len(preferredMirror.Links) {
+				feedLink.Mirrors = append(feedLink.Mirrors, mirror.Links[partIndex])
+			}
+		}
+
+		feedLinks = append(feedLinks, feedLink)
+	}
+
+	return feedLinks
+}
+
+// NewItemsLinks returns the feed new items links since the given date
+func (rf *RemoteFeed) NewItemsLinks(sinceDate time.Time, feedParserFunction FeedParser) ([]string, error) {
+	feedLinks, feedLinksError := rf.NewFeedLinks(sinceDate, feedParserFunction)
+
+	if feedLinksError != nil {
+		return nil, feedLinksError
+	}
+
+	links := make([]string, len(feedLinks))
+	for index, feedLink := range feedLinks {
+		links[index] = feedLink.Link
 	}
 
 	return links, nil
 }
+
+// recordLinksDispatch records the items of some of the last feed links as
+// processed, once all their links are dispatched
+//
+// The dispatched parts of the other items are recorded, so only their failed
+// parts are sent at the next poll. Dispatch errors are indexed like the links,
+// a nil slice meaning that no link was dispatched.
+func (rf *RemoteFeed) recordLinksDispatch(feedLinks []*FeedLink, dispatchErrors []error) error {
+	itemsByKey := make(map[string]*RemoteFeedItem)
+	for _, feedItem := range rf.remoteFeedItems {
+		itemsByKey[feedItem.Key()] = feedItem
+	}
+
+	var itemKeys []string
+	isFailed := make(map[string]bool)
+
+	for linkIndex, feedLink := range feedLinks {
+		if _, isKnown := isFailed[feedLink.ItemKey]; !isKnown {
+			itemKeys = append(itemKeys, feedLink.ItemKey)
+		}
+
+		isFailed[feedLink.ItemKey] = isFailed[feedLink.ItemKey] || dispatchErrors == nil || dispatchErrors[linkIndex] != nil
+	}
+
+	var dispatchedItems, failedItems []*RemoteFeedItem
+
+	for _, itemKey := range itemKeys {
+		item, exists := itemsByKey[itemKey]
+		if !exists {
+			continue
+		}
+
+		if isFailed[itemKey] {
+			failedItems = append(failedItems, item)
+		} else {
+			dispatchedItems = append(dispatchedItems, item)
+		}
+	}
+
+	if rf.Database != nil && dispatchErrors != nil {
+		var partKeys []string
+
+		for linkIndex, feedLink := range feedLinks {
+			if isFailed[feedLink.ItemKey] && dispatchErrors[linkIndex] == nil {
+				partKeys = append(partKeys, partKey(feedLink.ItemKey, feedLink.Link))
+			}
+		}
+
+		if len(partKeys) > 0 {
+			markError := rf.Database.MarkSeen(rf.URL, partKeys)
+			if markError != nil {
+				rf.releaseItems(append(dispatchedItems, failedItems...))
+				return markError
+			}
+		}
+	}
+
+	return rf.RecordDispatch(dispatchedItems, failedItems)
+}
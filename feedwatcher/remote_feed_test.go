@@ -2,11 +2,13 @@ package feedwatcher_test
 
 import (
 	"errors"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
 	"github.com/davidderus/christopher/config"
+	"github.com/davidderus/christopher/database"
 	. "github.com/davidderus/christopher/feedwatcher"
 )
 
@@ -46,6 +48,79 @@ var _ = Describe("RemoteFeed", func() {
 		})
 	})
 
+	Context("With a database", func() {
+		It("should return each item only once", func() {
+			db, _ := database.Open("")
+			myRemoteFeed = RemoteFeed{Title: "New items feed", URL: "basic", Provider: "BasicProvider", Database: db}
+
+			newItems, _ := myRemoteFeed.NewItems(feedSinceDateWithItems, customFeedParser)
+			Expect(newItems).To(HaveLen(3))
+			Expect(myRemoteFeed.RecordDispatch(newItems, nil)).To(Succeed())
+
+			newItems, _ = myRemoteFeed.NewItems(feedSinceDateWithItems, customFeedParser)
+			Expect(newItems).To(BeEmpty())
+		})
+
+		It("should return the items failing to be dispatched again", func() {
+			db, _ := database.Open("")
+			myRemoteFeed = RemoteFeed{Title: "New items feed", URL: "basic", Provider: "BasicProvider", Database: db}
+
+			newItems, _ := myRemoteFeed.NewItems(feedSinceDateWithItems, customFeedParser)
+			Expect(newItems).To(HaveLen(3))
+
+			newItems, _ = myRemoteFeed.NewItems(feedSinceDateWithItems, customFeedParser)
+			Expect(newItems).To(HaveLen(3))
+			Expect(myRemoteFeed.RecordDispatch(newItems[1:], newItems[:1])).To(Succeed())
+
+			newItems, _ = myRemoteFeed.NewItems(feedSinceDateWithItems, customFeedParser)
+			Expect(newItems).To(HaveLen(1))
+			Expect(newItems[0].Title).To(Equal("Zombie One"))
+		})
+
+		It("should resume from the last successful poll", func() {
+			db, _ := database.Open("")
+			db.SetLastPoll("basic", feedSinceDateWithItems)
+
+			myRemoteFeed = RemoteFeed{Title: "New items feed", URL: "basic", Provider: "BasicProvider", Database: db}
+			Expect(myRemoteFeed.SinceDate(feedSinceDateWithoutItems)).To(Equal(feedSinceDateWithItems))
+
+			newItems, _ := myRemoteFeed.NewItems(feedSinceDateWithoutItems, customFeedParser)
+			Expect(newItems).To(HaveLen(3))
+			Expect(db.LastPoll("basic")).To(Equal(feedSinceDateWithItems))
+
+			Expect(myRemoteFeed.RecordDispatch(newItems, nil)).To(Succeed())
+			Expect(db.LastPoll("basic")).To(BeTemporally("~", time.Now(), time.Second))
+		})
+
+		It("should not move the last poll on errors", func() {
+			db, _ := database.Open("")
+			myRemoteFeed = RemoteFeed{Title: "New items feed", URL: "basic", Provider: "BasicProvider", Database: db}
+
+			myRemoteFeed.NewItems(feedSinceDateWithItems, failingFeedParser)
+
+			Expect(db.LastPoll("basic").IsZero()).To(BeTrue())
+		})
+
+		It("should return back-dated items once the feed is known", func() {
+			db, _ := database.Open("")
+			myRemoteFeed = RemoteFeed{Title: "New items feed", URL: "basic", Provider: "BasicProvider", Database: db}
+
+			newItems, _ := myRemoteFeed.NewItems(feedSinceDateWithoutItems, customFeedParser)
+			Expect(newItems).To(BeEmpty())
+
+			backDatedFeedParser := func(feedURL string) ([]*RemoteFeedItem, error) {
+				feedItems, _ := customFeedParser(feedURL)
+				backDatedItem := &RemoteFeedItem{GUID: "42", Title: "Zombie One S01E02", PublishedAt: time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC)}
+
+				return append(feedItems, backDatedItem), nil
+			}
+
+			newItems, _ = myRemoteFeed.NewItems(feedSinceDateWithoutItems, backDatedFeedParser)
+			Expect(newItems).To(HaveLen(1))
+			Expect(newItems[0].Title).To(Equal("Zombie One S01E02"))
+		})
+	})
+
 	Context("With invalid items", func() {
 		It("should log an error", func() {
 			_, newItemsError := myRemoteFeed.NewItems(feedSinceDateWithItems, failingFeedParser)
@@ -78,8 +153,60 @@ var _ = Describe("RemoteFeed", func() {
 
 				Expect(linksError).NotTo(HaveOccurred())
 
-				Expect(links).To(Equal([]string{"http://uploaded.net/file/Zombie-One.mkv", "http://rapidgator.net/file/HTGAWM.mkv", ""}))
+				// Items without link are left out
+				Expect(links).To(Equal([]string{"http://uploaded.net/file/Zombie-One.mkv", "http://rapidgator.net/file/HTGAWM.mkv"}))
 			})
 		})
 	})
 })
+
+var _ = Describe("RemoteFeedItem", func() {
+	Describe("Checksum", func() {
+		It("should find a checksum in the description", func() {
+			item := &RemoteFeedItem{Title: "Zombie One", Description: "Size: 350 MB<br>MD5 hash: D41D8CD98F00B204E9800998ECF8427E<br>"}
+
+			Expect(item.Checksum()).To(Equal("md5:d41d8cd98f00b204e9800998ecf8427e"))
+		})
+
+		It("should normalize the algorithm name", func() {
+			item := &RemoteFeedItem{Title: "Shark Avocado [CRC-32=1a2b3c4d]"}
+
+			Expect(item.Checksum()).To(Equal("crc32:1a2b3c4d"))
+		})
+
+		It("should ignore the checksums not as long as their digest", func() {
+			item := &RemoteFeedItem{Title: "Zombie One", Description: "MD5: 1a2b3c4d<br>SHA-1: da39a3ee5e6b4b0d3255bfef95601890afd80709"}
+
+			Expect(item.Checksum()).To(Equal("sha1:da39a3ee5e6b4b0d3255bfef95601890afd80709"))
+		})
+
+		It("should be blank without checksum", func() {
+			item := &RemoteFeedItem{Title: "HTGAWM", Description: "http://rapidgator.net/file/HTGAWM.mkv"}
+
+			Expect(item.Checksum()).To(BeEmpty())
+		})
+	})
+
+	Describe("FileSize", func() {
+		It("should prefer the feed size", func() {
+			item := &RemoteFeedItem{Description: "Size: 350 MB", Size: 42}
+			Expect(item.FileSize()).To(Equal(int64(42)))
+
+			item = &RemoteFeedItem{Elements: map[string][]string{"torrent:contentLength": {"1024"}}}
+			Expect(item.FileSize()).To(Equal(int64(1024)))
+		})
+
+		It("should find a size in the description", func() {
+			item := &RemoteFeedItem{Title: "Zombie One", Description: "Size: 350 MB<br>MD5 hash: D41D8CD98F00B204E9800998ECF8427E<br>"}
+			Expect(item.FileSize()).To(Equal(int64(350 * 1024 * 1024)))
+
+			item = &RemoteFeedItem{Description: "size = 1,5 GiB"}
+			Expect(item.FileSize()).To(Equal(int64(1.5 * 1024 * 1024 * 1024)))
+		})
+
+		It("should be 0 without size", func() {
+			item := &RemoteFeedItem{Title: "HTGAWM"}
+			Expect(item.FileSize()).To(BeZero())
+		})
+	})
+})
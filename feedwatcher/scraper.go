@@ -0,0 +1,213 @@
+package feedwatcher
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"github.com/davidderus/christopher/config"
+	"golang.org/x/net/html"
+)
+
+// defaultScrapeLinkSelector selects the links of a scraped item
+const defaultScrapeLinkSelector = "a[href]"
+
+// Scraper reads the items of an HTML page thanks to some CSS selectors, for
+// sites without feeds
+type Scraper struct {
+	options config.ScrapeOptions
+
+	item     cascadia.Selector
+	title    cascadia.Selector
+	link     cascadia.Selector
+	date     cascadia.Selector
+	nextPage cascadia.Selector
+
+	client *http.Client
+}
+
+// NewScraper returns a scraper for the given options, its selectors being
+// checked
+func NewScraper(options config.ScrapeOptions) (*Scraper, error) {
+	scraper := &Scraper{options: options}
+
+	if scraper.options.Link == "" {
+		scraper.options.Link = defaultScrapeLinkSelector
+	}
+
+	if scraper.options.DateFormat == "" {
+		scraper.options.DateFormat = time.RFC3339
+	}
+
+	if scraper.options.MaxPages <= 0 {
+		scraper.options.MaxPages = 1
+	}
+
+	selectors := []struct {
+		name     string
+		value    string
+		selector *cascadia.Selector
+	}{
+		{"item", scraper.options.Item, &scraper.item},
+		{"title", scraper.options.Title, &scraper.title},
+		{"link", scraper.options.Link, &scraper.link},
+		{"date", scraper.options.Date, &scraper.date},
+		{"next page", scraper.options.NextPage, &scraper.nextPage},
+	}
+
+	for _, selector := range selectors {
+		if selector.value == "" {
+			continue
+		}
+
+		compiledSelector, compileError := cascadia.Compile(selector.value)
+		if compileError != nil {
+			return nil, fmt.Errorf("Invalid %s selector %s: %s", selector.name, selector.value, compileError)
+		}
+
+		*selector.selector = compiledSelector
+	}
+
+	if scraper.item == nil {
+		return nil, errors.New("Missing item selector")
+	}
+
+	scraper.client = &http.Client{Timeout: feedTimeOut * time.Second}
+
+	return scraper, nil
+}
+
+// Parse returns the items of a page and of its next pages, up to the pages
+// limit
+func (sc *Scraper) Parse(pageURL string) ([]*RemoteFeedItem, error) {
+	var feedItems []*RemoteFeedItem
+
+	visitedPages := make(map[string]bool)
+
+	for pageCount := 0; pageCount < sc.options.MaxPages && pageURL != "" && !visitedPages[pageURL]; pageCount++ {
+		visitedPages[pageURL] = true
+
+		document, baseURL, pageError := sc.page(pageURL)
+		if pageError != nil {
+			return nil, pageError
+		}
+
+		document.FindMatcher(sc.item).Each(func(itemIndex int, item *goquery.Selection) {
+			feedItems = append(feedItems, sc.feedItem(item, baseURL))
+		})
+
+		pageURL = sc.nextPageURL(document, baseURL)
+	}
+
+	return feedItems, nil
+}
+
+// page requests a page with the source user agent and returns it with its
+// final URL
+func (sc *Scraper) page(pageURL string) (*goquery.Document, *url.URL, error) {
+	response, responseError := fetchFeed(sc.client, pageURL, sc.options.UserAgent)
+	if responseError != nil {
+		return nil, nil, responseError
+	}
+	defer response.Body.Close()
+
+	document, documentError := goquery.NewDocumentFromReader(response.Body)
+	if documentError != nil {
+		return nil, nil, documentError
+	}
+
+	return document, response.Request.URL, nil
+}
+
+// feedItem turns a page item into a feed item
+//
+// The item HTML is kept as description, with absolute links, so extractors
+// can look for more links.
+func (sc *Scraper) feedItem(item *goquery.Selection, baseURL *url.URL) *RemoteFeedItem {
+	for _, node := range item.Nodes {
+		absoluteLinks(node, baseURL)
+	}
+
+	feedItem := &RemoteFeedItem{}
+
+	links := item.FindMatcher(sc.link)
+	links.EachWithBreak(func(linkIndex int, link *goquery.Selection) bool {
+		feedItem.Link = linkURL(link)
+		if feedItem.Link == "" {
+			return true
+		}
+
+		feedItem.Title = strings.TrimSpace(link.Text())
+
+		return false
+	})
+
+	if sc.title != nil {
+		feedItem.Title = strings.TrimSpace(item.FindMatcher(sc.title).First().Text())
+	}
+
+	if sc.date != nil {
+		dateElement := item.FindMatcher(sc.date).First()
+		dateValue := strings.TrimSpace(dateElement.AttrOr("datetime", dateElement.Text()))
+
+		publishedAt, dateError := time.Parse(sc.options.DateFormat, dateValue)
+		if dateError == nil {
+			feedItem.PublishedAt = publishedAt
+		}
+	}
+
+	feedItem.Description, _ = item.Html()
+
+	return feedItem
+}
+
+// nextPageURL returns the absolute URL of the next page, blank if none
+func (sc *Scraper) nextPageURL(document *goquery.Document, baseURL *url.URL) string {
+	if sc.nextPage == nil {
+		return ""
+	}
+
+	nextPage := document.FindMatcher(sc.nextPage).First()
+	if nextPage.Length() == 0 {
+		return ""
+	}
+
+	absoluteLinks(nextPage.Nodes[0], baseURL)
+
+	return linkURL(nextPage)
+}
+
+// linkURL returns the href or src of a link element
+func linkURL(link *goquery.Selection) string {
+	if href, hasHref := link.Attr("href"); hasHref {
+		return strings.TrimSpace(href)
+	}
+
+	return strings.TrimSpace(link.AttrOr("src", ""))
+}
+
+// absoluteLinks resolves the href and src attributes of a node and its
+// children against the page URL
+func absoluteLinks(node *html.Node, baseURL *url.URL) {
+	if node.Type == html.ElementNode {
+		for attrIndex, attr := range node.Attr {
+			if (attr.Key != "href" && attr.Key != "src") || strings.TrimSpace(attr.Val) == "" {
+				continue
+			}
+
+			linkURL, parseError := baseURL.Parse(strings.TrimSpace(attr.Val))
+			if parseError == nil {
+				node.Attr[attrIndex].Val = linkURL.String()
+			}
+		}
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		absoluteLinks(child, baseURL)
+	}
+}
@@ -0,0 +1,124 @@
+package feedwatcher_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/davidderus/christopher/config"
+	. "github.com/davidderus/christopher/feedwatcher"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Scraper", func() {
+	var pageServer *httptest.Server
+	var userAgents []string
+
+	scrapeOptions := config.ScrapeOptions{
+		Item:     "li.release",
+		Title:    "h2",
+		Link:     "a.download",
+		Date:     "time",
+		NextPage: "a.next",
+	}
+
+	BeforeEach(func() {
+		userAgents = nil
+
+		pageServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userAgents = append(userAgents, r.UserAgent())
+
+			switch r.URL.Query().Get("page") {
+			case "":
+				http.ServeFile(w, r, "../testdata/scrape_page_1.html")
+			case "2":
+				http.ServeFile(w, r, "../testdata/scrape_page_2.html")
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+	})
+
+	AfterEach(func() {
+		pageServer.Close()
+	})
+
+	It("should read the page items with the selectors", func() {
+		scraper, scraperError := NewScraper(scrapeOptions)
+		Expect(scraperError).NotTo(HaveOccurred())
+
+		feedItems, parseError := scraper.Parse(pageServer.URL + "/latest")
+		Expect(parseError).NotTo(HaveOccurred())
+
+		Expect(feedItems).To(HaveLen(2))
+		Expect(feedItems[0].Title).To(Equal("Zombie.One.S03E04.720p"))
+		Expect(feedItems[0].Link).To(Equal(pageServer.URL + "/download/4.torrent"))
+		Expect(feedItems[0].PublishedAt).To(Equal(time.Date(2017, time.February, 10, 20, 0, 0, 0, time.UTC)))
+		Expect(feedItems[0].Description).To(ContainSubstring(`href="http://mirror.example.com/4.mkv"`))
+		Expect(feedItems[1].Link).To(Equal(pageServer.URL + "/download/3.torrent"))
+	})
+
+	It("should follow the next pages up to the limit with the user agent", func() {
+		options := scrapeOptions
+		options.MaxPages = 5
+		options.UserAgent = "Christopher/1.0"
+
+		scraper, _ := NewScraper(options)
+		feedItems, parseError := scraper.Parse(pageServer.URL + "/latest")
+
+		// The third page is missing
+		Expect(parseError).To(HaveOccurred())
+		Expect(parseError.Error()).To(ContainSubstring("404 Not Found"))
+		Expect(feedItems).To(BeNil())
+
+		options.MaxPages = 2
+		scraper, _ = NewScraper(options)
+		feedItems, parseError = scraper.Parse(pageServer.URL + "/latest")
+
+		Expect(parseError).NotTo(HaveOccurred())
+		Expect(feedItems).To(HaveLen(3))
+		Expect(feedItems[2].Title).To(Equal("Zombie.One.S03E03.720p"))
+		Expect(feedItems[2].PublishedAt.IsZero()).To(BeTrue())
+		Expect(userAgents).To(Equal([]string{"Christopher/1.0", "Christopher/1.0", "Christopher/1.0", "Christopher/1.0", "Christopher/1.0"}))
+	})
+
+	It("should title the items with their link by default", func() {
+		scraper, _ := NewScraper(config.ScrapeOptions{Item: "li.release"})
+		feedItems, _ := scraper.Parse(pageServer.URL + "/latest")
+
+		Expect(feedItems).To(HaveLen(2))
+		Expect(feedItems[0].Title).To(Equal("Torrent"))
+		Expect(feedItems[0].Link).To(Equal(pageServer.URL + "/download/4.torrent"))
+	})
+
+	It("should reject invalid selectors", func() {
+		_, scraperError := NewScraper(config.ScrapeOptions{})
+		Expect(scraperError.Error()).To(Equal("Missing item selector"))
+
+		_, scraperError = NewScraper(config.ScrapeOptions{Item: "li.release", Date: "time["})
+		Expect(scraperError.Error()).To(HavePrefix("Invalid date selector time[:"))
+	})
+
+	It("should feed the feed watcher instead of its parser", func() {
+		scraper, _ := NewScraper(scrapeOptions)
+
+		remoteFeed := RemoteFeed{
+			Title:           "MyTracker",
+			URL:             pageServer.URL + "/latest",
+			Provider:        "generic",
+			ProviderOptions: config.ProviderOptions{},
+			Parser:          scraper.Parse,
+		}
+
+		feedWatcher := FeedWatcher{Feeds: []RemoteFeed{remoteFeed}, Parser: failingFeedParser}
+
+		feedLinks, linksError := feedWatcher.NewFeedLinks(time.Date(2017, time.February, 10, 0, 0, 0, 0, time.UTC))
+		Expect(linksError).NotTo(HaveOccurred())
+
+		Expect(feedLinks).To(HaveLen(1))
+		Expect(feedLinks[0].Link).To(Equal(pageServer.URL + "/download/4.torrent"))
+		Expect(feedLinks[0].Title).To(Equal("Zombie.One.S03E04.720p"))
+	})
+})
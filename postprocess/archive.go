@@ -0,0 +1,213 @@
+package postprocess
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// archiveSet is an archive and all its volumes
+type archiveSet struct {
+	// key identifies the archive, see archiveKey
+	key string
+
+	// first is the path of the volume to extract
+	first string
+
+	// volumes are the paths of all the volumes found on disk
+	volumes []string
+
+	// isZip indicates a single ZIP archive, extractable without command
+	isZip bool
+
+	// isContiguous is false if some volumes are missing in the numbering,
+	// including the first one
+	isContiguous bool
+}
+
+// volumeFamily is a naming scheme of archive volumes
+type volumeFamily struct {
+	pattern *regexp.Regexp
+
+	// number returns the volume number of a file name match
+	number func(matches []string) int
+
+	// firstNumber is the number of the first volume
+	firstNumber int
+}
+
+// volumeFamilies are the supported archive naming schemes
+//
+// Multi-part RAR first, as "show.part01.rar" also ends with ".rar".
+var volumeFamilies = []*volumeFamily{
+	// show.part01.rar, show.part02.rar…
+	{
+		pattern:     regexp.MustCompile(`(?i)^(.+)\.part(\d+)\.rar$`),
+		number:      func(matches []string) int { return atoi(matches[2]) },
+		firstNumber: 1,
+	},
+	// show.7z.001, show.zip.001…
+	{
+		pattern:     regexp.MustCompile(`(?i)^(.+\.(?:7z|zip|rar))\.(\d{3})$`),
+		number:      func(matches []string) int { return atoi(matches[2]) },
+		firstNumber: 1,
+	},
+	// show.rar, show.r00, show.r01…
+	{
+		pattern: regexp.MustCompile(`(?i)^(.+)\.(rar|r\d{2})$`),
+		number:  func(matches []string) int { return extensionNumber(matches[2]) },
+	},
+	// show.zip, show.z01, show.z02… the .zip holding the central directory
+	{
+		pattern: regexp.MustCompile(`(?i)^(.+)\.(zip|z\d{2})$`),
+		number:  func(matches []string) int { return extensionNumber(matches[2]) },
+	},
+	// show.7z
+	{
+		pattern: regexp.MustCompile(`(?i)^(.+)\.(7z)$`),
+		number:  func(matches []string) int { return 0 },
+	},
+}
+
+// findArchiveSet returns the archive set a file belongs to, nil if the file
+// is not an archive
+func findArchiveSet(filePath string) *archiveSet {
+	dir, fileName := filepath.Split(filePath)
+
+	for familyIndex, family := range volumeFamilies {
+		matches := family.pattern.FindStringSubmatch(fileName)
+		if matches == nil {
+			continue
+		}
+
+		set := family.archiveSet(dir, matches[1])
+		if set != nil {
+			set.key = archiveKey(familyIndex, dir, matches[1])
+		}
+
+		return set
+	}
+
+	return nil
+}
+
+// archiveKey identifies an archive by its naming scheme and base path
+func archiveKey(familyIndex int, dir, baseName string) string {
+	return strconv.Itoa(familyIndex) + ":" + filepath.Join(dir, baseName)
+}
+
+// archiveKeyOf returns the key of the archive a file would belong to, blank
+// if the file is not an archive
+func archiveKeyOf(filePath string) string {
+	dir, fileName := filepath.Split(filePath)
+
+	for familyIndex, family := range volumeFamilies {
+		matches := family.pattern.FindStringSubmatch(fileName)
+		if matches != nil {
+			return archiveKey(familyIndex, dir, matches[1])
+		}
+	}
+
+	return ""
+}
+
+// archiveSet lists the volumes of an archive in a dir
+func (vf *volumeFamily) archiveSet(dir, baseName string) *archiveSet {
+	fileInfos, _ := ioutil.ReadDir(dir)
+
+	numbers := make(map[int]string)
+	var sortedNumbers []int
+
+	for _, fileInfo := range fileInfos {
+		matches := vf.pattern.FindStringSubmatch(fileInfo.Name())
+		if matches == nil || fileInfo.IsDir() || matches[1] != baseName {
+			continue
+		}
+
+		volumeNumber := vf.number(matches)
+		numbers[volumeNumber] = filepath.Join(dir, fileInfo.Name())
+		sortedNumbers = append(sortedNumbers, volumeNumber)
+	}
+
+	if len(sortedNumbers) == 0 {
+		return nil
+	}
+
+	sort.Ints(sortedNumbers)
+
+	set := &archiveSet{first: numbers[sortedNumbers[0]], isContiguous: true}
+
+	for numberIndex, volumeNumber := range sortedNumbers {
+		set.volumes = append(set.volumes, numbers[volumeNumber])
+
+		if numberIndex > 0 && volumeNumber != sortedNumbers[numberIndex-1]+1 {
+			set.isContiguous = false
+		}
+	}
+
+	if sortedNumbers[0] != vf.firstNumber {
+		set.isContiguous = false
+	}
+
+	set.isZip = len(set.volumes) == 1 && strings.EqualFold(filepath.Ext(set.first), ".zip")
+
+	return set
+}
+
+// isComplete indicates if all the volumes of a set are downloaded
+//
+// Volumes still downloading are either pending in the downloader or have an
+// aria2 control file next to them. A missing last volume can't be detected.
+func (as *archiveSet) isComplete(pendingPaths []string) bool {
+	if !as.isContiguous {
+		return false
+	}
+
+	for _, pendingPath := range pendingPaths {
+		if archiveKeyOf(pendingPath) == as.key {
+			return false
+		}
+	}
+
+	for _, volume := range as.volumes {
+		if _, statError := os.Stat(volume + ".aria2"); statError == nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// extensionNumber returns the volume number of an extension such as "r01",
+// "rar" and "zip" being the first volumes
+func extensionNumber(extension string) int {
+	switch strings.ToLower(extension) {
+	case "rar":
+		return 0
+	case "zip":
+		// The .zip is the last volume but the one to extract
+		return 0
+	}
+
+	// .r00 is the second volume of a RAR archive, .z01 the first of a ZIP
+	number := atoi(extension[1:])
+	if strings.EqualFold(extension[:1], "r") {
+		number++
+	}
+
+	return number
+}
+
+// atoi returns the number in a string, -1 if invalid
+func atoi(number string) int {
+	parsedNumber, parseError := strconv.Atoi(number)
+	if parseError != nil {
+		return -1
+	}
+
+	return parsedNumber
+}
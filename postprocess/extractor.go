@@ -0,0 +1,157 @@
+package postprocess
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// errZIPEncrypted is returned by the native ZIP extraction on encrypted
+// archives
+var errZIPEncrypted = errors.New("Encrypted ZIP archive")
+
+// Extractor extracts archives with a command or natively for ZIP archives
+type Extractor struct {
+	// Command extracts an archive, "{archive}", "{dir}" and "{password}" being
+	// replaced in its arguments
+	//
+	// Passwords are thus visible in the process list of the host while
+	// extracting.
+	Command []string
+
+	// NativeZip extracts unencrypted single ZIP archives without Command
+	NativeZip bool
+
+	// Passwords are tried in order after a blank one
+	Passwords []string
+}
+
+// Extract extracts an archive set into a dir, trying each password
+func (e *Extractor) Extract(set *archiveSet, dir string) error {
+	mkdirError := os.MkdirAll(dir, 0755)
+	if mkdirError != nil {
+		return mkdirError
+	}
+
+	if set.isZip && e.NativeZip {
+		zipError := extractZip(set.first, dir)
+		if zipError != errZIPEncrypted || len(e.Command) == 0 {
+			return zipError
+		}
+	}
+
+	if len(e.Command) == 0 {
+		return fmt.Errorf("No command to extract %s", filepath.Base(set.first))
+	}
+
+	var commandError error
+
+	for _, password := range append([]string{""}, e.Passwords...) {
+		commandError = e.run(set.first, dir, password)
+		if commandError == nil {
+			return nil
+		}
+	}
+
+	return commandError
+}
+
+// run runs the extraction command with a password
+func (e *Extractor) run(archivePath, dir, password string) error {
+	replacer := strings.NewReplacer("{archive}", archivePath, "{dir}", dir, "{password}", password)
+
+	args := make([]string, len(e.Command))
+	for argIndex, arg := range e.Command {
+		args[argIndex] = replacer.Replace(arg)
+	}
+
+	var output bytes.Buffer
+
+	// Without stdin, commands asking for a password fail instead of waiting
+	command := exec.Command(args[0], args[1:]...)
+	command.Stdout = &output
+	command.Stderr = &output
+
+	runError := command.Run()
+	if runError != nil {
+		return fmt.Errorf("Extraction of %s failed: %s %s", filepath.Base(archivePath), runError, strings.TrimSpace(output.String()))
+	}
+
+	return nil
+}
+
+// extractZip extracts an unencrypted ZIP archive into a dir
+func extractZip(archivePath, dir string) error {
+	reader, openError := zip.OpenReader(archivePath)
+	if openError != nil {
+		return openError
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		// Bit 0 of the flags is set on encrypted files
+		if file.Flags&0x1 != 0 {
+			return errZIPEncrypted
+		}
+	}
+
+	cleanDir := filepath.Clean(dir) + string(os.PathSeparator)
+
+	for _, file := range reader.File {
+		filePath := filepath.Join(dir, file.Name)
+
+		// Refusing files extracted outside of the dir
+		if !strings.HasPrefix(filePath, cleanDir) {
+			return fmt.Errorf("Invalid file path %s in %s", file.Name, filepath.Base(archivePath))
+		}
+
+		if file.FileInfo().IsDir() {
+			mkdirError := os.MkdirAll(filePath, 0755)
+			if mkdirError != nil {
+				return mkdirError
+			}
+			continue
+		}
+
+		extractError := extractZipFile(file, filePath)
+		if extractError != nil {
+			return extractError
+		}
+	}
+
+	return nil
+}
+
+// extractZipFile writes a file of a ZIP archive to a path
+func extractZipFile(file *zip.File, filePath string) error {
+	mkdirError := os.MkdirAll(filepath.Dir(filePath), 0755)
+	if mkdirError != nil {
+		return mkdirError
+	}
+
+	zipFile, openError := file.Open()
+	if openError != nil {
+		return openError
+	}
+	defer zipFile.Close()
+
+	extractedFile, createError := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, file.Mode()|0600)
+	if createError != nil {
+		return createError
+	}
+
+	_, copyError := io.Copy(extractedFile, zipFile)
+	closeError := extractedFile.Close()
+
+	if copyError != nil {
+		return copyError
+	}
+
+	return closeError
+}
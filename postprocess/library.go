@@ -0,0 +1,206 @@
+package postprocess
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/davidderus/christopher/config"
+	"github.com/davidderus/christopher/release"
+)
+
+// maxLibraryRenames is the number of names tried before giving up on
+// collisions
+const maxLibraryRenames = 100
+
+// samplePattern matches the sample videos shipped with some releases
+var samplePattern = regexp.MustCompile(`(?i)(^|[ ._-])sample([ ._-]|$)`)
+
+// organizer moves episodes to the library
+type organizer struct {
+	config *config.LibraryOptions
+	naming *config.NamingOptions
+}
+
+// organizeAll moves the episodes among some files to the library
+//
+// Episodes are found in the file names, or in the feed item title when the
+// download has a single video.
+func (o *organizer) organizeAll(files []string, title string) []*Result {
+	var videos []string
+
+	for _, filePath := range files {
+		if o.isVideo(filePath) {
+			videos = append(videos, filePath)
+		}
+	}
+
+	var results []*Result
+
+	for _, video := range videos {
+		episode := release.Parse(video)
+
+		if !episode.IsEpisode() && len(videos) == 1 && title != "" {
+			episode = release.Parse(title)
+			if episode.Quality == "" {
+				episode.Quality = release.Parse(video).Quality
+			}
+		}
+
+		if !episode.IsEpisode() {
+			continue
+		}
+
+		result := &Result{Task: TaskOrganize, Source: video}
+		result.Destination, result.Error = o.organize(video, episode)
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// isVideo indicates if a file is a video to organize, samples excluded
+func (o *organizer) isVideo(filePath string) bool {
+	baseName := filepath.Base(filePath)
+	extension := filepath.Ext(baseName)
+
+	if samplePattern.MatchString(strings.TrimSuffix(baseName, extension)) {
+		return false
+	}
+
+	for _, videoExtension := range o.config.Extensions {
+		if strings.EqualFold(extension, "."+strings.TrimPrefix(videoExtension, ".")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// organize moves or links an episode to its library path
+func (o *organizer) organize(source string, episode *release.Release) (string, error) {
+	destination, pathError := o.resolveCollision(o.libraryPath(source, episode))
+	if pathError != nil {
+		return destination, pathError
+	}
+
+	mkdirError := os.MkdirAll(filepath.Dir(destination), 0755)
+	if mkdirError != nil {
+		return destination, mkdirError
+	}
+
+	if o.config.Mode == config.LibraryHardlink {
+		// Links can't replace an overwritten episode
+		os.Remove(destination)
+		return destination, os.Link(source, destination)
+	}
+
+	return destination, moveFile(source, destination)
+}
+
+// libraryPath returns the path of an episode following the library layout
+func (o *organizer) libraryPath(source string, episode *release.Release) string {
+	replacer := strings.NewReplacer(
+		"{Show}", o.sanitize(episode.Show),
+		"{Season}", strconv.Itoa(episode.Season),
+		"{SS}", fmt.Sprintf("%02d", episode.Season),
+		"{Episode}", strconv.Itoa(episode.Episode),
+		"{EE}", fmt.Sprintf("%02d", episode.Episode),
+		"{Quality}", episode.Quality,
+		"{ext}", strings.TrimPrefix(filepath.Ext(source), "."),
+	)
+
+	return filepath.Join(o.config.Dir, filepath.FromSlash(replacer.Replace(o.config.Layout)))
+}
+
+// sanitize makes a show name usable in a path
+func (o *organizer) sanitize(name string) string {
+	var sanitizedName bytes.Buffer
+
+	for _, character := range name {
+		if character == '/' || strings.ContainsRune(o.naming.InvalidCharacters, character) {
+			sanitizedName.WriteString(o.naming.Replacement)
+		} else {
+			sanitizedName.WriteRune(character)
+		}
+	}
+
+	return sanitizedName.String()
+}
+
+// resolveCollision returns the path to use for an episode according to the
+// collision mode
+func (o *organizer) resolveCollision(destination string) (string, error) {
+	if _, statError := os.Stat(destination); statError != nil {
+		return destination, nil
+	}
+
+	switch o.config.Collision {
+	case config.CollisionOverwrite:
+		return destination, nil
+	case config.CollisionRename:
+		extension := filepath.Ext(destination)
+		basePath := strings.TrimSuffix(destination, extension)
+
+		for renameIndex := 1; renameIndex <= maxLibraryRenames; renameIndex++ {
+			renamedPath := fmt.Sprintf("%s (%d)%s", basePath, renameIndex, extension)
+
+			if _, statError := os.Stat(renamedPath); statError != nil {
+				return renamedPath, nil
+			}
+		}
+	}
+
+	return destination, fmt.Errorf("%s is already in the library", filepath.Base(destination))
+}
+
+// moveFile moves a file, copying it if on another device
+func moveFile(source, destination string) error {
+	renameError := os.Rename(source, destination)
+	if renameError == nil {
+		return nil
+	}
+
+	copyError := copyFile(source, destination)
+	if copyError != nil {
+		return errors.New(renameError.Error() + ", " + copyError.Error())
+	}
+
+	return os.Remove(source)
+}
+
+// copyFile copies a file content and mode
+func copyFile(source, destination string) error {
+	sourceFile, openError := os.Open(source)
+	if openError != nil {
+		return openError
+	}
+	defer sourceFile.Close()
+
+	sourceInfo, statError := sourceFile.Stat()
+	if statError != nil {
+		return statError
+	}
+
+	destinationFile, createError := os.OpenFile(destination, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, sourceInfo.Mode())
+	if createError != nil {
+		return createError
+	}
+
+	_, copyError := io.Copy(destinationFile, sourceFile)
+	closeError := destinationFile.Close()
+
+	if copyError != nil {
+		os.Remove(destination)
+		return copyError
+	}
+
+	return closeError
+}
@@ -0,0 +1,457 @@
+package postprocess
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/davidderus/christopher/config"
+	"github.com/davidderus/christopher/downloader"
+)
+
+// Post-processing tasks
+const (
+	// TaskVerify checks the size and checksums of a file
+	TaskVerify = "verify"
+
+	// TaskExtract extracts an archive
+	TaskExtract = "extract"
+
+	// TaskOrganize moves an episode to the library
+	TaskOrganize = "organize"
+)
+
+// extractedRetention is the time an extracted archive is remembered, so it is
+// not extracted again on the next completions of its downloads
+const extractedRetention = 24 * time.Hour
+
+// originDelay is how long a completed download waits for its origin, the
+// download being known to the downloader before it is remembered
+const originDelay = 5 * time.Second
+
+// Result is the outcome of a post-processing task
+type Result struct {
+	DownloadID string
+
+	// Task is the task done, blank if the download could not be processed
+	Task string
+
+	// Source is the first volume of an extracted archive or an organized file
+	Source string
+
+	// Destination is the extraction dir or the path in the library
+	Destination string
+
+	// Files are the extracted files
+	Files []string
+
+	// RetryID is the id of the new download of a corrupted file
+	RetryID string
+
+	// Error is nil on success
+	Error error
+}
+
+// Origin are the infos known about a download before it completes
+type Origin struct {
+	Title    string // Feed item title
+	Size     int64  // Size given by the debrider, 0 if unknown
+	Checksum string // Checksum given by the feed item, such as "md5:d41d8…"
+
+	// Infos about the submission, to download the file again
+	URI       string // URI as submitted, before any debrid
+	Submitter string // Submitter of the URI (feed-watcher, webserver…)
+	Feed      string // Title of the feed the URI comes from
+	User      string // Webserver user having submitted the URI
+}
+
+// Processor post-processes the completed downloads of a downloader
+//
+// Files are first verified, corrupted downloads going no further. Archives are
+// then extracted once all their volumes are downloaded, whatever the download
+// completing them. Episodes, downloaded or extracted, are finally moved to the
+// library.
+type Processor struct {
+	downloader downloader.Downloader
+	verifier   *verifier
+	extractor  *Extractor
+	organizer  *organizer
+	config     *config.Config
+
+	// Notify is called with the result of each task if set
+	Notify func(result *Result)
+
+	// Redownload submits the origin of a corrupted download again and returns
+	// the id of the new download, corrupted files being only reported if unset
+	Redownload func(origin *Origin) (string, error)
+
+	mutex sync.Mutex
+
+	// extracted are the claim times of the archives already extracted or
+	// being so, by archive key
+	extracted map[string]time.Time
+
+	// origins are the infos of the downloads by id
+	origins map[string]*Origin
+
+	// originWaiters are closed once the origin of their download is remembered
+	originWaiters map[string]chan struct{}
+
+	// redownloads are the number of new downloads by file path
+	redownloads map[string]int
+}
+
+// NewProcessor returns a processor for the downloads of a downloader
+func NewProcessor(dlInstance downloader.Downloader, appConfig *config.Config) *Processor {
+	return &Processor{
+		downloader: dlInstance,
+		config:     appConfig,
+		verifier:   &verifier{config: &appConfig.Verification},
+		extractor: &Extractor{
+			Command:   appConfig.Extraction.Command,
+			NativeZip: appConfig.Extraction.NativeZip,
+			Passwords: appConfig.Extraction.Passwords,
+		},
+		organizer:     &organizer{config: &appConfig.Library, naming: &appConfig.Naming},
+		extracted:     make(map[string]time.Time),
+		origins:       make(map[string]*Origin),
+		originWaiters: make(map[string]chan struct{}),
+		redownloads:   make(map[string]int),
+	}
+}
+
+// Remember keeps the infos of a download known before it completes, to verify
+// it and name its episode if its file name is not explicit
+func (p *Processor) Remember(downloadID string, origin *Origin) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.origins[downloadID] = origin
+
+	if waiter, exists := p.originWaiters[downloadID]; exists {
+		close(waiter)
+		delete(p.originWaiters, downloadID)
+	}
+}
+
+// awaitOrigin waits a bit for the origin of a download to be remembered, as
+// fast downloads may complete before
+func (p *Processor) awaitOrigin(downloadID string) {
+	p.mutex.Lock()
+
+	if _, exists := p.origins[downloadID]; exists {
+		p.mutex.Unlock()
+		return
+	}
+
+	waiter, exists := p.originWaiters[downloadID]
+	if !exists {
+		waiter = make(chan struct{})
+		p.originWaiters[downloadID] = waiter
+	}
+
+	p.mutex.Unlock()
+
+	select {
+	case <-waiter:
+	case <-time.After(originDelay):
+		p.mutex.Lock()
+		delete(p.originWaiters, downloadID)
+		p.mutex.Unlock()
+	}
+}
+
+// HandleEvent post-processes a completed download in background, once its
+// origin is remembered
+//
+// It is meant to be subscribed to an EventStream.
+func (p *Processor) HandleEvent(event *downloader.DownloadEvent) {
+	if event.Type != downloader.EventComplete {
+		return
+	}
+
+	go func() {
+		p.awaitOrigin(event.DownloadID)
+		p.Process(event.DownloadID)
+	}()
+}
+
+// Process extracts the archives completed by a download, then organizes its
+// episodes
+func (p *Processor) Process(downloadID string) []*Result {
+	if !p.config.Verification.Enabled && !p.config.Extraction.Enabled && !p.config.Library.Enabled {
+		return nil
+	}
+
+	p.mutex.Lock()
+	origin := p.origins[downloadID]
+	delete(p.origins, downloadID)
+	p.mutex.Unlock()
+
+	if origin == nil {
+		origin = &Origin{}
+	}
+
+	status, statusError := p.downloader.DownloadStatus(downloadID)
+	if statusError != nil {
+		return []*Result{p.notify(&Result{DownloadID: downloadID, Error: statusError})}
+	}
+
+	var results []*Result
+
+	if p.config.Verification.Enabled {
+		results = p.verify(status, origin)
+
+		for _, result := range results {
+			if result.Error != nil {
+				return results
+			}
+		}
+	}
+
+	files := make([]string, len(status.Files))
+	for fileIndex, file := range status.Files {
+		files[fileIndex] = file.Path
+	}
+
+	if p.config.Extraction.Enabled {
+		pendingPaths, pendingError := p.pendingPaths()
+		if pendingError != nil {
+			return []*Result{p.notify(&Result{DownloadID: downloadID, Error: pendingError})}
+		}
+
+		for _, filePath := range files {
+			set := findArchiveSet(filePath)
+			if set == nil || !set.isComplete(pendingPaths) || !p.claim(set) {
+				continue
+			}
+
+			result := p.notify(p.extract(downloadID, set))
+			results = append(results, result)
+			files = append(files, result.Files...)
+		}
+	}
+
+	if p.config.Library.Enabled {
+		for _, result := range p.organizer.organizeAll(files, origin.Title) {
+			result.DownloadID = downloadID
+			results = append(results, p.notify(result))
+		}
+	}
+
+	return results
+}
+
+// verify checks all the files of a download
+//
+// The debrider size and the feed item checksum only apply to single file
+// downloads. Corrupted files are downloaded again if configured so.
+func (p *Processor) verify(status *downloader.DownloadStatus, origin *Origin) []*Result {
+	var results []*Result
+
+	for _, file := range status.Files {
+		expectedSize := file.TotalBytes
+		checksum := ""
+
+		if len(status.Files) == 1 {
+			checksum = origin.Checksum
+			if expectedSize <= 0 {
+				expectedSize = origin.Size
+			}
+		}
+
+		result := &Result{DownloadID: status.ID, Task: TaskVerify, Source: file.Path}
+		result.Error = p.verifier.verifyFile(file.Path, expectedSize, checksum)
+
+		// Debrider and downloader sizes may differ
+		if result.Error == nil && len(status.Files) == 1 && origin.Size > 0 && origin.Size != expectedSize {
+			result.Error = p.verifier.verifyFile(file.Path, origin.Size, "")
+		}
+
+		if result.Error != nil && p.config.Verification.OnMismatch == config.MismatchRedownload {
+			p.redownload(file, origin, result)
+		}
+
+		results = append(results, p.notify(result))
+	}
+
+	return results
+}
+
+// redownload submits the origin of a corrupted file again, unless it already
+// was too many times
+//
+// The new download is remembered by the processor of the downloader chosen
+// for it.
+func (p *Processor) redownload(file *downloader.DownloadFile, origin *Origin, result *Result) {
+	if p.Redownload == nil || origin.URI == "" {
+		return
+	}
+
+	p.mutex.Lock()
+	attempts := p.redownloads[file.Path]
+	if attempts >= p.config.Verification.MaxRedownloads {
+		p.mutex.Unlock()
+		return
+	}
+	p.redownloads[file.Path] = attempts + 1
+	p.mutex.Unlock()
+
+	removeError := os.Remove(file.Path)
+	if removeError != nil {
+		return
+	}
+
+	retryID, downloadError := p.Redownload(origin)
+	if downloadError != nil {
+		result.Error = fmt.Errorf("%s, download failed again: %s", result.Error, downloadError)
+		return
+	}
+
+	result.RetryID = retryID
+}
+
+// extract extracts an archive set and removes its volumes if needed
+func (p *Processor) extract(downloadID string, set *archiveSet) *Result {
+	result := &Result{DownloadID: downloadID, Task: TaskExtract, Source: set.first, Destination: p.config.Extraction.Dir}
+	if result.Destination == "" {
+		result.Destination = filepath.Dir(set.first)
+	}
+
+	result.Files, result.Error = p.extractPrivately(set, result.Destination)
+
+	if result.Error != nil {
+		// Allowing another try on a next completion
+		p.mutex.Lock()
+		delete(p.extracted, set.key)
+		p.mutex.Unlock()
+
+		return result
+	}
+
+	if p.config.Extraction.DeleteArchives {
+		for _, volume := range set.volumes {
+			removeError := os.Remove(volume)
+			if removeError != nil && result.Error == nil {
+				result.Error = removeError
+			}
+		}
+	}
+
+	return result
+}
+
+// extractPrivately extracts an archive set into a private dir of the
+// destination, then moves the extracted files to the destination
+//
+// The other files of the destination, such as downloads completing meanwhile,
+// are never taken as extracted. Extracted files replace the existing ones.
+func (p *Processor) extractPrivately(set *archiveSet, destination string) ([]string, error) {
+	mkdirError := os.MkdirAll(destination, 0755)
+	if mkdirError != nil {
+		return nil, mkdirError
+	}
+
+	privateDir, privateDirError := ioutil.TempDir(destination, ".christopher-extract-")
+	if privateDirError != nil {
+		return nil, privateDirError
+	}
+	defer os.RemoveAll(privateDir)
+
+	extractError := p.extractor.Extract(set, privateDir)
+	if extractError != nil {
+		return nil, extractError
+	}
+
+	var files []string
+
+	for extractedPath := range listFiles(privateDir) {
+		relativePath, _ := filepath.Rel(privateDir, extractedPath)
+		filePath := filepath.Join(destination, relativePath)
+
+		dirError := os.MkdirAll(filepath.Dir(filePath), 0755)
+		if dirError != nil {
+			return files, dirError
+		}
+
+		renameError := os.Rename(extractedPath, filePath)
+		if renameError != nil {
+			return files, renameError
+		}
+
+		files = append(files, filePath)
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// claim marks an archive as extracted, returning false if it already was
+//
+// Archives extracted for too long are forgotten.
+func (p *Processor) claim(set *archiveSet) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := time.Now()
+
+	for archiveKey, claimedAt := range p.extracted {
+		if now.Sub(claimedAt) > extractedRetention {
+			delete(p.extracted, archiveKey)
+		}
+	}
+
+	if _, exists := p.extracted[set.key]; exists {
+		return false
+	}
+
+	p.extracted[set.key] = now
+	return true
+}
+
+// pendingPaths returns the paths of the files being downloaded
+func (p *Processor) pendingPaths() ([]string, error) {
+	var paths []string
+
+	for _, state := range []downloader.DownloadState{downloader.StateActive, downloader.StateWaiting} {
+		statuses, listError := p.downloader.List(state)
+		if listError != nil {
+			return nil, listError
+		}
+
+		for _, status := range statuses {
+			for _, file := range status.Files {
+				paths = append(paths, file.Path)
+			}
+		}
+	}
+
+	return paths, nil
+}
+
+// notify sends a result to Notify and returns it
+func (p *Processor) notify(result *Result) *Result {
+	if p.Notify != nil {
+		p.Notify(result)
+	}
+
+	return result
+}
+
+// listFiles returns all the files of a dir and its subdirs
+func listFiles(dir string) map[string]bool {
+	files := make(map[string]bool)
+
+	filepath.Walk(dir, func(filePath string, fileInfo os.FileInfo, walkError error) error {
+		if walkError == nil && !fileInfo.IsDir() {
+			files[filePath] = true
+		}
+		return nil
+	})
+
+	return files
+}
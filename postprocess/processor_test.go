@@ -0,0 +1,476 @@
+package postprocess_test
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/davidderus/christopher/config"
+	"github.com/davidderus/christopher/downloader"
+	. "github.com/davidderus/christopher/postprocess"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestPostProcess(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "PostProcess Suite")
+}
+
+// fakeDownloader knows some downloads by id and some pending files
+type fakeDownloader struct {
+	downloader.Downloader
+
+	statuses     map[string]*downloader.DownloadStatus
+	pendingPaths []string
+}
+
+func (fd *fakeDownloader) DownloadStatus(downloadID string) (*downloader.DownloadStatus, error) {
+	return fd.statuses[downloadID], nil
+}
+
+func (fd *fakeDownloader) List(state downloader.DownloadState) ([]*downloader.DownloadStatus, error) {
+	if state != downloader.StateActive {
+		return nil, nil
+	}
+
+	status := &downloader.DownloadStatus{}
+	for _, pendingPath := range fd.pendingPaths {
+		status.Files = append(status.Files, &downloader.DownloadFile{Path: pendingPath})
+	}
+
+	return []*downloader.DownloadStatus{status}, nil
+}
+
+var _ = Describe("Processor", func() {
+	var dir string
+	var fakeDL *fakeDownloader
+	var appConfig *config.Config
+	var extractionConfig *config.ExtractionOptions
+	var notified []*Result
+
+	// complete creates a downloaded file known by the fake downloader
+	complete := func(downloadID, fileName string) string {
+		filePath := filepath.Join(dir, fileName)
+		ioutil.WriteFile(filePath, []byte(fileName), 0644)
+
+		fakeDL.statuses[downloadID] = &downloader.DownloadStatus{
+			ID:    downloadID,
+			State: downloader.StateComplete,
+			Files: []*downloader.DownloadFile{{Path: filePath}},
+		}
+
+		return filePath
+	}
+
+	process := func(downloadID string) []*Result {
+		processor := NewProcessor(fakeDL, appConfig)
+		processor.Notify = func(result *Result) { notified = append(notified, result) }
+
+		return processor.Process(downloadID)
+	}
+
+	BeforeEach(func() {
+		dir, _ = ioutil.TempDir("", "christopher-postprocess")
+		fakeDL = &fakeDownloader{statuses: make(map[string]*downloader.DownloadStatus)}
+		notified = nil
+
+		// Writing the archive and the password to the dir
+		appConfig = &config.Config{}
+		extractionConfig = &appConfig.Extraction
+		extractionConfig.Enabled = true
+		extractionConfig.Command = []string{"sh", "-c", `test "$1" = secret && echo "$0" > "$2/extracted.txt"`, "{archive}", "{password}", "{dir}"}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Context("with a ZIP archive", func() {
+		It("should extract it natively", func() {
+			extractionConfig.NativeZip = true
+			extractionConfig.Command = nil
+
+			archivePath := filepath.Join(dir, "HTGAWM.zip")
+			archiveFile, _ := os.Create(archivePath)
+			zipWriter := zip.NewWriter(archiveFile)
+			episodeWriter, _ := zipWriter.Create("Season 1/HTGAWM.S01E01.mkv")
+			episodeWriter.Write([]byte("Episode"))
+			zipWriter.Close()
+			archiveFile.Close()
+
+			fakeDL.statuses["1"] = &downloader.DownloadStatus{Files: []*downloader.DownloadFile{{Path: archivePath}}}
+
+			results := process("1")
+
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].Error).NotTo(HaveOccurred())
+			Expect(results[0].Destination).To(Equal(dir))
+
+			episode, _ := ioutil.ReadFile(filepath.Join(dir, "Season 1", "HTGAWM.S01E01.mkv"))
+			Expect(string(episode)).To(Equal("Episode"))
+			Expect(notified).To(Equal(results))
+		})
+	})
+
+	Context("with a multi-part archive", func() {
+		It("should wait for all the parts", func() {
+			extractionConfig.Passwords = []string{"wrong", "secret"}
+
+			firstPart := complete("1", "Zombie.One.part1.rar")
+			complete("2", "Zombie.One.part2.rar")
+			fakeDL.pendingPaths = []string{filepath.Join(dir, "Zombie.One.part3.rar")}
+
+			Expect(process("2")).To(BeEmpty())
+
+			complete("3", "Zombie.One.part3.rar")
+			fakeDL.pendingPaths = nil
+
+			results := process("3")
+
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].Error).NotTo(HaveOccurred())
+			Expect(results[0].Source).To(Equal(firstPart))
+
+			extracted, _ := ioutil.ReadFile(filepath.Join(dir, "extracted.txt"))
+			Expect(string(extracted)).To(Equal(firstPart + "\n"))
+		})
+
+		It("should only report the extracted files", func() {
+			extractionConfig.Passwords = []string{"secret"}
+
+			// A download completing during the extraction
+			extractionConfig.Command = []string{"sh", "-c", `test "$1" = secret && echo "$0" > "$2/extracted.txt" && touch "${0%/*}/Other.mkv"`, "{archive}", "{password}", "{dir}"}
+
+			ioutil.WriteFile(filepath.Join(dir, "extracted.txt"), []byte("Previous"), 0644)
+			firstPart := complete("1", "Zombie.One.part1.rar")
+
+			results := process("1")
+
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].Error).NotTo(HaveOccurred())
+			Expect(results[0].Files).To(Equal([]string{filepath.Join(dir, "extracted.txt")}))
+			Expect(filepath.Join(dir, "Other.mkv")).To(BeAnExistingFile())
+
+			extracted, _ := ioutil.ReadFile(filepath.Join(dir, "extracted.txt"))
+			Expect(string(extracted)).To(Equal(firstPart + "\n"))
+
+			leftFiles, _ := filepath.Glob(filepath.Join(dir, ".christopher-extract-*"))
+			Expect(leftFiles).To(BeEmpty())
+		})
+
+		It("should not extract archives with missing parts", func() {
+			complete("1", "Zombie.One.part1.rar")
+			complete("3", "Zombie.One.part3.rar")
+
+			Expect(process("3")).To(BeEmpty())
+		})
+
+		It("should wait for aria2 to finish the parts", func() {
+			complete("1", "Shark.Avocado.rar")
+			complete("2", "Shark.Avocado.r00")
+			ioutil.WriteFile(filepath.Join(dir, "Shark.Avocado.r00.aria2"), nil, 0644)
+
+			Expect(process("1")).To(BeEmpty())
+		})
+	})
+
+	Context("with archives to delete", func() {
+		It("should delete all the parts once extracted", func() {
+			extractionConfig.Passwords = []string{"secret"}
+			extractionConfig.DeleteArchives = true
+			extractionConfig.Dir = filepath.Join(dir, "extracted")
+
+			firstPart := complete("1", "HTGAWM.7z.001")
+			secondPart := complete("2", "HTGAWM.7z.002")
+
+			results := process("2")
+
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].Error).NotTo(HaveOccurred())
+			Expect(filepath.Join(dir, "extracted", "extracted.txt")).To(BeAnExistingFile())
+			Expect(firstPart).NotTo(BeAnExistingFile())
+			Expect(secondPart).NotTo(BeAnExistingFile())
+		})
+	})
+
+	Context("without the right password", func() {
+		It("should report the failure", func() {
+			extractionConfig.Passwords = []string{"wrong"}
+
+			complete("1", "HTGAWM.7z")
+
+			results := process("1")
+
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].Error.Error()).To(HavePrefix("Extraction of HTGAWM.7z failed"))
+			Expect(notified).To(Equal(results))
+		})
+	})
+
+	Context("with a download without archive", func() {
+		It("should do nothing", func() {
+			complete("1", "HTGAWM.mkv")
+
+			Expect(process("1")).To(BeEmpty())
+			Expect(notified).To(BeEmpty())
+		})
+	})
+
+	Context("with a library", func() {
+		var libraryDir string
+
+		BeforeEach(func() {
+			libraryDir = filepath.Join(dir, "library")
+
+			extractionConfig.Enabled = false
+			appConfig.Library = config.LibraryOptions{
+				Enabled:    true,
+				Dir:        libraryDir,
+				Layout:     "{Show}/Season {Season}/{Show} - S{SS}E{EE} [{Quality}].{ext}",
+				Mode:       config.LibraryMove,
+				Collision:  config.CollisionSkip,
+				Extensions: []string{".mkv", "mp4"},
+			}
+		})
+
+		It("should move the episodes to the library", func() {
+			source := complete("1", "Zombie.One.S03E04.720p.WEB-DL.mkv")
+
+			results := process("1")
+
+			destination := filepath.Join(libraryDir, "Zombie One", "Season 3", "Zombie One - S03E04 [720p].mkv")
+
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].Task).To(Equal(TaskOrganize))
+			Expect(results[0].Error).NotTo(HaveOccurred())
+			Expect(results[0].Destination).To(Equal(destination))
+			Expect(destination).To(BeAnExistingFile())
+			Expect(source).NotTo(BeAnExistingFile())
+		})
+
+		It("should link the episodes in hardlink mode", func() {
+			appConfig.Library.Mode = config.LibraryHardlink
+			source := complete("1", "Zombie.One.S03E04.720p.WEB-DL.mkv")
+
+			Expect(process("1")[0].Error).NotTo(HaveOccurred())
+			Expect(source).To(BeAnExistingFile())
+			Expect(filepath.Join(libraryDir, "Zombie One", "Season 3", "Zombie One - S03E04 [720p].mkv")).To(BeAnExistingFile())
+		})
+
+		It("should use the feed item title of opaque files", func() {
+			complete("1", "f4a2c1.mp4")
+
+			processor := NewProcessor(fakeDL, appConfig)
+			processor.Remember("1", &Origin{Title: "Shark Avocado 1x02 1080p"})
+
+			results := processor.Process("1")
+
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].Destination).To(Equal(filepath.Join(libraryDir, "Shark Avocado", "Season 1", "Shark Avocado - S01E02 [1080p].mp4")))
+		})
+
+		It("should wait for the origin of a download completing right away", func() {
+			complete("1", "f4a2c1.mp4")
+
+			processor := NewProcessor(fakeDL, appConfig)
+			destinations := make(chan string, 1)
+			processor.Notify = func(result *Result) { destinations <- result.Destination }
+
+			processor.HandleEvent(&downloader.DownloadEvent{Type: downloader.EventComplete, DownloadID: "1"})
+			time.Sleep(50 * time.Millisecond)
+			processor.Remember("1", &Origin{Title: "Shark Avocado 1x02 1080p"})
+
+			Eventually(destinations).Should(Receive(Equal(filepath.Join(libraryDir, "Shark Avocado", "Season 1", "Shark Avocado - S01E02 [1080p].mp4"))))
+		})
+
+		It("should ignore samples and other files", func() {
+			fakeDL.statuses["1"] = &downloader.DownloadStatus{Files: []*downloader.DownloadFile{
+				{Path: complete("2", "Zombie.One.S03E04.sample.mkv")},
+				{Path: complete("3", "Zombie.One.S03E04.nfo")},
+				{Path: complete("4", "Some.Movie.2016.mkv")},
+			}}
+
+			Expect(process("1")).To(BeEmpty())
+		})
+
+		It("should handle episodes already in the library", func() {
+			complete("1", "Zombie.One.S03E04.720p.mkv")
+			Expect(process("1")[0].Error).NotTo(HaveOccurred())
+
+			complete("2", "Zombie.One.S03E04.720p.mkv")
+			results := process("2")
+			Expect(results[0].Error.Error()).To(Equal("Zombie One - S03E04 [720p].mkv is already in the library"))
+
+			appConfig.Library.Collision = config.CollisionRename
+			results = process("2")
+			Expect(results[0].Error).NotTo(HaveOccurred())
+			Expect(results[0].Destination).To(HaveSuffix("Zombie One - S03E04 [720p] (1).mkv"))
+		})
+
+		It("should organize the extracted episodes", func() {
+			extractionConfig.Enabled = true
+			extractionConfig.NativeZip = true
+
+			archivePath := filepath.Join(dir, "HTGAWM.S02E10.zip")
+			archiveFile, _ := os.Create(archivePath)
+			zipWriter := zip.NewWriter(archiveFile)
+			episodeWriter, _ := zipWriter.Create("HTGAWM.S02E10.1080p.mkv")
+			episodeWriter.Write([]byte("Episode"))
+			zipWriter.Close()
+			archiveFile.Close()
+
+			fakeDL.statuses["1"] = &downloader.DownloadStatus{Files: []*downloader.DownloadFile{{Path: archivePath}}}
+
+			results := process("1")
+
+			Expect(results).To(HaveLen(2))
+			Expect(results[0].Task).To(Equal(TaskExtract))
+			Expect(results[0].Files).To(Equal([]string{filepath.Join(dir, "HTGAWM.S02E10.1080p.mkv")}))
+			Expect(results[1].Task).To(Equal(TaskOrganize))
+			Expect(filepath.Join(libraryDir, "HTGAWM", "Season 2", "HTGAWM - S02E10 [1080p].mkv")).To(BeAnExistingFile())
+		})
+	})
+
+	Context("with verification", func() {
+		BeforeEach(func() {
+			extractionConfig.Enabled = false
+			appConfig.Verification = config.VerificationOptions{
+				Enabled:        true,
+				Sidecars:       true,
+				OnMismatch:     config.MismatchFail,
+				MaxRedownloads: 1,
+			}
+		})
+
+		It("should accept valid files", func() {
+			filePath := complete("1", "Zombie.One.S03E04.mkv")
+			fakeDL.statuses["1"].Files[0].TotalBytes = 21
+
+			// CRC32 of "Zombie.One.S03E04.mkv", the MD5 being for another file
+			ioutil.WriteFile(filepath.Join(dir, "Zombie.One.sfv"), []byte("; Generated\nZombie.One.S03E04.mkv 6FFF38D1\n"), 0644)
+			ioutil.WriteFile(filepath.Join(dir, "Zombie.One.md5"), []byte("5a2c0ba0c3a7cb4d9fa1a8c5a2f3a9c8 *Other.mkv\n"), 0644)
+
+			results := process("1")
+
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].Task).To(Equal(TaskVerify))
+			Expect(results[0].Source).To(Equal(filePath))
+			Expect(results[0].Error).NotTo(HaveOccurred())
+		})
+
+		It("should report a size mismatch", func() {
+			complete("1", "Zombie.One.S03E04.mkv")
+			fakeDL.statuses["1"].Files[0].TotalBytes = 42
+
+			results := process("1")
+
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].Error.Error()).To(Equal("Size mismatch for Zombie.One.S03E04.mkv: 21 bytes instead of 42"))
+		})
+
+		It("should report a sidecar checksum mismatch", func() {
+			complete("1", "Zombie.One.S03E04.mkv")
+			ioutil.WriteFile(filepath.Join(dir, "Zombie.One.sfv"), []byte("Zombie.One.S03E04.mkv 00000000\n"), 0644)
+
+			results := process("1")
+
+			Expect(results[0].Error.Error()).To(Equal("CRC32 mismatch for Zombie.One.S03E04.mkv: 6fff38d1 instead of 00000000"))
+		})
+
+		It("should check the size and checksum of the feed item", func() {
+			complete("1", "Zombie.One.S03E04.mkv")
+
+			processor := NewProcessor(fakeDL, appConfig)
+			processor.Remember("1", &Origin{Size: 21, Checksum: "md5:00000000000000000000000000000000"})
+
+			results := processor.Process("1")
+
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].Error.Error()).To(HavePrefix("MD5 mismatch for Zombie.One.S03E04.mkv"))
+		})
+
+		It("should not extract or organize corrupted downloads", func() {
+			extractionConfig.Enabled = true
+			extractionConfig.NativeZip = true
+
+			complete("1", "HTGAWM.zip")
+			fakeDL.statuses["1"].Files[0].TotalBytes = 42
+
+			results := process("1")
+
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].Task).To(Equal(TaskVerify))
+		})
+
+		It("should download corrupted files again if configured so", func() {
+			appConfig.Verification.OnMismatch = config.MismatchRedownload
+
+			origin := &Origin{Title: "Zombie One S03E04", URI: "http://uptobox.com/zombie", Submitter: "feed-watcher", Feed: "Series"}
+
+			filePath := complete("1", "Zombie.One.S03E04.mkv")
+			fakeDL.statuses["1"].Files[0].TotalBytes = 42
+			fakeDL.statuses["1"].Files[0].URIs = []string{"http://debrid.example.com/zombie.mkv"}
+
+			var redownloaded []*Origin
+
+			processor := NewProcessor(fakeDL, appConfig)
+			processor.Redownload = func(redownloadedOrigin *Origin) (string, error) {
+				redownloaded = append(redownloaded, redownloadedOrigin)
+				return "retry-1", nil
+			}
+			processor.Remember("1", origin)
+
+			results := processor.Process("1")
+
+			Expect(results[0].Error).To(HaveOccurred())
+			Expect(results[0].RetryID).To(Equal("retry-1"))
+			Expect(filePath).NotTo(BeAnExistingFile())
+			Expect(redownloaded).To(Equal([]*Origin{origin}))
+
+			// Giving up after too many attempts
+			complete("1", "Zombie.One.S03E04.mkv")
+			fakeDL.statuses["1"].Files[0].TotalBytes = 42
+			processor.Remember("1", origin)
+
+			results = processor.Process("1")
+
+			Expect(results[0].RetryID).To(BeEmpty())
+			Expect(filePath).To(BeAnExistingFile())
+			Expect(redownloaded).To(HaveLen(1))
+		})
+
+		It("should only report corrupted files of unknown origin", func() {
+			appConfig.Verification.OnMismatch = config.MismatchRedownload
+
+			filePath := complete("1", "Zombie.One.S03E04.mkv")
+			fakeDL.statuses["1"].Files[0].TotalBytes = 42
+
+			processor := NewProcessor(fakeDL, appConfig)
+			processor.Redownload = func(_ *Origin) (string, error) {
+				return "retry-1", nil
+			}
+
+			results := processor.Process("1")
+
+			Expect(results[0].Error).To(HaveOccurred())
+			Expect(results[0].RetryID).To(BeEmpty())
+			Expect(filePath).To(BeAnExistingFile())
+		})
+	})
+
+	Context("with extraction disabled", func() {
+		It("should do nothing", func() {
+			extractionConfig.Enabled = false
+			extractionConfig.Passwords = []string{"secret"}
+
+			complete("1", "HTGAWM.7z")
+
+			Expect(process("1")).To(BeEmpty())
+		})
+	})
+})
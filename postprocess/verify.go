@@ -0,0 +1,174 @@
+package postprocess
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/davidderus/christopher/config"
+)
+
+// sidecarAlgorithms are the checksum algorithms of the sidecar files by
+// extension
+var sidecarAlgorithms = map[string]string{
+	".sfv":    "crc32",
+	".md5":    "md5",
+	".sha1":   "sha1",
+	".sha256": "sha256",
+}
+
+// verifier checks completed files against their expected size and checksums
+type verifier struct {
+	config *config.VerificationOptions
+}
+
+// verifyFile checks the size of a file and all its known checksums
+//
+// expectedSize and checksum are ignored if unknown.
+func (v *verifier) verifyFile(filePath string, expectedSize int64, checksum string) error {
+	fileInfo, statError := os.Stat(filePath)
+	if statError != nil {
+		return statError
+	}
+
+	if expectedSize > 0 && fileInfo.Size() != expectedSize {
+		return fmt.Errorf("Size mismatch for %s: %d bytes instead of %d", filepath.Base(filePath), fileInfo.Size(), expectedSize)
+	}
+
+	var checksums []string
+
+	if checksum != "" {
+		checksums = append(checksums, checksum)
+	}
+
+	if v.config.Sidecars {
+		checksums = append(checksums, sidecarChecksums(filePath)...)
+	}
+
+	for _, expectedChecksum := range checksums {
+		checksumParts := strings.SplitN(expectedChecksum, ":", 2)
+		if len(checksumParts) != 2 {
+			return fmt.Errorf("Invalid checksum %s", expectedChecksum)
+		}
+
+		fileChecksum, checksumError := computeChecksum(filePath, checksumParts[0])
+		if checksumError != nil {
+			return checksumError
+		}
+
+		if !strings.EqualFold(fileChecksum, checksumParts[1]) {
+			return fmt.Errorf("%s mismatch for %s: %s instead of %s", strings.ToUpper(checksumParts[0]), filepath.Base(filePath), fileChecksum, strings.ToLower(checksumParts[1]))
+		}
+	}
+
+	return nil
+}
+
+// computeChecksum returns the hexadecimal checksum of a file
+func computeChecksum(filePath, algorithm string) (string, error) {
+	var hasher hash.Hash
+
+	switch algorithm {
+	case "md5":
+		hasher = md5.New()
+	case "sha1":
+		hasher = sha1.New()
+	case "sha256":
+		hasher = sha256.New()
+	case "crc32":
+		hasher = crc32.NewIEEE()
+	default:
+		return "", fmt.Errorf("Unsupported checksum algorithm %s", algorithm)
+	}
+
+	file, openError := os.Open(filePath)
+	if openError != nil {
+		return "", openError
+	}
+	defer file.Close()
+
+	_, copyError := io.Copy(hasher, file)
+	if copyError != nil {
+		return "", copyError
+	}
+
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
+
+// sidecarChecksums returns the checksums of a file listed in the sidecar
+// files of its dir
+func sidecarChecksums(filePath string) []string {
+	dir, fileName := filepath.Split(filePath)
+
+	fileInfos, _ := ioutil.ReadDir(dir)
+
+	var checksums []string
+
+	for _, fileInfo := range fileInfos {
+		algorithm, isSidecar := sidecarAlgorithms[strings.ToLower(filepath.Ext(fileInfo.Name()))]
+		if !isSidecar || fileInfo.IsDir() {
+			continue
+		}
+
+		sidecarChecksum := readSidecar(filepath.Join(dir, fileInfo.Name()), algorithm)[fileName]
+		if sidecarChecksum != "" {
+			checksums = append(checksums, algorithm+":"+sidecarChecksum)
+		}
+	}
+
+	return checksums
+}
+
+// readSidecar returns the checksums listed in a sidecar file by file name
+//
+// SFV lines are formatted as "name checksum", the others as "checksum name"
+// or "checksum *name".
+func readSidecar(sidecarPath, algorithm string) map[string]string {
+	checksums := make(map[string]string)
+
+	sidecarFile, openError := os.Open(sidecarPath)
+	if openError != nil {
+		return checksums
+	}
+	defer sidecarFile.Close()
+
+	scanner := bufio.NewScanner(sidecarFile)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var name, checksum string
+
+		if algorithm == "crc32" {
+			separatorIndex := strings.LastIndexAny(line, " \t")
+			if separatorIndex < 0 {
+				continue
+			}
+
+			name, checksum = strings.TrimSpace(line[:separatorIndex]), line[separatorIndex+1:]
+		} else {
+			separatorIndex := strings.IndexAny(line, " \t")
+			if separatorIndex < 0 {
+				continue
+			}
+
+			checksum, name = line[:separatorIndex], strings.TrimLeft(line[separatorIndex+1:], " \t*")
+		}
+
+		checksums[filepath.Base(filepath.FromSlash(name))] = strings.ToLower(checksum)
+	}
+
+	return checksums
+}
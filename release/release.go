@@ -0,0 +1,123 @@
+package release
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Release holds the infos found in a release name such as
+// "Zombie.One.S03E04.720p.WEB-DL.mkv"
+type Release struct {
+	Name string // Name as parsed
+
+	// Show is the show name, with spaces as separators, blank if not found
+	Show string
+
+	// Season and Episode are 0 if not found
+	Season  int
+	Episode int
+
+	// Quality is the video resolution such as "720p", blank if not found
+	Quality string
+
+	// AirDate is the air date of the daily shows episodes such as
+	// "The.Daily.Show.2017.02.10", zero if not found
+	AirDate time.Time
+}
+
+// episodePatterns matches the "S03E04" and "3x04" episode markers
+var episodePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)^(.*?)[ ._-]+s(\d{1,2})[ ._-]?e(\d{1,3})\b`),
+	regexp.MustCompile(`(?i)^(.*?)[ ._-]+(\d{1,2})x(\d{1,3})\b`),
+}
+
+// airDatePattern matches the "2017.02.10" air dates of daily shows
+var airDatePattern = regexp.MustCompile(`^(.*?)[ ._-]+((?:19|20)\d{2})[ ._-](\d{2})[ ._-](\d{2})\b`)
+
+// qualityPattern matches the video resolutions
+var qualityPattern = regexp.MustCompile(`(?i)\b(2160p|4k|1080p|1080i|720p|576p|480p)\b`)
+
+// separatorsPattern matches the characters used as spaces in release names
+var separatorsPattern = regexp.MustCompile(`[._ ]+`)
+
+// Parse extracts the infos of a release name
+//
+// Directories and file extension are ignored.
+func Parse(name string) *Release {
+	release := &Release{Name: name}
+
+	baseName := path.Base(name)
+	if baseName == "." || baseName == "/" {
+		return release
+	}
+
+	quality := qualityPattern.FindString(baseName)
+	if strings.EqualFold(quality, "4k") {
+		quality = "2160p"
+	}
+	release.Quality = strings.ToLower(quality)
+
+	for _, pattern := range episodePatterns {
+		matches := pattern.FindStringSubmatch(baseName)
+		if matches == nil {
+			continue
+		}
+
+		release.Show = cleanShow(matches[1])
+		release.Season, _ = strconv.Atoi(matches[2])
+		release.Episode, _ = strconv.Atoi(matches[3])
+
+		return release
+	}
+
+	if matches := airDatePattern.FindStringSubmatch(baseName); matches != nil {
+		airDate, dateError := time.Parse("2006-01-02", matches[2]+"-"+matches[3]+"-"+matches[4])
+		if dateError == nil {
+			release.Show = cleanShow(matches[1])
+			release.AirDate = airDate
+		}
+	}
+
+	return release
+}
+
+// IsEpisode indicates if the release is a TV show episode
+func (r *Release) IsEpisode() bool {
+	return r.Show != "" && r.Episode > 0
+}
+
+// IsDaily indicates if the release is a daily show episode, known by its
+// air date
+func (r *Release) IsDaily() bool {
+	return r.Show != "" && !r.AirDate.IsZero()
+}
+
+// EpisodeKey identifies the episode of a release within its show, such as
+// "S03E04" or "2017-02-10" for daily shows, blank if not an episode
+func (r *Release) EpisodeKey() string {
+	if r.IsEpisode() {
+		return fmt.Sprintf("S%02dE%02d", r.Season, r.Episode)
+	}
+
+	if r.IsDaily() {
+		return r.AirDate.Format("2006-01-02")
+	}
+
+	return ""
+}
+
+// cleanShow turns a release show name into a readable one
+func cleanShow(show string) string {
+	show = separatorsPattern.ReplaceAllString(show, " ")
+	return strings.TrimSpace(strings.Trim(show, "-"))
+}
+
+// ParseEpisodeKey returns the key of an episode given alone, such as "s3e1",
+// "3x01" or "2017-02-10", blank if invalid
+func ParseEpisodeKey(episode string) string {
+	return Parse("Show " + strings.TrimSpace(episode)).EpisodeKey()
+}
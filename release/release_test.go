@@ -0,0 +1,80 @@
+package release_test
+
+import (
+	. "github.com/davidderus/christopher/release"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+	"time"
+)
+
+func TestRelease(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Release Suite")
+}
+
+var _ = Describe("Release", func() {
+	Describe("Parse", func() {
+		It("should parse SxxEyy episodes", func() {
+			release := Parse("Zombie.One.S03E04.720p.WEB-DL.x264.mkv")
+
+			Expect(release.Show).To(Equal("Zombie One"))
+			Expect(release.Season).To(Equal(3))
+			Expect(release.Episode).To(Equal(4))
+			Expect(release.Quality).To(Equal("720p"))
+			Expect(release.IsEpisode()).To(BeTrue())
+		})
+
+		It("should parse 1x02 episodes", func() {
+			release := Parse("Shark Avocado - 1x02 - Pilot")
+
+			Expect(release.Show).To(Equal("Shark Avocado"))
+			Expect(release.Season).To(Equal(1))
+			Expect(release.Episode).To(Equal(2))
+		})
+
+		It("should ignore directories", func() {
+			release := Parse("/downloads/S01/HTGAWM.s02e10.mkv")
+
+			Expect(release.Show).To(Equal("HTGAWM"))
+			Expect(release.Season).To(Equal(2))
+			Expect(release.Episode).To(Equal(10))
+		})
+
+		It("should parse daily shows episodes", func() {
+			release := Parse("The.Daily.Show.2017.02.10.720p.WEB.mkv")
+
+			Expect(release.Show).To(Equal("The Daily Show"))
+			Expect(release.AirDate).To(Equal(time.Date(2017, time.February, 10, 0, 0, 0, 0, time.UTC)))
+			Expect(release.IsEpisode()).To(BeFalse())
+			Expect(release.IsDaily()).To(BeTrue())
+			Expect(release.EpisodeKey()).To(Equal("2017-02-10"))
+		})
+
+		It("should not find episodes in movies", func() {
+			release := Parse("Some.Movie.2016.1080p.BluRay.mkv")
+
+			Expect(release.Show).To(BeEmpty())
+			Expect(release.Quality).To(Equal("1080p"))
+			Expect(release.IsEpisode()).To(BeFalse())
+			Expect(release.IsDaily()).To(BeFalse())
+			Expect(release.EpisodeKey()).To(BeEmpty())
+		})
+	})
+
+	Describe("EpisodeKey", func() {
+		It("should identify SxxEyy and 1x02 episodes alike", func() {
+			Expect(Parse("Zombie.One.S03E04.720p.WEB-DL.x264.mkv").EpisodeKey()).To(Equal("S03E04"))
+			Expect(Parse("Shark Avocado - 1x02 - Pilot").EpisodeKey()).To(Equal("S01E02"))
+		})
+
+		It("should parse the episodes given alone", func() {
+			Expect(ParseEpisodeKey("s3e1")).To(Equal("S03E01"))
+			Expect(ParseEpisodeKey("3x01")).To(Equal("S03E01"))
+			Expect(ParseEpisodeKey("2017-02-10")).To(Equal("2017-02-10"))
+			Expect(ParseEpisodeKey("pilot")).To(BeEmpty())
+		})
+	})
+})
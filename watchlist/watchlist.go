@@ -0,0 +1,342 @@
+package watchlist
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidderus/christopher/config"
+	"github.com/davidderus/christopher/database"
+	"github.com/davidderus/christopher/release"
+)
+
+// showSeparators matches the characters ignored in show names
+var showSeparators = regexp.MustCompile(`[^\pL\pN]+`)
+
+// Watchlist follows the episodes of some TV shows, so each episode is grabbed
+// once, unless in a better quality
+//
+// Shows come from the config file and the database, where episodes are
+// tracked.
+type Watchlist struct {
+	options  config.WatchlistOptions
+	database *database.Database
+
+	// mutex makes episodes claims atomic across feeds
+	mutex sync.Mutex
+
+	// claims are the releases of the episodes being sent to download, by
+	// show key and episode key
+	claims map[string]string
+}
+
+// Show is a TV show of the watchlist
+type Show struct {
+	Name string `json:"name"`
+	From string `json:"from,omitempty"` // First episode wanted
+
+	// InConfig indicates that the show comes from the config file, and can
+	// not be removed from the command line
+	InConfig bool `json:"in_config"`
+}
+
+// ShowStatus is the progress of a show
+type ShowStatus struct {
+	Show
+
+	// Grabbed is the count of grabbed episodes
+	Grabbed int `json:"grabbed"`
+
+	// LastEpisode is the last grabbed episode, blank if none
+	LastEpisode string `json:"last_episode,omitempty"`
+
+	// Missing are the episodes never grabbed before the last one in each
+	// season, daily shows having none
+	Missing []string `json:"missing"`
+}
+
+// New returns the watchlist of the config shows and the database ones
+func New(options config.WatchlistOptions, db *database.Database) *Watchlist {
+	return &Watchlist{options: options, database: db, claims: make(map[string]string)}
+}
+
+// ShowKey identifies a show whatever the case and separators of its name
+func ShowKey(name string) string {
+	return strings.TrimSpace(showSeparators.ReplaceAllString(strings.ToLower(name), " "))
+}
+
+// Shows returns the watched shows sorted by name, the config ones first if
+// a show is in both
+func (wl *Watchlist) Shows() []*Show {
+	showsByKey := make(map[string]*Show)
+
+	for showKey, watchedShow := range wl.database.WatchedShows() {
+		showsByKey[showKey] = &Show{Name: watchedShow.Name, From: watchedShow.From}
+	}
+
+	for _, configShow := range wl.options.Shows {
+		showsByKey[ShowKey(configShow.Name)] = &Show{Name: configShow.Name, From: release.ParseEpisodeKey(configShow.From), InConfig: true}
+	}
+
+	shows := make([]*Show, 0, len(showsByKey))
+	for _, show := range showsByKey {
+		shows = append(shows, show)
+	}
+
+	sort.Slice(shows, func(i, j int) bool {
+		return ShowKey(shows[i].Name) < ShowKey(shows[j].Name)
+	})
+
+	return shows
+}
+
+// Add adds a show to the database watchlist, from a given episode if any
+func (wl *Watchlist) Add(name, from string) error {
+	showKey := ShowKey(name)
+	if showKey == "" {
+		return fmt.Errorf("Invalid show name %s", name)
+	}
+
+	fromKey := ""
+	if from != "" {
+		fromKey = release.ParseEpisodeKey(from)
+		if fromKey == "" {
+			return fmt.Errorf("Invalid episode %s", from)
+		}
+	}
+
+	return wl.database.AddShow(showKey, &database.WatchedShow{Name: strings.TrimSpace(name), From: fromKey, AddedAt: time.Now()})
+}
+
+// Remove removes a show from the database watchlist, its grabbed episodes
+// being kept
+func (wl *Watchlist) Remove(name string) error {
+	if wl.configShow(ShowKey(name)) != nil {
+		return fmt.Errorf("Show %s is set in the config file", name)
+	}
+
+	isRemoved, removeError := wl.database.RemoveShow(ShowKey(name))
+	if removeError != nil {
+		return removeError
+	}
+
+	if !isRemoved {
+		return fmt.Errorf("Unknown show %s", name)
+	}
+
+	return nil
+}
+
+// Claim reserves the episode of a release if wanted, the rule rejecting it
+// being returned otherwise
+//
+// An episode is wanted if its show is watched, it is not before the show
+// first wanted episode, it is not claimed by another release and it was
+// never grabbed or only in a lesser quality with upgrades enabled. Claimed
+// episodes are either grabbed or released once sent to download.
+func (wl *Watchlist) Claim(releaseName string) string {
+	episode := release.Parse(releaseName)
+
+	episodeKey := episode.EpisodeKey()
+	if episodeKey == "" {
+		return "not an episode"
+	}
+
+	show := wl.show(ShowKey(episode.Show))
+	if show == nil {
+		return "show " + episode.Show + " not watched"
+	}
+
+	if show.From != "" && isBefore(episodeKey, show.From) {
+		return "episode " + episodeKey + " before " + show.From
+	}
+
+	wl.mutex.Lock()
+	defer wl.mutex.Unlock()
+
+	showKey := ShowKey(show.Name)
+
+	if claimingRelease, isClaimed := wl.claims[showKey+"/"+episodeKey]; isClaimed {
+		return fmt.Sprintf("episode %s already claimed by %s", episodeKey, claimingRelease)
+	}
+
+	grabbedEpisode, isGrabbed := wl.database.GrabbedEpisodes(showKey)[episodeKey]
+	if isGrabbed && !wl.isUpgrade(grabbedEpisode.Quality, episode.Quality) {
+		return fmt.Sprintf("episode %s already grabbed in %s", episodeKey, qualityName(grabbedEpisode.Quality))
+	}
+
+	wl.claims[showKey+"/"+episodeKey] = releaseName
+
+	return ""
+}
+
+// Grab records the claimed episode of a release as grabbed
+func (wl *Watchlist) Grab(releaseName string) error {
+	episode := release.Parse(releaseName)
+	showKey, episodeKey := ShowKey(episode.Show), episode.EpisodeKey()
+
+	wl.mutex.Lock()
+	defer wl.mutex.Unlock()
+
+	delete(wl.claims, showKey+"/"+episodeKey)
+
+	return wl.database.SetGrabbedEpisode(showKey, episodeKey, &database.GrabbedEpisode{
+		Release:   releaseName,
+		Quality:   episode.Quality,
+		GrabbedAt: time.Now(),
+	})
+}
+
+// Release gives up the claimed episode of a release, which failed to be sent
+// to download
+func (wl *Watchlist) Release(releaseName string) {
+	episode := release.Parse(releaseName)
+
+	wl.mutex.Lock()
+	defer wl.mutex.Unlock()
+
+	delete(wl.claims, ShowKey(episode.Show)+"/"+episode.EpisodeKey())
+}
+
+// Status returns the progress of each watched show
+func (wl *Watchlist) Status() []*ShowStatus {
+	shows := wl.Shows()
+	statuses := make([]*ShowStatus, len(shows))
+
+	for showIndex, show := range shows {
+		grabbedEpisodes := wl.database.GrabbedEpisodes(ShowKey(show.Name))
+
+		episodeKeys := make([]string, 0, len(grabbedEpisodes))
+		for episodeKey := range grabbedEpisodes {
+			if show.From == "" || !isBefore(episodeKey, show.From) {
+				episodeKeys = append(episodeKeys, episodeKey)
+			}
+		}
+
+		sort.Strings(episodeKeys)
+
+		statuses[showIndex] = &ShowStatus{Show: *show, Grabbed: len(episodeKeys), Missing: missingEpisodes(episodeKeys, show.From)}
+
+		if len(episodeKeys) > 0 {
+			statuses[showIndex].LastEpisode = episodeKeys[len(episodeKeys)-1]
+		}
+	}
+
+	return statuses
+}
+
+// show returns the watched show of a key, nil if not watched
+func (wl *Watchlist) show(showKey string) *Show {
+	if showKey == "" {
+		return nil
+	}
+
+	if configShow := wl.configShow(showKey); configShow != nil {
+		return configShow
+	}
+
+	watchedShow, exists := wl.database.WatchedShows()[showKey]
+	if !exists {
+		return nil
+	}
+
+	return &Show{Name: watchedShow.Name, From: watchedShow.From}
+}
+
+// configShow returns the config show of a key, nil if none
+func (wl *Watchlist) configShow(showKey string) *Show {
+	for _, configShow := range wl.options.Shows {
+		if ShowKey(configShow.Name) == showKey {
+			return &Show{Name: configShow.Name, From: release.ParseEpisodeKey(configShow.From), InConfig: true}
+		}
+	}
+
+	return nil
+}
+
+// isUpgrade indicates if a grabbed episode is wanted again in a quality
+func (wl *Watchlist) isUpgrade(grabbedQuality, quality string) bool {
+	return wl.options.Upgrade && wl.qualityRank(quality) < wl.qualityRank(grabbedQuality)
+}
+
+// qualityRank returns the preference of a quality, lower being better, the
+// unlisted qualities coming last
+func (wl *Watchlist) qualityRank(quality string) int {
+	for rank, preferredQuality := range wl.options.Qualities {
+		if quality != "" && strings.EqualFold(preferredQuality, quality) {
+			return rank
+		}
+	}
+
+	return len(wl.options.Qualities)
+}
+
+// isBefore indicates if an episode comes before another one of the same kind
+func isBefore(episodeKey, otherKey string) bool {
+	if len(episodeKey) != len(otherKey) || episodeKey[0] != otherKey[0] {
+		return false
+	}
+
+	return episodeKey < otherKey
+}
+
+// missingEpisodes returns the episodes missing before the last grabbed one of
+// each season, from the first wanted episode, the grabbed keys being sorted
+func missingEpisodes(episodeKeys []string, from string) []string {
+	missing := []string{}
+
+	fromSeason, fromEpisode := 0, 0
+	fmt.Sscanf(from, "S%dE%d", &fromSeason, &fromEpisode)
+
+	// Grabbed episodes by season
+	seasons := make(map[int]map[int]bool)
+	var seasonNumbers []int
+
+	for _, episodeKey := range episodeKeys {
+		var season, episode int
+		if _, scanError := fmt.Sscanf(episodeKey, "S%dE%d", &season, &episode); scanError != nil {
+			continue
+		}
+
+		if seasons[season] == nil {
+			seasons[season] = make(map[int]bool)
+			seasonNumbers = append(seasonNumbers, season)
+		}
+
+		seasons[season][episode] = true
+	}
+
+	for _, season := range seasonNumbers {
+		lastEpisode := 0
+		for episode := range seasons[season] {
+			if episode > lastEpisode {
+				lastEpisode = episode
+			}
+		}
+
+		firstEpisode := 1
+		if season == fromSeason {
+			firstEpisode = fromEpisode
+		}
+
+		for episode := firstEpisode; episode < lastEpisode; episode++ {
+			if !seasons[season][episode] {
+				missing = append(missing, fmt.Sprintf("S%02dE%02d", season, episode))
+			}
+		}
+	}
+
+	return missing
+}
+
+// qualityName returns a quality, "unknown quality" if blank
+func qualityName(quality string) string {
+	if quality == "" {
+		return "unknown quality"
+	}
+
+	return quality
+}
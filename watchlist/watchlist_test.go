@@ -0,0 +1,131 @@
+package watchlist_test
+
+import (
+	"testing"
+
+	"github.com/davidderus/christopher/config"
+	"github.com/davidderus/christopher/database"
+	. "github.com/davidderus/christopher/watchlist"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestWatchlist(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Watchlist Suite")
+}
+
+var _ = Describe("Watchlist", func() {
+	var db *database.Database
+	var showsWatchlist *Watchlist
+
+	options := config.WatchlistOptions{
+		Shows: []*config.WatchlistShow{
+			{Name: "Zombie One", From: "s3e2"},
+			{Name: "The Daily Show"},
+		},
+	}
+
+	BeforeEach(func() {
+		db, _ = database.Open("")
+		showsWatchlist = New(options, db)
+	})
+
+	// claimAndGrab claims the episode of a release, grabbing it if wanted
+	claimAndGrab := func(releaseName string) string {
+		rule := showsWatchlist.Claim(releaseName)
+		if rule == "" {
+			Expect(showsWatchlist.Grab(releaseName)).To(Succeed())
+		}
+
+		return rule
+	}
+
+	Describe("Claim", func() {
+		It("should claim each episode of the watched shows once", func() {
+			Expect(claimAndGrab("Zombie.One.S03E04.720p.WEB-DL")).To(BeEmpty())
+			Expect(claimAndGrab("zombie one 3x04 1080p")).To(Equal("episode S03E04 already grabbed in 720p"))
+			Expect(claimAndGrab("The.Daily.Show.2017.02.10.WEB")).To(BeEmpty())
+			Expect(claimAndGrab("The Daily Show 2017-02-10 720p")).To(Equal("episode 2017-02-10 already grabbed in unknown quality"))
+		})
+
+		It("should reject the unwanted releases", func() {
+			Expect(showsWatchlist.Claim("HTGAWM.S03E10.720p.HDTV")).To(Equal("show HTGAWM not watched"))
+			Expect(showsWatchlist.Claim("Zombie.One.S03E01.720p.WEB-DL")).To(Equal("episode S03E01 before S03E02"))
+			Expect(showsWatchlist.Claim("Zombie.One.S02E10.720p.WEB-DL")).To(Equal("episode S02E10 before S03E02"))
+			Expect(showsWatchlist.Claim("Some.Movie.2016.1080p.BluRay")).To(Equal("not an episode"))
+		})
+
+		It("should only record the episodes once grabbed", func() {
+			Expect(showsWatchlist.Claim("Zombie.One.S03E04.720p.WEB-DL")).To(BeEmpty())
+			Expect(showsWatchlist.Claim("Zombie.One.S03E04.1080p.WEB-DL")).To(Equal("episode S03E04 already claimed by Zombie.One.S03E04.720p.WEB-DL"))
+			Expect(db.GrabbedEpisodes("zombie one")).To(BeEmpty())
+
+			showsWatchlist.Release("Zombie.One.S03E04.720p.WEB-DL")
+			Expect(showsWatchlist.Claim("Zombie.One.S03E04.1080p.WEB-DL")).To(BeEmpty())
+			Expect(showsWatchlist.Grab("Zombie.One.S03E04.1080p.WEB-DL")).To(Succeed())
+
+			Expect(db.GrabbedEpisodes("zombie one")["S03E04"].Release).To(Equal("Zombie.One.S03E04.1080p.WEB-DL"))
+		})
+
+		It("should upgrade the episodes to a better quality", func() {
+			upgradeOptions := options
+			upgradeOptions.Qualities = []string{"1080p", "720p"}
+			upgradeOptions.Upgrade = true
+			showsWatchlist = New(upgradeOptions, db)
+
+			Expect(claimAndGrab("Zombie.One.S03E04.HDTV")).To(BeEmpty())
+			Expect(claimAndGrab("Zombie.One.S03E04.720p.WEB-DL")).To(BeEmpty())
+			Expect(claimAndGrab("Zombie.One.S03E04.720p.HDTV")).To(Equal("episode S03E04 already grabbed in 720p"))
+			Expect(claimAndGrab("Zombie.One.S03E04.1080p.WEB-DL")).To(BeEmpty())
+			Expect(db.GrabbedEpisodes("zombie one")["S03E04"].Release).To(Equal("Zombie.One.S03E04.1080p.WEB-DL"))
+		})
+	})
+
+	Describe("Add and Remove", func() {
+		It("should watch the shows added to the database", func() {
+			Expect(showsWatchlist.Claim("HTGAWM.S03E10.720p.HDTV")).NotTo(BeEmpty())
+
+			Expect(showsWatchlist.Add("HTGAWM", "3x10")).To(Succeed())
+			Expect(showsWatchlist.Claim("HTGAWM.S03E09.720p.HDTV")).To(Equal("episode S03E09 before S03E10"))
+			Expect(showsWatchlist.Claim("HTGAWM.S03E10.720p.HDTV")).To(BeEmpty())
+
+			Expect(showsWatchlist.Shows()).To(Equal([]*Show{
+				{Name: "HTGAWM", From: "S03E10"},
+				{Name: "The Daily Show", InConfig: true},
+				{Name: "Zombie One", From: "S03E02", InConfig: true},
+			}))
+
+			Expect(showsWatchlist.Remove("htgawm")).To(Succeed())
+			Expect(showsWatchlist.Claim("HTGAWM.S03E11.720p.HDTV")).To(Equal("show HTGAWM not watched"))
+		})
+
+		It("should refuse the invalid changes", func() {
+			Expect(showsWatchlist.Add("HTGAWM", "pilot").Error()).To(Equal("Invalid episode pilot"))
+			Expect(showsWatchlist.Add(" - ", "").Error()).To(Equal("Invalid show name  - "))
+			Expect(showsWatchlist.Remove("Zombie One").Error()).To(Equal("Show Zombie One is set in the config file"))
+			Expect(showsWatchlist.Remove("HTGAWM").Error()).To(Equal("Unknown show HTGAWM"))
+		})
+	})
+
+	Describe("Status", func() {
+		It("should list the last and missing episodes of each show", func() {
+			for _, releaseName := range []string{"Zombie.One.S03E05", "Zombie.One.S03E03", "Zombie.One.S04E03", "The.Daily.Show.2017.02.10"} {
+				claimAndGrab(releaseName)
+			}
+
+			statuses := showsWatchlist.Status()
+			Expect(statuses).To(HaveLen(2))
+
+			Expect(statuses[0].Name).To(Equal("The Daily Show"))
+			Expect(statuses[0].LastEpisode).To(Equal("2017-02-10"))
+			Expect(statuses[0].Missing).To(BeEmpty())
+
+			Expect(statuses[1].Name).To(Equal("Zombie One"))
+			Expect(statuses[1].Grabbed).To(Equal(3))
+			Expect(statuses[1].LastEpisode).To(Equal("S04E03"))
+			Expect(statuses[1].Missing).To(Equal([]string{"S03E02", "S03E04", "S04E01", "S04E02"}))
+		})
+	})
+})
@@ -0,0 +1,97 @@
+package webserver
+
+import (
+	"net/http"
+
+	"github.com/davidderus/christopher/downloader"
+	"github.com/gorilla/mux"
+)
+
+type downloadsResponse struct {
+	State     string                       `json:"state"`
+	Downloads []*downloader.DownloadStatus `json:"downloads"`
+}
+
+type downloadActionResponse struct {
+	ID     string `json:"id,omitempty"`
+	Action string `json:"action"`
+}
+
+// DownloadsHandler lists the downloader downloads for a given state
+func (ws *WebServer) DownloadsHandler(w http.ResponseWriter, request *http.Request) {
+	stateName := request.URL.Query().Get("state")
+	if stateName == "" {
+		stateName = string(downloader.StateActive)
+	}
+
+	state, stateError := downloader.ParseDownloadState(stateName)
+	if stateError != nil {
+		http.Error(w, stateError.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dlInstance, dlError := ws.loadDownloader()
+	if dlError != nil {
+		http.Error(w, dlError.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	downloads, listError := dlInstance.List(state)
+	if listError != nil {
+		http.Error(w, listError.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ws.writeJSON(w, downloadsResponse{State: string(state), Downloads: downloads})
+}
+
+// DownloadActionHandler pauses, resumes or removes a download
+func (ws *WebServer) DownloadActionHandler(w http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	downloadID := vars["id"]
+	action := vars["action"]
+
+	dlInstance, dlError := ws.loadDownloader()
+	if dlError != nil {
+		http.Error(w, dlError.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var actionError error
+
+	switch action {
+	case "pause":
+		actionError = dlInstance.Pause(downloadID)
+	case "resume":
+		actionError = dlInstance.Resume(downloadID)
+	case "remove":
+		actionError = dlInstance.Remove(downloadID)
+	default:
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+
+	if actionError != nil {
+		http.Error(w, actionError.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ws.writeJSON(w, downloadActionResponse{ID: downloadID, Action: action})
+}
+
+// PurgeHandler purges completed, failed and removed downloads
+func (ws *WebServer) PurgeHandler(w http.ResponseWriter, request *http.Request) {
+	dlInstance, dlError := ws.loadDownloader()
+	if dlError != nil {
+		http.Error(w, dlError.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	purgeError := dlInstance.Purge()
+	if purgeError != nil {
+		http.Error(w, purgeError.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ws.writeJSON(w, downloadActionResponse{Action: "purge"})
+}
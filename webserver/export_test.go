@@ -0,0 +1,9 @@
+package webserver
+
+import "net/http"
+
+// Router returns the webserver routes without CSRF protection, only to the
+// tests
+func (ws *WebServer) Router() http.Handler {
+	return ws.router
+}
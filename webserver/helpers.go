@@ -1,11 +1,12 @@
 package webserver
 
 import (
+	"encoding/json"
 	"html/template"
 	"net/http"
 	"path/filepath"
 
-	"github.com/davidderus/christopher/dispatcher"
+	"github.com/davidderus/christopher/downloader"
 )
 
 func (ws *WebServer) writeWithTemplate(response http.ResponseWriter, templateName string, templatePath string, data interface{}) error {
@@ -34,13 +35,21 @@ func (ws *WebServer) writeWithTemplate(response http.ResponseWriter, templateNam
 	return nil
 }
 
-func (ws *WebServer) loadScenario() *dispatcher.Scenario {
-	story := &dispatcher.ChristopherStory{}
-	story.SetConfig(ws.appConfig).EnableDebrider().EnableDownloader()
-	story.SetTeller(ws.appTeller)
+func (ws *WebServer) loadDownloader() (downloader.Downloader, error) {
+	downloaderConfig := ws.appConfig.Downloader
 
-	scenario := story.Scenario()
-	scenario.SetInitialStep("config")
+	return downloader.NewDownloader(downloaderConfig.Name, downloaderConfig.AuthInfos)
+}
+
+// writeJSON writes a JSON serialized response
+func (ws *WebServer) writeJSON(w http.ResponseWriter, data interface{}) {
+	marshaledJSON, jsonError := json.Marshal(data)
+	if jsonError != nil {
+		http.Error(w, jsonError.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	return scenario
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledJSON)
 }
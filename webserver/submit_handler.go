@@ -5,7 +5,6 @@ import (
 	"io/ioutil"
 	"net/http"
 	"regexp"
-	"sync"
 
 	"github.com/davidderus/christopher/dispatcher"
 )
@@ -21,15 +20,6 @@ type submitResponse struct {
 
 var uriMatcher = regexp.MustCompile(`(https?:\/\/[\da-z\.-]+\.[a-z\.]{2,6}[\/\w \.-]*\/?)`)
 
-func (ws *WebServer) dispatchURI(uri string, waitGroup *sync.WaitGroup) {
-	defer waitGroup.Done()
-
-	event := &dispatcher.Event{Origin: "cli", Value: uri}
-
-	scenario := ws.loadScenario()
-	scenario.Play(event)
-}
-
 // SubmitHandler handles submitted links
 func (ws *WebServer) SubmitHandler(w http.ResponseWriter, request *http.Request) {
 	body, _ := ioutil.ReadAll(request.Body)
@@ -44,14 +34,13 @@ func (ws *WebServer) SubmitHandler(w http.ResponseWriter, request *http.Request)
 	uris := uriMatcher.FindAllString(submittedRequest.Urls, -1)
 	urisCount := len(uris)
 
-	var waitGroup sync.WaitGroup
-	waitGroup.Add(urisCount)
-
-	for _, uri := range uris {
-		go ws.dispatchURI(string(uri), &waitGroup)
+	events := make([]*dispatcher.Event, urisCount)
+	for uriIndex, uri := range uris {
+		events[uriIndex] = &dispatcher.Event{Origin: "webserver", Value: uri, User: ws.requestUser(request)}
 	}
 
-	waitGroup.Wait()
+	// Links are debrided concurrently and sent to the downloader all at once
+	ws.story.PlayBatch(events)
 
 	marshaledJSON, jsonError := json.Marshal(submitResponse{Count: urisCount, Errors: nil})
 	if jsonError != nil {
@@ -0,0 +1,29 @@
+package webserver
+
+import (
+	"net/http"
+
+	"github.com/davidderus/christopher/database"
+	"github.com/davidderus/christopher/watchlist"
+)
+
+type watchlistResponse struct {
+	Shows []*watchlist.ShowStatus `json:"shows"`
+}
+
+// WatchlistHandler lists the watched shows with their last and missing
+// episodes
+//
+// The database is read on each request, as the feed watcher keeps it up to
+// date.
+func (ws *WebServer) WatchlistHandler(w http.ResponseWriter, request *http.Request) {
+	appDatabase, databaseError := database.Open(ws.appConfig.DBPath)
+	if databaseError != nil {
+		http.Error(w, databaseError.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	showsWatchlist := watchlist.New(ws.appConfig.Watchlist, appDatabase)
+
+	ws.writeJSON(w, watchlistResponse{Shows: showsWatchlist.Status()})
+}
@@ -10,6 +10,7 @@ import (
 
 	auth "github.com/abbot/go-http-auth"
 	"github.com/davidderus/christopher/config"
+	"github.com/davidderus/christopher/debrider"
 	"github.com/davidderus/christopher/dispatcher"
 	"github.com/davidderus/christopher/teller"
 	"github.com/gorilla/csrf"
@@ -25,10 +26,21 @@ type WebServer struct {
 	scenario      *dispatcher.Scenario
 	router        *mux.Router
 	csrf          func(http.Handler) http.Handler
+
+	// story plays all the submitted URIs, sharing their debrider sessions
+	// and downloader pools
+	story *dispatcher.ChristopherStory
 }
 
 // Init initiates the WebServer struct
-func (ws *WebServer) Init() {
+func (ws *WebServer) Init() error {
+	// Loading persisted debrider sessions
+	sessions, sessionsError := debrider.NewSessionPool(ws.appConfig.Debrider.SessionsPath)
+	if sessionsError != nil {
+		return sessionsError
+	}
+	ws.story.SetDebriderSessions(sessions)
+
 	// Enables auth if there is users in config
 	if len(ws.options.Users) > 0 {
 		ws.enableAuthentication()
@@ -39,11 +51,16 @@ func (ws *WebServer) Init() {
 
 	// Building router with routes
 	ws.buildRouter()
+
+	return nil
 }
 
 // Start starts the webserver
 func (ws *WebServer) Start() error {
-	ws.Init()
+	initError := ws.Init()
+	if initError != nil {
+		return initError
+	}
 
 	webServerAddress := fmt.Sprintf("%s:%d", ws.options.Host, ws.options.Port)
 
@@ -75,6 +92,17 @@ func (ws *WebServer) LoadHandlerWithAuth(handler http.HandlerFunc) http.HandlerF
 	return handler
 }
 
+// requestUser returns the name of the user authenticated for a request, if any
+//
+// The name is only set by the digest auth once the request is verified.
+func (ws *WebServer) requestUser(request *http.Request) string {
+	if ws.authenticator == nil {
+		return ""
+	}
+
+	return request.Header.Get(auth.AuthUsernameHeader)
+}
+
 // lookForSecret returns a password hash from config for a given existing user
 func (ws *WebServer) lookForSecret(user, realm string) string {
 	for _, webUser := range ws.options.Users {
@@ -90,10 +118,19 @@ func (ws *WebServer) buildRouter() {
 	router := mux.NewRouter()
 	router.HandleFunc("/", ws.LoadHandlerWithAuth(ws.HomeHandler))
 	router.HandleFunc("/submit", ws.LoadHandlerWithAuth(ws.SubmitHandler)).Methods("POST")
+	router.HandleFunc("/downloads", ws.LoadHandlerWithAuth(ws.DownloadsHandler)).Methods("GET")
+	router.HandleFunc("/downloads/purge", ws.LoadHandlerWithAuth(ws.PurgeHandler)).Methods("POST")
+	router.HandleFunc("/downloads/{id}/{action:pause|resume|remove}", ws.LoadHandlerWithAuth(ws.DownloadActionHandler)).Methods("POST")
+	router.HandleFunc("/watchlist", ws.LoadHandlerWithAuth(ws.WatchlistHandler)).Methods("GET")
 
 	ws.router = router
 }
 
+// Story returns the story playing the submitted URIs
+func (ws *WebServer) Story() *dispatcher.ChristopherStory {
+	return ws.story
+}
+
 // NewWebServer instanciates a web server
 func NewWebServer(appConfig *config.Config, appTeller *teller.Teller) *WebServer {
 	server := &WebServer{}
@@ -101,5 +138,10 @@ func NewWebServer(appConfig *config.Config, appTeller *teller.Teller) *WebServer
 	server.appTeller = appTeller
 	server.options = &appConfig.WebServer
 
+	server.story = &dispatcher.ChristopherStory{}
+	server.story.SetConfig(appConfig).EnableDebrider().EnableDownloader()
+	server.story.SetTeller(appTeller)
+	server.story.SetDownloaderPools(dispatcher.NewDownloaderPools(appConfig))
+
 	return server
 }
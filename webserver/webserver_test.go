@@ -2,14 +2,19 @@ package webserver_test
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 
 	"github.com/davidderus/christopher/config"
+	"github.com/davidderus/christopher/database"
 	"github.com/davidderus/christopher/teller"
 	. "github.com/davidderus/christopher/webserver"
 
+	"github.com/dnaeon/go-vcr/recorder"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
@@ -23,6 +28,16 @@ func TestConfig(t *testing.T) {
 
 const validConfigSampleFile = "../testdata/config_valid_sample.toml"
 
+// note: stop has to be handled manually
+func getRecorder(cassette string) *recorder.Recorder {
+	recording, recordingError := recorder.New(fmt.Sprintf("../testdata/cassettes/aria_downloader/%s", cassette))
+	if recordingError != nil {
+		Fail(recordingError.Error())
+	}
+
+	return recording
+}
+
 // TODO Test basic auth
 var _ = Describe("WebServer", func() {
 	var webServer *WebServer
@@ -95,3 +110,136 @@ var _ = Describe("WebServer", func() {
 		})
 	})
 })
+
+var _ = Describe("WebServer downloads", func() {
+	var webServer *WebServer
+	var defaultHTTPTransport http.RoundTripper
+
+	BeforeEach(func() {
+		defaultHTTPTransport = http.DefaultTransport
+
+		appConfig, _ := config.LoadFromFile(validConfigSampleFile)
+		appTeller := teller.NewTeller(appConfig.Teller.LogLevel, appConfig.Teller.LogFormatter)
+		appTeller.SetLogOutput(ioutil.Discard)
+
+		// Routing without digest auth
+		appConfig.WebServer.Users = nil
+
+		webServer = NewWebServer(appConfig, appTeller)
+		webServer.Init()
+	})
+
+	AfterEach(func() {
+		http.DefaultTransport = defaultHTTPTransport
+	})
+
+	Describe("GET /downloads", func() {
+		It("should list the active downloads", func() {
+			testRecorder := getRecorder("list_active_downloads")
+			http.DefaultTransport = testRecorder
+
+			request, _ := http.NewRequest("GET", "/downloads?state=active", nil)
+			recorder := httptest.NewRecorder()
+			webServer.Router().ServeHTTP(recorder, request)
+
+			testRecorder.Stop()
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Body.String()).To(ContainSubstring(`"state":"active"`))
+			Expect(recorder.Body.String()).To(ContainSubstring(`"id":"96676fbc46cbbc04"`))
+		})
+
+		It("should refuse an invalid state", func() {
+			request, _ := http.NewRequest("GET", "/downloads?state=sleeping", nil)
+			recorder := httptest.NewRecorder()
+			webServer.Router().ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(recorder.Body.String()).To(ContainSubstring("Invalid download state sleeping"))
+		})
+	})
+
+	Describe("POST /downloads/{id}/pause", func() {
+		It("should pause the download", func() {
+			testRecorder := getRecorder("pause_download")
+			http.DefaultTransport = testRecorder
+
+			request, _ := http.NewRequest("POST", "/downloads/96676fbc46cbbc04/pause", nil)
+			recorder := httptest.NewRecorder()
+			webServer.Router().ServeHTTP(recorder, request)
+
+			testRecorder.Stop()
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Body.String()).To(Equal(`{"id":"96676fbc46cbbc04","action":"pause"}`))
+		})
+
+		It("should report downloader errors", func() {
+			testRecorder := getRecorder("pause_download_with_invalid_gid")
+			http.DefaultTransport = testRecorder
+
+			request, _ := http.NewRequest("POST", "/downloads/111/pause", nil)
+			recorder := httptest.NewRecorder()
+			webServer.Router().ServeHTTP(recorder, request)
+
+			testRecorder.Stop()
+
+			Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+			Expect(recorder.Body.String()).To(ContainSubstring("GID 111 is not found"))
+		})
+	})
+
+	Describe("POST /downloads/purge", func() {
+		It("should purge the downloads", func() {
+			testRecorder := getRecorder("purge_downloads")
+			http.DefaultTransport = testRecorder
+
+			request, _ := http.NewRequest("POST", "/downloads/purge", nil)
+			recorder := httptest.NewRecorder()
+			webServer.Router().ServeHTTP(recorder, request)
+
+			testRecorder.Stop()
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Body.String()).To(Equal(`{"action":"purge"}`))
+		})
+	})
+})
+
+var _ = Describe("WebServer watchlist", func() {
+	var webServer *WebServer
+	var dir string
+
+	BeforeEach(func() {
+		dir, _ = ioutil.TempDir("", "christopher-webserver")
+
+		appConfig, _ := config.LoadFromFile(validConfigSampleFile)
+		appTeller := teller.NewTeller(appConfig.Teller.LogLevel, appConfig.Teller.LogFormatter)
+		appTeller.SetLogOutput(ioutil.Discard)
+
+		appConfig.WebServer.Users = nil
+		appConfig.DBPath = filepath.Join(dir, "database.db")
+		appConfig.Watchlist.Shows = []*config.WatchlistShow{{Name: "Zombie One", From: "S03E01"}}
+
+		appDatabase, _ := database.Open(appConfig.DBPath)
+		appDatabase.SetGrabbedEpisode("zombie one", "S03E04", &database.GrabbedEpisode{Release: "Zombie.One.S03E04.720p", Quality: "720p"})
+
+		webServer = NewWebServer(appConfig, appTeller)
+		webServer.Init()
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Describe("GET /watchlist", func() {
+		It("should list the shows with their missing episodes", func() {
+			request, _ := http.NewRequest("GET", "/watchlist", nil)
+			recorder := httptest.NewRecorder()
+			webServer.Router().ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Body.String()).To(Equal(`{"shows":[{"name":"Zombie One","from":"S03E01","in_config":true,"grabbed":1,"last_episode":"S03E04","missing":["S03E01","S03E02","S03E03"]}]}`))
+		})
+	})
+})